@@ -0,0 +1,173 @@
+package adexp
+
+import (
+	"strings"
+)
+
+// ключевые слова ADEXP
+const (
+	KeyTitle    = "TITLE"
+	KeyBegin    = "BEGIN"
+	KeyEnd      = "END"
+	KeyArcid    = "ARCID"
+	KeySsrCode  = "SSRCODE"
+	KeyAdep     = "ADEP"
+	KeyAdes     = "ADES"
+	KeyRefData  = "REFDATA"
+	KeyMsgRef   = "MSGREF"
+	KeySender   = "SENDER"
+	KeyRecvr    = "RECVR"
+	KeyFac      = "FAC"
+	KeySeqNum   = "SEQNUM"
+	KeyCoorData = "COORDATA"
+	KeyPtid     = "PTID"
+	KeyTo       = "TO"
+	KeyTfl      = "TFL"
+	KeySfl      = "SFL"
+)
+
+// FieldKind вид поля ADEXP
+type FieldKind int
+
+const (
+	// Primary простое поле: "-ARCID AFR123"
+	Primary FieldKind = iota
+	// Structured составное поле, значение которого - набор подполей: "-REFDATA -SENDER -FAC LFPB ..."
+	Structured
+	// List список: "-BEGIN RTEPTS -PT -PTID ABC ... -END RTEPTS"
+	List
+)
+
+// составные поля и ключевые слова их подполей
+var structuredFields = map[string]map[string]bool{
+	KeyRefData:  {KeySender: true, KeyRecvr: true, KeySeqNum: true},
+	KeyMsgRef:   {KeySender: true, KeyRecvr: true, KeySeqNum: true},
+	KeySender:   {KeyFac: true},
+	KeyRecvr:    {KeyFac: true},
+	KeyCoorData: {KeyPtid: true, KeyTo: true, KeyTfl: true, KeySfl: true},
+	"ESTDATA":   {KeyPtid: true, "ETO": true, "FL": true, KeySfl: true},
+	"PT":        {KeyPtid: true, "ETO": true, "FL": true},
+	"AD":        {"ADID": true, "ETO": true},
+	"VEC":       {"RELDIST": true, "TRACKANGLE": true, "FL": true},
+}
+
+// Field поле ADEXP сообщения
+type Field struct {
+	Kind      FieldKind // вид поля
+	Keyword   string    // ключевое слово (без '-')
+	Value     string    // значение простого поля
+	Subfields []Field   // подполя (для составного поля) или элементы списка
+}
+
+// Message ADEXP сообщение - упорядоченный набор полей
+type Message struct {
+	Fields []Field
+}
+
+// Title значение поля TITLE
+func (m *Message) Title() string {
+	if fld, ok := m.Get(KeyTitle); ok {
+		return fld.Value
+	}
+	return ""
+}
+
+// Get первое поле верхнего уровня с ключевым словом keyword
+func (m *Message) Get(keyword string) (*Field, bool) {
+	return findField(m.Fields, keyword)
+}
+
+// Value значение первого простого поля верхнего уровня с ключевым словом keyword
+func (m *Message) Value(keyword string) string {
+	if fld, ok := m.Get(keyword); ok {
+		return fld.Value
+	}
+	return ""
+}
+
+// Append добавить поле в конец сообщения
+func (m *Message) Append(fld Field) {
+	m.Fields = append(m.Fields, fld)
+}
+
+// Set замена первого поля верхнего уровня с тем же ключевым словом (или добавление в конец)
+func (m *Message) Set(fld Field) {
+	if cur, ok := m.Get(fld.Keyword); ok {
+		*cur = fld
+	} else {
+		m.Append(fld)
+	}
+}
+
+// Get первое подполе с ключевым словом keyword
+func (f *Field) Get(keyword string) (*Field, bool) {
+	return findField(f.Subfields, keyword)
+}
+
+// SubValue значение первого подполя с ключевым словом keyword
+func (f *Field) SubValue(keyword string) string {
+	if fld, ok := f.Get(keyword); ok {
+		return fld.Value
+	}
+	return ""
+}
+
+func findField(fields []Field, keyword string) (*Field, bool) {
+	for idx := range fields {
+		if fields[idx].Keyword == keyword {
+			return &fields[idx], true
+		}
+	}
+	return nil, false
+}
+
+// NewPrimary простое поле
+func NewPrimary(keyword string, value string) Field {
+	return Field{Kind: Primary, Keyword: keyword, Value: value}
+}
+
+// NewStructured составное поле
+func NewStructured(keyword string, subfields ...Field) Field {
+	return Field{Kind: Structured, Keyword: keyword, Subfields: subfields}
+}
+
+// NewList список
+func NewList(keyword string, items ...Field) Field {
+	return Field{Kind: List, Keyword: keyword, Subfields: items}
+}
+
+// String сообщение в формате ADEXP
+func (m *Message) String() string {
+	var sb strings.Builder
+	for idx, val := range m.Fields {
+		if idx > 0 {
+			sb.WriteString(" ")
+		}
+		val.write(&sb)
+	}
+	return sb.String()
+}
+
+// запись поля в формате ADEXP
+func (f *Field) write(sb *strings.Builder) {
+	switch f.Kind {
+	case Primary:
+		sb.WriteString("-" + f.Keyword)
+		if f.Value != "" {
+			sb.WriteString(" " + f.Value)
+		}
+	case Structured:
+		sb.WriteString("-" + f.Keyword)
+		for _, val := range f.Subfields {
+			sb.WriteString(" ")
+			val.write(sb)
+		}
+	case List:
+		sb.WriteString("-" + KeyBegin + " " + f.Keyword)
+		for _, val := range f.Subfields {
+			sb.WriteString(" ")
+			val.write(sb)
+		}
+		sb.WriteString(" -" + KeyEnd + " " + f.Keyword)
+	}
+}
@@ -0,0 +1,118 @@
+package adexp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fmtp/oldi_msg"
+)
+
+// в ADEXP заголовок OLDI сообщения имеет префикс "I" (IACT, IABI, ...), LAM передается без префикса
+const titlePrefix = "I"
+
+// ToOldi преобразование ADEXP сообщения в структуру OLDI сообщения формата ICAO.
+// Переносятся только поля, имеющие соответствие в формате ICAO.
+func ToOldi(m Message) (oldi_msg.Message, error) {
+	title := m.Title()
+	if title != oldi_msg.TitleLAM {
+		title = strings.TrimPrefix(title, titlePrefix)
+	}
+	if len(title) != 3 {
+		return oldi_msg.NewMessage(title), fmt.Errorf("Тип ADEXP сообщения не соответствует OLDI: %s.", m.Title())
+	}
+	retValue := oldi_msg.NewMessage(title)
+
+	if refData, ok := m.Get(KeyRefData); ok {
+		retValue.Number = numberFromField(refData)
+	}
+	if msgRef, ok := m.Get(KeyMsgRef); ok {
+		retValue.Reference = numberFromField(msgRef)
+	}
+
+	retValue.Arcid = m.Value(KeyArcid)
+	retValue.SsrCode = m.Value(KeySsrCode)
+	retValue.Adep = m.Value(KeyAdep)
+	retValue.Ades = m.Value(KeyAdes)
+
+	if coorData, ok := m.Get(KeyCoorData); ok {
+		retValue.Estimate.Point = coorData.SubValue(KeyPtid)
+		retValue.Estimate.Time = coorData.SubValue(KeyTo)
+		if tfl := coorData.SubValue(KeyTfl); tfl != "" {
+			retValue.Estimate.Level = tfl
+		}
+	}
+
+	if retValue.HasFlightData() && retValue.Arcid == "" {
+		return retValue, fmt.Errorf("В ADEXP сообщении %s не задано поле -ARCID.", m.Title())
+	}
+	return retValue, nil
+}
+
+// FromOldi преобразование OLDI сообщения формата ICAO в ADEXP сообщение.
+// Поля ICAO без соответствия в ADEXP (Other) не переносятся.
+func FromOldi(om oldi_msg.Message) Message {
+	var retValue Message
+
+	title := om.Title
+	if title != oldi_msg.TitleLAM {
+		title = titlePrefix + title
+	}
+	retValue.Append(NewPrimary(KeyTitle, title))
+
+	if !om.Number.IsEmpty() {
+		retValue.Append(NumberField(KeyRefData, om.Number))
+	}
+	if !om.Reference.IsEmpty() {
+		retValue.Append(NumberField(KeyMsgRef, om.Reference))
+	}
+
+	if om.HasFlightData() {
+		retValue.Append(NewPrimary(KeyArcid, om.Arcid))
+		if om.SsrCode != "" {
+			retValue.Append(NewPrimary(KeySsrCode, om.SsrCode))
+		}
+		if om.Adep != "" {
+			retValue.Append(NewPrimary(KeyAdep, om.Adep))
+		}
+		if om.Ades != "" {
+			retValue.Append(NewPrimary(KeyAdes, om.Ades))
+		}
+		if !om.Estimate.IsEmpty() {
+			coorData := NewStructured(KeyCoorData, NewPrimary(KeyPtid, om.Estimate.Point))
+			if om.Estimate.Time != "" {
+				coorData.Subfields = append(coorData.Subfields, NewPrimary(KeyTo, om.Estimate.Time))
+			}
+			if om.Estimate.Level != "" {
+				coorData.Subfields = append(coorData.Subfields, NewPrimary(KeyTfl, om.Estimate.Level))
+			}
+			retValue.Append(coorData)
+		}
+	}
+	return retValue
+}
+
+// номер сообщения из составного поля REFDATA / MSGREF
+func numberFromField(fld *Field) oldi_msg.MessageNumber {
+	retValue := oldi_msg.MessageNumber{Number: oldi_msg.NoNumber}
+
+	if sender, ok := fld.Get(KeySender); ok {
+		retValue.Sender = sender.SubValue(KeyFac)
+	}
+	if recvr, ok := fld.Get(KeyRecvr); ok {
+		retValue.Receiver = recvr.SubValue(KeyFac)
+	}
+	if num, err := strconv.Atoi(fld.SubValue(KeySeqNum)); err == nil {
+		retValue.Number = num
+	}
+	return retValue
+}
+
+// NumberField составное поле REFDATA / MSGREF из номера сообщения
+func NumberField(keyword string, num oldi_msg.MessageNumber) Field {
+	return NewStructured(keyword,
+		NewStructured(KeySender, NewPrimary(KeyFac, num.Sender)),
+		NewStructured(KeyRecvr, NewPrimary(KeyFac, num.Receiver)),
+		NewPrimary(KeySeqNum, fmt.Sprintf("%03d", num.Number)),
+	)
+}
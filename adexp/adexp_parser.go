@@ -0,0 +1,138 @@
+package adexp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// token лексема ADEXP: ключевое слово и следующее за ним значение
+type token struct {
+	keyword string // ключевое слово (без '-')
+	value   string // значение (слова до следующего ключевого слова)
+}
+
+// IsAdexp признак того, что текст является ADEXP сообщением (начинается с ключевого слова)
+func IsAdexp(text string) bool {
+	words := strings.Fields(text)
+	return len(words) > 0 && isKeyword(words[0])
+}
+
+// ключевое слово - слово, начинающееся с '-', за которым следует латинская буква
+func isKeyword(word string) bool {
+	return len(word) > 1 && word[0] == '-' && word[1] >= 'A' && word[1] <= 'Z'
+}
+
+// разбиение текста на лексемы. Пробельные символы внутри значений нормализуются до одного пробела
+func tokenize(text string) ([]token, error) {
+	var retValue []token
+
+	for _, word := range strings.Fields(text) {
+		if isKeyword(word) {
+			retValue = append(retValue, token{keyword: word[1:]})
+		} else {
+			if len(retValue) == 0 {
+				return nil, fmt.Errorf("Текст перед первым ключевым словом ADEXP: %s.", word)
+			}
+			last := &retValue[len(retValue)-1]
+			if last.value != "" {
+				last.value += " "
+			}
+			last.value += word
+		}
+	}
+	return retValue, nil
+}
+
+// parser разбор последовательности лексем в дерево полей
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+func (p *parser) parseField() (Field, error) {
+	tok := p.next()
+
+	switch {
+	case tok.keyword == KeyBegin:
+		if tok.value == "" {
+			return Field{}, errors.New("Не задано имя списка после -BEGIN.")
+		}
+		listField := NewList(tok.value)
+		for {
+			if p.eof() {
+				return Field{}, fmt.Errorf("Не найдено окончание списка -END %s.", tok.value)
+			}
+			if p.peek().keyword == KeyEnd {
+				endTok := p.next()
+				if endTok.value != tok.value {
+					return Field{}, fmt.Errorf("Окончание списка -END %s не соответствует началу -BEGIN %s.", endTok.value, tok.value)
+				}
+				return listField, nil
+			}
+			item, err := p.parseField()
+			if err != nil {
+				return Field{}, err
+			}
+			listField.Subfields = append(listField.Subfields, item)
+		}
+
+	case tok.keyword == KeyEnd:
+		return Field{}, fmt.Errorf("Окончание списка -END %s без соответствующего -BEGIN.", tok.value)
+
+	case tok.value == "" && structuredFields[tok.keyword] != nil:
+		allowed := structuredFields[tok.keyword]
+		structField := NewStructured(tok.keyword)
+		for !p.eof() && allowed[p.peek().keyword] {
+			sub, err := p.parseField()
+			if err != nil {
+				return Field{}, err
+			}
+			structField.Subfields = append(structField.Subfields, sub)
+		}
+		return structField, nil
+	}
+
+	return NewPrimary(tok.keyword, tok.value), nil
+}
+
+// Parse разбор текста ADEXP сообщения в дерево полей
+func Parse(text string) (Message, error) {
+	var retValue Message
+
+	tokens, err := tokenize(text)
+	if err != nil {
+		return retValue, err
+	}
+	if len(tokens) == 0 {
+		return retValue, errors.New("Пустое ADEXP сообщение.")
+	}
+
+	p := parser{tokens: tokens}
+	for !p.eof() {
+		fld, err := p.parseField()
+		if err != nil {
+			return retValue, err
+		}
+		retValue.Fields = append(retValue.Fields, fld)
+	}
+
+	if retValue.Title() == "" {
+		return retValue, errors.New("В ADEXP сообщении не задано поле -TITLE.")
+	}
+	return retValue, nil
+}
@@ -0,0 +1,41 @@
+package adexp
+
+import (
+	"testing"
+
+	"fmtp/oldi_msg"
+)
+
+func TestRoundTrip(t *testing.T) {
+	text := "-TITLE IACT -REFDATA -SENDER -FAC LFPB -RECVR -FAC EGLL -SEQNUM 123 -ARCID AFR123 -SSRCODE A1234 " +
+		"-ADEP LFPG -ADES EGLL -COORDATA -PTID ABNUR -TO 1230 -TFL F330 " +
+		"-BEGIN RTEPTS -PT -PTID ABNUR -ETO 211019123000 -PT -PTID KOK -END RTEPTS -RFL F350"
+
+	msg, err := Parse(text)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := msg.String(); got != text {
+		t.Fatalf("String:\n got %s\nwant %s", got, text)
+	}
+	if rtePts, ok := msg.Get("RTEPTS"); !ok || rtePts.Kind != List || len(rtePts.Subfields) != 2 {
+		t.Fatalf("RTEPTS: %+v", rtePts)
+	}
+
+	om, err := ToOldi(msg)
+	if err != nil {
+		t.Fatalf("ToOldi: %v", err)
+	}
+	if want := "(ACTLFPB/EGLL123-AFR123/A1234-LFPG-ABNUR/1230F330-EGLL)"; om.String() != want {
+		t.Fatalf("ICAO:\n got %s\nwant %s", om.String(), want)
+	}
+
+	parsedOm, err := oldi_msg.Parse(om.String())
+	if err != nil {
+		t.Fatalf("oldi_msg.Parse: %v", err)
+	}
+	back := FromOldi(parsedOm)
+	if back.Value(KeyArcid) != "AFR123" || back.Title() != "IACT" {
+		t.Fatalf("FromOldi: %s", back.String())
+	}
+}
@@ -20,6 +20,14 @@ const (
 
 	Encode1251 string = "Windows-1251"
 	EncodeUtf  string = "UTF-8"
+
+	PayloadIcao  string = "ICAO"  // OLDI сообщения в формате полей ICAO
+	PayloadAdexp string = "ADEXP" // OLDI сообщения в формате ADEXP
+
+	RunnerDefault   string = ""          // способ запуска по умолчанию (docker или process, в зависимости от режима работы контроллера)
+	RunnerProcess   string = "process"   // отдельный процесс (копия исполняемого файла)
+	RunnerDocker    string = "docker"    // docker контейнер
+	RunnerInProcess string = "inprocess" // горутины в процессе контроллера (без отдельного приложения и web странички канала)
 )
 
 // ChannelSettings настройки контроллера записи логов в файл
@@ -38,15 +46,22 @@ type ChannelSettings struct {
 	ReconnectTimeout int            `json:"ReconnectTimeout"` // таймаут подключения (для клиента).
 	FmtpInitStateStr string         `json:"FmtpInitState"`    // текст 'data_ready' | 'disabled'
 	FmtpInitState    fmtp.FmtpState // начальное состояние.
-	RemoteAddress    string         `json:"RemoteAddress"` // удаленный адрес.
-	RemotePort       int            `json:"RemotePort"`    // удаленный порт (для клиента).
-	LocalPort        int            `json:"LocalPort"`     // локальный порт	(для сервера).
-	DataEncoding     string         `json:"DataEncoding"`  // кодировка сообщений.
-	LogDebug         bool           `json:"DebugLog"`      // с отладочными сообщениями.
-	IsWorking        bool           `json:"State"`         // работоспособность.
-	URLAddress       string         `json:"URLAddress"`    // IP адрес для доступа к web страничке
-	URLPath          string         `json:"URLPath"`       // путь для доступа к web страничке
-	URLPort          int            `json:"URLPort"`       // порт для доступа к web страничке
+	RemoteAddress    string         `json:"RemoteAddress"`    // удаленный адрес.
+	RemotePort       int            `json:"RemotePort"`       // удаленный порт (для клиента).
+	LocalPort        int            `json:"LocalPort"`        // локальный порт	(для сервера).
+	DataEncoding     string         `json:"DataEncoding"`     // кодировка сообщений.
+	PayloadFormat    string         `json:"PayloadFormat"`    // формат OLDI сообщений ('ICAO' | 'ADEXP').
+	LamEnabled       bool           `json:"LamEnabled"`       // контроль получения логических подтверждений (LAM) на отправленные OLDI сообщения.
+	LamTimeout       int            `json:"LamTimeout"`       // время ожидания LAM (сек).
+	LamGenerate      bool           `json:"LamGenerate"`      // формирование LAM на полученные OLDI сообщения.
+	OldiNumbering    bool           `json:"OldiNumbering"`    // присвоение номеров отправляемым OLDI сообщениям.
+	LogDebug         bool           `json:"DebugLog"`         // с отладочными сообщениями.
+	IsWorking        bool           `json:"State"`            // работоспособность.
+	URLAddress       string         `json:"URLAddress"`       // IP адрес для доступа к web страничке
+	URLPath          string         `json:"URLPath"`          // путь для доступа к web страничке
+	URLPort          int            `json:"URLPort"`          // порт для доступа к web страничке
+	Runner           string         `json:"Runner"`           // способ запуска канала ('' | 'process' | 'docker' | 'inprocess').
+	ContainerProfile string         `json:"ContainerProfile"` // имя профиля docker контейнера (пусто - профиль по умолчанию).
 }
 
 // ToLogMessage строка для вывода в лог.
@@ -72,6 +87,22 @@ func (chSett *ChannelSettings) ToLogMessage() string {
 		retValue += "Локальный порт: " + strconv.Itoa(chSett.LocalPort) + " "
 	}
 	retValue += "Кодировка: " + chSett.DataEncoding + " "
+	retValue += "Формат сообщений: " + chSett.PayloadFormat + " "
+	if chSett.Runner != RunnerDefault {
+		retValue += "Способ запуска: " + chSett.Runner + " "
+	}
+	if chSett.ContainerProfile != "" {
+		retValue += "Профиль контейнера: " + chSett.ContainerProfile + " "
+	}
+	if chSett.LamEnabled {
+		retValue += "Ожидание LAM: " + strconv.Itoa(chSett.LamTimeout) + " сек. "
+	}
+	if chSett.LamGenerate {
+		retValue += "Формирование LAM: да. "
+	}
+	if chSett.OldiNumbering {
+		retValue += "Нумерация OLDI сообщений: да. "
+	}
 	retValue += "Отладка: "
 	if chSett.LogDebug {
 		retValue += " да. "
@@ -125,6 +156,20 @@ func (chSett *ChannelSettings) CheckSettings() error {
 	if chSett.DataEncoding == "" {
 		return errors.New("Не задана кодировка сообщений.")
 	}
+	if chSett.PayloadFormat == "" {
+		chSett.PayloadFormat = PayloadIcao
+	}
+	if chSett.PayloadFormat != PayloadIcao && chSett.PayloadFormat != PayloadAdexp {
+		return errors.New("Некорректный формат OLDI сообщений.")
+	}
+	if chSett.LamEnabled && chSett.LamTimeout <= 0 {
+		return errors.New("Некорректное значение времени ожидания LAM.")
+	}
+	switch chSett.Runner {
+	case RunnerDefault, RunnerProcess, RunnerDocker, RunnerInProcess:
+	default:
+		return errors.New("Некорректный способ запуска канала.")
+	}
 
 	chSett.FmtpInitState.FromString(chSett.FmtpInitStateStr)
 	return nil
@@ -132,6 +177,8 @@ func (chSett *ChannelSettings) CheckSettings() error {
 
 // ChannelSettingsWithPort настройки каналов, плюс порт для взяимодействия с каналами
 type ChannelSettingsWithPort struct {
-	ChSettings []ChannelSettings
-	ChPort     int
+	ChSettings              []ChannelSettings
+	ChPort                  int
+	ContainerProfiles       []ContainerProfile // профили docker контейнеров каналов
+	DefaultContainerProfile string             // имя профиля по умолчанию (пусто - BuiltinContainerProfile)
 }
@@ -0,0 +1,142 @@
+package channel_settings
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultContainerName шаблон имени docker контейнера канала по умолчанию
+	DefaultContainerName = "fmtp_channel_{local}_{remote}_{id}"
+
+	// DefaultNetworkMode режим сети docker контейнера канала по умолчанию
+	DefaultNetworkMode = "host"
+
+	// ReservedLabelPrefix префикс меток docker контейнера, устанавливаемых контроллером
+	ReservedLabelPrefix = "fmtp."
+)
+
+// метки docker контейнера канала, устанавливаемые контроллером
+const (
+	LabelChannelID = ReservedLabelPrefix + "channel.id"         // идентификатор канала
+	LabelLocalATC  = ReservedLabelPrefix + "channel.local_atc"  // локальный ATC
+	LabelRemoteATC = ReservedLabelPrefix + "channel.remote_atc" // удаленный ATC
+	LabelProfile   = ReservedLabelPrefix + "profile"            // имя профиля контейнера
+	LabelSettings  = ReservedLabelPrefix + "settings_hash"      // хэш настроек запуска канала (для подхвата контейнера после перезапуска контроллера)
+)
+
+// ContainerProfile параметры docker контейнера FMTP канала
+type ContainerProfile struct {
+	Name           string            `json:"Name"`           // имя профиля
+	Cpus           float64           `json:"Cpus"`           // ограничение кол-ва процессоров (0.5 - половина процессора). 0 - не ограничено
+	CPUCount       int64             `json:"CPUCount"`       // кол-во процессоров (учитывается docker только в Windows)
+	CPUPercent     int64             `json:"CPUPercent"`     // доля процессора, % (учитывается docker только в Windows)
+	MemoryMB       int64             `json:"MemoryMB"`       // ограничение памяти, МБ. 0 - не ограничено
+	NetworkMode    string            `json:"NetworkMode"`    // режим сети ("host" | "bridge" | "container:<имя>" | имя сети). Пусто - "host"
+	ContainerName  string            `json:"ContainerName"`  // шаблон имени контейнера ({id}, {local}, {remote}). Пусто - DefaultContainerName
+	Labels         map[string]string `json:"Labels"`         // дополнительные метки контейнера
+	Env            []string          `json:"Env"`            // дополнительные переменные окружения ("ИМЯ=значение")
+	LogDriver      string            `json:"LogDriver"`      // драйвер журнала docker. Пусто - драйвер docker по умолчанию
+	LogOptions     map[string]string `json:"LogOptions"`     // параметры драйвера журнала docker
+	ReadonlyRootfs bool              `json:"ReadonlyRootfs"` // файловая система контейнера только для чтения
+}
+
+// BuiltinContainerProfile профиль, используемый, если в настройках профили не заданы
+var BuiltinContainerProfile = ContainerProfile{
+	Name:        "builtin",
+	CPUCount:    1,
+	CPUPercent:  10,
+	MemoryMB:    100,
+	NetworkMode: DefaultNetworkMode,
+}
+
+// EffectiveNetworkMode режим сети контейнера
+func (cp ContainerProfile) EffectiveNetworkMode() string {
+	if cp.NetworkMode == "" {
+		return DefaultNetworkMode
+	}
+	return cp.NetworkMode
+}
+
+// ContainerNameFor имя docker контейнера канала
+func (cp ContainerProfile) ContainerNameFor(chSett ChannelSettings) string {
+	pattern := cp.ContainerName
+	if pattern == "" {
+		pattern = DefaultContainerName
+	}
+	return strings.NewReplacer(
+		"{id}", strconv.Itoa(chSett.Id),
+		"{local}", chSett.LocalATC,
+		"{remote}", chSett.RemoteATC,
+	).Replace(pattern)
+}
+
+// LabelsFor метки docker контейнера канала (метки профиля и метки контроллера)
+func (cp ContainerProfile) LabelsFor(chSett ChannelSettings) map[string]string {
+	retValue := make(map[string]string, len(cp.Labels)+4)
+	for key, val := range cp.Labels {
+		retValue[key] = val
+	}
+	retValue[LabelChannelID] = strconv.Itoa(chSett.Id)
+	retValue[LabelLocalATC] = chSett.LocalATC
+	retValue[LabelRemoteATC] = chSett.RemoteATC
+	retValue[LabelProfile] = cp.Name
+	return retValue
+}
+
+// ToLogMessage описание профиля для журнала и web страницы (значения переменных окружения не выводятся)
+func (cp ContainerProfile) ToLogMessage() string {
+	retValue := fmt.Sprintf("Профиль: %s. CPU: %v. Память: %d МБ. Сеть: %s.", cp.Name, cp.Cpus, cp.MemoryMB, cp.EffectiveNetworkMode())
+	if len(cp.Labels) > 0 {
+		retValue += " Метки: " + joinSortedKeys(cp.Labels) + "."
+	}
+	if len(cp.Env) > 0 {
+		envNames := make([]string, 0, len(cp.Env))
+		for _, val := range cp.Env {
+			envNames = append(envNames, strings.SplitN(val, "=", 2)[0])
+		}
+		retValue += " Env: " + strings.Join(envNames, ", ") + "."
+	}
+	if cp.LogDriver != "" {
+		retValue += " Журнал: " + cp.LogDriver + "."
+	}
+	if cp.ReadonlyRootfs {
+		retValue += " Только чтение."
+	}
+	return retValue
+}
+
+func joinSortedKeys(vals map[string]string) string {
+	keys := make([]string, 0, len(vals))
+	for key := range vals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// FindContainerProfile поиск профиля по имени
+func FindContainerProfile(profiles []ContainerProfile, name string) (ContainerProfile, bool) {
+	for _, val := range profiles {
+		if val.Name == name {
+			return val, true
+		}
+	}
+	return ContainerProfile{}, false
+}
+
+// ContainerProfileFor профиль docker контейнера канала: профиль канала, профиль по умолчанию или встроенный профиль
+func (s ChannelSettingsWithPort) ContainerProfileFor(chSett ChannelSettings) ContainerProfile {
+	name := chSett.ContainerProfile
+	if name == "" {
+		name = s.DefaultContainerProfile
+	}
+	if name != "" {
+		if profile, ok := FindContainerProfile(s.ContainerProfiles, name); ok {
+			return profile
+		}
+	}
+	return BuiltinContainerProfile
+}
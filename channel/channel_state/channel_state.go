@@ -6,6 +6,7 @@ const (
 	ChannelStateOk      = "ok"
 	ChannelStateStopped = "stopped"
 	ChannelStateError   = "error"
+	ChannelStateFailed  = "failed" // канал неисправен (частые нештатные завершения), перезапуск прекращен до сброса
 
 	StateSendInterval = 1 * time.Second
 
@@ -22,7 +23,19 @@ type ChannelState struct {
 	DaemonState string `json:"DaemonState"` // состояние канала *Не переменовывать в ChannelState
 	FmtpState   string `json:"FmtpState"`   // FMTP состояние канала
 	ChannelURL  string `json:"ChannelURL"`  // URL web странички канала
-	StateColor  string `json:"-"`
+
+	RestartCount int    `json:"RestartCount"`           // кол-во перезапусков канала контроллером
+	LastExit     string `json:"LastExit,omitempty"`     // код и причина последнего нештатного завершения
+	LastExitTime string `json:"LastExitTime,omitempty"` // время последнего нештатного завершения
+	OutputTail   string `json:"OutputTail,omitempty"`   // последние строки вывода канала перед нештатным завершением
+
+	Runner           string `json:"Runner"`                     // способ запуска канала ("process" | "docker" | "inprocess")
+	ContainerProfile string `json:"ContainerProfile,omitempty"` // профиль docker контейнера (для каналов в docker контейнере)
+	ProtocolVersion  int    `json:"ProtocolVersion,omitempty"`  // согласованная версия протокола взаимодействия с контроллером
+	UnackedOut       int    `json:"UnackedOut,omitempty"`       // сообщения контроллера, не подтвержденные каналом
+	UnackedIn        int    `json:"UnackedIn,omitempty"`        // сообщения канала, не подтвержденные контроллером (по данным канала)
+
+	StateColor string `json:"-"`
 }
 
 func ChannelStatesEqual(first []ChannelState, second []ChannelState) bool {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"fmtp/channel/channel_settings"
@@ -43,6 +44,10 @@ type StateController struct {
 	FmtpDataSendChan    chan fmtp.FmtpMessage    // канал для приема данных полученных поверх FMTP
 
 	receivedBuffer bytes.Buffer // буфер полученных из TCP транспорта данных
+
+	WebDebugParams bool          // вывод параметров на web страницу (false - канал работает в процессе контроллера)
+	doneChan       chan struct{} // канал, закрываемый при остановке контроллера
+	stopOnce       sync.Once
 }
 
 // конструктор
@@ -54,9 +59,18 @@ func NewStateController() *StateController {
 		LogMessageChan:      make(chan fmtp_log.LogMessage, 100),
 		FmtpDataReceiveChan: make(chan fmtp.FmtpMessage, 1024),
 		FmtpDataSendChan:    make(chan fmtp.FmtpMessage, 1024),
+		WebDebugParams:      true,
+		doneChan:            make(chan struct{}),
 	}
 }
 
+// Stop остановка работы контроллера и TCP транспорта
+func (fsc *StateController) Stop() {
+	fsc.stopOnce.Do(func() {
+		close(fsc.doneChan)
+	})
+}
+
 // запуск работы контроллера
 func (fsc *StateController) Work(settings channel_settings.ChannelSettings) {
 	fsc.curSet = settings
@@ -100,6 +114,9 @@ func (fsc *StateController) Work(settings channel_settings.ChannelSettings) {
 				webStateColor = channel_state.WebErrorColor
 			}
 
+			if !fsc.WebDebugParams {
+				break
+			}
 			if fsc.curSet.NetRole == "server" {
 				logger.SetDebugParam("Состояние TCP сервера:", webState, webStateColor)
 			} else {
@@ -172,14 +189,26 @@ func (fsc *StateController) Work(settings channel_settings.ChannelSettings) {
 				curChannelState = channel_state.ChannelStateError
 			}
 
-			fsc.FmtpStateChan <- channel_state.ChannelState{
+			select {
+			case fsc.FmtpStateChan <- channel_state.ChannelState{
 				ChannelID:   fsc.curSet.Id,
 				LocalName:   fsc.curSet.LocalATC,
 				RemoteName:  fsc.curSet.RemoteName,
 				DaemonState: curChannelState,
 				FmtpState:   fsc.currentState.ToString(),
 				ChannelURL:  fmt.Sprintf("http://%s:%d/%s", fsc.curSet.URLAddress, fsc.curSet.URLPort, fsc.curSet.URLPath),
+			}:
+			case <-fsc.doneChan:
 			}
+
+		// остановка контроллера
+		case <-fsc.doneChan:
+			fsc.tcpTransport.Stop()
+			fsc.tiTimer.stopTimer()
+			fsc.tsTimer.stopTimer()
+			fsc.trTimer.stopTimer()
+			fsc.stateTick.Stop()
+			return
 		}
 	}
 }
@@ -16,7 +16,10 @@ func IdleStateEnter(fsc *StateController, eventType fmtp.FmtpEvent) {
 	//stateCntrl_->getTransport()->stop();
 	//reconnectTimer_->start(reconnectTimeout_);
 	time.AfterFunc(time.Duration(fsc.curSet.ReconnectTimeout)*time.Second, func() {
-		fsc.tcpTransport.ReconnectChan() <- struct{}{}
+		select {
+		case fsc.tcpTransport.ReconnectChan() <- struct{}{}:
+		case <-fsc.doneChan:
+		}
 	})
 }
 
@@ -64,6 +64,6 @@ func newFmtpTimer(curDuration time.Duration, curFmtpEvent fmtp.FmtpEvent) *Timer
 	return &Timer{duration: curDuration,
 		timer:     time.NewTimer(curDuration),
 		fmtpEvent: curFmtpEvent,
-		eventChan: make(chan fmtp.FmtpEvent),
+		eventChan: make(chan fmtp.FmtpEvent, 1), // буфер, чтобы событие по таймауту не блокировало горутину после остановки контроллера
 	}
 }
@@ -33,6 +33,9 @@ type TcpTransportClient struct {
 	lastConnectError   error // последняя возникшая ошибка при установке соединения (чтоб не отправлять в лог одно и то же)
 	lastKeepaliveError error // последняя возникшая ошибка при установке keepalive (чтоб не отправлять в лог одно и то же)
 	errorChan          chan error
+
+	doneChan chan struct{} // канал, закрываемый при остановке транспорта
+	stopOnce sync.Once
 }
 
 // конструктор
@@ -49,6 +52,7 @@ func NewFmtpTcpClient() *TcpTransportClient {
 		errorChan:          make(chan error),
 		lastConnectError:   errors.New(""),
 		lastKeepaliveError: errors.New(""),
+		doneChan:           make(chan struct{}),
 	}
 }
 
@@ -95,7 +99,73 @@ func (ftc *TcpTransportClient) Work() {
 
 		case <-ftc.reconnectChan:
 			ftc.startClient()
+
+		case <-ftc.doneChan:
+			return
+		}
+	}
+}
+
+// Stop остановка клиента и закрытие TCP подключения
+func (ftc *TcpTransportClient) Stop() {
+	ftc.stopOnce.Do(func() {
+		close(ftc.doneChan)
+
+		ftc.Lock()
+		defer ftc.Unlock()
+		if ftc.tcpClient != nil {
+			ftc.tcpClient.Close()
 		}
+	})
+}
+
+// отправка сообщения для журнала. false - транспорт остановлен
+func (ftc *TcpTransportClient) sendLog(logMsg fmtp_log.LogMessage) bool {
+	select {
+	case ftc.logMessageChan <- logMsg:
+		return true
+	case <-ftc.doneChan:
+		return false
+	}
+}
+
+// отправка состояния подключения. false - транспорт остановлен
+func (ftc *TcpTransportClient) sendConnState(connState bool) bool {
+	select {
+	case ftc.connStateChan <- connState:
+		return true
+	case <-ftc.doneChan:
+		return false
+	}
+}
+
+// отправка FMTP события. false - транспорт остановлен
+func (ftc *TcpTransportClient) sendEvent(event fmtp.FmtpEvent) bool {
+	select {
+	case ftc.eventAfterSendChan <- event:
+		return true
+	case <-ftc.doneChan:
+		return false
+	}
+}
+
+// отправка ошибки подключения. false - транспорт остановлен
+func (ftc *TcpTransportClient) sendError(err error) bool {
+	select {
+	case ftc.errorChan <- err:
+		return true
+	case <-ftc.doneChan:
+		return false
+	}
+}
+
+// отправка принятых данных. false - транспорт остановлен
+func (ftc *TcpTransportClient) sendReceived(data []byte) bool {
+	select {
+	case ftc.receivedDataChan <- data:
+		return true
+	case <-ftc.doneChan:
+		return false
 	}
 }
 
@@ -105,22 +175,29 @@ func (ftc *TcpTransportClient) startClient() {
 	if ftc.tcpClient, err = net.Dial("tcp", ftc.curSett.ServerAddr+":"+strconv.Itoa(ftc.curSett.ServerPort)); err != nil {
 		if err.Error() != ftc.lastConnectError.Error() {
 			ftc.lastConnectError = err
-			ftc.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityError,
-				fmt.Sprintf("При установке TCP соединения возникла ошибка. Ошибка:<%s>", err.Error()))
+			ftc.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityError,
+				fmt.Sprintf("При установке TCP соединения возникла ошибка. Ошибка:<%s>", err.Error())))
 		}
-		ftc.connStateChan <- false
+		ftc.sendConnState(false)
+		return
+	}
+	// транспорт остановлен во время установки соединения
+	select {
+	case <-ftc.doneChan:
+		ftc.tcpClient.Close()
 		return
+	default:
 	}
-	ftc.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityDebug, "Установлено TCP соединение FMTP канала.")
-	ftc.connStateChan <- true
+	ftc.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityDebug, "Установлено TCP соединение FMTP канала."))
+	ftc.sendConnState(true)
 
 	if err = ftc.tcpClient.(*net.TCPConn).SetKeepAlive(false); err != nil {
 		if err.Error() != ftc.lastKeepaliveError.Error() {
 			ftc.lastKeepaliveError = err
-			ftc.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityError,
-				fmt.Sprintf("При установке флага keep_alive TCP соединения возникла ошибка. Ошибка:<%s>", err.Error()))
+			ftc.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityError,
+				fmt.Sprintf("При установке флага keep_alive TCP соединения возникла ошибка. Ошибка:<%s>", err.Error())))
 		}
-		ftc.connStateChan <- false
+		ftc.sendConnState(false)
 		return
 	}
 
@@ -130,17 +207,19 @@ func (ftc *TcpTransportClient) startClient() {
 
 //
 func (ftc *TcpTransportClient) stopClient() {
-	ftc.Lock()
-	ftc.cancelWorkChan <- struct{}{}
-	ftc.Unlock()
+	select {
+	case ftc.cancelWorkChan <- struct{}{}:
+	case <-ftc.doneChan:
+		return
+	}
 
-	ftc.connStateChan <- false
+	ftc.sendConnState(false)
 
 	if err := ftc.tcpClient.Close(); err != nil {
-		ftc.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityError,
-			fmt.Sprintf("Ошибка при закрытии TCP соединение FMTP канала. Ошибка: <%s>.", err.Error()))
+		ftc.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityError,
+			fmt.Sprintf("Ошибка при закрытии TCP соединение FMTP канала. Ошибка: <%s>.", err.Error())))
 	} else {
-		ftc.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityError, "Закрыто TCP соединение FMTP канала.")
+		ftc.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityError, "Закрыто TCP соединение FMTP канала."))
 	}
 }
 
@@ -156,14 +235,16 @@ func (ftc *TcpTransportClient) receiveLoop() {
 			buffer := make([]byte, 1024)
 			if readBytes, err := ftc.tcpClient.Read(buffer); err != nil {
 				if err != io.EOF {
-					ftc.logMessageChan <- fmtp_log.LogChannelSTDT(fmtp_log.SeverityError, fmtp_log.NoneFmtpType, fmtp_log.DirectionIncoming,
-						fmt.Sprintf("Ошибка чтения данных из FMTP канала. Ошибка: <%s>.", err.Error()))
+					ftc.sendLog(fmtp_log.LogChannelSTDT(fmtp_log.SeverityError, fmtp_log.NoneFmtpType, fmtp_log.DirectionIncoming,
+						fmt.Sprintf("Ошибка чтения данных из FMTP канала. Ошибка: <%s>.", err.Error())))
 				}
-				ftc.errorChan <- err
+				ftc.sendError(err)
 				return
 			} else {
 				fmt.Println("Read bytes", readBytes, "  ", string(buffer[:readBytes]))
-				ftc.receivedDataChan <- buffer[:readBytes]
+				if !ftc.sendReceived(buffer[:readBytes]) {
+					return
+				}
 			}
 		}
 	}
@@ -180,12 +261,12 @@ func (ftc *TcpTransportClient) sendLoop() {
 		// получены данные для отправки
 		case curData := <-ftc.toSendDataChan:
 			if _, err := ftc.tcpClient.Write(curData.DataToSend); err != nil {
-				ftc.logMessageChan <- fmtp_log.LogChannelSTDT(fmtp_log.SeverityError, fmtp_log.NoneFmtpType, fmtp_log.DirectionIncoming,
-					fmt.Sprintf("Ошибка отправки данных в FMTP канала. Ошибка: <%s>.", err.Error()))
-				ftc.errorChan <- err
+				ftc.sendLog(fmtp_log.LogChannelSTDT(fmtp_log.SeverityError, fmtp_log.NoneFmtpType, fmtp_log.DirectionIncoming,
+					fmt.Sprintf("Ошибка отправки данных в FMTP канала. Ошибка: <%s>.", err.Error())))
+				ftc.sendError(err)
 				return
 			} else if curData.EventAfterSend != fmtp.None {
-				ftc.eventAfterSendChan <- curData.EventAfterSend
+				ftc.sendEvent(curData.EventAfterSend)
 			}
 		}
 	}
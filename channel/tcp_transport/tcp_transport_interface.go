@@ -30,4 +30,5 @@ type TcpTransport interface {
 	ConnStateChan() chan bool            // канал для передачи успешности подключения по TCP
 	ReconnectChan() chan struct{}        // канал для передачи сигнала о необходимости подключиться ксерверу (для TCP клиента)
 	Work()
+	Stop() // остановка транспорта (закрытие подключений, завершение Work)
 }
@@ -30,6 +30,10 @@ type TcpTransportServer struct {
 	reconnectChan  chan struct{}            // канал для сообщения TCP клиенту о необходимости подключитья к серверу (не используется)
 
 	errorChan chan error
+
+	listener net.Listener  // TCP сервер
+	doneChan chan struct{} // канал, закрываемый при остановке транспорта
+	stopOnce sync.Once
 }
 
 // конструктор
@@ -44,6 +48,7 @@ func NewFmtpTcpServer() *TcpTransportServer {
 		connStateChan:    make(chan bool),
 		errorChan:        make(chan error),
 		reconnectChan:    make(chan struct{}),
+		doneChan:         make(chan struct{}),
 	}
 }
 
@@ -89,7 +94,86 @@ func (fts *TcpTransportServer) Work() {
 			fts.stopClient()
 
 		case <-fts.reconnectChan:
+
+		case <-fts.doneChan:
+			return
+		}
+	}
+}
+
+// Stop остановка TCP сервера и закрытие клиентского подключения
+func (fts *TcpTransportServer) Stop() {
+	fts.stopOnce.Do(func() {
+		close(fts.doneChan)
+
+		fts.Lock()
+		defer fts.Unlock()
+		if fts.listener != nil {
+			fts.listener.Close()
+		}
+		if fts.tcpClient != nil {
+			fts.tcpClient.Close()
 		}
+	})
+}
+
+// признак остановки транспорта
+func (fts *TcpTransportServer) isStopped() bool {
+	select {
+	case <-fts.doneChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// отправка сообщения для журнала. false - транспорт остановлен
+func (fts *TcpTransportServer) sendLog(logMsg fmtp_log.LogMessage) bool {
+	select {
+	case fts.logMessageChan <- logMsg:
+		return true
+	case <-fts.doneChan:
+		return false
+	}
+}
+
+// отправка состояния подключения. false - транспорт остановлен
+func (fts *TcpTransportServer) sendConnState(connState bool) bool {
+	select {
+	case fts.connStateChan <- connState:
+		return true
+	case <-fts.doneChan:
+		return false
+	}
+}
+
+// отправка FMTP события. false - транспорт остановлен
+func (fts *TcpTransportServer) sendEvent(event fmtp.FmtpEvent) bool {
+	select {
+	case fts.fmtpEventChan <- event:
+		return true
+	case <-fts.doneChan:
+		return false
+	}
+}
+
+// отправка ошибки подключения. false - транспорт остановлен
+func (fts *TcpTransportServer) sendError(err error) bool {
+	select {
+	case fts.errorChan <- err:
+		return true
+	case <-fts.doneChan:
+		return false
+	}
+}
+
+// отправка принятых данных. false - транспорт остановлен
+func (fts *TcpTransportServer) sendReceived(data []byte) bool {
+	select {
+	case fts.receivedDataChan <- data:
+		return true
+	case <-fts.doneChan:
+		return false
 	}
 }
 
@@ -98,45 +182,56 @@ func (fts *TcpTransportServer) startServer() {
 	var listener net.Listener
 	listener, err := net.Listen("tcp", string(":"+strconv.Itoa(fts.curSett.LocalPort)))
 	if err != nil {
-		fts.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityError,
-			fmt.Sprintf("Ошибка запуска TCP сервера FMTP канала. Ошибка: <%s>.", err.Error()))
+		fts.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityError,
+			fmt.Sprintf("Ошибка запуска TCP сервера FMTP канала. Ошибка: <%s>.", err.Error())))
 
-		fts.connStateChan <- false
+		fts.sendConnState(false)
 		return
 	}
-	fts.connStateChan <- true
-	fts.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityInfo, "Запущен TCP сервер FMTP канала.")
+	fts.Lock()
+	fts.listener = listener
+	fts.Unlock()
+	if fts.isStopped() {
+		listener.Close()
+		return
+	}
+
+	fts.sendConnState(true)
+	fts.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityInfo, "Запущен TCP сервер FMTP канала."))
 	defer listener.Close()
 
 	for {
 		var curConn net.Conn
 		curConn, err := listener.Accept()
 		if err != nil {
-			fts.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityError,
-				fmt.Sprintf("Ошибка подключения клиента к TCP серверу FMTP канала. Ошибка: <%s>.", err.Error()))
+			if fts.isStopped() {
+				return
+			}
+			fts.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityError,
+				fmt.Sprintf("Ошибка подключения клиента к TCP серверу FMTP канала. Ошибка: <%s>.", err.Error())))
 			continue
 		}
 		remoteAddr, _ := curConn.RemoteAddr().(*net.TCPAddr)
 
 		if fts.tcpClient != nil {
 			//fts.stopClient()
-			fts.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityWarning,
+			fts.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityWarning,
 				fmt.Sprintf("Отклонено входящее подключение к TCP серверу FMTP канала. "+
-					"Клиент уже подключен. Адрес отклоненного клиента: <%s>", remoteAddr.IP.String()))
+					"Клиент уже подключен. Адрес отклоненного клиента: <%s>", remoteAddr.IP.String())))
 			continue
 		} else {
 			if fts.curSett.ClientAddr != "" && remoteAddr.IP.String() != fts.curSett.ClientAddr {
-				fts.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityWarning,
+				fts.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityWarning,
 					fmt.Sprintf("Отклонено входящее подключение к TCP серверу FMTP канала. "+
-						"Адрес клиента не соответствует. Адрес отклоненного клиента: <%s>", remoteAddr.IP.String()))
+						"Адрес клиента не соответствует. Адрес отклоненного клиента: <%s>", remoteAddr.IP.String())))
 			} else {
-				fts.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityInfo,
+				fts.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityInfo,
 					fmt.Sprintf("Успешное подключение клиента к TCP серверу FMTP канала. "+
-						"Адрес подключенного клиента: <%s>", remoteAddr.IP.String()))
+						"Адрес подключенного клиента: <%s>", remoteAddr.IP.String())))
 
 				fts.tcpClient = curConn
-				fts.connStateChan <- true
-				fts.fmtpEventChan <- fmtp.RSetup
+				fts.sendConnState(true)
+				fts.sendEvent(fmtp.RSetup)
 
 				go fts.receiveLoop()
 				go fts.sendLoop()
@@ -148,16 +243,20 @@ func (fts *TcpTransportServer) startServer() {
 //
 func (fts *TcpTransportServer) stopClient() {
 	//utils.ChanSafeClose(fts.cancelWorkChan)
-	fts.cancelWorkChan <- struct{}{}
+	select {
+	case fts.cancelWorkChan <- struct{}{}:
+	case <-fts.doneChan:
+		return
+	}
 
-	fts.connStateChan <- false
+	fts.sendConnState(false)
 
 	if fts.tcpClient != nil {
 		if err := fts.tcpClient.Close(); err != nil {
-			fts.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityError,
-				fmt.Sprintf("Ошибка при закрытии клиентского TCP подключения FMTP канала. Ошибка: <%s>.", err.Error()))
+			fts.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityError,
+				fmt.Sprintf("Ошибка при закрытии клиентского TCP подключения FMTP канала. Ошибка: <%s>.", err.Error())))
 		} else {
-			fts.logMessageChan <- fmtp_log.LogChannelST(fmtp_log.SeverityInfo, "Закрыто клиентское TCP соединение FMTP канала.")
+			fts.sendLog(fmtp_log.LogChannelST(fmtp_log.SeverityInfo, "Закрыто клиентское TCP соединение FMTP канала."))
 			fts.tcpClient = nil
 		}
 	}
@@ -176,13 +275,13 @@ func (fts *TcpTransportServer) receiveLoop() {
 				buffer := make([]byte, 8192)
 				if readBytes, err := fts.tcpClient.Read(buffer); err != nil {
 					if err != io.EOF {
-						fts.logMessageChan <- fmtp_log.LogChannelSTDT(fmtp_log.SeverityError, fmtp_log.NoneFmtpType, fmtp_log.DirectionIncoming,
-							fmt.Sprintf("Ошибка чтения данных из FMTP канала. Ошибка: <%s>.", err.Error()))
+						fts.sendLog(fmtp_log.LogChannelSTDT(fmtp_log.SeverityError, fmtp_log.NoneFmtpType, fmtp_log.DirectionIncoming,
+							fmt.Sprintf("Ошибка чтения данных из FMTP канала. Ошибка: <%s>.", err.Error())))
 					}
-					fts.errorChan <- err
+					fts.sendError(err)
+					return
+				} else if !fts.sendReceived(buffer[:readBytes]) {
 					return
-				} else {
-					fts.receivedDataChan <- buffer[:readBytes]
 				}
 			}
 		}
@@ -200,12 +299,12 @@ func (fts *TcpTransportServer) sendLoop() {
 		// получены данные для отправки
 		case curData := <-fts.toSendDataChan:
 			if _, err := fts.tcpClient.Write(curData.DataToSend); err != nil {
-				fts.logMessageChan <- fmtp_log.LogChannelSTDT(fmtp_log.SeverityError, fmtp_log.NoneFmtpType, fmtp_log.DirectionIncoming,
-					fmt.Sprintf("Ошибка отправки данных в FMTP канала. Ошибка: <%s>.", err.Error()))
-				fts.errorChan <- err
+				fts.sendLog(fmtp_log.LogChannelSTDT(fmtp_log.SeverityError, fmtp_log.NoneFmtpType, fmtp_log.DirectionIncoming,
+					fmt.Sprintf("Ошибка отправки данных в FMTP канала. Ошибка: <%s>.", err.Error())))
+				fts.sendError(err)
 				return
 			} else if curData.EventAfterSend != fmtp.None {
-				fts.fmtpEventChan <- curData.EventAfterSend
+				fts.sendEvent(curData.EventAfterSend)
 			}
 		}
 	}
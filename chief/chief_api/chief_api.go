@@ -0,0 +1,288 @@
+package chief_api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/channel/channel_state"
+	"fmtp/chief/chief_settings"
+	"fmtp/chief/chief_state"
+	"fmtp/chief_channel"
+	"fmtp/configurator"
+
+	"lemz.com/fdps/logger"
+)
+
+// ApiPath префикс пути REST API контроллера
+const ApiPath = "/api/v1/"
+
+// время ожидания выполнения команды управления каналом
+const cmdTimeout = 10 * time.Second
+
+// ChannelInfo настройки и текущее состояние канала
+type ChannelInfo struct {
+	Settings channel_settings.ChannelSettings `json:"Settings"`
+	State    *channel_state.ChannelState      `json:"State"` // nil - состояние канала не получено
+}
+
+// ProviderInfo настройки и текущее состояние провайдера
+type ProviderInfo struct {
+	Settings chief_settings.ProviderSettings `json:"Settings"`
+	States   []chief_state.ProviderState     `json:"States"`
+}
+
+// HealthInfo общее состояние контроллера
+type HealthInfo struct {
+	Status             string `json:"Status"` // "ok" | "error"
+	ControllerID       int    `json:"ControllerID"`
+	ControllerIP       string `json:"ControllerIP"`
+	ControllerVersion  string `json:"ControllerVersion"`
+	DockerVersion      string `json:"DockerVersion"`
+	SettingsTimestamp  string `json:"SettingsTimestamp"`  // метка времени текущих настроек
+	SettingsReceived   bool   `json:"SettingsReceived"`   // признак получения настроек (от конфигуратора или из файла)
+	CommonErrorMessage string `json:"CommonErrorMessage"` // текст ошибки
+	ChannelCount       int    `json:"ChannelCount"`       // кол-во каналов в настройках
+	ChannelOkCount     int    `json:"ChannelOkCount"`     // кол-во работающих каналов
+	ProviderCount      int    `json:"ProviderCount"`      // кол-во провайдеров в настройках
+	ProviderOkCount    int    `json:"ProviderOkCount"`    // кол-во подключенных провайдеров
+	Role               string `json:"Role"`               // роль контроллера в паре ("single" | "leader" | "standby")
+	NodeID             string `json:"NodeID"`             // имя экземпляра контроллера
+	LeaderNode         string `json:"LeaderNode"`         // имя ведущего экземпляра пары
+
+	SettingsProblems chief_settings.SettingsProblems `json:"SettingsProblems"` // проблемы, найденные при проверке настроек
+}
+
+// CommandResult результат выполнения команды управления каналом
+type CommandResult struct {
+	ChannelID int    `json:"ChannelID"`
+	Command   string `json:"Command"`
+	Result    string `json:"Result"`
+}
+
+type errorResponse struct {
+	Error string `json:"Error"`
+}
+
+// ChiefApi обработчик запросов REST API
+type ChiefApi struct {
+	cmdChan chan chief_channel.ChannelCommand // канал для передачи команд управления каналами
+}
+
+// Start регистрация обработчиков REST API на web сервере контроллера
+func Start(cmdChan chan chief_channel.ChannelCommand) {
+	api := &ChiefApi{cmdChan: cmdChan}
+
+	http.HandleFunc(ApiPath+"health", api.handleHealth)
+	http.HandleFunc(ApiPath+"channels", api.handleChannels)
+	http.HandleFunc(ApiPath+"channels/", api.handleChannel)
+	http.HandleFunc(ApiPath+"providers", api.handleProviders)
+	http.HandleFunc(ApiPath+"openapi.json", handleOpenApi)
+
+	logger.PrintfDebug("Зарегистрированы обработчики REST API контроллера. Путь: %s", ApiPath)
+}
+
+func writeJson(w http.ResponseWriter, statusCode int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.PrintfErr("Ошибка формирования ответа REST API. Ошибка: %v", err)
+		statusCode = http.StatusInternalServerError
+		data = []byte(`{"Error":"internal error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, errText string) {
+	writeJson(w, statusCode, errorResponse{Error: errText})
+}
+
+// проверка метода запроса
+func checkMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, "Метод "+r.Method+" не поддерживается.")
+		return false
+	}
+	return true
+}
+
+// состояние канала по идентификатору
+func channelState(channelID int) *channel_state.ChannelState {
+	for _, val := range chief_state.CommonChiefState.ChannelStates {
+		if val.ChannelID == channelID {
+			retValue := val
+			return &retValue
+		}
+	}
+	return nil
+}
+
+func channelInfo(chSett channel_settings.ChannelSettings) ChannelInfo {
+	return ChannelInfo{Settings: chSett, State: channelState(chSett.Id)}
+}
+
+func (api *ChiefApi) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	health := HealthInfo{
+		Status:             chief_state.CommonChiefState.CommonState,
+		ControllerID:       configurator.ChiefCfg.CntrlID,
+		ControllerIP:       configurator.ChiefCfg.IPAddr,
+		ControllerVersion:  chief_state.CommonChiefState.ControllerVersion,
+		DockerVersion:      chief_state.CommonChiefState.DockerVersion,
+		SettingsTimestamp:  configurator.ChiefCfg.Timestamp,
+		SettingsReceived:   configurator.ChiefCfg.IsInitialised,
+		CommonErrorMessage: chief_state.CommonChiefState.CommonErrorMessage,
+		ChannelCount:       len(configurator.ChiefCfg.ChannelSetts),
+		ProviderCount:      len(configurator.ChiefCfg.ProvidersSetts),
+		SettingsProblems:   chief_state.CommonChiefState.SettingsProblems,
+		Role:               chief_state.CommonChiefState.Role,
+		NodeID:             chief_state.CommonChiefState.NodeID,
+		LeaderNode:         chief_state.CommonChiefState.LeaderNode,
+	}
+	for _, val := range chief_state.CommonChiefState.ChannelStates {
+		if val.DaemonState == channel_state.ChannelStateOk {
+			health.ChannelOkCount++
+		}
+	}
+	for _, val := range chief_state.CommonChiefState.ProviderStates {
+		if val.ProviderState == chief_state.StateOk {
+			health.ProviderOkCount++
+		}
+	}
+
+	statusCode := http.StatusOK
+	if !health.SettingsReceived || health.Status != chief_state.StateOk {
+		statusCode = http.StatusServiceUnavailable
+	}
+	writeJson(w, statusCode, health)
+}
+
+func (api *ChiefApi) handleChannels(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	retValue := make([]ChannelInfo, 0)
+	for _, val := range configurator.ChiefCfg.ChannelSetts {
+		retValue = append(retValue, channelInfo(val))
+	}
+	sort.Slice(retValue, func(i, j int) bool {
+		return retValue[i].Settings.Id < retValue[j].Settings.Id
+	})
+	writeJson(w, http.StatusOK, retValue)
+}
+
+// обработчик запросов к каналу: GET channels/{id}, POST channels/{id}/{start|stop|restart|reset}
+func (api *ChiefApi) handleChannel(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, ApiPath+"channels/"), "/"), "/")
+
+	channelID, err := strconv.Atoi(pathParts[0])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Некорректный идентификатор канала.")
+		return
+	}
+
+	switch len(pathParts) {
+	case 1:
+		if !checkMethod(w, r, http.MethodGet) {
+			return
+		}
+		for _, val := range configurator.ChiefCfg.ChannelSetts {
+			if val.Id == channelID {
+				writeJson(w, http.StatusOK, channelInfo(val))
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, chief_channel.ErrChannelNotFound.Error())
+
+	case 2:
+		if !checkMethod(w, r, http.MethodPost) {
+			return
+		}
+		switch pathParts[1] {
+		case chief_channel.ChannelCmdStart, chief_channel.ChannelCmdStop, chief_channel.ChannelCmdRestart, chief_channel.ChannelCmdReset:
+			api.execCommand(w, chief_channel.NewChannelCommand(channelID, pathParts[1]))
+		default:
+			writeError(w, http.StatusNotFound, chief_channel.ErrUnknownChannelCmd.Error())
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, "Ресурс не найден.")
+	}
+}
+
+// передача команды контроллеру каналов и ожидание результата
+func (api *ChiefApi) execCommand(w http.ResponseWriter, cmd chief_channel.ChannelCommand) {
+	select {
+	case api.cmdChan <- cmd:
+	case <-time.After(cmdTimeout):
+		writeError(w, http.StatusServiceUnavailable, "Контроллер каналов не принял команду.")
+		return
+	}
+
+	select {
+	case err := <-cmd.ResultChan:
+		if err == nil {
+			writeJson(w, http.StatusOK, CommandResult{ChannelID: cmd.ChannelID, Command: cmd.Cmd, Result: "ok"})
+			return
+		}
+
+		statusCode := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, chief_channel.ErrChannelNotFound):
+			statusCode = http.StatusNotFound
+		case errors.Is(err, chief_channel.ErrChannelAlreadyRunning),
+			errors.Is(err, chief_channel.ErrChannelNotRunning),
+			errors.Is(err, chief_channel.ErrChannelNotWorking):
+			statusCode = http.StatusConflict
+		case errors.Is(err, chief_channel.ErrUnknownChannelCmd):
+			statusCode = http.StatusBadRequest
+		}
+		writeError(w, statusCode, err.Error())
+
+	case <-time.After(cmdTimeout):
+		writeError(w, http.StatusGatewayTimeout, "Истекло время ожидания выполнения команды.")
+	}
+}
+
+func (api *ChiefApi) handleProviders(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	retValue := make([]ProviderInfo, 0)
+	for _, val := range configurator.ChiefCfg.ProvidersSetts {
+		provInfo := ProviderInfo{Settings: val, States: make([]chief_state.ProviderState, 0)}
+		// токен провайдера не передаем
+		provInfo.Settings.Token = ""
+
+		for _, stVal := range chief_state.CommonChiefState.ProviderStates {
+			if stVal.ProviderID == val.ID && stVal.ProviderType == val.DataType {
+				provInfo.States = append(provInfo.States, stVal)
+			}
+		}
+		retValue = append(retValue, provInfo)
+	}
+	sort.Slice(retValue, func(i, j int) bool {
+		return retValue[i].Settings.ID < retValue[j].Settings.ID
+	})
+	writeJson(w, http.StatusOK, retValue)
+}
+
+func handleOpenApi(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write([]byte(openApiDoc))
+}
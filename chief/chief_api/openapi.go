@@ -0,0 +1,213 @@
+package chief_api
+
+// описание REST API контроллера в формате OpenAPI 3.0
+var openApiDoc = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "FDPS FMTP chief API",
+    "version": "1.0.0",
+    "description": "Состояние и управление FMTP каналами и провайдерами контроллера."
+  },
+  "servers": [{"url": "/api/v1"}],
+  "paths": {
+    "/health": {
+      "get": {
+        "summary": "Общее состояние контроллера",
+        "responses": {
+          "200": {"description": "Контроллер работает штатно", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Health"}}}},
+          "503": {"description": "Настройки не получены или есть каналы / провайдеры с ошибками", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Health"}}}}
+        }
+      }
+    },
+    "/channels": {
+      "get": {
+        "summary": "Список каналов с настройками и текущим состоянием",
+        "responses": {
+          "200": {"description": "Список каналов", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Channel"}}}}}
+        }
+      }
+    },
+    "/channels/{id}": {
+      "get": {
+        "summary": "Канал с настройками и текущим состоянием",
+        "parameters": [{"$ref": "#/components/parameters/ChannelID"}],
+        "responses": {
+          "200": {"description": "Канал", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Channel"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/channels/{id}/start": {
+      "post": {
+        "summary": "Запуск канала",
+        "parameters": [{"$ref": "#/components/parameters/ChannelID"}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/CommandResult"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "503": {"$ref": "#/components/responses/Error"},
+          "504": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/channels/{id}/stop": {
+      "post": {
+        "summary": "Остановка канала. Канал не перезапускается автоматически до команды start или restart",
+        "parameters": [{"$ref": "#/components/parameters/ChannelID"}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/CommandResult"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "503": {"$ref": "#/components/responses/Error"},
+          "504": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/channels/{id}/restart": {
+      "post": {
+        "summary": "Перезапуск канала",
+        "parameters": [{"$ref": "#/components/parameters/ChannelID"}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/CommandResult"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "503": {"$ref": "#/components/responses/Error"},
+          "504": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/channels/{id}/reset": {
+      "post": {
+        "summary": "Сброс счетчиков перезапусков и признака неисправности канала (состояние failed). Канал запускается, если должен работать",
+        "parameters": [{"$ref": "#/components/parameters/ChannelID"}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/CommandResult"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "503": {"$ref": "#/components/responses/Error"},
+          "504": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/providers": {
+      "get": {
+        "summary": "Список провайдеров с настройками и текущим состоянием",
+        "responses": {
+          "200": {"description": "Список провайдеров", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Provider"}}}}}
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "summary": "Описание API",
+        "responses": {"200": {"description": "Документ OpenAPI"}}
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "ChannelID": {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}, "description": "Идентификатор канала (DaemonID)"}
+    },
+    "responses": {
+      "Error": {"description": "Ошибка", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "CommandResult": {"description": "Команда выполнена", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CommandResult"}}}}
+    },
+    "schemas": {
+      "Error": {
+        "type": "object",
+        "properties": {"Error": {"type": "string"}}
+      },
+      "CommandResult": {
+        "type": "object",
+        "properties": {
+          "ChannelID": {"type": "integer"},
+          "Command": {"type": "string", "enum": ["start", "stop", "restart", "reset"]},
+          "Result": {"type": "string"}
+        }
+      },
+      "Health": {
+        "type": "object",
+        "properties": {
+          "Status": {"type": "string", "enum": ["ok", "error"]},
+          "ControllerID": {"type": "integer"},
+          "ControllerIP": {"type": "string"},
+          "ControllerVersion": {"type": "string"},
+          "DockerVersion": {"type": "string"},
+          "SettingsTimestamp": {"type": "string"},
+          "SettingsReceived": {"type": "boolean"},
+          "CommonErrorMessage": {"type": "string"},
+          "ChannelCount": {"type": "integer"},
+          "ChannelOkCount": {"type": "integer"},
+          "ProviderCount": {"type": "integer"},
+          "ProviderOkCount": {"type": "integer"},
+          "Role": {"type": "string", "enum": ["single", "leader", "standby"], "description": "Роль контроллера в паре"},
+          "NodeID": {"type": "string", "description": "Имя экземпляра контроллера"},
+          "LeaderNode": {"type": "string", "description": "Имя ведущего экземпляра пары (пусто - неизвестен)"},
+          "SettingsProblems": {"type": "array", "nullable": true, "items": {"$ref": "#/components/schemas/SettingsProblem"}}
+        }
+      },
+      "SettingsProblem": {
+        "type": "object",
+        "properties": {
+          "Severity": {"type": "string", "enum": ["error", "warning"]},
+          "Object": {"type": "string", "enum": ["chief", "channel", "provider", "routing", "file"]},
+          "ObjectID": {"type": "integer"},
+          "DataType": {"type": "string", "description": "Тип провайдера (для проблем в настройках провайдеров)"},
+          "Field": {"type": "string"},
+          "Message": {"type": "string"}
+        }
+      },
+      "ChannelState": {
+        "type": "object",
+        "properties": {
+          "DaemonID": {"type": "integer"},
+          "LocalName": {"type": "string"},
+          "RemoteName": {"type": "string"},
+          "DaemonState": {"type": "string", "enum": ["ok", "stopped", "error", "failed"]},
+          "FmtpState": {"type": "string"},
+          "ChannelURL": {"type": "string"},
+          "RestartCount": {"type": "integer", "description": "Кол-во перезапусков канала контроллером"},
+          "LastExit": {"type": "string", "description": "Код и причина последнего нештатного завершения"},
+          "LastExitTime": {"type": "string", "description": "Время последнего нештатного завершения"},
+          "OutputTail": {"type": "string", "description": "Последние строки вывода (stdout и stderr) перед нештатным завершением"},
+          "Runner": {"type": "string", "enum": ["process", "docker", "inprocess"], "description": "Способ запуска канала"},
+          "ContainerProfile": {"type": "string", "description": "Профиль docker контейнера"},
+          "ProtocolVersion": {"type": "integer", "description": "Согласованная версия протокола взаимодействия канала с контроллером"},
+          "UnackedOut": {"type": "integer", "description": "Сообщения контроллера, не подтвержденные каналом"},
+          "UnackedIn": {"type": "integer", "description": "Сообщения канала, не подтвержденные контроллером"}
+        }
+      },
+      "Channel": {
+        "type": "object",
+        "properties": {
+          "Settings": {"type": "object", "description": "Настройки канала (формат настроек конфигуратора)"},
+          "State": {"nullable": true, "allOf": [{"$ref": "#/components/schemas/ChannelState"}]}
+        }
+      },
+      "ProviderState": {
+        "type": "object",
+        "properties": {
+          "ProviderID": {"type": "integer"},
+          "ProviderType": {"type": "string", "enum": ["OLDI", "AODB"]},
+          "ProviderTransport": {"type": "string", "enum": ["grpc", "tcp"]},
+          "ProviderIPs": {"type": "array", "items": {"type": "string"}},
+          "ProviderState": {"type": "string", "enum": ["ok", "error"]},
+          "ProviderErrorMessage": {"type": "string"},
+          "Backlog": {"type": "integer"}
+        }
+      },
+      "Provider": {
+        "type": "object",
+        "properties": {
+          "Settings": {"type": "object", "description": "Настройки провайдера (без токена)"},
+          "States": {"type": "array", "items": {"$ref": "#/components/schemas/ProviderState"}}
+        }
+      }
+    }
+  }
+}
+`
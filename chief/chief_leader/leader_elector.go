@@ -0,0 +1,178 @@
+package chief_leader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"fmtp/fmtp_log"
+
+	"lemz.com/fdps/logger"
+)
+
+// роль контроллера
+const (
+	RoleSingle  = "single"  // контроллер работает без резервирования
+	RoleLeader  = "leader"  // ведущий контроллер пары: запускает каналы и обслуживает провайдеров
+	RoleStandby = "standby" // резервный контроллер пары: ожидает освобождения аренды
+)
+
+// RoleInfo роль контроллера в паре
+type RoleInfo struct {
+	Role       string // роль контроллера
+	NodeID     string // имя экземпляра контроллера
+	LeaderNode string // имя ведущего экземпляра (пусто - неизвестен)
+	Decided    bool   // роль определена (получен результат захвата аренды или контроллер работает без резервирования)
+}
+
+// IsLeader признак работы с каналами и провайдерами
+func (ri RoleInfo) IsLeader() bool {
+	return ri.Role == RoleLeader || ri.Role == RoleSingle
+}
+
+func (ri RoleInfo) String() string {
+	return fmt.Sprintf("Роль: %s. Экземпляр: %s. Ведущий: %s.", ri.Role, ri.NodeID, ri.LeaderNode)
+}
+
+// LeaderElector выбор ведущего контроллера пары по аренде.
+// Ведущий продлевает аренду каждые RenewIntervalSec, резервный в те же моменты пытается ее захватить.
+// Ведущий, не сумевший продлить аренду, становится резервным до ее окончания, чтобы пара не работала с каналами одновременно.
+type LeaderElector struct {
+	RoleChan chan RoleInfo // канал для передачи изменений роли контроллера
+
+	setts     LeaderSettings
+	lease     Lease
+	role      RoleInfo
+	lastRenew time.Time // время начала последнего успешного продления аренды
+}
+
+// NewLeaderElector конструктор. Аренда создается в соответствии с настройками
+func NewLeaderElector(setts LeaderSettings) *LeaderElector {
+	var lease Lease
+	// при ошибке файла настроек аренда не создается (контроллер остается резервным)
+	if setts.Enabled && setts.loadErr == nil {
+		var err error
+		if lease, err = NewLease(setts); err != nil {
+			logger.PrintfErr("Ошибка создания аренды ведущего контроллера. Ошибка: %v.", err)
+		}
+	}
+	return NewLeaderElectorWithLease(setts, lease)
+}
+
+// NewLeaderElectorWithLease конструктор с заданной арендой (например, MemoryLease, общей для пары в тестах).
+// lease == nil - аренда недоступна (ошибка настроек), контроллер остается резервным
+func NewLeaderElectorWithLease(setts LeaderSettings, lease Lease) *LeaderElector {
+	retValue := &LeaderElector{
+		RoleChan: make(chan RoleInfo, 10),
+		setts:    setts,
+		lease:    lease,
+		role:     RoleInfo{Role: RoleStandby, NodeID: setts.nodeID()},
+	}
+	if !setts.Enabled {
+		retValue.role.Role = RoleSingle
+		retValue.role.LeaderNode = retValue.role.NodeID
+		retValue.role.Decided = true
+	}
+	return retValue
+}
+
+// Role начальная роль контроллера (до первой попытки захвата аренды).
+// При работе парой роль не определена (Decided == false) до первого результата захвата аренды
+func (e *LeaderElector) Role() RoleInfo {
+	return e.role
+}
+
+// Work реализация работы
+func (e *LeaderElector) Work(done chan struct{}) {
+	if !e.setts.Enabled {
+		e.RoleChan <- e.role
+		return
+	}
+	if e.lease == nil {
+		logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, fmtp_log.ChannelTypeNone,
+			"Аренда ведущего контроллера недоступна. Контроллер остается резервным."))
+		e.role.Decided = true
+		e.RoleChan <- e.role
+		return
+	}
+	defer e.lease.Close()
+
+	logger.PrintfInfo("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityInfo, fmtp_log.ChannelTypeNone,
+		fmt.Sprintf("Контроллер работает парой. Экземпляр: %s. Хранение аренды: %s (%s). Время действия аренды: %v.",
+			e.role.NodeID, e.setts.Backend, e.setts.leaseKey(), e.setts.leaseTtl())))
+	e.RoleChan <- e.role
+
+	renewTicker := time.NewTicker(e.setts.renewInterval())
+	defer renewTicker.Stop()
+
+	e.elect()
+	for {
+		select {
+		// сработал тикер продления / захвата аренды
+		case <-renewTicker.C:
+			e.elect()
+
+		case <-done:
+			e.release()
+			return
+		}
+	}
+}
+
+// попытка захвата или продления аренды
+func (e *LeaderElector) elect() {
+	startTime := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), e.setts.renewInterval())
+	holder, err := e.lease.TryAcquire(ctx, e.role.NodeID, e.setts.leaseTtl())
+	cancel()
+
+	if err != nil {
+		logger.PrintfErr("Ошибка захвата / продления аренды ведущего контроллера. Ошибка: %v.", err)
+
+		// аренда могла быть продлена в последний раз перед началом предыдущей попытки - уступаем до ее окончания
+		if e.role.Role == RoleLeader && time.Since(e.lastRenew) >= e.setts.leaseTtl()-e.setts.renewInterval() {
+			e.setRole(RoleStandby, "")
+		}
+		return
+	}
+
+	if holder == e.role.NodeID {
+		e.lastRenew = startTime
+		e.setRole(RoleLeader, holder)
+	} else {
+		e.setRole(RoleStandby, holder)
+	}
+}
+
+// освобождение аренды при завершении работы, чтобы резервный контроллер не ожидал ее окончания
+func (e *LeaderElector) release() {
+	if e.role.Role != RoleLeader {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.setts.renewInterval())
+	defer cancel()
+
+	if err := e.lease.Release(ctx, e.role.NodeID); err != nil {
+		logger.PrintfErr("Ошибка освобождения аренды ведущего контроллера. Ошибка: %v.", err)
+	}
+}
+
+func (e *LeaderElector) setRole(role string, leaderNode string) {
+	if e.role.Decided && e.role.Role == role && e.role.LeaderNode == leaderNode {
+		return
+	}
+	prevRole := e.role.Role
+	e.role.Role = role
+	e.role.LeaderNode = leaderNode
+	e.role.Decided = true
+
+	if prevRole != role {
+		severity := fmtp_log.SeverityInfo
+		if role == RoleStandby {
+			severity = fmtp_log.SeverityWarning
+		}
+		logger.PrintfWarn("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(severity, fmtp_log.ChannelTypeNone,
+			fmt.Sprintf("Изменена роль контроллера: %s -> %s. %s", prevRole, role, e.role)))
+	}
+	e.RoleChan <- e.role
+}
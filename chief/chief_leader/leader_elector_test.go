@@ -0,0 +1,129 @@
+package chief_leader
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRoleDecidedAfterElection(t *testing.T) {
+	lease := NewMemoryLease()
+	first := NewLeaderElectorWithLease(LeaderSettings{Enabled: true, NodeID: "first"}, lease)
+	second := NewLeaderElectorWithLease(LeaderSettings{Enabled: true, NodeID: "second"}, lease)
+
+	if first.Role().Decided || first.Role().IsLeader() {
+		t.Fatalf("initial role %v must be undecided standby", first.Role())
+	}
+
+	first.elect()
+	if role := <-first.RoleChan; !role.Decided || role.Role != RoleLeader {
+		t.Fatalf("first role %v, want decided leader", role)
+	}
+
+	second.elect()
+	if role := <-second.RoleChan; !role.Decided || role.Role != RoleStandby || role.LeaderNode != "first" {
+		t.Fatalf("second role %v, want decided standby", role)
+	}
+
+	// unchanged role is not resent
+	second.elect()
+	if len(second.RoleChan) != 0 {
+		t.Fatalf("unchanged role resent")
+	}
+
+	if single := NewLeaderElectorWithLease(LeaderSettings{}, nil); !single.Role().Decided || !single.Role().IsLeader() {
+		t.Fatalf("single role %v must be decided", single.Role())
+	}
+}
+
+func TestFileLeaseLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lease")
+	first, second := newFileLease(path), newFileLease(path)
+
+	unlock, err := first.lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lock held by the other instance is never taken over
+	ctx, cancel := context.WithTimeout(context.Background(), 3*fileLockRetryInterval)
+	if _, err = second.lock(ctx); err == nil {
+		t.Fatalf("lock taken while held")
+	}
+	cancel()
+
+	unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	unlock, err = second.lock(ctx)
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	unlock()
+}
+
+func TestFileLeaseAcquire(t *testing.T) {
+	lease := newFileLease(filepath.Join(t.TempDir(), "leader.lease"))
+	ctx := context.Background()
+
+	if holder, err := lease.TryAcquire(ctx, "first", time.Minute); err != nil || holder != "first" {
+		t.Fatalf("first acquire: %q %v", holder, err)
+	}
+	if holder, err := lease.TryAcquire(ctx, "second", time.Minute); err != nil || holder != "first" {
+		t.Fatalf("second acquire: %q %v", holder, err)
+	}
+	if err := lease.Release(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if holder, err := lease.TryAcquire(ctx, "second", time.Minute); err != nil || holder != "second" {
+		t.Fatalf("acquire after release: %q %v", holder, err)
+	}
+}
+
+func useLeaderConfig(t *testing.T, path string) {
+	prev := leaderConfigName
+	leaderConfigName = path
+	t.Cleanup(func() { leaderConfigName = prev })
+}
+
+func TestBrokenSettingsKeepStandby(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader-config.json")
+	broken := []byte(`{"Enabled": true, "Backend": "redis",}`)
+	if err := ioutil.WriteFile(path, broken, 0644); err != nil {
+		t.Fatal(err)
+	}
+	useLeaderConfig(t, path)
+
+	setts := LoadSettings()
+	if data, _ := ioutil.ReadFile(path); string(data) != string(broken) {
+		t.Fatalf("broken settings file overwritten: %s", data)
+	}
+
+	elector := NewLeaderElector(setts)
+	done := make(chan struct{})
+	defer close(done)
+	go elector.Work(done)
+
+	select {
+	case role := <-elector.RoleChan:
+		if !role.Decided || role.IsLeader() {
+			t.Fatalf("role %v, want decided standby", role)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no role")
+	}
+}
+
+func TestMissingSettingsRunSingle(t *testing.T) {
+	useLeaderConfig(t, filepath.Join(t.TempDir(), "leader-config.json"))
+
+	setts := LoadSettings()
+	if setts.Enabled || setts.loadErr != nil {
+		t.Fatalf("missing file: %+v", setts)
+	}
+	if role := NewLeaderElector(setts).Role(); role.Role != RoleSingle {
+		t.Fatalf("role %v, want single", role)
+	}
+}
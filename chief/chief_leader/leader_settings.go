@@ -0,0 +1,119 @@
+package chief_leader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"fmtp/fmtp_log"
+	"fmtp/secret"
+
+	"lemz.com/fdps/logger"
+	"lemz.com/fdps/utils"
+)
+
+// способ хранения аренды ведущего контроллера
+const (
+	BackendRedis  = "redis"  // ключ в БД Redis
+	BackendFile   = "file"   // файл на общем для пары контроллеров диске
+	BackendMemory = "memory" // в памяти процесса (локальная замена для тестов, пара в одном процессе)
+)
+
+// значения по умолчанию
+const (
+	defaultLeaseKey    = "FmtpChiefLeader"
+	defaultLeaseTtl    = 10 * time.Second
+	defaultRenewPeriod = 3 * time.Second
+)
+
+// LeaderSettings настройки работы контроллеров парой (ведущий / резервный).
+// Хранятся в локальном файле, т.к. определяют, какой из экземпляров работает с конфигуратором, каналами и провайдерами.
+type LeaderSettings struct {
+	Enabled          bool   `json:"Enabled"`          // признак работы парой (false - контроллер всегда ведущий)
+	NodeID           string `json:"NodeID"`           // имя экземпляра контроллера в паре (пусто - имя хоста)
+	Backend          string `json:"Backend"`          // способ хранения аренды ("redis" | "file" | "memory")
+	LeaseKey         string `json:"LeaseKey"`         // ключ аренды в Redis или путь к файлу аренды
+	LeaseTtlSec      int    `json:"LeaseTtlSec"`      // время действия аренды, сек.
+	RenewIntervalSec int    `json:"RenewIntervalSec"` // период продления аренды, сек. (не более трети времени действия)
+
+	RedisHostname string `json:"RedisHostname"` // адрес/название хоста Redis
+	RedisPort     int    `json:"RedisPort"`     // порт подключения к Redis
+	RedisDbId     int    `json:"RedisDbId"`     // идентификатор БД Redis
+	RedisUser     string `json:"RedisUser"`     // пользователь Redis
+	RedisPassword string `json:"RedisPassword"` // пароль для подключения к Redis (допускается "enc:...")
+
+	loadErr error // ошибка чтения файла настроек (контроллер остается резервным)
+}
+
+var leaderConfigName = utils.AppPath() + "/config/leader-config.json"
+
+// LoadSettings чтение настроек работы парой из локального файла.
+// Если файла нет, контроллер работает без резервирования (файл создается с настройками по умолчанию).
+// Если файл не читается или содержит ошибку, файл не изменяется, а контроллер остается резервным,
+// чтобы оба контроллера пары не работали с каналами и провайдерами одновременно
+func LoadSettings() LeaderSettings {
+	var retValue LeaderSettings
+	data, errRead := ioutil.ReadFile(leaderConfigName)
+	if os.IsNotExist(errRead) {
+		logger.PrintfInfo("Файл настроек работы контроллеров парой отсутствует. Файл: %s. Контроллер работает без резервирования.", leaderConfigName)
+		if errWrite := utils.SaveToFile(leaderConfigName, retValue); errWrite != nil {
+			logger.PrintfErr("Ошибка записи настроек работы контроллеров парой в файл. Файл: %s. Ошибка: %s", leaderConfigName, errWrite)
+		}
+		return retValue
+	}
+	if errRead == nil {
+		errRead = json.Unmarshal(data, &retValue)
+	}
+	if errRead != nil {
+		logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, fmtp_log.ChannelTypeNone,
+			fmt.Sprintf("Ошибка чтения настроек работы контроллеров парой из файла. Файл: %s. Ошибка: %v. Контроллер остается резервным до исправления файла.",
+				leaderConfigName, errRead)))
+		return LeaderSettings{Enabled: true, loadErr: errRead}
+	}
+	if err := secret.DecryptFields(&retValue.RedisPassword); err != nil {
+		logger.PrintfErr("Ошибка расшифровки пароля Redis в настройках работы контроллеров парой. Ошибка: %v.", err)
+	}
+	return retValue
+}
+
+// nodeID имя экземпляра контроллера в паре
+func (s LeaderSettings) nodeID() string {
+	if s.NodeID != "" {
+		return s.NodeID
+	}
+	if hostName, err := os.Hostname(); err == nil {
+		return hostName
+	}
+	return "fmtp_chief"
+}
+
+func (s LeaderSettings) leaseKey() string {
+	if s.LeaseKey != "" {
+		return s.LeaseKey
+	}
+	if s.Backend == BackendFile {
+		return utils.AppPath() + "/run/leader.lease"
+	}
+	return defaultLeaseKey
+}
+
+func (s LeaderSettings) leaseTtl() time.Duration {
+	if s.LeaseTtlSec > 0 {
+		return time.Duration(s.LeaseTtlSec) * time.Second
+	}
+	return defaultLeaseTtl
+}
+
+// период продления аренды. Ведущий должен успеть продлить аренду хотя бы раз до ее окончания
+func (s LeaderSettings) renewInterval() time.Duration {
+	retValue := defaultRenewPeriod
+	if s.RenewIntervalSec > 0 {
+		retValue = time.Duration(s.RenewIntervalSec) * time.Second
+	}
+	if maxInterval := s.leaseTtl() / 3; retValue > maxInterval {
+		retValue = maxInterval
+	}
+	return retValue
+}
@@ -0,0 +1,76 @@
+package chief_leader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Lease аренда ведущего контроллера. Ведущим является экземпляр, владеющий действующей арендой
+type Lease interface {
+	// TryAcquire захват свободной (истекшей) аренды или продление аренды, которой владеет nodeID.
+	// Возвращает текущего владельца аренды.
+	TryAcquire(ctx context.Context, nodeID string, ttl time.Duration) (string, error)
+
+	// Release освобождение аренды, если ее владелец - nodeID
+	Release(ctx context.Context, nodeID string) error
+
+	// Close закрытие подключений
+	Close() error
+}
+
+// NewLease аренда в соответствии с настройками
+func NewLease(setts LeaderSettings) (Lease, error) {
+	switch setts.Backend {
+	case BackendRedis:
+		return newRedisLease(setts), nil
+	case BackendFile:
+		return newFileLease(setts.leaseKey()), nil
+	case BackendMemory:
+		return NewMemoryLease(), nil
+	default:
+		return nil, fmt.Errorf("Неизвестный способ хранения аренды ведущего контроллера: '%s'.", setts.Backend)
+	}
+}
+
+// MemoryLease аренда в памяти процесса. Локальная замена Redis и файла для тестов (оба экземпляра в одном процессе)
+type MemoryLease struct {
+	sync.Mutex
+	holder  string
+	expires time.Time
+}
+
+// NewMemoryLease конструктор
+func NewMemoryLease() *MemoryLease {
+	return &MemoryLease{}
+}
+
+// TryAcquire реализация Lease
+func (l *MemoryLease) TryAcquire(ctx context.Context, nodeID string, ttl time.Duration) (string, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	if l.holder == "" || l.holder == nodeID || now.After(l.expires) {
+		l.holder = nodeID
+		l.expires = now.Add(ttl)
+	}
+	return l.holder, nil
+}
+
+// Release реализация Lease
+func (l *MemoryLease) Release(ctx context.Context, nodeID string) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.holder == nodeID {
+		l.holder = ""
+	}
+	return nil
+}
+
+// Close реализация Lease
+func (l *MemoryLease) Close() error {
+	return nil
+}
@@ -0,0 +1,134 @@
+package chief_leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// интервал повторных попыток захвата блокировки файла аренды
+const fileLockRetryInterval = 50 * time.Millisecond
+
+// содержимое файла аренды
+type fileLeaseData struct {
+	Holder  string    `json:"Holder"`  // владелец аренды
+	Expires time.Time `json:"Expires"` // время окончания аренды
+}
+
+// fileLease аренда в виде файла на общем диске пары контроллеров.
+// Изменение файла выполняется под блокировкой файла "<путь>.lock" средствами ОС (flock / LockFileEx).
+// Блокировка снимается ОС при завершении экземпляра, поэтому оставленные блокировки не удаляются, а файл блокировки не удаляется никогда.
+// Время окончания аренды сравнивается с локальным временем, поэтому время хостов пары должно быть синхронизировано.
+type fileLease struct {
+	path string
+}
+
+func newFileLease(path string) *fileLease {
+	return &fileLease{path: path}
+}
+
+// захват блокировки файла аренды
+func (l *fileLease) lock(ctx context.Context) (func(), error) {
+	lockPath := l.path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return nil, err
+	}
+
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		locked, lockErr := tryLockFile(lockFile)
+		if lockErr != nil {
+			lockFile.Close()
+			return nil, lockErr
+		}
+		if locked {
+			return func() {
+				unlockFile(lockFile)
+				lockFile.Close()
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			lockFile.Close()
+			return nil, fmt.Errorf("Не удалось захватить блокировку файла аренды %s. Ошибка: %v.", l.path, ctx.Err())
+		case <-time.After(fileLockRetryInterval):
+		}
+	}
+}
+
+func (l *fileLease) read() (fileLeaseData, error) {
+	var retValue fileLeaseData
+	data, err := ioutil.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return retValue, nil
+	}
+	if err == nil && len(data) > 0 {
+		err = json.Unmarshal(data, &retValue)
+	}
+	return retValue, err
+}
+
+// запись через временный файл, чтобы другой экземпляр не прочитал файл частично
+func (l *fileLease) write(leaseData fileLeaseData) error {
+	data, err := json.Marshal(leaseData)
+	if err != nil {
+		return err
+	}
+	tmpPath := l.path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, l.path)
+}
+
+// TryAcquire реализация Lease
+func (l *fileLease) TryAcquire(ctx context.Context, nodeID string, ttl time.Duration) (string, error) {
+	unlock, err := l.lock(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	cur, err := l.read()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if cur.Holder == "" || cur.Holder == nodeID || now.After(cur.Expires) {
+		cur = fileLeaseData{Holder: nodeID, Expires: now.Add(ttl)}
+		if err = l.write(cur); err != nil {
+			return "", err
+		}
+	}
+	return cur.Holder, nil
+}
+
+// Release реализация Lease
+func (l *fileLease) Release(ctx context.Context, nodeID string) error {
+	unlock, err := l.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cur, err := l.read()
+	if err != nil || cur.Holder != nodeID {
+		return err
+	}
+	return l.write(fileLeaseData{})
+}
+
+// Close реализация Lease
+func (l *fileLease) Close() error {
+	return nil
+}
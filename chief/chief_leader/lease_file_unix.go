@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package chief_leader
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// попытка монопольной блокировки файла без ожидания. false - файл заблокирован другим экземпляром
+func tryLockFile(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// снятие блокировки файла
+func unlockFile(file *os.File) {
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,59 @@
+package chief_leader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// захват или продление аренды: ключ отсутствует (аренда истекла) или принадлежит узлу
+var acquireScript = redis.NewScript(`
+local cur = redis.call("GET", KEYS[1])
+if cur == false or cur == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return ARGV[1]
+end
+return cur`)
+
+// удаление ключа аренды, только если он принадлежит узлу
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// redisLease аренда в виде ключа Redis с временем жизни
+type redisLease struct {
+	redisClnt *redis.Client
+	key       string
+}
+
+func newRedisLease(setts LeaderSettings) *redisLease {
+	return &redisLease{
+		redisClnt: redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", setts.RedisHostname, setts.RedisPort),
+			Network:  "tcp",
+			DB:       setts.RedisDbId,
+			Username: setts.RedisUser,
+			Password: setts.RedisPassword,
+		}),
+		key: setts.leaseKey(),
+	}
+}
+
+// TryAcquire реализация Lease
+func (l *redisLease) TryAcquire(ctx context.Context, nodeID string, ttl time.Duration) (string, error) {
+	return acquireScript.Run(ctx, l.redisClnt, []string{l.key}, nodeID, ttl.Milliseconds()).Text()
+}
+
+// Release реализация Lease
+func (l *redisLease) Release(ctx context.Context, nodeID string) error {
+	return releaseScript.Run(ctx, l.redisClnt, []string{l.key}, nodeID).Err()
+}
+
+// Close реализация Lease
+func (l *redisLease) Close() error {
+	return l.redisClnt.Close()
+}
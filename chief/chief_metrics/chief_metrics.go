@@ -8,6 +8,9 @@ const (
 	metricChan  = "chan"
 	metricFdps  = "fdps"
 	metricRedis = "redis"
+
+	metricChanUnackedOut = "chan_unacked_out" // сообщения контроллера, не подтвержденные каналами
+	metricChanUnackedIn  = "chan_unacked_in"  // сообщения каналов, не подтвержденные контроллером (по данным каналов)
 )
 
 ////////////////////////////////////////////////////////////////////////////////////
@@ -27,6 +30,20 @@ type RedisMetrics struct {
 const ChanTypeLabel = "tp"
 const ChanTpSend = "send"
 const ChanTpRecv = "recv"
+const ChanTpLamAck = "lam_ack"               // получен LAM на отправленное сообщение
+const ChanTpLamTimeout = "lam_tout"          // не получен LAM на отправленное сообщение
+const ChanTpLamGenerated = "lam_gen"         // сформирован LAM на полученное сообщение
+const ChanTpSeqGap = "seq_gap"               // пропущенные номера полученных сообщений
+const ChanTpSeqDup = "seq_dup"               // повтор номеров полученных сообщений
+const ChanTpRouteFailover = "route_failover" // сообщение отправлено в резервный канал маршрута
+const ChanTpRouteFanOut = "route_fanout"     // сообщение отправлено в несколько каналов маршрута
+const ChanTpRouteNone = "route_none"         // нет канала маршрута в состоянии data_ready
+const ChanTpRestart = "restart"              // перезапуск канала после нештатного завершения
+const ChanTpCrashLoop = "crash_loop"         // канал признан неисправным из-за частых нештатных завершений
+const ChanTpRetransmit = "retransmit"        // повторная передача неподтвержденного сообщения после восстановления связи
+const ChanTpDeliveryDup = "dlv_dup"          // повторно полученное сообщение отброшено
+const ChanTpDeliveryGap = "dlv_gap"          // сообщения, удаленные отправителем из-за переполнения очереди
+const ChanTpDeliveryDrop = "dlv_drop"        // неподтвержденные сообщения удалены из-за переполнения очереди
 
 const ChanLocAtcLabel = "latc"
 const ChanRemAtcLabel = "ratc"
@@ -38,6 +55,12 @@ type ChanMetrics struct {
 	Count  int
 }
 
+// UnackedMetrics кол-во неподтвержденных сообщений между контроллером и каналами
+type UnackedMetrics struct {
+	ToChannels   int // сообщения контроллера, не подтвержденные каналами
+	FromChannels int // сообщения каналов, не подтвержденные контроллером
+}
+
 ////////////////////////////////////////////////////////////////////////////////////
 
 const ProvTypeLabel = "tp"
@@ -61,9 +84,10 @@ type ChiefMetricsCntrl struct {
 }
 
 var (
-	ChanMetricsChan  = make(chan ChanMetrics, 10)
-	ProvMetricsChan  = make(chan ProvMetrics, 10)
-	RedisMetricsChan = make(chan RedisMetrics, 10)
+	ChanMetricsChan    = make(chan ChanMetrics, 10)
+	UnackedMetricsChan = make(chan UnackedMetrics, 10)
+	ProvMetricsChan    = make(chan ProvMetrics, 10)
+	RedisMetricsChan   = make(chan RedisMetrics, 10)
 )
 
 func NewChiefMetricsCntrl() *ChiefMetricsCntrl {
@@ -82,6 +106,8 @@ func (c *ChiefMetricsCntrl) Run() {
 			prom_metrics.AppendCounterVec(metricChan, "Канал", []string{ChanTypeLabel, ChanLocAtcLabel, ChanRemAtcLabel})
 			prom_metrics.AppendCounterVec(metricFdps, "Провайдер", []string{ProvTypeLabel})
 			prom_metrics.AppendCounterVec(metricRedis, "Redis", []string{RedisTypeLabel})
+			prom_metrics.AppendGauge(metricChanUnackedOut, "Сообщения контроллера, не подтвержденные каналами")
+			prom_metrics.AppendGauge(metricChanUnackedIn, "Сообщения каналов, не подтвержденные контроллером")
 			prom_metrics.Initialize()
 
 		case chMt := <-ChanMetricsChan:
@@ -91,6 +117,10 @@ func (c *ChiefMetricsCntrl) Run() {
 				ChanRemAtcLabel: chMt.RemAtc,
 			})
 
+		case unMt := <-UnackedMetricsChan:
+			prom_metrics.SetToGauge(metricChanUnackedOut, unMt.ToChannels)
+			prom_metrics.SetToGauge(metricChanUnackedIn, unMt.FromChannels)
+
 		case prMt := <-ProvMetricsChan:
 			prom_metrics.AddToCounterVec(metricFdps, prMt.SendCount, map[string]string{ProvTypeLabel: ProvTpSend})
 			prom_metrics.AddToCounterVec(metricFdps, prMt.RecvCount, map[string]string{ProvTypeLabel: ProvTpRecv})
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
+	"path"
+	"time"
 
 	ch_set "fmtp/channel/channel_settings"
+	pb "fmtp/chief/proto/fmtp"
+	"fmtp/secret"
 
 	"lemz.com/fdps/utils"
 )
@@ -16,13 +19,122 @@ const (
 	OLDIProvider = "OLDI"
 )
 
+// способ подключения провайдера
+const (
+	ProviderTransportGrpc = "grpc" // GRPC (по умолчанию)
+	ProviderTransportTcp  = "tcp"  // TCP с разбиением потока на сообщения STX/ETX (только OLDI)
+)
+
 type ProviderSettings struct {
-	ID               int      `json:"ProviderID"`     // идентификатор провайдера
-	IPAddresses      []string `json:"ProviderIPs"`    // список IP адресов провайдера
-	Status           string   `json:"ProviderStatus"` // статус работы провайдера (primary/secondary) - не используется
-	DataType         string   `json:"ProviderType"`   // тип данных поверх FMTP ("AODB" | "OLDI")
+	ID               int      `json:"ProviderID"`        // идентификатор провайдера
+	IPAddresses      []string `json:"ProviderIPs"`       // список IP адресов провайдера
+	Status           string   `json:"ProviderStatus"`    // статус работы провайдера (primary/secondary) - не используется
+	DataType         string   `json:"ProviderType"`      // тип данных поверх FMTP ("AODB" | "OLDI")
+	Transport        string   `json:"ProviderTransport"` // способ подключения провайдера ("grpc" | "tcp")
 	ProviderEncoding string   // кодировка сообщений при общении с провайдером OLDI ("Windows-1251" | "UTF-8")
 	LocalPort        int      // сетевой порт (заполняется из общей структуры настроек)
+
+	CidFilter     []string `json:"CidFilter"`     // шаблоны CID (удаленных ATC), сообщения которых передаются провайдеру (пусто - все). Допускаются '*' и '?'
+	MsgTypeFilter []string `json:"MsgTypeFilter"` // типы сообщений, передаваемых провайдеру ("operational" | "lam_ack" | "lam_timeout"), пусто - все
+	MsgTtlSec     int      `json:"MsgTtlSec"`     // время хранения сообщений в очереди провайдера, сек. (0 - по умолчанию)
+
+	Token string `json:"ProviderToken"` // токен, передаваемый провайдером в метаданных GRPC вызовов (пусто - не проверяется)
+}
+
+// ProviderTlsSettings настройки TLS GRPC серверов для подключения провайдеров
+type ProviderTlsSettings struct {
+	CertFile     string `json:"CertFile"`     // файл сертификата сервера (PEM). Не задан - TLS не используется
+	KeyFile      string `json:"KeyFile"`      // файл закрытого ключа сервера (PEM)
+	ClientCAFile string `json:"ClientCAFile"` // файл сертификатов УЦ клиентов (PEM). Задан - обязательна проверка сертификата клиента (mTLS)
+}
+
+// Enabled признак использования TLS
+func (ts ProviderTlsSettings) Enabled() bool {
+	return ts.CertFile != "" && ts.KeyFile != ""
+}
+
+// ProviderTransport способ подключения провайдера (по умолчанию GRPC)
+func (ps ProviderSettings) ProviderTransport() string {
+	if ps.Transport == ProviderTransportTcp {
+		return ProviderTransportTcp
+	}
+	return ProviderTransportGrpc
+}
+
+// defaultMsgTtl время хранения сообщений в очереди провайдера по умолчанию
+const defaultMsgTtl = 30 * time.Second
+
+// MsgTtl время хранения сообщений в очереди провайдера
+func (ps ProviderSettings) MsgTtl() time.Duration {
+	if ps.MsgTtlSec > 0 {
+		return time.Duration(ps.MsgTtlSec) * time.Second
+	}
+	return defaultMsgTtl
+}
+
+// Accepts признак того, что сообщение с заданными CID и типом передается провайдеру (подписка провайдера)
+func (ps ProviderSettings) Accepts(cid string, msgType string) bool {
+	if len(ps.CidFilter) > 0 {
+		cidOk := false
+		for _, val := range ps.CidFilter {
+			if MatchCid(val, cid) {
+				cidOk = true
+				break
+			}
+		}
+		if !cidOk {
+			return false
+		}
+	}
+
+	if len(ps.MsgTypeFilter) > 0 {
+		// сообщения без типа считаются оперативными
+		if msgType == "" {
+			msgType = pb.MsgTpOperational
+		}
+		for _, val := range ps.MsgTypeFilter {
+			if val == msgType {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// MatchCid проверка соответствия CID шаблону: точное значение, префикс ("UUW*"), шаблон с '*' и '?' или "*" - любой CID
+func MatchCid(pattern string, cid string) bool {
+	if pattern == cid || pattern == "*" {
+		return true
+	}
+	matched, err := path.Match(pattern, cid)
+	return err == nil && matched
+}
+
+// RouteRule правило маршрутизации сообщений провайдеров в FMTP каналы
+type RouteRule struct {
+	Cid      string `json:"Cid"`      // шаблон CID (удаленного ATC) сообщения
+	DataType string `json:"DataType"` // тип провайдера ("OLDI" | "AODB"), пусто - любой
+	MsgType  string `json:"MsgType"`  // тип сообщения (поле Tp), пусто - любой
+	Channels []int  `json:"Channels"` // идентификаторы каналов в порядке приоритета
+	FanOut   bool   `json:"FanOut"`   // отправка сообщения во все каналы правила в состоянии data_ready
+}
+
+// Matches признак соответствия сообщения правилу
+func (rr RouteRule) Matches(cid string, dataType string, msgType string) bool {
+	if rr.DataType != "" && rr.DataType != dataType {
+		return false
+	}
+	if rr.MsgType != "" {
+		// сообщения без типа считаются оперативными
+		if msgType == "" {
+			msgType = pb.MsgTpOperational
+		}
+		if rr.MsgType != msgType {
+			return false
+		}
+	}
+	return MatchCid(rr.Cid, cid)
 }
 
 type LoggerSettings struct {
@@ -44,9 +156,17 @@ type ChiefSettings struct {
 	Timestamp            string `json:"ConfigTimestamp"`      // метка времени
 	ChannelsPort         int    `json:"DaemonsPort"`          // TCP порт для связи с демонами.
 	OldiProviderPort     int    `json:"OldiProviderPort"`     // TCP порт для связи с плановым сервисом (OLDI).
+	OldiProviderTcpPort  int    `json:"OldiProviderTcpPort"`  // TCP порт для связи с плановым сервисом (OLDI) без GRPC.
 	OldiProviderEncoding string `json:"OldiProviderEncoding"` // кодировка сообщений при общении с провайдером OLDI ("Windows-1251" | "UTF-8")
 	AodbProviderPort     int    `json:"AodbProviderPort"`     // TCP порт для связи с плановым сервисом (AODB).
 	DockerRegistry       string `json:"DockerRegistry"`       // репозиторий с docker образами каналовы
+	ChannelAuthRequired  bool   `json:"ChannelAuthRequired"`  // подключение каналов только с токеном (каналы старых версий без рукопожатия отклоняются)
+
+	ContainerProfiles       []ch_set.ContainerProfile `json:"ContainerProfiles"`       // профили docker контейнеров каналов
+	DefaultContainerProfile string                    `json:"DefaultContainerProfile"` // имя профиля по умолчанию (пусто - встроенный профиль)
+
+	ProviderTls  ProviderTlsSettings `json:"ProviderTls"`  // настройки TLS GRPC серверов для подключения провайдеров
+	RoutingRules []RouteRule         `json:"RoutingRules"` // правила маршрутизации сообщений провайдеров в каналы (проверяются по порядку)
 
 	LoggerSetts    LoggerSettings           `json:"LoggerSettings"`
 	ChannelSetts   []ch_set.ChannelSettings `json:"FmtpDaemons"`
@@ -66,14 +186,18 @@ func (s *ChiefSettings) ReadFromFile() error {
 		fmt.Println(err.Error())
 		return err
 	}
-	return nil
+	return s.DecryptSecrets()
 }
 
-// SaveToFile сохранение настроек в файл
+// SaveToFile сохранение настроек в файл (секреты сохраняются в зашифрованном виде)
 func (s *ChiefSettings) SaveToFile() error {
-	if confData, errMrsh := json.Marshal(s); errMrsh != nil {
+	encSetts, errEnc := s.encrypted()
+	if errEnc != nil {
+		return errEnc
+	}
+	if confData, errMrsh := json.Marshal(encSetts); errMrsh != nil {
 		return errMrsh
-	} else if errWriteSetts := ioutil.WriteFile(chiefSettingsFile, utils.JsonPrettyPrint(confData), os.ModePerm); errWriteSetts != nil {
+	} else if errWriteSetts := secret.WriteFile(chiefSettingsFile, utils.JsonPrettyPrint(confData)); errWriteSetts != nil {
 		return errWriteSetts
 	}
 	return nil
@@ -111,11 +235,14 @@ func (s *ChiefSettings) ProviderSettings(providerType string) []ProviderSettings
 	return retSetts
 }
 
-func (s *ChiefSettings) GetChannelIdByCid(cid string) int {
-	for _, val := range s.ChannelSetts {
-		if val.RemoteATC == cid {
-			return val.Id
+// ProviderSettingsByTransport настройки провайдеров по типу и способу подключения
+func (s *ChiefSettings) ProviderSettingsByTransport(providerType string, transport string) []ProviderSettings {
+	var retSetts []ProviderSettings
+
+	for _, val := range s.ProvidersSetts {
+		if val.DataType == providerType && val.ProviderTransport() == transport {
+			retSetts = append(retSetts, val)
 		}
 	}
-	return -1
+	return retSetts
 }
@@ -0,0 +1,42 @@
+package chief_settings
+
+import (
+	"fmtp/secret"
+)
+
+// указатели на секреты в настройках контроллера
+func (s *ChiefSettings) secretFields() []*string {
+	retValue := []*string{&s.LoggerSetts.DbPassword}
+	for idx := range s.ProvidersSetts {
+		retValue = append(retValue, &s.ProvidersSetts[idx].Token)
+	}
+	return retValue
+}
+
+// копия настроек с собственным списком провайдеров (для изменения секретов без изменения исходных настроек)
+func (s ChiefSettings) copyWithProviders() ChiefSettings {
+	retValue := s
+	retValue.ProvidersSetts = append([]ProviderSettings(nil), s.ProvidersSetts...)
+	return retValue
+}
+
+// DecryptSecrets расшифровка секретов, заданных в виде "enc:..."
+func (s *ChiefSettings) DecryptSecrets() error {
+	return secret.DecryptFields(s.secretFields()...)
+}
+
+// настройки с зашифрованными секретами (для сохранения в файл)
+func (s ChiefSettings) encrypted() (ChiefSettings, error) {
+	retValue := s.copyWithProviders()
+	err := secret.EncryptFields(retValue.secretFields()...)
+	return retValue, err
+}
+
+// Redacted настройки со скрытыми секретами (для вывода в журнал и на web страницы)
+func (s ChiefSettings) Redacted() ChiefSettings {
+	retValue := s.copyWithProviders()
+	for _, val := range retValue.secretFields() {
+		*val = secret.Redact(*val)
+	}
+	return retValue
+}
@@ -0,0 +1,358 @@
+package chief_settings
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	ch_set "fmtp/channel/channel_settings"
+
+	"lemz.com/fdps/utils"
+)
+
+// важность проблемы в настройках
+const (
+	ProblemError   = "error"   // объект с ошибкой не применяется
+	ProblemWarning = "warning" // объект применяется
+)
+
+// объект настроек, к которому относится проблема
+const (
+	ProblemObjChief    = "chief"    // общие настройки контроллера. Ошибка - настройки не применяются
+	ProblemObjChannel  = "channel"  // настройки канала. Ошибка - канал не запускается
+	ProblemObjProvider = "provider" // настройки провайдера. Ошибка - провайдер не подключается
+	ProblemObjRouting  = "routing"  // правило маршрутизации
+	ProblemObjProfile  = "profile"  // профиль docker контейнера (ID - номер профиля). Ошибка - каналы с профилем не запускаются
+	ProblemObjFile     = "file"     // файл настроек (автономный режим)
+)
+
+// SettingsProblem проблема, найденная при проверке настроек
+type SettingsProblem struct {
+	Severity string `json:"Severity"`           // важность ("error" | "warning")
+	Object   string `json:"Object"`             // объект настроек ("chief" | "channel" | "provider" | "routing" | "file")
+	ObjectID int    `json:"ObjectID"`           // идентификатор канала / провайдера, номер правила маршрутизации
+	DataType string `json:"DataType,omitempty"` // тип провайдера (идентификаторы провайдеров уникальны в пределах типа)
+	Field    string `json:"Field"`              // поле настроек
+	Message  string `json:"Message"`            // описание проблемы
+}
+
+func (sp SettingsProblem) String() string {
+	retValue := sp.Object
+	if sp.DataType != "" {
+		retValue += " " + sp.DataType
+	}
+	if sp.Object != ProblemObjChief && sp.Object != ProblemObjFile {
+		retValue += fmt.Sprintf(" %d", sp.ObjectID)
+	}
+	if sp.Field != "" {
+		retValue += " (" + sp.Field + ")"
+	}
+	return retValue + ": " + sp.Message
+}
+
+// SettingsProblems список проблем в настройках
+type SettingsProblems []SettingsProblem
+
+func (sps *SettingsProblems) add(severity string, object string, objectID int, field string, format string, args ...interface{}) {
+	*sps = append(*sps, SettingsProblem{
+		Severity: severity,
+		Object:   object,
+		ObjectID: objectID,
+		Field:    field,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// проблема в настройках провайдера
+func (sps *SettingsProblems) addProvider(severity string, provSett ProviderSettings, field string, format string, args ...interface{}) {
+	sps.add(severity, ProblemObjProvider, provSett.ID, field, format, args...)
+	(*sps)[len(*sps)-1].DataType = provSett.DataType
+}
+
+// HasFatal признак наличия ошибок, при которых настройки не могут быть применены
+func (sps SettingsProblems) HasFatal() bool {
+	for _, val := range sps {
+		if val.Severity == ProblemError && (val.Object == ProblemObjChief || val.Object == ProblemObjFile) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasErrors признак наличия ошибок (не только предупреждений)
+func (sps SettingsProblems) HasErrors() bool {
+	for _, val := range sps {
+		if val.Severity == ProblemError {
+			return true
+		}
+	}
+	return false
+}
+
+// идентификаторы объектов заданного типа с ошибками (ключ - тип провайдера и идентификатор)
+func (sps SettingsProblems) invalidIDs(object string) map[string]struct{} {
+	retValue := make(map[string]struct{})
+	for _, val := range sps {
+		if val.Severity == ProblemError && val.Object == object {
+			retValue[objectKey(val.DataType, val.ObjectID)] = struct{}{}
+		}
+	}
+	return retValue
+}
+
+// ключ объекта настроек (тип провайдера пуст для остальных объектов)
+func objectKey(dataType string, id int) string {
+	return fmt.Sprintf("%s_%d", dataType, id)
+}
+
+// Validate проверка настроек контроллера. knownVersions - доступные версии приложения (docker образа) FMTP канала
+// (nil - версии не проверяются). Возвращает список найденных проблем (пусто - настройки корректны).
+func (s *ChiefSettings) Validate(knownVersions []string) SettingsProblems {
+	var retValue SettingsProblems
+
+	// порты контроллера
+	chiefPorts := make(map[int]string)
+	checkChiefPort := func(field string, port int, required bool) {
+		if port == 0 && !required {
+			return
+		}
+		if port <= 0 || port > 65535 {
+			retValue.add(ProblemError, ProblemObjChief, 0, field, "Некорректный порт: %d.", port)
+			return
+		}
+		if other, ok := chiefPorts[port]; ok {
+			retValue.add(ProblemError, ProblemObjChief, 0, field, "Порт %d совпадает с портом %s.", port, other)
+			return
+		}
+		chiefPorts[port] = field
+	}
+	checkChiefPort("DaemonsPort", s.ChannelsPort, true)
+	checkChiefPort("OldiProviderPort", s.OldiProviderPort, false)
+	checkChiefPort("OldiProviderTcpPort", s.OldiProviderTcpPort, false)
+	checkChiefPort("AodbProviderPort", s.AodbProviderPort, false)
+
+	if s.ProviderTls.Enabled() != (s.ProviderTls.CertFile != "" || s.ProviderTls.KeyFile != "") {
+		retValue.add(ProblemError, ProblemObjChief, 0, "ProviderTls", "Для TLS необходимо задать и сертификат, и закрытый ключ.")
+	}
+
+	profiles := s.validateContainerProfiles(&retValue)
+
+	versions := make(map[string]struct{})
+	for _, val := range knownVersions {
+		versions[val] = struct{}{}
+	}
+
+	channelIDs := make(map[int]struct{})
+	serverPorts := make(map[int]int)   // локальный порт канала-сервера -> ID канала
+	urlPorts := make(map[int]int)      // порт web странички канала -> ID канала
+	remoteAtcs := make(map[string]int) // тип данных + удаленный ATC -> ID канала
+	for _, val := range s.ChannelSetts {
+		if _, ok := channelIDs[val.Id]; ok {
+			retValue.add(ProblemError, ProblemObjChannel, val.Id, "DaemonID", "Повтор идентификатора канала.")
+		}
+		channelIDs[val.Id] = struct{}{}
+
+		// проверка настроек отдельного канала (на копии, т.к. CheckSettings изменяет настройки)
+		chSett := val
+		if err := chSett.CheckSettings(); err != nil {
+			retValue.add(ProblemError, ProblemObjChannel, val.Id, "", "%s", err.Error())
+		}
+		if val.DataType != "" && val.DataType != OLDIProvider && val.DataType != AODBProvider {
+			retValue.add(ProblemError, ProblemObjChannel, val.Id, "DataType", "Некорректный тип данных: \"%s\".", val.DataType)
+		}
+
+		if val.ContainerProfile != "" {
+			if profileOk, ok := profiles[val.ContainerProfile]; !ok {
+				retValue.add(ProblemError, ProblemObjChannel, val.Id, "ContainerProfile", "Профиль контейнера \"%s\" отсутствует в настройках.", val.ContainerProfile)
+			} else if !profileOk {
+				retValue.add(ProblemError, ProblemObjChannel, val.Id, "ContainerProfile", "Профиль контейнера \"%s\" содержит ошибки.", val.ContainerProfile)
+			} else if val.Runner == ch_set.RunnerProcess || val.Runner == ch_set.RunnerInProcess {
+				retValue.add(ProblemWarning, ProblemObjChannel, val.Id, "ContainerProfile", "Профиль контейнера не используется при способе запуска \"%s\".", val.Runner)
+			}
+		}
+
+		// канал в процессе контроллера не использует приложение / docker образ FMTP канала
+		if knownVersions != nil && val.Runner != ch_set.RunnerInProcess {
+			if _, ok := versions[val.Version]; !ok {
+				retValue.add(ProblemError, ProblemObjChannel, val.Id, "Version", "Версия \"%s\" отсутствует среди доступных версий приложения FMTP канал.", val.Version)
+			}
+		}
+
+		if val.NetRole == ch_set.TcpServerText {
+			if otherID, ok := serverPorts[val.LocalPort]; ok {
+				retValue.add(ProblemError, ProblemObjChannel, val.Id, "LocalPort", "Локальный порт %d используется каналом %d.", val.LocalPort, otherID)
+			} else {
+				serverPorts[val.LocalPort] = val.Id
+			}
+			if field, ok := chiefPorts[val.LocalPort]; ok {
+				retValue.add(ProblemError, ProblemObjChannel, val.Id, "LocalPort", "Локальный порт %d совпадает с портом контроллера %s.", val.LocalPort, field)
+			}
+		}
+
+		// порт web странички канала назначается контроллером по идентификатору канала
+		urlPort := utils.FmtpChannelStartWebPort + val.Id
+		if field, ok := chiefPorts[urlPort]; ok {
+			retValue.add(ProblemError, ProblemObjChannel, val.Id, "URLPort", "Порт web странички канала %d совпадает с портом контроллера %s.", urlPort, field)
+		}
+		urlPorts[urlPort] = val.Id
+
+		atcKey := val.DataType + "_" + val.RemoteATC
+		if otherID, ok := remoteAtcs[atcKey]; ok {
+			retValue.add(ProblemWarning, ProblemObjChannel, val.Id, "RemoteATC",
+				"Удаленный ATC %s совпадает с каналом %d. Без правил маршрутизации канал %d используется как резервный.", val.RemoteATC, otherID, val.Id)
+		} else {
+			remoteAtcs[atcKey] = val.Id
+		}
+	}
+
+	// пересечение портов web страничек каналов с локальными портами каналов
+	for port, chID := range serverPorts {
+		if urlChID, ok := urlPorts[port]; ok {
+			retValue.add(ProblemError, ProblemObjChannel, chID, "LocalPort", "Локальный порт %d совпадает с портом web странички канала %d.", port, urlChID)
+		}
+	}
+
+	providerIDs := make(map[string]struct{})
+	for _, val := range s.ProvidersSetts {
+		key := objectKey(val.DataType, val.ID)
+		if _, ok := providerIDs[key]; ok {
+			retValue.addProvider(ProblemError, val, "ProviderID", "Повтор идентификатора провайдера %s.", val.DataType)
+		}
+		providerIDs[key] = struct{}{}
+
+		if val.DataType != OLDIProvider && val.DataType != AODBProvider {
+			retValue.addProvider(ProblemError, val, "ProviderType", "Некорректный тип провайдера: \"%s\".", val.DataType)
+		}
+		if val.ProviderTransport() == ProviderTransportTcp && val.DataType != OLDIProvider {
+			retValue.addProvider(ProblemError, val, "ProviderTransport", "Подключение по TCP поддерживается только для провайдеров OLDI.")
+		}
+		if len(val.IPAddresses) == 0 {
+			retValue.addProvider(ProblemWarning, val, "ProviderIPs", "Не заданы адреса провайдера. Подключение провайдера будет отклонено.")
+		}
+		for _, ipVal := range val.IPAddresses {
+			if net.ParseIP(ipVal) == nil {
+				retValue.addProvider(ProblemError, val, "ProviderIPs", "Некорректный адрес провайдера: \"%s\".", ipVal)
+			}
+		}
+	}
+
+	for idx, val := range s.RoutingRules {
+		if len(val.Channels) == 0 {
+			retValue.add(ProblemWarning, ProblemObjRouting, idx+1, "Channels", "Не заданы каналы правила.")
+		}
+		for _, chID := range val.Channels {
+			if _, ok := channelIDs[chID]; !ok {
+				retValue.add(ProblemWarning, ProblemObjRouting, idx+1, "Channels", "Канал %d отсутствует в настройках.", chID)
+			}
+		}
+	}
+	return retValue
+}
+
+// допустимые имена меток, переменных окружения и сетей docker
+var (
+	labelKeyRegexp    = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]*$`)
+	envNameRegexp     = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	networkNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// минимальное ограничение памяти docker контейнера, МБ
+const minContainerMemoryMB = 6
+
+// проверка профилей docker контейнеров. Возвращает имена профилей с признаком корректности
+func (s *ChiefSettings) validateContainerProfiles(problems *SettingsProblems) map[string]bool {
+	retValue := make(map[string]bool)
+
+	for idx, val := range s.ContainerProfiles {
+		profileID := idx + 1
+		before := len(*problems)
+		addErr := func(field string, format string, args ...interface{}) {
+			problems.add(ProblemError, ProblemObjProfile, profileID, field, format, args...)
+		}
+
+		if val.Name == "" {
+			addErr("Name", "Не задано имя профиля.")
+		} else if _, ok := retValue[val.Name]; ok {
+			addErr("Name", "Повтор имени профиля \"%s\".", val.Name)
+		}
+		if val.Cpus < 0 {
+			addErr("Cpus", "Некорректное ограничение кол-ва процессоров: %v.", val.Cpus)
+		}
+		if val.CPUCount < 0 {
+			addErr("CPUCount", "Некорректное кол-во процессоров: %d.", val.CPUCount)
+		}
+		if val.CPUPercent < 0 || val.CPUPercent > 100 {
+			addErr("CPUPercent", "Некорректная доля процессора: %d%%.", val.CPUPercent)
+		}
+		if val.MemoryMB < 0 || (val.MemoryMB > 0 && val.MemoryMB < minContainerMemoryMB) {
+			addErr("MemoryMB", "Некорректное ограничение памяти: %d МБ (минимум %d МБ).", val.MemoryMB, minContainerMemoryMB)
+		}
+
+		switch netMode := val.EffectiveNetworkMode(); {
+		case netMode == "none":
+			addErr("NetworkMode", "Канал без сети не может подключиться к контроллеру.")
+		case netMode == ch_set.DefaultNetworkMode:
+		case strings.HasPrefix(netMode, "container:") || networkNameRegexp.MatchString(netMode):
+			problems.add(ProblemWarning, ProblemObjProfile, profileID, "NetworkMode",
+				"Канал подключается к контроллеру по адресу 127.0.0.1. В режиме сети \"%s\" порт контроллера должен быть доступен в сети контейнера.", netMode)
+		default:
+			addErr("NetworkMode", "Некорректный режим сети: \"%s\".", netMode)
+		}
+
+		if val.ContainerName != "" && !strings.Contains(val.ContainerName, "{id}") {
+			addErr("ContainerName", "Шаблон имени контейнера должен содержать {id}.")
+		}
+		for key := range val.Labels {
+			if !labelKeyRegexp.MatchString(key) {
+				addErr("Labels", "Некорректное имя метки: \"%s\".", key)
+			} else if strings.HasPrefix(key, ch_set.ReservedLabelPrefix) {
+				addErr("Labels", "Метки с префиксом \"%s\" устанавливаются контроллером: \"%s\".", ch_set.ReservedLabelPrefix, key)
+			}
+		}
+		for _, env := range val.Env {
+			if envName := strings.SplitN(env, "=", 2)[0]; !strings.Contains(env, "=") || !envNameRegexp.MatchString(envName) {
+				addErr("Env", "Некорректная переменная окружения: \"%s\" (ожидается ИМЯ=значение).", envName)
+			}
+		}
+		if val.LogDriver == "" && len(val.LogOptions) > 0 {
+			problems.add(ProblemWarning, ProblemObjProfile, profileID, "LogOptions", "Параметры журнала не используются без драйвера журнала.")
+		}
+
+		if val.Name != "" {
+			if _, ok := retValue[val.Name]; !ok {
+				retValue[val.Name] = !(*problems)[before:].HasErrors()
+			}
+		}
+	}
+
+	if s.DefaultContainerProfile != "" {
+		if profileOk, ok := retValue[s.DefaultContainerProfile]; !ok {
+			problems.add(ProblemError, ProblemObjChief, 0, "DefaultContainerProfile", "Профиль контейнера \"%s\" отсутствует в настройках.", s.DefaultContainerProfile)
+		} else if !profileOk {
+			problems.add(ProblemError, ProblemObjChief, 0, "DefaultContainerProfile", "Профиль контейнера \"%s\" содержит ошибки.", s.DefaultContainerProfile)
+		}
+	}
+	return retValue
+}
+
+// WithoutInvalid настройки без каналов и провайдеров, в которых найдены ошибки
+func (s ChiefSettings) WithoutInvalid(problems SettingsProblems) ChiefSettings {
+	invalidChannels := problems.invalidIDs(ProblemObjChannel)
+	invalidProviders := problems.invalidIDs(ProblemObjProvider)
+
+	retValue := s
+	retValue.ChannelSetts = make([]ch_set.ChannelSettings, 0, len(s.ChannelSetts))
+	for _, val := range s.ChannelSetts {
+		if _, ok := invalidChannels[objectKey("", val.Id)]; !ok {
+			retValue.ChannelSetts = append(retValue.ChannelSetts, val)
+		}
+	}
+	retValue.ProvidersSetts = make([]ProviderSettings, 0, len(s.ProvidersSetts))
+	for _, val := range s.ProvidersSetts {
+		if _, ok := invalidProviders[objectKey(val.DataType, val.ID)]; !ok {
+			retValue.ProvidersSetts = append(retValue.ProvidersSetts, val)
+		}
+	}
+	return retValue
+}
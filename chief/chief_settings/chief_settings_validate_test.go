@@ -0,0 +1,90 @@
+package chief_settings
+
+import (
+	"testing"
+)
+
+// settings with valid chief ports and the given providers
+func providerSettings(provs ...ProviderSettings) ChiefSettings {
+	return ChiefSettings{ChannelsPort: 13100, ProvidersSetts: provs}
+}
+
+func TestValidateProviders(t *testing.T) {
+	oldi := ProviderSettings{ID: 1, DataType: OLDIProvider, IPAddresses: []string{"10.0.0.1"}}
+	aodb := ProviderSettings{ID: 1, DataType: AODBProvider, IPAddresses: []string{"10.0.0.2"}}
+
+	badAddr := oldi
+	badAddr.ID = 2
+	badAddr.IPAddresses = []string{"10.0.0.300", "provider.local"}
+
+	noAddr := aodb
+	noAddr.ID = 3
+	noAddr.IPAddresses = nil
+
+	badType := oldi
+	badType.ID = 4
+	badType.DataType = "FPL"
+
+	cases := []struct {
+		name     string
+		provs    []ProviderSettings
+		errors   int
+		warnings int
+	}{
+		{"same id of different types", []ProviderSettings{oldi, aodb}, 0, 0},
+		{"duplicate id", []ProviderSettings{oldi, aodb, oldi}, 1, 0},
+		{"bad addresses", []ProviderSettings{badAddr}, 2, 0},
+		{"no addresses", []ProviderSettings{noAddr}, 0, 1},
+		{"bad type", []ProviderSettings{badType}, 1, 0},
+	}
+
+	for _, val := range cases {
+		setts := providerSettings(val.provs...)
+		var errors, warnings int
+		for _, problem := range setts.Validate(nil) {
+			if problem.Object != ProblemObjProvider {
+				t.Fatalf("%s: unexpected problem %s", val.name, problem)
+			}
+			if problem.Severity == ProblemError {
+				errors++
+			} else {
+				warnings++
+			}
+		}
+		if errors != val.errors || warnings != val.warnings {
+			t.Fatalf("%s: %d errors %d warnings, want %d %d", val.name, errors, warnings, val.errors, val.warnings)
+		}
+	}
+}
+
+func TestWithoutInvalidProviders(t *testing.T) {
+	oldi := ProviderSettings{ID: 1, DataType: OLDIProvider, IPAddresses: []string{"bad address"}}
+	aodb := ProviderSettings{ID: 1, DataType: AODBProvider, IPAddresses: []string{"10.0.0.2"}}
+	other := ProviderSettings{ID: 2, DataType: OLDIProvider, IPAddresses: []string{"10.0.0.3"}}
+
+	setts := providerSettings(oldi, aodb, other)
+	problems := setts.Validate(nil)
+	if !problems.HasErrors() || problems.HasFatal() {
+		t.Fatalf("problems %v: want provider error only", problems)
+	}
+	if problems[0].DataType != OLDIProvider {
+		t.Fatalf("problem data type %q, want %q", problems[0].DataType, OLDIProvider)
+	}
+
+	// partial apply: only the OLDI provider with the bad address is dropped
+	applied := setts.WithoutInvalid(problems)
+	if len(applied.ProvidersSetts) != 2 {
+		t.Fatalf("%d providers applied, want 2", len(applied.ProvidersSetts))
+	}
+	for _, val := range applied.ProvidersSetts {
+		if val.DataType == OLDIProvider && val.ID == 1 {
+			t.Fatalf("invalid provider applied")
+		}
+	}
+
+	// duplicate id drops both providers of the type
+	setts = providerSettings(other, other, aodb)
+	if applied = setts.WithoutInvalid(setts.Validate(nil)); len(applied.ProvidersSetts) != 1 || applied.ProvidersSetts[0].DataType != AODBProvider {
+		t.Fatalf("providers applied %v, want AODB only", applied.ProvidersSetts)
+	}
+}
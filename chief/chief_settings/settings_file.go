@@ -0,0 +1,92 @@
+package chief_settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SettingsFilePath путь к файлу настроек контроллера по умолчанию
+func SettingsFilePath() string {
+	return chiefSettingsFile
+}
+
+// ReadSettingsFile чтение настроек из локального файла (JSON или YAML - по расширению .yaml/.yml).
+// Неизвестные поля считаются ошибкой, чтобы опечатки в файле не приводили к молчаливому использованию значений по умолчанию.
+// Секреты могут быть заданы в зашифрованном виде ("enc:...").
+func ReadSettingsFile(path string) (ChiefSettings, error) {
+	var retValue ChiefSettings
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return retValue, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if data, err = yamlToJson(data); err != nil {
+			return retValue, fmt.Errorf("Ошибка разбора YAML. %v", err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&retValue); err != nil {
+		return retValue, fmt.Errorf("Ошибка разбора настроек. %v", err)
+	}
+	if err = retValue.DecryptSecrets(); err != nil {
+		return retValue, err
+	}
+	return retValue, nil
+}
+
+// преобразование YAML в JSON, чтобы использовать json теги структур настроек
+func yamlToJson(data []byte) ([]byte, error) {
+	var yamlData interface{}
+	if err := yaml.Unmarshal(data, &yamlData); err != nil {
+		return nil, err
+	}
+
+	jsonData, err := convertYamlValue(yamlData)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonData)
+}
+
+// yaml.v2 разбирает объекты в map[interface{}]interface{}, которые не сериализуются в JSON
+func convertYamlValue(val interface{}) (interface{}, error) {
+	switch typedVal := val.(type) {
+	case map[interface{}]interface{}:
+		retValue := make(map[string]interface{}, len(typedVal))
+		for key, mapVal := range typedVal {
+			strKey, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("Ключ %v не является строкой.", key)
+			}
+			convVal, err := convertYamlValue(mapVal)
+			if err != nil {
+				return nil, err
+			}
+			retValue[strKey] = convVal
+		}
+		return retValue, nil
+
+	case []interface{}:
+		retValue := make([]interface{}, len(typedVal))
+		for idx, sliceVal := range typedVal {
+			convVal, err := convertYamlValue(sliceVal)
+			if err != nil {
+				return nil, err
+			}
+			retValue[idx] = convVal
+		}
+		return retValue, nil
+	}
+	return val, nil
+}
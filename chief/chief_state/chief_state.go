@@ -1,6 +1,7 @@
 package chief_state
 
 import (
+	"fmtp/channel/channel_settings"
 	"fmtp/channel/channel_state"
 	"fmtp/chief/chief_settings"
 )
@@ -23,49 +24,86 @@ type LoggerState struct {
 type ProviderState struct {
 	ProviderID           int      `json:"ProviderID"`           // идентификатор провайдера
 	ProviderType         string   `json:"ProviderType"`         // тип провайдера (OLID | AODB)
+	ProviderTransport    string   `json:"ProviderTransport"`    // способ подключения провайдера (grpc | tcp)
 	ProviderIPs          []string `json:"ProviderIPs"`          // список сетевых адресов провайдеров
 	ProviderState        string   `json:"ProviderState"`        // состояние провайдера
 	ProviderErrorMessage string   `json:"ProviderErrorMessage"` // текст ошибки
+	Backlog              int      `json:"Backlog"`              // кол-во сообщений в очереди на отправку провайдеру
 	ClientAddresses      string   `json:"-"`                    // адреса подключенных клиентов
 	ProviderURL          string   `json:"-"`                    // URL web странички провайдера
 	StateColor           string   `json:"-"`
 }
 
 type ChiefState struct {
-	CntrlID            int                          `json:"ControllerID"` // идентификатор контроллера
-	IPAddr             string                       `json:"ControllerIP"` // IP адрес контроллера
-	CommonState        string                       `json:"CommonState"`
-	CommonErrorMessage string                       `json:"CommonErrorMessage"`
-	ControllerVersion  string                       `json:"ControllerVersion"`
-	DockerVersion      string                       `json:"DockerVersion"`  // версия docker-engine
-	ChannelStates      []channel_state.ChannelState `json:"DaemonStates"`   // состояние FMTP каналов
-	ProviderStates     []ProviderState              `json:"ProviderStates"` // состояние провайдеров
+	CntrlID            int                             `json:"ControllerID"` // идентификатор контроллера
+	IPAddr             string                          `json:"ControllerIP"` // IP адрес контроллера
+	CommonState        string                          `json:"CommonState"`
+	CommonErrorMessage string                          `json:"CommonErrorMessage"`
+	ControllerVersion  string                          `json:"ControllerVersion"`
+	DockerVersion      string                          `json:"DockerVersion"`    // версия docker-engine
+	ChannelStates      []channel_state.ChannelState    `json:"DaemonStates"`     // состояние FMTP каналов
+	ProviderStates     []ProviderState                 `json:"ProviderStates"`   // состояние провайдеров
+	SettingsSource     string                          `json:"SettingsSource"`   // источник текущих настроек
+	SettingsProblems   chief_settings.SettingsProblems `json:"SettingsProblems"` // проблемы, найденные при загрузке / проверке настроек
+	Role               string                          `json:"Role"`             // роль контроллера в паре ("single" | "leader" | "standby")
+	NodeID             string                          `json:"NodeID"`           // имя экземпляра контроллера в паре
+	LeaderNode         string                          `json:"LeaderNode"`       // имя ведущего экземпляра пары (пусто - неизвестен)
+
+	ContainerProfiles       []channel_settings.ContainerProfile `json:"-"` // профили docker контейнеров каналов
+	DefaultContainerProfile string                              `json:"-"` // имя профиля по умолчанию
+}
+
+// источник настроек контроллера
+const (
+	SettingsFromConfigurator = "configurator" // получены от конфигуратора
+	SettingsFromFile         = "file"         // считаны из сохраненного файла (конфигуратор недоступен)
+	SettingsFromStandalone   = "standalone"   // локальный файл настроек (автономный режим)
+)
+
+// SetSettingsState источник настроек и проблемы, найденные при загрузке / проверке настроек
+func SetSettingsState(source string, problems chief_settings.SettingsProblems) {
+	CommonChiefState.SettingsSource = source
+	CommonChiefState.SettingsProblems = problems
+}
+
+// SetRole роль контроллера в паре
+func SetRole(role string, nodeID string, leaderNode string) {
+	CommonChiefState.Role = role
+	CommonChiefState.NodeID = nodeID
+	CommonChiefState.LeaderNode = leaderNode
+}
+
+// SetContainerProfiles профили docker контейнеров каналов
+func SetContainerProfiles(profiles []channel_settings.ContainerProfile, defaultProfile string) {
+	CommonChiefState.ContainerProfiles = profiles
+	CommonChiefState.DefaultContainerProfile = defaultProfile
 }
 
 func SetDockerVersion(dockerVers string) {
 	CommonChiefState.DockerVersion = dockerVers
 }
 
-func SetAodbProviderState(aodbState []ProviderState) {
-	var resStates []ProviderState
-	for _, val := range CommonChiefState.ProviderStates {
-		if val.ProviderType == chief_settings.OLDIProvider {
-			resStates = append(resStates, val)
-		}
-	}
-	resStates = append(resStates, aodbState...)
-	CommonChiefState.ProviderStates = resStates
-	checkCommonState()
+// SetGrpcProviderState состояния провайдеров типа providerType, подключаемых по GRPC
+func SetGrpcProviderState(providerType string, states []ProviderState) {
+	setProviderStates(providerType, chief_settings.ProviderTransportGrpc, states)
 }
 
-func SetOldiProviderState(oldiState []ProviderState) {
+func SetOldiTcpProviderState(oldiState []ProviderState) {
+	setProviderStates(chief_settings.OLDIProvider, chief_settings.ProviderTransportTcp, oldiState)
+}
+
+// замена состояний провайдеров заданного типа и способа подключения
+func setProviderStates(providerType string, transport string, states []ProviderState) {
 	var resStates []ProviderState
 	for _, val := range CommonChiefState.ProviderStates {
-		if val.ProviderType == chief_settings.AODBProvider {
+		if val.ProviderType != providerType || val.ProviderTransport != transport {
 			resStates = append(resStates, val)
 		}
 	}
-	resStates = append(resStates, oldiState...)
+	for _, val := range states {
+		val.ProviderTransport = transport
+		resStates = append(resStates, val)
+	}
 	CommonChiefState.ProviderStates = resStates
 	checkCommonState()
 }
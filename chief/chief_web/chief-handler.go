@@ -41,6 +41,14 @@ func InitChiefChannelsHandler(handleURL string, title string) {
 }
 
 func (cw *ChiefHandler) handlerMain(w http.ResponseWriter, r *http.Request) {
+	srv.chiefPage.SettingsSource = chief_state.CommonChiefState.SettingsSource
+	srv.chiefPage.SettingsProblems = chief_state.CommonChiefState.SettingsProblems
+	srv.chiefPage.Role = chief_state.CommonChiefState.Role
+	srv.chiefPage.NodeID = chief_state.CommonChiefState.NodeID
+	srv.chiefPage.LeaderNode = chief_state.CommonChiefState.LeaderNode
+	srv.chiefPage.ContainerProfiles = chief_state.CommonChiefState.ContainerProfiles
+	srv.chiefPage.DefaultContainerProfile = chief_state.CommonChiefState.DefaultContainerProfile
+
 	srv.chiefPage.ChannelStates = srv.chiefPage.ChannelStates[:0]
 
 	for _, val := range chief_state.CommonChiefState.ChannelStates {
@@ -49,7 +57,7 @@ func (cw *ChiefHandler) handlerMain(w http.ResponseWriter, r *http.Request) {
 		switch val.DaemonState {
 		case channel_state.ChannelStateStopped:
 			channel_st.StateColor = StopColor
-		case channel_state.ChannelStateError:
+		case channel_state.ChannelStateError, channel_state.ChannelStateFailed:
 			channel_st.StateColor = ErrorColor
 		case channel_state.ChannelStateOk:
 			channel_st.StateColor = OkColor
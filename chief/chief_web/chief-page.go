@@ -1,9 +1,12 @@
 package chief_web
 
 import (
+	"fmtp/channel/channel_settings"
 	"fmtp/channel/channel_state"
+	"fmtp/chief/chief_settings"
 	"fmtp/chief/chief_state"
 	"html/template"
+	"strings"
 	"sync"
 )
 
@@ -13,6 +16,15 @@ type ChiefPage struct {
 	templ *template.Template
 	Title string
 
+	SettingsSource   string                          // источник настроек
+	Role             string                          // роль контроллера в паре
+	NodeID           string                          // имя экземпляра контроллера
+	LeaderNode       string                          // имя ведущего экземпляра пары
+	SettingsProblems chief_settings.SettingsProblems // проблемы в настройках
+
+	ContainerProfiles       []channel_settings.ContainerProfile // профили docker контейнеров каналов
+	DefaultContainerProfile string                              // имя профиля по умолчанию
+
 	ChannelStates      []channel_state.ChannelState
 	OldiProviderStates []chief_state.ProviderState
 	AodbProviderStates []chief_state.ProviderState
@@ -23,7 +35,9 @@ func (m *ChiefPage) initialize(title string) {
 	defer m.Unlock()
 
 	var err error
-	if m.templ, err = template.New("ChiefTemplate").Parse(ChiefPageTemplate); err != nil {
+	// значения переменных окружения профилей не выводятся (могут содержать секреты)
+	funcs := template.FuncMap{"envName": func(env string) string { return strings.SplitN(env, "=", 2)[0] }}
+	if m.templ, err = template.New("ChiefTemplate").Funcs(funcs).Parse(ChiefPageTemplate); err != nil {
 		return
 	}
 
@@ -46,7 +60,33 @@ var ChiefPageTemplate = `{{define "ChiefTemplate"}}
 	</head>
 	<body style="background-color:#EAECEE;">
 		<font size="4" face="verdana" color="black">
-		
+
+			<p>Источник настроек: {{.SettingsSource}}</p>
+			<p>Роль контроллера: {{.Role}}{{if ne .Role "single"}} (экземпляр: {{.NodeID}}, ведущий: {{if .LeaderNode}}{{.LeaderNode}}{{else}}неизвестен{{end}}){{end}}</p>
+			{{if .SettingsProblems}}
+			<table width="100%" border="1" cellspacing="0" cellpadding="4" >
+				<caption style="font-weight:bold">Проблемы в настройках</caption>
+				<tr>
+					<th>Важность</th>
+					<th>Объект</th>
+					<th>ID</th>
+					<th>Поле</th>
+					<th>Описание</th>
+				</tr>
+				{{range .SettingsProblems}}
+					<tr align="left" bgcolor="{{if eq .Severity "error"}}#F2C4CA{{else}}#F4EDBA{{end}}">
+						<td> {{.Severity}} </td>
+						<td> {{.Object}}{{if .DataType}} {{.DataType}}{{end}} </td>
+						<td> {{.ObjectID}} </td>
+						<td> {{.Field}} </td>
+						<td> {{.Message}} </td>
+					</tr>
+				{{end}}
+			</table>
+
+			<b>   </br>
+			{{end}}
+
 			<table width="100%" border="1" cellspacing="0" cellpadding="4" >
 				<caption style="font-weight:bold">FMTP каналы</caption>
 				<tr>
@@ -55,7 +95,10 @@ var ChiefPageTemplate = `{{define "ChiefTemplate"}}
 					<th>FMTP остояния</th>
 					<th>Лок ATC</th>
 					<th>Уд ATC</th>
-					<th>URL</th>			
+					<th>URL</th>
+					<th>Запуск</th>
+					<th>Перезапуски</th>
+					<th>Последнее завершение</th>
 				</tr>
 				{{with .ChannelStates}}
 					{{range .}}
@@ -65,12 +108,47 @@ var ChiefPageTemplate = `{{define "ChiefTemplate"}}
 							<td align="left"> {{.FmtpState}} </td>							
 							<td align="left"> {{.LocalName}} </td>
 							<td align="left"> {{.RemoteName}} </td>
-							<td align="left"> <a href="{{.ChannelURL}}" style="display:block;">{{.ChannelURL}}</a> </td>					
+							<td align="left"> <a href="{{.ChannelURL}}" style="display:block;">{{.ChannelURL}}</a> </td>
+							<td align="left"> {{.Runner}}{{if .ContainerProfile}} ({{.ContainerProfile}}){{end}} </td>
+							<td align="left"> {{.RestartCount}} </td>
+							<td align="left" title="{{.OutputTail}}"> {{if .LastExit}}<a href="/crashReport#channel_{{.ChannelID}}">{{.LastExitTime}} {{.LastExit}}</a>{{end}} </td>
 						</tr>
 					{{end}}
 				{{end}}
 			</table>
 
+			{{if .ContainerProfiles}}
+			<b>   </br>
+
+			<table width="100%" border="1" cellspacing="0" cellpadding="4" >
+				<caption style="font-weight:bold">Профили docker контейнеров (по умолчанию: {{if .DefaultContainerProfile}}{{.DefaultContainerProfile}}{{else}}встроенный{{end}})</caption>
+				<tr>
+					<th>Имя</th>
+					<th>CPU</th>
+					<th>Память, МБ</th>
+					<th>Сеть</th>
+					<th>Имя контейнера</th>
+					<th>Метки</th>
+					<th>Env</th>
+					<th>Журнал</th>
+					<th>Только чтение</th>
+				</tr>
+				{{range .ContainerProfiles}}
+					<tr align="left">
+						<td> {{.Name}} </td>
+						<td> {{if .Cpus}}{{.Cpus}}{{else}}-{{end}} </td>
+						<td> {{if .MemoryMB}}{{.MemoryMB}}{{else}}-{{end}} </td>
+						<td> {{.EffectiveNetworkMode}} </td>
+						<td> {{.ContainerName}} </td>
+						<td> {{range $key, $val := .Labels}}{{$key}}={{$val}} {{end}} </td>
+						<td> {{range .Env}}{{envName .}} {{end}} </td>
+						<td> {{.LogDriver}} {{range $key, $val := .LogOptions}}{{$key}}={{$val}} {{end}} </td>
+						<td> {{if .ReadonlyRootfs}}да{{else}}нет{{end}} </td>
+					</tr>
+				{{end}}
+			</table>
+			{{end}}
+
 			<b>   </br>
 			<b>   </br>
 			<b>   </br>
@@ -80,6 +158,7 @@ var ChiefPageTemplate = `{{define "ChiefTemplate"}}
 				<tr>
 					<th>ID</th>
 					<th>Состояние</th>
+					<th>Очередь</th>
 					<th>Список клиентов</th>			
 				</tr>
 				{{with .AodbProviderStates}}
@@ -87,6 +166,7 @@ var ChiefPageTemplate = `{{define "ChiefTemplate"}}
 						<tr align="center" bgcolor="{{.StateColor}}">	
 							<td align="left"> {{.ProviderID}} </td>
 							<td align="left"> {{.ProviderState}} </td>
+							<td align="left"> {{.Backlog}} </td>
 							<td align="left"> {{.ClientAddresses}} </td>				
 						</tr>
 					{{end}}
@@ -102,6 +182,7 @@ var ChiefPageTemplate = `{{define "ChiefTemplate"}}
 				<tr>
 					<th>ID</th>
 					<th>Состояние</th>
+					<th>Очередь</th>
 					<th>Список клиентов</th>		
 				</tr>
 				{{with .OldiProviderStates}}
@@ -109,6 +190,7 @@ var ChiefPageTemplate = `{{define "ChiefTemplate"}}
 						<tr align="center" bgcolor="{{.StateColor}}">	
 							<td align="left"> {{.ProviderID}} </td>
 							<td align="left"> {{.ProviderState}} </td>	
+							<td align="left"> {{.Backlog}} </td>
 							<td align="left"> {{.ClientAddresses}} </td>			
 						</tr>
 					{{end}}
@@ -0,0 +1,53 @@
+package chief_web
+
+import (
+	"fmtp/chief/chief_state"
+	"net/http"
+	"sort"
+
+	"lemz.com/fdps/logger"
+)
+
+// CrashReportHandler обработчик страницы отчета о нештатных завершениях каналов
+type CrashReportHandler struct {
+	handleURL string
+	title     string
+}
+
+var CrashHdl CrashReportHandler
+
+func (ch CrashReportHandler) Path() string {
+	return ch.handleURL
+}
+
+func (ch CrashReportHandler) Caption() string {
+	return ch.title
+}
+
+func (ch CrashReportHandler) HttpHandler() func(http.ResponseWriter, *http.Request) {
+	return ch.handlerMain
+}
+
+func InitCrashReportHandler(handleURL string, title string) {
+	CrashHdl.handleURL = "/" + handleURL
+	CrashHdl.title = title
+}
+
+func (ch *CrashReportHandler) handlerMain(w http.ResponseWriter, r *http.Request) {
+	srv.crashPage.Lock()
+	defer srv.crashPage.Unlock()
+
+	srv.crashPage.ChannelStates = srv.crashPage.ChannelStates[:0]
+	for _, val := range chief_state.CommonChiefState.ChannelStates {
+		if val.LastExit != "" {
+			srv.crashPage.ChannelStates = append(srv.crashPage.ChannelStates, val)
+		}
+	}
+	sort.Slice(srv.crashPage.ChannelStates, func(i, j int) bool {
+		return srv.crashPage.ChannelStates[i].ChannelID < srv.crashPage.ChannelStates[j].ChannelID
+	})
+
+	if err := srv.crashPage.templ.ExecuteTemplate(w, "CrashTemplate", srv.crashPage); err != nil {
+		logger.PrintfErr("Ошибка формирования страницы отчета о нештатных завершениях каналов. Ошибка: %v", err)
+	}
+}
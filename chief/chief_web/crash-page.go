@@ -0,0 +1,60 @@
+package chief_web
+
+import (
+	"fmtp/channel/channel_state"
+	"html/template"
+	"sync"
+
+	logger "lemz.com/fdps/logger"
+)
+
+// путь страницы отчета о нештатных завершениях каналов
+const crashReportPath = "crashReport"
+
+// CrashPage страница отчета о нештатных завершениях каналов (последние строки вывода канала перед завершением)
+type CrashPage struct {
+	sync.Mutex
+	templ *template.Template
+	Title string
+
+	ChannelStates []channel_state.ChannelState // состояния каналов, имеющих нештатные завершения
+}
+
+func (cp *CrashPage) initialize(title string) {
+	cp.Lock()
+	defer cp.Unlock()
+
+	var err error
+	if cp.templ, err = template.New("CrashTemplate").Parse(CrashPageTemplate); err != nil {
+		logger.PrintfErr("CrashReport template Parse ERROR: %v", err)
+		return
+	}
+	cp.Title = title
+}
+
+var CrashPageTemplate = `{{define "CrashTemplate"}}
+<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<title>{{.Title}}</title>
+	</head>
+	<body style="background-color:#EAECEE;">
+		<font size="4" face="verdana" color="black">
+			<p><a href="/">К состоянию каналов</a></p>
+			{{range .ChannelStates}}
+				<h3 id="channel_{{.ChannelID}}">Канал {{.ChannelID}} ({{.LocalName}} - {{.RemoteName}}, {{.Runner}})</h3>
+				<p>
+					Время завершения: {{.LastExitTime}}</br>
+					{{.LastExit}}</br>
+					Перезапуски: {{.RestartCount}}. Состояние: {{.DaemonState}}
+				</p>
+				<pre style="background-color:#FFFFFF; border:1px solid black; padding:4px; white-space:pre-wrap;">{{if .OutputTail}}{{.OutputTail}}{{else}}Вывод канала отсутствует{{end}}</pre>
+			{{else}}
+				<p>Нештатных завершений каналов нет</p>
+			{{end}}
+		</font>
+	</body>
+</html>
+{{end}}
+`
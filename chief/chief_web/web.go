@@ -16,6 +16,7 @@ type httpServer struct {
 	done       chan struct{}
 	configPage *ConfigPage
 	chiefPage  *ChiefPage
+	crashPage  *CrashPage
 }
 
 var srv httpServer
@@ -34,11 +35,15 @@ func Start(done chan struct{}) {
 		done:       done,
 		configPage: new(ConfigPage),
 		chiefPage:  new(ChiefPage),
+		crashPage:  new(CrashPage),
 	}
 	srv.configPage.initialize("FDPS-FMTP-CHIEF-CONFIG")
 	srv.chiefPage.initialize("FDPS-FMTP-CHIEF")
+	srv.crashPage.initialize("FDPS-FMTP-CHIEF-CRASH")
 	InitChiefChannelsHandler(utils.FmtpChiefWebPath, "CHIEF")
 	utils.AppendHandler(ChiefHdl)
+	InitCrashReportHandler(crashReportPath, "CRASH REPORT")
+	utils.AppendHandler(CrashHdl)
 
 	InitEditConfigHandler(utils.FmtpChiefWebConfigPath, "EDIT CONFIG")
 	utils.AppendHandler(EditConfHandler)
@@ -2,8 +2,11 @@ package chief_worker
 
 import (
 	"fmtp/channel/channel_settings"
+	"fmtp/chief/chief_api"
+	"fmtp/chief/chief_leader"
 	"fmtp/chief/chief_logger"
 	"fmtp/chief/chief_metrics"
+	"fmtp/chief/chief_settings"
 	"fmtp/chief/chief_state"
 	"fmtp/chief/oldi"
 	"fmtp/chief/tky"
@@ -15,27 +18,74 @@ import (
 	"lemz.com/fdps/prom_metrics"
 )
 
-func Start(withDocker bool, dockerVersion string, done chan struct{}, wg *sync.WaitGroup) {
+// Start запуск работы контроллера. standaloneSettingsFile - локальный файл настроек для автономного режима (пусто - настройки от конфигуратора)
+func Start(withDocker bool, dockerVersion string, standaloneSettingsFile string, done chan struct{}, wg *sync.WaitGroup) {
 
 	// клиент для связи с конфигуратором
 	var chiefConfClient *configurator.ChiefConfiguratorClient
 
 	// grpc сервер для подключения OLDI провайдеров
-	var oldiGrpcCntrl = oldi.NewOldiGrpcController()
+	var oldiGrpcCntrl = oldi.NewProviderGrpcController(chief_settings.OLDIProvider)
+
+	// tcp сервер для подключения OLDI провайдеров
+	var oldiTcpCntrl = oldi.NewOldiTcpController()
+
+	// grpc сервер для подключения AODB провайдеров
+	var aodbGrpcCntrl = oldi.NewProviderGrpcController(chief_settings.AODBProvider)
 
 	// контроллер FMTP каналов
 	var channelCntrl = chief_channel.NewChiefChannelServer(done, withDocker)
 
-	chiefConfClient = configurator.NewChiefClient(withDocker)
+	// выбор ведущего контроллера пары
+	var leaderElector = chief_leader.NewLeaderElector(chief_leader.LoadSettings())
+	chiefRole := leaderElector.Role()
+	chief_state.SetRole(chiefRole.Role, chiefRole.NodeID, chiefRole.LeaderNode)
+
+	// резервный контроллер пары не запускает каналы и серверы провайдеров
+	oldiGrpcCntrl.ActiveChan <- chiefRole.IsLeader()
+	aodbGrpcCntrl.ActiveChan <- chiefRole.IsLeader()
+
+	// признак получения настроек (до получения настроек каналы, запущенные до перезапуска контроллера, не останавливаются)
+	settsReceived := false
+
+	// передача настроек каналов и провайдеров TCP с учетом роли контроллера.
+	// До определения роли настройки не передаются: пустые настройки каналов резервного контроллера
+	// остановили бы каналы, запущенные до перезапуска контроллера, еще до результата выбора ведущего
+	sendRoleDependentSetts := func() {
+		if !settsReceived || !chiefRole.Decided {
+			return
+		}
+		chSetts := channel_settings.ChannelSettingsWithPort{
+			ChSettings:              configurator.ChiefCfg.ChannelSetts,
+			ChPort:                  configurator.ChiefCfg.ChannelsPort,
+			ContainerProfiles:       configurator.ChiefCfg.ContainerProfiles,
+			DefaultContainerProfile: configurator.ChiefCfg.DefaultContainerProfile,
+		}
+		tcpSetts := configurator.ChiefCfg.ProviderSettingsByTransport(chief_settings.OLDIProvider, chief_settings.ProviderTransportTcp)
+		if !chiefRole.IsLeader() {
+			chSetts.ChSettings = nil
+			tcpSetts = nil
+		}
+		channelCntrl.ChannelSettsChan <- chSetts
+		oldiTcpCntrl.SettsChan <- tcpSetts
+	}
+
+	chiefConfClient = configurator.NewChiefClient(withDocker, standaloneSettingsFile)
 
 	go chiefConfClient.Work()
 	// отправляем запрос настроек контроллера
 	go chiefConfClient.Start()
 
 	go oldiGrpcCntrl.Work()
+	go oldiTcpCntrl.Work()
+	go aodbGrpcCntrl.Work()
 	go channelCntrl.Work()
 
 	go tky.Work()
+	go leaderElector.Work(done)
+
+	// REST API контроллера
+	chief_api.Start(channelCntrl.CommandChan)
 
 	chief_state.CommonChiefState.ControllerVersion = version.Release
 	chief_state.CommonChiefState.DockerVersion = dockerVersion
@@ -48,12 +98,12 @@ func Start(withDocker bool, dockerVersion string, done chan struct{}, wg *sync.W
 
 		// настройки контроллера изменены
 		case <-chiefConfClient.ChiefSettChangedChan:
-			channelCntrl.ChannelSettsChan <- channel_settings.ChannelSettingsWithPort{
-				ChSettings: configurator.ChiefCfg.ChannelSetts,
-				ChPort:     configurator.ChiefCfg.ChannelsPort,
-			}
+			settsReceived = true
+			sendRoleDependentSetts()
+			chief_state.SetContainerProfiles(configurator.ChiefCfg.ContainerProfiles, configurator.ChiefCfg.DefaultContainerProfile)
 
 			oldiGrpcCntrl.SettsChangedChan <- struct{}{}
+			aodbGrpcCntrl.SettsChangedChan <- struct{}{}
 
 			chief_logger.ChiefLog.SettsChangedChan <- struct{}{}
 
@@ -67,13 +117,49 @@ func Start(withDocker bool, dockerVersion string, done chan struct{}, wg *sync.W
 				CollectLabels:    map[string]string{"host": configurator.ChiefCfg.IPAddr},
 			}
 
+		// изменена роль контроллера в паре
+		case newRole := <-leaderElector.RoleChan:
+			wasLeader := chiefRole.IsLeader()
+			wasDecided := chiefRole.Decided
+			chiefRole = newRole
+			chief_state.SetRole(chiefRole.Role, chiefRole.NodeID, chiefRole.LeaderNode)
+
+			// ведущий запускает каналы и серверы провайдеров, резервный - останавливает
+			if chiefRole.IsLeader() != wasLeader {
+				oldiGrpcCntrl.ActiveChan <- chiefRole.IsLeader()
+				aodbGrpcCntrl.ActiveChan <- chiefRole.IsLeader()
+			}
+			if chiefRole.IsLeader() != wasLeader || chiefRole.Decided != wasDecided {
+				sendRoleDependentSetts()
+			}
+
 		// получены данные от провайдера OLDI
 		case fdpsData := <-oldiGrpcCntrl.FromFdpsChan:
 			channelCntrl.FromFdpsPacketChan <- fdpsData
 
+		// получены данные от провайдера OLDI, подключенного по TCP
+		case fdpsData := <-oldiTcpCntrl.FromFdpsChan:
+			channelCntrl.FromFdpsPacketChan <- fdpsData
+
 		// OLDI пакет от контроллера каналов
 		case oldiData := <-channelCntrl.ToFdpsPacketChan:
-			oldiGrpcCntrl.ToFdpsChan <- oldiData
+			grpcProvs := configurator.ChiefCfg.ProviderSettingsByTransport(chief_settings.OLDIProvider, chief_settings.ProviderTransportGrpc)
+			tcpProvs := configurator.ChiefCfg.ProviderSettingsByTransport(chief_settings.OLDIProvider, chief_settings.ProviderTransportTcp)
+
+			if len(grpcProvs) > 0 || len(tcpProvs) == 0 {
+				oldiGrpcCntrl.ToFdpsChan <- oldiData
+			}
+			if len(tcpProvs) > 0 {
+				oldiTcpCntrl.ToFdpsChan <- oldiData
+			}
+
+		// получены данные от провайдера AODB
+		case aodbData := <-aodbGrpcCntrl.FromFdpsChan:
+			channelCntrl.FromFdpsPacketChan <- aodbData
+
+		// AODB пакет от контроллера каналов
+		case aodbData := <-channelCntrl.ToAodbPacketChan:
+			aodbGrpcCntrl.ToFdpsChan <- aodbData
 
 		case <-done:
 			wg.Done()
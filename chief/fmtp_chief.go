@@ -1,11 +1,16 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"sync"
 
 	"fmtp/chief/chief_logger"
+	"fmtp/chief/chief_settings"
 	"fmtp/chief/chief_web"
 	"fmtp/chief/chief_worker"
+	"fmtp/fmtp_log"
+	"fmtp/secret"
 
 	"lemz.com/fdps/logger"
 	"lemz.com/fdps/utils"
@@ -19,6 +24,9 @@ const (
 var workWithDocker bool
 var dockerVersion string
 
+var standaloneFlag = flag.Bool("standalone", false, "автономный режим: настройки из локального файла, без конфигуратора")
+var settingsFileFlag = flag.String("settings", "", "локальный файл настроек (JSON или YAML) для автономного режима")
+
 func initDockerInfo() bool {
 	if dockerVersion, dockErr := utils.GetDockerVersion(); dockErr != nil {
 		logger.SetDockerVersion("???")
@@ -32,6 +40,8 @@ func initDockerInfo() bool {
 }
 
 func main() {
+	flag.Parse()
+
 	logger.InitLoggerSettings(utils.AppPath()+"/config/loggers.json", appName, appVersion)
 	if logger.LogSettInst.NeedWebLog {
 		utils.AppendHandler(logger.WebLogger)
@@ -41,6 +51,11 @@ func main() {
 	logger.AppendLogger(chief_logger.ChiefLog)
 	go chief_logger.ChiefLog.Work()
 
+	if keyErr := secret.CheckKey(); keyErr != nil {
+		logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, fmtp_log.ChannelTypeNone,
+			fmt.Sprintf("Настройки, содержащие пароли и токены, не будут сохранены в файл. %v", keyErr)))
+	}
+
 	if !initDockerInfo() {
 		utils.InitFileBinUtils(
 			utils.AppPath()+"/versions",
@@ -57,6 +72,14 @@ func main() {
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 
-	go chief_worker.Start(workWithDocker, dockerVersion, done, &wg)
+	var standaloneSettingsFile string
+	if *standaloneFlag || *settingsFileFlag != "" {
+		standaloneSettingsFile = *settingsFileFlag
+		if standaloneSettingsFile == "" {
+			standaloneSettingsFile = chief_settings.SettingsFilePath()
+		}
+	}
+
+	go chief_worker.Start(workWithDocker, dockerVersion, standaloneSettingsFile, done, &wg)
 	wg.Wait()
 }
@@ -3,62 +3,65 @@ package oldi
 import (
 	"context"
 	"fmt"
-	"net"
 	"sync"
 	"time"
 
 	"fmtp/chief/chief_metrics"
 	"fmtp/chief/chief_settings"
 	pb "fmtp/chief/proto/fmtp"
+	"fmtp/chief/routing"
 	"fmtp/configurator"
 	"fmtp/fmtp_log"
 
 	"lemz.com/fdps/logger"
 
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
 const (
 	providerValidDur = 10 * time.Second // время, после которого, если не приходят сообщения от провайдера, то считаем его недоступным
-	msgValidDur      = 30 * time.Second // время, в течении которого сообщение валидно
+	MsgValidDur      = 30 * time.Second // время, в течении которого сообщение валидно (если не задано в настройках провайдера)
+	MsgCleanInterval = time.Second      // интервал проверки времени хранения сообщений в очередях провайдеров
 	maxMsgToSend     = 1000             // максимальное кол-во соообщений для отправки провайдеру
 )
 
-// fmtpServerImpl - реализация интерфейса grpc сервера
-type fmtpGrpcServerImpl struct {
+// FmtpGrpcServerImpl - реализация интерфейса grpc сервера (используется для провайдеров OLDI и AODB)
+type FmtpGrpcServerImpl struct {
 	sync.Mutex
 
-	msgToFdps    []*pb.Msg
-	clntActivity sync.Map              //map[string]time.Time  // ключ - адрес fdps провайдера, значение - время последней активности
-	FromFdpsChan chan pb.MsgWithChanId // канал для приема сообщений от провайдера OLDI
+	dataType string // тип провайдера ("OLDI" | "AODB")
+
+	queues       map[int]*providerQueue // очереди провайдеров, опрашивающих RecvMsq (ключ - идентификатор провайдера)
+	streams      map[int]*streamSession // сессии потоков MsgStream (ключ - идентификатор провайдера)
+	clntActivity sync.Map               //map[int]providerActivity  // ключ - идентификатор провайдера, значение - последняя активность
+	FromFdpsChan chan pb.MsgWithChanId  // канал для приема сообщений от провайдера OLDI
+}
+
+// providerActivity последняя активность провайдера
+type providerActivity struct {
+	host     string    // адрес клиента
+	lastTime time.Time // время последнего вызова
 }
 
-func newFmtpGrpcServerImpl() *fmtpGrpcServerImpl {
-	retValue := fmtpGrpcServerImpl{}
-	retValue.msgToFdps = make([]*pb.Msg, 0)
+// NewFmtpGrpcServerImpl конструктор
+func NewFmtpGrpcServerImpl(dataType string) *FmtpGrpcServerImpl {
+	retValue := FmtpGrpcServerImpl{dataType: dataType}
+	retValue.queues = make(map[int]*providerQueue)
+	retValue.streams = make(map[int]*streamSession)
 	retValue.FromFdpsChan = make(chan pb.MsgWithChanId, 1024)
 	return &retValue
 }
 
-func (s *fmtpGrpcServerImpl) SendMsg(ctx context.Context, msg *pb.MsgList) (*pb.SvcResult, error) {
-	p, _ := peer.FromContext(ctx)
-	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
-		s.clntActivity.Store(host, time.Now().UTC())
-	}
+func (s *FmtpGrpcServerImpl) SendMsg(ctx context.Context, msg *pb.MsgList) (*pb.SvcResult, error) {
+	s.storeActivity(ctx)
 	var errorString string
 
 	metric := chief_metrics.ProvMetrics{RecvCount: len(msg.List)}
 
 	for _, val := range msg.List {
-		chId := configurator.ChiefCfg.GetChannelIdByCid(val.Cid)
-		if chId != -1 {
-			s.FromFdpsChan <- pb.MsgWithChanId{PbMsg: val, ChanId: chId}
-		} else {
-			errNoChannel := fmt.Sprintf("Не найден FMTP канал для отправки сообщения. CID (remote ATC): %s", val.Cid)
-			errorString += errNoChannel + "\n"
-			logger.PrintfErr(errNoChannel)
+		if err := s.routeMsg(val); err != nil {
+			errorString += err.Error() + "\n"
 			metric.MissedCount++
 		}
 	}
@@ -66,86 +69,153 @@ func (s *fmtpGrpcServerImpl) SendMsg(ctx context.Context, msg *pb.MsgList) (*pb.
 	return &pb.SvcResult{Errormessage: errorString}, status.New(codes.OK, "").Err()
 }
 
-func (s *fmtpGrpcServerImpl) RecvMsq(ctx context.Context, msg *pb.SvcReq) (*pb.MsgList, error) {
+// передача сообщения провайдера в FMTP каналы по таблице маршрутизации
+func (s *FmtpGrpcServerImpl) routeMsg(msg *pb.Msg) error {
+	route, err := routing.Resolve(&configurator.ChiefCfg, msg, s.dataType)
+	if err != nil {
+		logger.PrintfErr(err.Error())
+		return err
+	}
+	s.FromFdpsChan <- route.Packet(msg, s.dataType)
+	return nil
+}
+
+func (s *FmtpGrpcServerImpl) RecvMsq(ctx context.Context, msg *pb.SvcReq) (*pb.MsgList, error) {
 	s.Lock()
 	defer s.Unlock()
 
-	p, _ := peer.FromContext(ctx)
-	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
-		s.clntActivity.Store(host, time.Now().UTC())
+	providerID, ok := s.storeActivity(ctx)
+	if !ok {
+		logger.PrintfWarn("Запрос сообщений от клиента %s без авторизации провайдера %s.", peerHost(ctx), s.dataType)
+		return &pb.MsgList{List: make([]*pb.Msg, 0)}, status.New(codes.OK, "").Err()
 	}
 
-	toSend := make([]*pb.Msg, 0)
+	toSend := s.providerQueue(providerID).pop(maxMsgToSend)
 
-	if len(s.msgToFdps) > maxMsgToSend {
-		toSend = append(toSend, s.msgToFdps[:maxMsgToSend]...)
-		s.msgToFdps = s.msgToFdps[maxMsgToSend:]
-	} else {
-		toSend = make([]*pb.Msg, len(s.msgToFdps))
-		copy(toSend, s.msgToFdps)
-		s.msgToFdps = s.msgToFdps[:0]
-	}
 	chief_metrics.ProvMetricsChan <- chief_metrics.ProvMetrics{SendCount: len(toSend)}
 	for _, val := range toSend {
-		logger.PrintfInfo("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityInfo, chief_settings.OLDIProvider,
-			fmt.Sprintf("Плановой подсистеме отправлено сообщение: %s.", val.Txt)))
+		switch val.Tp {
+		case pb.MsgTpLamAck, pb.MsgTpLamTimeout:
+			logger.PrintfDebug("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityDebug, s.dataType,
+				fmt.Sprintf("Плановой подсистеме (ID %d) отправлено состояние подтверждения (%s) сообщения с идентификатором %s.", providerID, val.Tp, val.Id)))
+		default:
+			logger.PrintfInfo("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityInfo, s.dataType,
+				fmt.Sprintf("Плановой подсистеме (ID %d) отправлено сообщение: %s.", providerID, val.Txt)))
+		}
 	}
 	return &pb.MsgList{List: toSend}, status.New(codes.OK, "").Err()
 }
 
-// адреса провайдеров, активных в заданный промежуток времени
-func (s *fmtpGrpcServerImpl) getActiveProviders() []string {
-	retValue := make([]string, 0)
+// сохранение времени активности провайдера, авторизованного для вызова
+func (s *FmtpGrpcServerImpl) storeActivity(ctx context.Context) (int, bool) {
+	providerID, ok := authProviderID(ctx)
+	if ok {
+		s.clntActivity.Store(providerID, providerActivity{host: peerHost(ctx), lastTime: time.Now().UTC()})
+	}
+	return providerID, ok
+}
+
+// настройки провайдеров, работающих по GRPC
+func (s *FmtpGrpcServerImpl) grpcProviderSettings() []chief_settings.ProviderSettings {
+	return configurator.ChiefCfg.ProviderSettingsByTransport(s.dataType, chief_settings.ProviderTransportGrpc)
+}
+
+// очередь провайдера, опрашивающего RecvMsq (создается при первом обращении)
+func (s *FmtpGrpcServerImpl) providerQueue(providerID int) *providerQueue {
+	if pq, ok := s.queues[providerID]; ok {
+		return pq
+	}
+	s.queues[providerID] = newProviderQueue(providerID)
+	return s.queues[providerID]
+}
+
+// ActiveProviders провайдеры, активные в заданный промежуток времени (ключ - идентификатор провайдера, значение - адрес клиента)
+func (s *FmtpGrpcServerImpl) ActiveProviders() map[int]string {
+	retValue := s.streamProviders()
 	nowTime := time.Now().UTC()
 	s.clntActivity.Range(func(key, value interface{}) bool {
-		if value.(time.Time).Add(providerValidDur).After(nowTime) {
-			retValue = append(retValue, key.(string))
+		if act := value.(providerActivity); act.lastTime.Add(providerValidDur).After(nowTime) {
+			if _, ok := retValue[key.(int)]; !ok {
+				retValue[key.(int)] = act.host
+			}
 		}
 		return true
 	})
 	return retValue
 }
 
-func (s *fmtpGrpcServerImpl) appendMsg(msg *pb.Msg) {
+// Backlog кол-во сообщений, ожидающих отправки провайдеру (или подтверждения провайдером)
+func (s *FmtpGrpcServerImpl) Backlog(providerID int) int {
 	s.Lock()
 	defer s.Unlock()
 
-	s.msgToFdps = append(s.msgToFdps, msg)
+	var retValue int
+	if pq, ok := s.queues[providerID]; ok {
+		retValue += len(pq.msgs)
+	}
+	if ss, ok := s.streams[providerID]; ok {
+		retValue += ss.backlog()
+	}
+	return retValue
 }
 
-func (s *fmtpGrpcServerImpl) cleanOldMsg() {
+// AppendMsg добавить сообщение в очереди на отправку провайдерам.
+// Сообщение передается каждому провайдеру, подписанному на CID и тип сообщения:
+// в поток MsgStream, если провайдер работает через поток, иначе - в очередь провайдера, опрашиваемую RecvMsq.
+func (s *FmtpGrpcServerImpl) AppendMsg(msg *pb.Msg) {
 	s.Lock()
 	defer s.Unlock()
 
-	maxIdx := -1
+	nowTime := time.Now()
+	for _, val := range s.grpcProviderSettings() {
+		if !val.Accepts(msg.Cid, msg.Tp) {
+			continue
+		}
+
+		if ss, ok := s.streams[val.ID]; ok && ss.isAlive(nowTime) {
+			ss.push(msg)
+		} else {
+			pq := s.providerQueue(val.ID)
+			pq.msgs = append(pq.msgs, msg)
+		}
+	}
+}
+
+// CleanOldMsg удаление из очередей сообщений, не отправленных провайдерам в течении времени хранения
+func (s *FmtpGrpcServerImpl) CleanOldMsg() {
+	s.Lock()
+	defer s.Unlock()
 
-	for idx, val := range s.msgToFdps {
-		if val.Rrtime.AsTime().UTC().Add(msgValidDur).Before(time.Now().UTC()) {
-			maxIdx = idx
+	nowTime := time.Now().UTC()
+	setts := s.grpcProviderSettings()
 
-			logger.PrintfErr("now time %s\ntime grpc %s\ntime grpc TO UTC %s\ntime grpc TO UTC + 30 %s\n",
-				time.Now().UTC().Format("2006-01-02 15:04:05"),
-				val.Rrtime.AsTime().Format("2006-01-02 15:04:05"),
-				val.Rrtime.AsTime().UTC().Format("2006-01-02 15:04:05"),
-				val.Rrtime.AsTime().UTC().Add(msgValidDur).Format("2006-01-02 15:04:05"))
+	ttlByID := make(map[int]time.Duration)
+	for _, val := range setts {
+		ttlByID[val.ID] = val.MsgTtl()
+	}
 
-			logger.PrintfWarn("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityWarning, chief_settings.OLDIProvider,
-				fmt.Sprintf("Сообщение удалено из очереди на отправку провайдеру по истечении 30 сек.: %s", val.Txt)))
-		} else {
-			// раз попался первый с валидным временем, последующие новее
-			break
+	for providerID, val := range s.streams {
+		ttl, ok := ttlByID[providerID]
+		if !ok {
+			ttl = MsgValidDur
+		}
+		if removed := val.cleanOld(nowTime, ttl); removed > 0 {
+			chief_metrics.ProvMetricsChan <- chief_metrics.ProvMetrics{TimeoutCount: removed}
+		}
+		if !val.isAlive(nowTime) {
+			delete(s.streams, providerID)
 		}
 	}
 
-	if maxIdx != -1 {
-		for idx := 0; idx <= maxIdx; idx++ {
-			s.msgToFdps[idx] = nil
+	for providerID, val := range s.queues {
+		// провайдер удален из настроек
+		ttl, ok := ttlByID[providerID]
+		if !ok {
+			delete(s.queues, providerID)
+			continue
 		}
-		if maxIdx == len(s.msgToFdps)-1 {
-			s.msgToFdps = s.msgToFdps[:0]
-		} else {
-			s.msgToFdps = s.msgToFdps[maxIdx+1 : len(s.msgToFdps)]
+		if removed := val.cleanOld(nowTime, ttl, s.dataType); removed > 0 {
+			chief_metrics.ProvMetricsChan <- chief_metrics.ProvMetrics{TimeoutCount: removed}
 		}
-		chief_metrics.ProvMetricsChan <- chief_metrics.ProvMetrics{TimeoutCount: maxIdx}
 	}
 }
@@ -0,0 +1,361 @@
+package oldi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"fmtp/chief/chief_metrics"
+	pb "fmtp/chief/proto/fmtp"
+	"fmtp/fmtp_log"
+
+	"lemz.com/fdps/logger"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultStreamWindow = 100             // макс. кол-во не подтвержденных сообщений в потоке, если провайдер не задал
+	streamRetainDur     = 5 * time.Minute // время хранения сессии потока отключенного провайдера
+)
+
+// errStreamBusy поток провайдера уже подключен
+var errStreamBusy = errors.New("Поток провайдера уже подключен.")
+
+// streamSession сессия потока MsgStream провайдера. Сохраняется после отключения провайдера
+// для возобновления передачи с последнего подтвержденного сообщения.
+type streamSession struct {
+	sync.Mutex
+
+	id           string // идентификатор сессии (передается провайдеру в StreamWelcome)
+	providerID   int
+	host         string // адрес подключенного провайдера
+	connected    bool
+	lastActivity time.Time
+
+	nextSeq uint64          // номер следующего сообщения для провайдера
+	outbox  []*pb.StreamMsg // сообщения для провайдера, не подтвержденные провайдером (по возрастанию номера)
+	sentSeq uint64          // номер последнего отправленного в текущем подключении сообщения
+	window  int             // макс. кол-во отправленных и не подтвержденных сообщений
+	recvSeq uint64          // номер последнего принятого сообщения провайдера (для отбрасывания повторов)
+
+	notify chan struct{} // сигнал о появлении сообщений для отправки / подтверждений
+}
+
+func newStreamSession(providerID int) *streamSession {
+	return &streamSession{
+		id:         newSessionID(),
+		providerID: providerID,
+		nextSeq:    1,
+		window:     defaultStreamWindow,
+		notify:     make(chan struct{}, 1),
+	}
+}
+
+// случайный идентификатор сессии. Отличается после перезапуска контроллера,
+// поэтому провайдер не может возобновить сессию с номерами из прежней нумерации
+func newSessionID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (ss *streamSession) wakeUp() {
+	select {
+	case ss.notify <- struct{}{}:
+	default:
+	}
+}
+
+// attach подключение провайдера. Подтвержденные сообщения удаляются, остальные будут отправлены повторно.
+// Номер подтвержденного сообщения учитывается только при возобновлении той же сессии
+// (после перезапуска контроллера или провайдера все не подтвержденные сообщения отправляются заново).
+// Второе одновременное подключение потока провайдера отклоняется.
+func (ss *streamSession) attach(hello *pb.StreamHello, host string) (*pb.StreamWelcome, error) {
+	ss.Lock()
+	defer ss.Unlock()
+
+	if ss.connected {
+		return nil, errStreamBusy
+	}
+
+	ss.host = host
+	ss.connected = true
+	ss.lastActivity = time.Now()
+	ss.window = defaultStreamWindow
+	if hello.Window > 0 {
+		ss.window = int(hello.Window)
+	}
+
+	if hello.Sessionid != ss.id {
+		ss.sentSeq = 0
+		ss.recvSeq = 0
+	} else {
+		lastAcked := hello.Lastackedseq
+		if lastAcked > ss.nextSeq-1 {
+			lastAcked = ss.nextSeq - 1
+		}
+		for len(ss.outbox) > 0 && ss.outbox[0].Seq <= lastAcked {
+			ss.outbox = ss.outbox[1:]
+		}
+		ss.sentSeq = lastAcked
+	}
+	ss.wakeUp()
+	return &pb.StreamWelcome{Sessionid: ss.id, Lastrecvseq: ss.recvSeq}, nil
+}
+
+func (ss *streamSession) detach() {
+	ss.Lock()
+	defer ss.Unlock()
+
+	ss.connected = false
+	ss.lastActivity = time.Now()
+}
+
+// push добавить сообщение для провайдера
+func (ss *streamSession) push(msg *pb.Msg) {
+	ss.Lock()
+	ss.outbox = append(ss.outbox, &pb.StreamMsg{Seq: ss.nextSeq, Msg: msg})
+	ss.nextSeq++
+	ss.Unlock()
+
+	ss.wakeUp()
+}
+
+// accept проверка номера сообщения провайдера. Повторно переданные провайдером сообщения не принимаются.
+func (ss *streamSession) accept(seq uint64) bool {
+	ss.Lock()
+	defer ss.Unlock()
+
+	if seq <= ss.recvSeq {
+		return false
+	}
+	ss.recvSeq = seq
+	ss.lastActivity = time.Now()
+	return true
+}
+
+// ack подтверждение провайдером получения сообщения
+func (ss *streamSession) ack(seq uint64) {
+	ss.Lock()
+	for idx, val := range ss.outbox {
+		if val.Seq == seq {
+			ss.outbox = append(ss.outbox[:idx], ss.outbox[idx+1:]...)
+			break
+		}
+	}
+	ss.lastActivity = time.Now()
+	ss.Unlock()
+
+	ss.wakeUp()
+}
+
+// toSend сообщения, которые можно отправить с учетом окна не подтвержденных сообщений
+func (ss *streamSession) toSend() []*pb.StreamMsg {
+	ss.Lock()
+	defer ss.Unlock()
+
+	var retValue []*pb.StreamMsg
+	inFlight := 0
+	for _, val := range ss.outbox {
+		if val.Seq <= ss.sentSeq {
+			inFlight++
+		}
+	}
+	for _, val := range ss.outbox {
+		if inFlight >= ss.window {
+			break
+		}
+		if val.Seq > ss.sentSeq {
+			retValue = append(retValue, val)
+			ss.sentSeq = val.Seq
+			inFlight++
+		}
+	}
+	return retValue
+}
+
+// cleanOld удаление сообщений, не подтвержденных провайдером в течении ttl. Возвращает кол-во удаленных.
+func (ss *streamSession) cleanOld(nowTime time.Time, ttl time.Duration) int {
+	ss.Lock()
+	defer ss.Unlock()
+
+	removed := 0
+	for len(ss.outbox) > 0 && ss.outbox[0].Msg.Rrtime.AsTime().UTC().Add(ttl).Before(nowTime) {
+		logger.PrintfWarn("Сообщение удалено из очереди на отправку провайдеру (ID %d) по истечении %v: %s",
+			ss.providerID, ttl, ss.outbox[0].Msg.Txt)
+		ss.outbox = ss.outbox[1:]
+		removed++
+	}
+	return removed
+}
+
+// кол-во не подтвержденных провайдером сообщений
+func (ss *streamSession) backlog() int {
+	ss.Lock()
+	defer ss.Unlock()
+
+	return len(ss.outbox)
+}
+
+// признак того, что сессия используется (провайдер подключен или отключился недавно)
+func (ss *streamSession) isAlive(nowTime time.Time) bool {
+	ss.Lock()
+	defer ss.Unlock()
+
+	return ss.connected || ss.lastActivity.Add(streamRetainDur).After(nowTime)
+}
+
+// MsgStream двунаправленный поток сообщений с провайдером
+func (s *FmtpGrpcServerImpl) MsgStream(stream pb.FmtpService_MsgStreamServer) error {
+	host := peerHost(stream.Context())
+	providerID, isAuth := authProviderID(stream.Context())
+
+	firstReq, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	hello := firstReq.GetHello()
+	if hello == nil {
+		return status.Error(codes.InvalidArgument, "Первым сообщением потока должно быть StreamHello.")
+	}
+	if !isAuth || int(hello.Providerid) != providerID {
+		s.auditReject("MsgStream", host, fmt.Sprintf("идентификатор потока %d не соответствует провайдеру с ID %d", hello.Providerid, providerID))
+		return status.Error(codes.PermissionDenied, "Идентификатор провайдера потока не соответствует авторизованному провайдеру.")
+	}
+
+	sess := s.streamSession(int(hello.Providerid))
+	welcome, err := sess.attach(hello, host)
+	if err != nil {
+		s.auditReject("MsgStream", host, fmt.Sprintf("поток провайдера с ID %d уже подключен", hello.Providerid))
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	defer sess.detach()
+
+	logger.PrintfInfo("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityInfo, s.dataType,
+		fmt.Sprintf("Подключен поток провайдера с ID %d (%s). Сессия: %s (%s). Последнее подтвержденное сообщение: %d.",
+			hello.Providerid, host, welcome.Sessionid, sessionResumeText(hello.Sessionid == welcome.Sessionid), hello.Lastackedseq)))
+
+	var sendMutex sync.Mutex
+	send := func(resp *pb.StreamResp) error {
+		sendMutex.Lock()
+		defer sendMutex.Unlock()
+		return stream.Send(resp)
+	}
+
+	if err := send(&pb.StreamResp{Body: &pb.StreamResp_Welcome{Welcome: welcome}}); err != nil {
+		return err
+	}
+
+	recvErrChan := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErrChan <- err
+				return
+			}
+			s.storeActivity(stream.Context())
+
+			switch body := req.Body.(type) {
+			case *pb.StreamReq_Msg:
+				ack := &pb.StreamAck{Seq: body.Msg.Seq}
+				metric := chief_metrics.ProvMetrics{RecvCount: 1}
+				if !sess.accept(body.Msg.Seq) {
+					// повтор уже принятого сообщения только подтверждается
+					logger.PrintfDebug("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityDebug, s.dataType,
+						fmt.Sprintf("Повтор сообщения провайдера с ID %d (номер %d) отброшен.", hello.Providerid, body.Msg.Seq)))
+					metric.RecvCount = 0
+				} else if body.Msg.Msg == nil {
+					ack.Errormessage = "Пустое сообщение."
+				} else if routeErr := s.routeMsg(body.Msg.Msg); routeErr != nil {
+					ack.Errormessage = routeErr.Error()
+					metric.MissedCount++
+				}
+				chief_metrics.ProvMetricsChan <- metric
+
+				if err := send(&pb.StreamResp{Body: &pb.StreamResp_Ack{Ack: ack}}); err != nil {
+					recvErrChan <- err
+					return
+				}
+
+			case *pb.StreamReq_Ack:
+				sess.ack(body.Ack.Seq)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+
+		case err := <-recvErrChan:
+			logger.PrintfInfo("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityInfo, s.dataType,
+				fmt.Sprintf("Отключен поток провайдера с ID %d (%s). Причина: %v.", hello.Providerid, host, err)))
+			return nil
+
+		case <-sess.notify:
+			toSend := sess.toSend()
+			for _, val := range toSend {
+				if err := send(&pb.StreamResp{Body: &pb.StreamResp_Msg{Msg: val}}); err != nil {
+					return err
+				}
+				logger.PrintfInfo("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityInfo, s.dataType,
+					fmt.Sprintf("Плановой подсистеме отправлено сообщение: %s.", val.Msg.Txt)))
+			}
+			if len(toSend) > 0 {
+				chief_metrics.ProvMetricsChan <- chief_metrics.ProvMetrics{SendCount: len(toSend)}
+			}
+		}
+	}
+}
+
+// текст признака возобновления сессии для журнала
+func sessionResumeText(isResumed bool) string {
+	if isResumed {
+		return "возобновлена"
+	}
+	return "новая нумерация"
+}
+
+// сессия потока провайдера (создается при первом подключении).
+// Сообщения, накопленные в очереди RecvMsq провайдера, переносятся в поток.
+func (s *FmtpGrpcServerImpl) streamSession(providerID int) *streamSession {
+	s.Lock()
+	defer s.Unlock()
+
+	sess, ok := s.streams[providerID]
+	if !ok {
+		sess = newStreamSession(providerID)
+		s.streams[providerID] = sess
+	}
+	if pq, ok := s.queues[providerID]; ok {
+		for _, val := range pq.pop(len(pq.msgs)) {
+			sess.push(val)
+		}
+	}
+	return sess
+}
+
+// провайдеры, подключенные через поток MsgStream (ключ - идентификатор провайдера, значение - адрес клиента)
+func (s *FmtpGrpcServerImpl) streamProviders() map[int]string {
+	s.Lock()
+	defer s.Unlock()
+
+	retValue := make(map[int]string)
+	for providerID, val := range s.streams {
+		val.Lock()
+		if val.connected {
+			retValue[providerID] = val.host
+		}
+		val.Unlock()
+	}
+	return retValue
+}
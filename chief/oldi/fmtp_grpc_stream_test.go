@@ -0,0 +1,101 @@
+package oldi
+
+import (
+	"testing"
+
+	pb "fmtp/chief/proto/fmtp"
+)
+
+// session with count messages queued for the provider
+func queuedSession(count int) *streamSession {
+	ss := newStreamSession(1)
+	for idx := 0; idx < count; idx++ {
+		ss.push(&pb.Msg{})
+	}
+	return ss
+}
+
+func TestStreamAttachNewSession(t *testing.T) {
+	ss := queuedSession(3)
+
+	// provider reports acks of a previous (unknown) session
+	welcome, err := ss.attach(&pb.StreamHello{Providerid: 1, Sessionid: "other", Lastackedseq: 100}, "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if welcome.Sessionid != ss.id {
+		t.Fatalf("welcome session %q, want %q", welcome.Sessionid, ss.id)
+	}
+	if len(ss.outbox) != 3 || ss.sentSeq != 0 {
+		t.Fatalf("outbox %d sent %d, want everything resent", len(ss.outbox), ss.sentSeq)
+	}
+}
+
+func TestStreamAttachResume(t *testing.T) {
+	ss := queuedSession(5)
+
+	if _, err := ss.attach(&pb.StreamHello{Providerid: 1, Sessionid: ss.id, Lastackedseq: 2}, "host"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ss.outbox) != 3 || ss.outbox[0].Seq != 3 || ss.sentSeq != 2 {
+		t.Fatalf("outbox %d sent %d, want messages from 3", len(ss.outbox), ss.sentSeq)
+	}
+	ss.detach()
+
+	// acked seq beyond issued numbers is clamped
+	if _, err := ss.attach(&pb.StreamHello{Providerid: 1, Sessionid: ss.id, Lastackedseq: 1000}, "host"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ss.outbox) != 0 || ss.sentSeq != 5 {
+		t.Fatalf("outbox %d sent %d, want sent clamped to 5", len(ss.outbox), ss.sentSeq)
+	}
+	ss.push(&pb.Msg{})
+	if msgs := ss.toSend(); len(msgs) != 1 || msgs[0].Seq != 6 {
+		t.Fatalf("new message after clamp not sent")
+	}
+}
+
+func TestStreamAttachConcurrent(t *testing.T) {
+	ss := queuedSession(0)
+	if _, err := ss.attach(&pb.StreamHello{Providerid: 1}, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.attach(&pb.StreamHello{Providerid: 1}, "second"); err != errStreamBusy {
+		t.Fatalf("second stream: got %v, want errStreamBusy", err)
+	}
+	if ss.host != "first" {
+		t.Fatalf("host %q replaced by rejected stream", ss.host)
+	}
+	ss.detach()
+	if _, err := ss.attach(&pb.StreamHello{Providerid: 1}, "second"); err != nil {
+		t.Fatalf("attach after detach: %v", err)
+	}
+}
+
+func TestStreamAcceptDuplicates(t *testing.T) {
+	ss := queuedSession(0)
+	ss.attach(&pb.StreamHello{Providerid: 1}, "host")
+
+	for _, seq := range []uint64{1, 2, 3} {
+		if !ss.accept(seq) {
+			t.Fatalf("seq %d rejected", seq)
+		}
+	}
+	if ss.accept(2) || ss.accept(3) {
+		t.Fatalf("resent seq accepted")
+	}
+	ss.detach()
+
+	// resumed session keeps received seq
+	welcome, _ := ss.attach(&pb.StreamHello{Providerid: 1, Sessionid: ss.id}, "host")
+	if welcome.Lastrecvseq != 3 || ss.accept(3) {
+		t.Fatalf("received seq %d lost on resume", welcome.Lastrecvseq)
+	}
+	ss.detach()
+
+	// restarted provider starts numbering again
+	ss.attach(&pb.StreamHello{Providerid: 1}, "host")
+	if !ss.accept(1) {
+		t.Fatalf("seq of new provider session rejected")
+	}
+}
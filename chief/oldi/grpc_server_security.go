@@ -0,0 +1,297 @@
+package oldi
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"fmtp/chief/chief_settings"
+	pb "fmtp/chief/proto/fmtp"
+	"fmtp/configurator"
+	"fmtp/fmtp_log"
+
+	"lemz.com/fdps/logger"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ProviderTokenKey ключ метаданных GRPC вызова с токеном провайдера
+	ProviderTokenKey = "x-provider-token"
+	// ProviderIDKey ключ метаданных GRPC вызова с идентификатором провайдера
+	ProviderIDKey = "x-provider-id"
+
+	authorizationKey = "authorization"
+	bearerPrefix     = "Bearer "
+
+	fmtpServiceName = "FmtpService.FmtpService"
+)
+
+// NewProviderGrpcServer создание GRPC сервера для подключения провайдеров:
+// TLS (mTLS) по настройкам контроллера, проверка адреса и токена провайдера,
+// сервисы health и reflection.
+func NewProviderGrpcServer(fmtpServer *FmtpGrpcServerImpl) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(fmtpServer.unaryAuthInterceptor),
+		grpc.StreamInterceptor(fmtpServer.streamAuthInterceptor),
+	}
+
+	if tlsSetts := configurator.ChiefCfg.ProviderTls; tlsSetts.Enabled() {
+		tlsCfg, err := serverTlsConfig(tlsSetts)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterFmtpServiceServer(grpcServer, fmtpServer)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(fmtpServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	reflection.Register(grpcServer)
+	return grpcServer, nil
+}
+
+// настройки TLS сервера
+func serverTlsConfig(tlsSetts chief_settings.ProviderTlsSettings) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(tlsSetts.CertFile, tlsSetts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка чтения сертификата TLS сервера. Ошибка: %v", err)
+	}
+
+	retValue := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if tlsSetts.ClientCAFile != "" {
+		caData, err := ioutil.ReadFile(tlsSetts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка чтения сертификатов УЦ клиентов. Ошибка: %v", err)
+		}
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caData) {
+			return nil, errors.New("Файл сертификатов УЦ клиентов не содержит сертификатов")
+		}
+		retValue.ClientCAs = caPool
+		retValue.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return retValue, nil
+}
+
+// служебные сервисы (health, reflection), вызовы которых не требуют авторизации провайдера.
+// Вызовы остальных сервисов, в том числе зарегистрированных на сервере в будущем, требуют авторизации
+var serviceMethodPrefixes = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+	"/grpc.reflection.v1.ServerReflection/",
+}
+
+// вызов служебного сервиса
+func isServiceMethod(fullMethod string) bool {
+	for _, val := range serviceMethodPrefixes {
+		if strings.HasPrefix(fullMethod, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// токен провайдера из метаданных вызова
+func tokenFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if vals := md.Get(ProviderTokenKey); len(vals) > 0 {
+		return vals[0]
+	}
+	if vals := md.Get(authorizationKey); len(vals) > 0 && strings.HasPrefix(vals[0], bearerPrefix) {
+		return strings.TrimPrefix(vals[0], bearerPrefix)
+	}
+	return ""
+}
+
+// идентификатор провайдера из метаданных вызова (false - не передан)
+func providerIDFromContext(ctx context.Context) (int, bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return 0, false, nil
+	}
+	vals := md.Get(ProviderIDKey)
+	if len(vals) == 0 {
+		return 0, false, nil
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(vals[0]))
+	if err != nil {
+		return 0, false, fmt.Errorf("неверный идентификатор провайдера: %s", vals[0])
+	}
+	return id, true, nil
+}
+
+// authProviderKey ключ контекста вызова с идентификатором авторизованного провайдера
+type authProviderKey struct{}
+
+// идентификатор провайдера, авторизованного для вызова
+func authProviderID(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(authProviderKey{}).(int)
+	return id, ok
+}
+
+// адрес клиента вызова
+func peerHost(ctx context.Context) string {
+	var host string
+	if p, ok := peer.FromContext(ctx); ok {
+		host, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+	return host
+}
+
+// identifyProvider определение провайдера по идентификатору и токену из метаданных вызова.
+// Адрес клиента ограничивает подключение адресами провайдера из настроек, но не используется для
+// выбора провайдера (несколько провайдеров могут работать с одного адреса).
+// Клиенты, не передающие идентификатор, определяются по токену среди всех провайдеров,
+// а без токена - по адресу, если с этого адреса работает единственный провайдер без токена.
+func identifyProvider(setts []chief_settings.ProviderSettings, ctx context.Context, host string) (chief_settings.ProviderSettings, codes.Code, string) {
+	id, hasID, err := providerIDFromContext(ctx)
+	if err != nil {
+		return chief_settings.ProviderSettings{}, codes.InvalidArgument, err.Error()
+	}
+	token := tokenFromContext(ctx)
+
+	if !hasID {
+		return identifyProviderWithoutID(setts, token, host)
+	}
+
+	for _, val := range setts {
+		if val.ID != id {
+			continue
+		}
+		if len(val.IPAddresses) > 0 && !providerHasHost(val, host) {
+			return val, codes.PermissionDenied, fmt.Sprintf("адрес не соответствует настройкам провайдера с ID %d", id)
+		}
+		if val.Token != "" {
+			if token == "" {
+				return val, codes.Unauthenticated, fmt.Sprintf("не передан токен провайдера с ID %d", id)
+			}
+			if !tokenEqual(token, val.Token) {
+				return val, codes.Unauthenticated, fmt.Sprintf("неверный токен провайдера с ID %d", id)
+			}
+		}
+		return val, codes.OK, ""
+	}
+	return chief_settings.ProviderSettings{}, codes.PermissionDenied, fmt.Sprintf("провайдер с ID %d отсутствует в настройках", id)
+}
+
+// определение провайдера клиента, не передающего идентификатор провайдера
+func identifyProviderWithoutID(setts []chief_settings.ProviderSettings, token string, host string) (chief_settings.ProviderSettings, codes.Code, string) {
+	var found []chief_settings.ProviderSettings
+
+	if token != "" {
+		// токен сравнивается со всеми провайдерами (время проверки не зависит от того, какой провайдер совпал)
+		for _, val := range setts {
+			if val.Token != "" && tokenEqual(token, val.Token) {
+				found = append(found, val)
+			}
+		}
+		switch {
+		case len(found) == 0:
+			return chief_settings.ProviderSettings{}, codes.Unauthenticated, "неверный токен провайдера"
+		case len(found) > 1:
+			return chief_settings.ProviderSettings{}, codes.Unauthenticated, "токен задан у нескольких провайдеров, требуется идентификатор провайдера"
+		case len(found[0].IPAddresses) > 0 && !providerHasHost(found[0], host):
+			return found[0], codes.PermissionDenied, fmt.Sprintf("адрес не соответствует настройкам провайдера с ID %d", found[0].ID)
+		}
+		return found[0], codes.OK, ""
+	}
+
+	isHostKnown := false
+	for _, val := range setts {
+		if providerHasHost(val, host) {
+			isHostKnown = true
+			if val.Token == "" {
+				found = append(found, val)
+			}
+		}
+	}
+	switch {
+	case !isHostKnown:
+		return chief_settings.ProviderSettings{}, codes.PermissionDenied, "адрес отсутствует в настройках провайдеров"
+	case len(found) == 0:
+		return chief_settings.ProviderSettings{}, codes.Unauthenticated, "не передан токен провайдера"
+	case len(found) > 1:
+		return chief_settings.ProviderSettings{}, codes.PermissionDenied, "с адреса работают несколько провайдеров, требуется идентификатор провайдера"
+	}
+	return found[0], codes.OK, ""
+}
+
+// сравнение токенов за время, не зависящее от совпадающей части
+func tokenEqual(token string, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// authorize определение провайдера вызова. Возвращает контекст с идентификатором провайдера
+func (s *FmtpGrpcServerImpl) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	if isServiceMethod(fullMethod) {
+		return ctx, nil
+	}
+
+	host := peerHost(ctx)
+	provSett, code, reason := identifyProvider(s.grpcProviderSettings(), ctx, host)
+	if code != codes.OK {
+		s.auditReject(fullMethod, host, reason)
+		return ctx, status.Error(code, "Провайдер не авторизован: "+reason+".")
+	}
+	return context.WithValue(ctx, authProviderKey{}, provSett.ID), nil
+}
+
+// запись в журнал отклоненного вызова
+func (s *FmtpGrpcServerImpl) auditReject(fullMethod string, host string, reason string) {
+	logger.PrintfWarn("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityWarning, s.dataType,
+		fmt.Sprintf("Отклонен вызов %s от клиента %s. Причина: %s.", fullMethod, host, reason)))
+}
+
+func (s *FmtpGrpcServerImpl) unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	authCtx, err := s.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(authCtx, req)
+}
+
+// authServerStream поток с контекстом авторизованного провайдера
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ass *authServerStream) Context() context.Context {
+	return ass.ctx
+}
+
+func (s *FmtpGrpcServerImpl) streamAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	authCtx, err := s.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authServerStream{ServerStream: ss, ctx: authCtx})
+}
@@ -0,0 +1,110 @@
+package oldi
+
+import (
+	"context"
+	"testing"
+
+	"fmtp/chief/chief_settings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// incoming call context with metadata pairs
+func callContext(kv ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(kv...))
+}
+
+func TestIdentifyProviderByID(t *testing.T) {
+	// two providers share one host
+	setts := []chief_settings.ProviderSettings{
+		{ID: 1, IPAddresses: []string{"10.0.0.1"}, Token: "first"},
+		{ID: 2, IPAddresses: []string{"10.0.0.1"}, Token: "second"},
+		{ID: 3, IPAddresses: []string{"10.0.0.3"}},
+	}
+
+	cases := []struct {
+		ctx    context.Context
+		host   string
+		code   codes.Code
+		wantID int
+	}{
+		{callContext(ProviderIDKey, "2", ProviderTokenKey, "second"), "10.0.0.1", codes.OK, 2},
+		{callContext(ProviderIDKey, "1", ProviderTokenKey, "first"), "10.0.0.1", codes.OK, 1},
+		{callContext(ProviderIDKey, "2", ProviderTokenKey, "first"), "10.0.0.1", codes.Unauthenticated, 0},
+		{callContext(ProviderIDKey, "2"), "10.0.0.1", codes.Unauthenticated, 0},
+		{callContext(ProviderIDKey, "3"), "10.0.0.1", codes.PermissionDenied, 0},
+		{callContext(ProviderIDKey, "9"), "10.0.0.1", codes.PermissionDenied, 0},
+		{callContext(ProviderIDKey, "x"), "10.0.0.1", codes.InvalidArgument, 0},
+		{callContext(), "10.0.0.3", codes.OK, 3},
+		{callContext(), "10.0.0.9", codes.PermissionDenied, 0},
+	}
+
+	for idx, val := range cases {
+		sett, code, reason := identifyProvider(setts, val.ctx, val.host)
+		if code != val.code {
+			t.Fatalf("case %d: code %v (%s), want %v", idx, code, reason, val.code)
+		}
+		if code == codes.OK && sett.ID != val.wantID {
+			t.Fatalf("case %d: provider %d, want %d", idx, sett.ID, val.wantID)
+		}
+	}
+}
+
+func TestIdentifyProviderWithoutID(t *testing.T) {
+	setts := []chief_settings.ProviderSettings{
+		{ID: 1, IPAddresses: []string{"10.0.0.1"}, Token: "first"},
+		{ID: 2, IPAddresses: []string{"10.0.0.1"}, Token: "second"},
+		{ID: 3, IPAddresses: []string{"10.0.0.3"}},
+		{ID: 4, IPAddresses: []string{"10.0.0.4"}},
+		{ID: 5, IPAddresses: []string{"10.0.0.4"}},
+	}
+
+	cases := []struct {
+		ctx    context.Context
+		host   string
+		code   codes.Code
+		wantID int
+	}{
+		// token of the second provider on a shared host
+		{callContext(ProviderTokenKey, "second"), "10.0.0.1", codes.OK, 2},
+		{callContext("authorization", "Bearer first"), "10.0.0.1", codes.OK, 1},
+		{callContext(ProviderTokenKey, "other"), "10.0.0.1", codes.Unauthenticated, 0},
+		{callContext(ProviderTokenKey, "second"), "10.0.0.3", codes.PermissionDenied, 0},
+		{callContext(), "10.0.0.1", codes.Unauthenticated, 0},
+		{callContext(), "10.0.0.3", codes.OK, 3},
+		{callContext(), "10.0.0.4", codes.PermissionDenied, 0},
+		{callContext(), "10.0.0.9", codes.PermissionDenied, 0},
+	}
+
+	for idx, val := range cases {
+		sett, code, reason := identifyProvider(setts, val.ctx, val.host)
+		if code != val.code {
+			t.Fatalf("case %d: code %v (%s), want %v", idx, code, reason, val.code)
+		}
+		if code == codes.OK && sett.ID != val.wantID {
+			t.Fatalf("case %d: provider %d, want %d", idx, sett.ID, val.wantID)
+		}
+	}
+}
+
+func TestIsServiceMethod(t *testing.T) {
+	cases := []struct {
+		method string
+		want   bool
+	}{
+		{"/grpc.health.v1.Health/Check", true},
+		{"/grpc.health.v1.Health/Watch", true},
+		{"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", true},
+		{"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", true},
+		{"/" + fmtpServiceName + "/MsgStream", false},
+		{"/other.Service/Call", false},
+		{"/grpc.health.v1.HealthX/Check", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := isServiceMethod(c.method); got != c.want {
+			t.Fatalf("%q: %v, want %v", c.method, got, c.want)
+		}
+	}
+}
@@ -1,16 +1,19 @@
 package oldi
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
-	"strings"
 	"time"
 
 	"fmtp/channel/channel_settings"
+	"fmtp/chief/chief_metrics"
 	"fmtp/chief/chief_settings"
 	"fmtp/chief/chief_state"
+	pb "fmtp/chief/proto/fmtp"
+	"fmtp/chief/routing"
+	"fmtp/configurator"
 	"fmtp/fmtp_log"
 
 	"lemz.com/fdps/logger"
@@ -25,137 +28,197 @@ const (
 
 	srvStateOkValue    = "Запущен."
 	srvStateErrorValue = "Не запущен."
+
+	clntSendQueueSize = 1024            // размер очереди сообщений для отправки клиенту
+	clntWriteTimeout  = 5 * time.Second // таймаут отправки данных клиенту
 )
 
 type oldiClnt struct {
+	providerID     int           // идентификатор провайдера, к которому относится клиент
 	cancelWorkChan chan struct{} // канал для сигнала прекращения отправки/приема данных
-	toSendDataChan chan []byte   // канал для отправки данных
+	toSendDataChan chan *pb.Msg  // канал для отправки данных
 }
 
 // OldiTcpController контроллер для работы с провайдером OLDI по TCP
 type OldiTcpController struct {
-	SettsChan chan []chief_settings.ProviderSettings // канал для приема настроек провайдеров
+	SettsChan chan []chief_settings.ProviderSettings // канал для приема настроек провайдеров, подключаемых по TCP
 	setts     []chief_settings.ProviderSettings      // текущие настройки провайдеров
 
-	FromOldiDataChan chan []byte // канал для приема сообщений от провайдера OLDI
-	ToOldiDataChan   chan []byte // канал для отправки сообщений провайдеру OLDI
+	FromFdpsChan chan pb.MsgWithChanId // канал для приема сообщений от провайдера OLDI
+	ToFdpsChan   chan *pb.Msg          // канал для отправки сообщений провайдеру OLDI
 
 	checkStateTicker *time.Ticker // тикер для проверки состояния контроллера
 
+	clntConnChan    chan net.Conn // канал для приема подключенных клиентов
+	clntDisconnChan chan net.Conn // канал для приема отключенных клиентов
+
 	providerClients map[net.Conn]oldiClnt
 	tcpListener     net.Listener
-	tcpListenerWork bool
 	tcpLocalPort    int
 
-	closeTcpListenerFunc func()
-
 	providerEncoding string
 }
 
-// NewOldiController конструктор
+// NewOldiTcpController конструктор
 func NewOldiTcpController() *OldiTcpController {
 	return &OldiTcpController{
 		SettsChan:        make(chan []chief_settings.ProviderSettings, 10),
-		FromOldiDataChan: make(chan []byte, 1024),
-		ToOldiDataChan:   make(chan []byte, 1024),
+		FromFdpsChan:     make(chan pb.MsgWithChanId, 1024),
+		ToFdpsChan:       make(chan *pb.Msg, 1024),
 		checkStateTicker: time.NewTicker(stateTickerInt),
+		clntConnChan:     make(chan net.Conn, 10),
+		clntDisconnChan:  make(chan net.Conn, 10),
 		providerClients:  make(map[net.Conn]oldiClnt),
 	}
 }
 
-func (c *OldiTcpController) startServer(ctx context.Context, localPort int) {
+func (c *OldiTcpController) startServer(localPort int) {
 	var errListen error
-	if c.tcpListener, errListen = net.Listen("tcp", string(":"+strconv.Itoa(localPort))); errListen != nil {
+	if c.tcpListener, errListen = net.Listen("tcp", ":"+strconv.Itoa(localPort)); errListen != nil {
 		logger.PrintfErr("Ошибка запуска TCP сервера OLDI провайдера. Ошибка: %v.", errListen)
 		logger.SetDebugParam(srvStateKey, srvStateErrorValue, logger.StateErrorColor)
-		c.tcpListenerWork = false
+		c.tcpListener = nil
 		return
-	} else {
-		c.tcpListenerWork = true
-		logger.PrintfDebug("Запущен TCP сервер для работы с OLDI провайдером. Порт: %d", localPort)
-		logger.SetDebugParam(srvStateKey, srvStateOkValue+" Порт: "+strconv.Itoa(localPort), logger.StateOkColor)
-		//defer tcpListener.Close()
+	}
 
-		for {
-			select {
+	logger.PrintfDebug("Запущен TCP сервер для работы с OLDI провайдером. Порт: %d", localPort)
+	logger.SetDebugParam(srvStateKey, srvStateOkValue+" Порт: "+strconv.Itoa(localPort), logger.StateOkColor)
 
-			case <-ctx.Done():
-				return
+	go func(listener net.Listener) {
+		for {
+			curConn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				logger.PrintfErr("Ошибка подключения OLDI провайдера. Ошибка: %v.", err)
+				continue
+			}
+			c.clntConnChan <- curConn
+		}
+	}(c.tcpListener)
+}
 
-			default:
-				if curConn, err := c.tcpListener.Accept(); err != nil {
-					logger.PrintfErr("Ошибка подключения OLDI провайдера. Ошибка: %v.", err)
-					continue
-				} else {
-					c.providerClients[curConn] = oldiClnt{
-						cancelWorkChan: make(chan struct{}),
-						toSendDataChan: make(chan []byte, 1024),
-					}
+func (c *OldiTcpController) stopServer() {
+	for key := range c.providerClients {
+		c.closeClient(key)
+	}
 
-					remoteAddr, _ := curConn.RemoteAddr().(*net.TCPAddr)
-					logger.PrintfDebug("Успешное подключение OLDI провайдера. Адрес подключенного клиента: %s", remoteAddr.IP.String())
+	if c.tcpListener != nil {
+		if errClose := c.tcpListener.Close(); errClose != nil {
+			logger.PrintfErr("Ошибка закрытия TCP сервера для подключения OLDI провайдеров. Ошибка: %v", errClose)
+		}
+		c.tcpListener = nil
+	}
+	logger.SetDebugParam(srvStateKey, srvStateErrorValue, logger.StateErrorColor)
+}
 
-					go c.receiveLoop(curConn, c.providerClients[curConn])
-					go c.sendLoop(curConn, c.providerClients[curConn])
+// идентификатор провайдера по адресу подключенного клиента
+func (c *OldiTcpController) providerByAddr(addr net.Addr) (int, bool) {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		for _, val := range c.setts {
+			for _, ipVal := range val.IPAddresses {
+				if ipVal == tcpAddr.IP.String() {
+					return val.ID, true
 				}
 			}
 		}
 	}
+	return 0, false
 }
 
-func (c *OldiTcpController) stopServer() {
+// признак подписки провайдера на сообщение
+func (c *OldiTcpController) providerAccepts(providerID int, msg *pb.Msg) bool {
+	for _, val := range c.setts {
+		if val.ID == providerID {
+			return val.Accepts(msg.Cid, msg.Tp)
+		}
+	}
+	return false
+}
 
-	for key := range c.providerClients {
-		c.closeClient(key)
+func (c *OldiTcpController) openClient(conn net.Conn) {
+	providerID, ok := c.providerByAddr(conn.RemoteAddr())
+	if !ok {
+		logger.PrintfWarn("Отклонено подключение OLDI провайдера с адресом %s. Адрес отсутствует в настройках провайдеров.", conn.RemoteAddr().String())
+		conn.Close()
+		return
 	}
 
-	if errClose := c.tcpListener.Close(); errClose != nil {
-		logger.PrintfErr("Ошибка закрытия TCP сервера для подключения OLDI провайдеров. Ошибка: %v")
+	clnt := oldiClnt{
+		providerID:     providerID,
+		cancelWorkChan: make(chan struct{}),
+		toSendDataChan: make(chan *pb.Msg, clntSendQueueSize),
 	}
-	c.closeTcpListenerFunc()
+	c.providerClients[conn] = clnt
+	logger.PrintfDebug("Успешное подключение OLDI провайдера. ID провайдера: %d. Адрес подключенного клиента: %s", providerID, conn.RemoteAddr().String())
+
+	go c.receiveLoop(conn, c.providerEncoding)
+	go c.sendLoop(conn, clnt, c.providerEncoding)
 }
 
 func (c *OldiTcpController) closeClient(conn net.Conn) {
 	if val, ok := c.providerClients[conn]; ok {
-
-		conn.SetDeadline(time.Now().Add(time.Second))
 		// останавливаем передачу / прием
 		utils.ChanSafeClose(val.cancelWorkChan)
+		conn.Close()
 		logger.PrintfDebug("Отключен OLDI провайдер. Адрес: %s", conn.RemoteAddr().String())
 		delete(c.providerClients, conn)
 	}
 }
 
 // обработчик получения данных
-func (c *OldiTcpController) receiveLoop(clntConn net.Conn, clnt oldiClnt) {
+func (c *OldiTcpController) receiveLoop(clntConn net.Conn, encoding string) {
+	var decoder frameDecoder
+	buffer := make([]byte, 8192)
+
 	for {
-		select {
-		// отмена приема данных
-		case <-clnt.cancelWorkChan:
+		readBytes, err := clntConn.Read(buffer)
+		if err != nil {
+			logger.PrintfDebug("Завершен прием данных от OLDI провайдера. Адрес: %s. Причина: %v.", clntConn.RemoteAddr().String(), err)
+			c.clntDisconnChan <- clntConn
 			return
-		// прием данных
-		default:
-			buffer := make([]byte, 8192)
-			if readBytes, err := clntConn.Read(buffer); err != nil {
-				logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogChannelSTDT(fmtp_log.SeverityError, fmtp_log.NoneFmtpType, fmtp_log.DirectionIncoming,
-					fmt.Sprintf("Ошибка чтения данных из FMTP канала. Ошибка: %v.", err)))
-
-				c.closeClient(clntConn)
-			} else {
-				logger.PrintfDebug("Приняты данные от OLDI провайдера: %v", string(buffer[:readBytes]))
+		}
 
-				if c.providerEncoding == channel_settings.Encode1251 {
-					c.FromOldiDataChan <- utils.Win1251toUtf8(buffer[:readBytes])
-				} else {
-					c.FromOldiDataChan <- buffer[:readBytes]
-				}
+		frames, dropped := decoder.feed(buffer[:readBytes])
+		if dropped > 0 {
+			logger.PrintfWarn("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityWarning, chief_settings.OLDIProvider,
+				fmt.Sprintf("От провайдера OLDI (%s) получены данные вне формата STX/ETX. Отброшено байт: %d.", clntConn.RemoteAddr().String(), dropped)))
+		}
+
+		metric := chief_metrics.ProvMetrics{}
+		for _, frame := range frames {
+			if encoding == channel_settings.Encode1251 {
+				frame = utils.Win1251toUtf8(frame)
+			}
+
+			msg, decErr := decodeFrame(frame)
+			if decErr != nil {
+				logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, chief_settings.OLDIProvider,
+					fmt.Sprintf("Ошибка разбора сообщения от провайдера OLDI (%s). Ошибка: %v.", clntConn.RemoteAddr().String(), decErr)))
+				continue
 			}
+			metric.RecvCount++
+
+			route, routeErr := routing.Resolve(&configurator.ChiefCfg, msg, chief_settings.OLDIProvider)
+			if routeErr != nil {
+				logger.PrintfErr(routeErr.Error())
+				metric.MissedCount++
+				continue
+			}
+
+			logger.PrintfInfo("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityInfo, chief_settings.OLDIProvider,
+				fmt.Sprintf("Получено сообщение от плановой подсистемы: %s", msg.Txt)))
+			c.FromFdpsChan <- route.Packet(msg, chief_settings.OLDIProvider)
+		}
+		if len(frames) > 0 {
+			chief_metrics.ProvMetricsChan <- metric
 		}
 	}
 }
 
 // обработчик отправки данных
-func (c *OldiTcpController) sendLoop(clntConn net.Conn, clnt oldiClnt) {
+func (c *OldiTcpController) sendLoop(clntConn net.Conn, clnt oldiClnt, encoding string) {
 	for {
 		select {
 		// отмена отправки данных
@@ -163,19 +226,28 @@ func (c *OldiTcpController) sendLoop(clntConn net.Conn, clnt oldiClnt) {
 			return
 
 		// получены данные для отправки
-		case curData := <-clnt.toSendDataChan:
-			var dataToSend []byte
-			if c.providerEncoding == channel_settings.Encode1251 {
-				dataToSend = utils.Utf8toWin1251(curData)
+		case curMsg := <-clnt.toSendDataChan:
+			dataToSend, err := encodeFrame(curMsg)
+			if err != nil {
+				logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, chief_settings.OLDIProvider,
+					fmt.Sprintf("Сообщение не отправлено провайдеру OLDI (%s). Ошибка: %v Сообщение: %q.", clntConn.RemoteAddr().String(), err, curMsg.Txt)))
+				continue
+			}
+			if encoding == channel_settings.Encode1251 {
+				dataToSend = utils.Utf8toWin1251(dataToSend)
 			}
 
+			clntConn.SetWriteDeadline(time.Now().Add(clntWriteTimeout))
 			if _, err := clntConn.Write(dataToSend); err != nil {
-				logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogChannelSTDT(fmtp_log.SeverityError, fmtp_log.NoneFmtpType, fmtp_log.DirectionIncoming,
-					fmt.Sprintf("Ошибка отправки данных в FMTP канала. Ошибка: %v.", err)))
-				c.closeClient(clntConn)
-			} else {
-				logger.PrintfDebug("Отправлены данные OLDI провайдеру: %v", string(curData))
+				logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, chief_settings.OLDIProvider,
+					fmt.Sprintf("Ошибка отправки данных провайдеру OLDI (%s). Ошибка: %v.", clntConn.RemoteAddr().String(), err)))
+				c.clntDisconnChan <- clntConn
+				return
 			}
+
+			chief_metrics.ProvMetricsChan <- chief_metrics.ProvMetrics{SendCount: 1}
+			logger.PrintfInfo("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityInfo, chief_settings.OLDIProvider,
+				fmt.Sprintf("Плановой подсистеме отправлено сообщение: %s.", curMsg.Txt)))
 		}
 	}
 }
@@ -185,31 +257,53 @@ func (c *OldiTcpController) Work() {
 
 	for {
 		select {
-		// получены новые настройки каналов
+		// получены новые настройки провайдеров
 		case c.setts = <-c.SettsChan:
 			var localPort int
+			var providerEncoding string
 			for _, val := range c.setts {
 				localPort = val.LocalPort
-				c.providerEncoding = val.ProviderEncoding
+				providerEncoding = val.ProviderEncoding
 			}
 
-			if c.tcpLocalPort != localPort {
+			if c.tcpLocalPort != localPort || c.providerEncoding != providerEncoding {
 				c.tcpLocalPort = localPort
+				c.providerEncoding = providerEncoding
 
-				if c.tcpListenerWork {
-					c.stopServer()
+				c.stopServer()
+				if c.tcpLocalPort > 0 {
+					c.startServer(c.tcpLocalPort)
+				}
+			} else {
+				// отключаем клиентов, адреса которых удалены из настроек
+				for conn := range c.providerClients {
+					if _, ok := c.providerByAddr(conn.RemoteAddr()); !ok {
+						c.closeClient(conn)
+					}
 				}
-				var ctx context.Context
-				ctx, c.closeTcpListenerFunc = context.WithCancel(context.Background())
-
-				go c.startServer(ctx, c.tcpLocalPort)
 			}
 
-		// получен новый пакет для отправки провайдеру
-		case incomeData := <-c.ToOldiDataChan:
-			// отправляем всем клиентам
-			for _, v := range c.providerClients {
-				v.toSendDataChan <- incomeData
+		// подключен клиент
+		case conn := <-c.clntConnChan:
+			c.openClient(conn)
+
+		// отключен клиент
+		case conn := <-c.clntDisconnChan:
+			c.closeClient(conn)
+
+		// получен новый пакет для отправки провайдеру. Отправляем каждому подключенному клиенту провайдера, подписанного на сообщение
+		case incomeData := <-c.ToFdpsChan:
+			for conn, clnt := range c.providerClients {
+				if !c.providerAccepts(clnt.providerID, incomeData) {
+					continue
+				}
+				select {
+				case clnt.toSendDataChan <- incomeData:
+				default:
+					logger.PrintfWarn("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityWarning, chief_settings.OLDIProvider,
+						fmt.Sprintf("Переполнена очередь сообщений для провайдера OLDI (%s). Сообщение не отправлено: %s.", conn.RemoteAddr().String(), incomeData.Txt)))
+					chief_metrics.ProvMetricsChan <- chief_metrics.ProvMetrics{TimeoutCount: 1}
+				}
 			}
 
 		// сработал тикер проверки состояния контроллера
@@ -224,17 +318,16 @@ func (c *OldiTcpController) Work() {
 					ProviderState: chief_state.StateError,
 				}
 
-				for _, ipVal := range val.IPAddresses {
-					for key := range c.providerClients {
-						if strings.HasPrefix(key.RemoteAddr().String(), ipVal) {
-							curState.ProviderState = chief_state.StateOk
-							curState.ClientAddresses += " " + key.RemoteAddr().String()
-						}
+				for conn, clnt := range c.providerClients {
+					if clnt.providerID == val.ID {
+						curState.ProviderState = chief_state.StateOk
+						curState.ClientAddresses += " " + conn.RemoteAddr().String()
+						curState.Backlog += len(clnt.toSendDataChan)
 					}
 				}
 				states = append(states, curState)
 			}
-			chief_state.SetOldiProviderState(states)
+			chief_state.SetOldiTcpProviderState(states)
 		}
 	}
 }
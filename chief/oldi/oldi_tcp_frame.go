@@ -0,0 +1,109 @@
+package oldi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	pb "fmtp/chief/proto/fmtp"
+)
+
+// Формат сообщения при обмене с провайдером OLDI по TCP:
+//
+//	STX CID US ID US TP US TXT ETX
+//
+// STX (0x02) - начало сообщения, ETX (0x03) - окончание сообщения,
+// US (0x1F) - разделитель полей. CID - удаленный ATC (адресат / отправитель сообщения),
+// ID - идентификатор сообщения, TP - тип сообщения (может быть пустым), TXT - текст сообщения.
+const (
+	frameStx byte = 0x02
+	frameEtx byte = 0x03
+	frameUs  byte = 0x1F
+
+	frameFieldCount = 4
+	maxFrameSize    = 64 * 1024 // максимальный размер сообщения
+)
+
+// управляющие символы формата, недопустимые в полях сообщения
+var frameControlChars = string([]byte{frameStx, frameEtx, frameUs})
+
+// encodeFrame формирование TCP сообщения из GRPC сообщения.
+// Поля, содержащие STX, ETX или US, нарушили бы формат, поэтому такое сообщение не формируется
+func encodeFrame(msg *pb.Msg) ([]byte, error) {
+	for _, val := range []struct{ name, value string }{{"CID", msg.Cid}, {"ID", msg.Id}, {"TP", msg.Tp}, {"TXT", msg.Txt}} {
+		if strings.ContainsAny(val.value, frameControlChars) {
+			return nil, fmt.Errorf("Поле %s сообщения содержит управляющий символ STX, ETX или US.", val.name)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(frameStx)
+	buf.WriteString(msg.Cid)
+	buf.WriteByte(frameUs)
+	buf.WriteString(msg.Id)
+	buf.WriteByte(frameUs)
+	buf.WriteString(msg.Tp)
+	buf.WriteByte(frameUs)
+	buf.WriteString(msg.Txt)
+	buf.WriteByte(frameEtx)
+	return buf.Bytes(), nil
+}
+
+// decodeFrame разбор содержимого TCP сообщения (без STX и ETX)
+func decodeFrame(data []byte) (*pb.Msg, error) {
+	fields := strings.SplitN(string(data), string(frameUs), frameFieldCount)
+	if len(fields) != frameFieldCount {
+		return nil, errors.New("Некорректное кол-во полей в сообщении.")
+	}
+	if fields[0] == "" {
+		return nil, errors.New("Не задан CID сообщения.")
+	}
+	return &pb.Msg{Cid: fields[0], Id: fields[1], Tp: fields[2], Txt: fields[3]}, nil
+}
+
+// frameDecoder выделение сообщений STX/ETX из потока данных TCP соединения
+type frameDecoder struct {
+	buffer []byte
+}
+
+// feed добавить принятые данные. Возвращает выделенные сообщения (без STX и ETX)
+// и кол-во байт, отброшенных из-за нарушения формата.
+func (fd *frameDecoder) feed(data []byte) ([][]byte, int) {
+	var frames [][]byte
+	var dropped int
+
+	fd.buffer = append(fd.buffer, data...)
+
+	for {
+		stxIdx := bytes.IndexByte(fd.buffer, frameStx)
+		if stxIdx < 0 {
+			dropped += len(fd.buffer)
+			fd.buffer = fd.buffer[:0]
+			break
+		}
+		// данные до начала сообщения отбрасываем
+		dropped += stxIdx
+		fd.buffer = fd.buffer[stxIdx:]
+
+		etxIdx := bytes.IndexByte(fd.buffer, frameEtx)
+		if etxIdx < 0 {
+			if len(fd.buffer) > maxFrameSize {
+				dropped += len(fd.buffer)
+				fd.buffer = fd.buffer[:0]
+			}
+			break
+		}
+
+		// начало следующего сообщения до окончания текущего - текущее отбрасываем
+		if nextStx := bytes.IndexByte(fd.buffer[1:etxIdx], frameStx); nextStx >= 0 {
+			dropped += nextStx + 1
+			fd.buffer = fd.buffer[nextStx+1:]
+			continue
+		}
+
+		frames = append(frames, append([]byte(nil), fd.buffer[1:etxIdx]...))
+		fd.buffer = fd.buffer[etxIdx+1:]
+	}
+	return frames, dropped
+}
@@ -0,0 +1,131 @@
+package oldi
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "fmtp/chief/proto/fmtp"
+)
+
+func TestEncodeFrame(t *testing.T) {
+	cases := []struct {
+		msg     *pb.Msg
+		want    string
+		wantErr bool
+	}{
+		{&pb.Msg{Cid: "UUWV", Id: "7", Tp: "oldi", Txt: "(ACT)"}, "\x02UUWV\x1f7\x1foldi\x1f(ACT)\x03", false},
+		{&pb.Msg{Cid: "UUWV", Txt: "(ACT)"}, "\x02UUWV\x1f\x1f\x1f(ACT)\x03", false},
+		{&pb.Msg{Cid: "UU\x02WV", Txt: "(ACT)"}, "", true},
+		{&pb.Msg{Cid: "UUWV", Id: "7\x1f", Txt: "(ACT)"}, "", true},
+		{&pb.Msg{Cid: "UUWV", Tp: "\x03", Txt: "(ACT)"}, "", true},
+		{&pb.Msg{Cid: "UUWV", Txt: "(ACT\x03)"}, "", true},
+		{&pb.Msg{Cid: "UUWV", Txt: "(ACT\x1f)"}, "", true},
+	}
+	for _, c := range cases {
+		got, err := encodeFrame(c.msg)
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%q: error %v, want error %v", c.msg.Txt, err, c.wantErr)
+		}
+		if string(got) != c.want {
+			t.Fatalf("%q: frame %q, want %q", c.msg.Txt, got, c.want)
+		}
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	msg := &pb.Msg{Cid: "UUWV", Id: "7", Tp: "oldi", Txt: "(ACT-AFR123)"}
+	data, err := encodeFrame(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fd frameDecoder
+	frames, dropped := fd.feed(data)
+	if len(frames) != 1 || dropped != 0 {
+		t.Fatalf("%d frames, %d dropped", len(frames), dropped)
+	}
+	got, err := decodeFrame(frames[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cid != msg.Cid || got.Id != msg.Id || got.Tp != msg.Tp || got.Txt != msg.Txt {
+		t.Fatalf("decoded %+v, want %+v", got, msg)
+	}
+}
+
+func TestFrameDecoderFeed(t *testing.T) {
+	oversize := "\x02" + strings.Repeat("a", maxFrameSize)
+
+	cases := []struct {
+		name        string
+		chunks      []string
+		wantFrames  []string
+		wantDropped int
+		wantBuffer  int // bytes left for the next feed
+	}{
+		{"single", []string{"\x02abc\x03"}, []string{"abc"}, 0, 0},
+		{"two in one read", []string{"\x02a\x03\x02b\x03"}, []string{"a", "b"}, 0, 0},
+		{"split frame", []string{"\x02ab", "c\x03"}, []string{"abc"}, 0, 0},
+		{"split before etx", []string{"\x02abc", "", "\x03\x02d"}, []string{"abc"}, 0, 2},
+		{"garbage prefix", []string{"xyz\x02abc\x03"}, []string{"abc"}, 3, 0},
+		{"garbage only", []string{"xyz"}, nil, 3, 0},
+		{"garbage between", []string{"\x02a\x03zz\x02b\x03"}, []string{"a", "b"}, 2, 0},
+		{"stx before etx", []string{"\x02lost\x02abc\x03"}, []string{"abc"}, 5, 0},
+		{"etx without stx", []string{"abc\x03"}, nil, 4, 0},
+		{"oversize", []string{oversize, "b\x03\x02c\x03"}, []string{"c"}, len(oversize) + 2, 0},
+		{"empty frame", []string{"\x02\x03"}, []string{""}, 0, 0},
+	}
+	for _, c := range cases {
+		var fd frameDecoder
+		var frames []string
+		dropped := 0
+		for _, chunk := range c.chunks {
+			got, drop := fd.feed([]byte(chunk))
+			for _, val := range got {
+				frames = append(frames, string(val))
+			}
+			dropped += drop
+		}
+		if !reflect.DeepEqual(frames, c.wantFrames) {
+			t.Fatalf("%s: frames %q, want %q", c.name, frames, c.wantFrames)
+		}
+		if dropped != c.wantDropped {
+			t.Fatalf("%s: dropped %d, want %d", c.name, dropped, c.wantDropped)
+		}
+		if len(fd.buffer) != c.wantBuffer {
+			t.Fatalf("%s: %d bytes buffered, want %d", c.name, len(fd.buffer), c.wantBuffer)
+		}
+	}
+}
+
+func TestFrameDecoderKeepsFrameData(t *testing.T) {
+	var fd frameDecoder
+	frames, _ := fd.feed([]byte("\x02abc\x03\x02de"))
+	fd.feed([]byte("f\x03"))
+	if !bytes.Equal(frames[0], []byte("abc")) {
+		t.Fatalf("frame changed by later feed: %q", frames[0])
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	cases := []struct {
+		data    string
+		want    *pb.Msg
+		wantErr bool
+	}{
+		{"UUWV\x1f7\x1foldi\x1f(ACT)", &pb.Msg{Cid: "UUWV", Id: "7", Tp: "oldi", Txt: "(ACT)"}, false},
+		{"UUWV\x1f\x1f\x1f", &pb.Msg{Cid: "UUWV"}, false},
+		{"UUWV\x1f7\x1f(ACT)", nil, true},
+		{"\x1f7\x1foldi\x1f(ACT)", nil, true},
+	}
+	for _, c := range cases {
+		got, err := decodeFrame([]byte(c.data))
+		if (err != nil) != c.wantErr {
+			t.Fatalf("%q: error %v, want error %v", c.data, err, c.wantErr)
+		}
+		if c.want != nil && (got.Cid != c.want.Cid || got.Id != c.want.Id || got.Tp != c.want.Tp || got.Txt != c.want.Txt) {
+			t.Fatalf("%q: decoded %+v, want %+v", c.data, got, c.want)
+		}
+	}
+}
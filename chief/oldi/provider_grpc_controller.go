@@ -0,0 +1,209 @@
+package oldi
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"fmtp/chief/chief_settings"
+	"fmtp/chief/chief_state"
+	pb "fmtp/chief/proto/fmtp"
+	chief_cfg "fmtp/configurator"
+	"fmtp/fmtp_log"
+
+	"lemz.com/fdps/logger"
+
+	"google.golang.org/grpc"
+)
+
+// период повторного запуска GRPC сервера после ошибки (например, порт занят)
+const grpcRestartInterval = 10 * time.Second
+
+// ProviderGrpcController контроллер для работы с провайдерами заданного типа (OLDI, AODB) по GRPC
+type ProviderGrpcController struct {
+	SettsChangedChan chan struct{} // канал для приема настроек провайдеров
+	ActiveChan       chan bool     // канал для приема признака работы с провайдерами (false - резервный контроллер пары)
+
+	FromFdpsChan chan pb.MsgWithChanId // канал для приема сообщений от провайдера
+	ToFdpsChan   chan *pb.Msg          // канал для отправки сообщений провайдеру
+
+	checkStateTicker      *time.Ticker      // тикер для проверки состояния контроллера
+	checkMsgForFdpsTicker *time.Ticker      // тикер проверки валидности сообщений для провайдера
+	grpcRestartTicker     *time.Ticker      // тикер повторного запуска GRPC сервера после ошибки
+	grpcFailedChan        chan *grpc.Server // канал уведомления об ошибке работы GRPC сервера
+
+	dataType    string // тип провайдеров (chief_settings.OLDIProvider, chief_settings.AODBProvider)
+	srvStateKey string // ключ состояния сервера на web странице
+
+	grpcServer  *grpc.Server
+	fmtpServer  *FmtpGrpcServerImpl
+	grpcAddress string
+	grpcTls     chief_settings.ProviderTlsSettings // текущие настройки TLS сервера
+	grpcServed  bool
+	active      bool // признак работы с провайдерами (ведущий контроллер пары)
+}
+
+// NewProviderGrpcController конструктор контроллера провайдеров типа dataType
+func NewProviderGrpcController(dataType string) *ProviderGrpcController {
+	return &ProviderGrpcController{
+		SettsChangedChan:      make(chan struct{}, 10),
+		ActiveChan:            make(chan bool, 10),
+		active:                true,
+		FromFdpsChan:          make(chan pb.MsgWithChanId, 1024),
+		ToFdpsChan:            make(chan *pb.Msg, 1024),
+		checkStateTicker:      time.NewTicker(stateTickerInt),
+		checkMsgForFdpsTicker: time.NewTicker(MsgCleanInterval),
+		grpcRestartTicker:     time.NewTicker(grpcRestartInterval),
+		grpcFailedChan:        make(chan *grpc.Server, 1),
+		dataType:              dataType,
+		srvStateKey:           dataType + " GRPC. Состояние:",
+		fmtpServer:            NewFmtpGrpcServerImpl(dataType),
+	}
+}
+
+// порт GRPC сервера для провайдеров из настроек
+func (c *ProviderGrpcController) port() int {
+	if c.dataType == chief_settings.AODBProvider {
+		return chief_cfg.ChiefCfg.AodbProviderPort
+	}
+	return chief_cfg.ChiefCfg.OldiProviderPort
+}
+
+// запуск GRPC сервера. При ошибке сервер передается в grpcFailedChan для повторного запуска
+func (c *ProviderGrpcController) startGrpcServer(grpcServer *grpc.Server, address string) {
+	lis, err := net.Listen("tcp4", address)
+	if err != nil {
+		logger.PrintfErr("Ошибка запуска TCP сервера GRPC для провайдеров %s: %v", c.dataType, err)
+		logger.SetDebugParam(c.srvStateKey, srvStateErrorValue, logger.StateErrorColor)
+		c.grpcFailedChan <- grpcServer
+		return
+	}
+	logger.SetDebugParam(c.srvStateKey, srvStateOkValue+" Адрес: "+address, logger.StateOkColor)
+	if err := grpcServer.Serve(lis); err != nil {
+		logger.PrintfErr("Ошибка запуска GRPC сервера для провайдеров %s: %v", c.dataType, err)
+		logger.SetDebugParam(c.srvStateKey, srvStateErrorValue, logger.StateErrorColor)
+		c.grpcFailedChan <- grpcServer
+	}
+}
+
+// обработка ошибки работы GRPC сервера: сброс состояния, сервер запускается повторно по тикеру
+func (c *ProviderGrpcController) grpcServerFailed(grpcServer *grpc.Server) {
+	if grpcServer != c.grpcServer || !c.grpcServed {
+		return
+	}
+	c.grpcServer.Stop()
+	c.grpcServed = false
+	c.grpcAddress = ""
+}
+
+func (c *ProviderGrpcController) stopGrpcServer() {
+	if c.grpcServed {
+		c.grpcServer.Stop()
+		c.grpcServed = false
+	}
+}
+
+// запуск / перезапуск GRPC сервера в соответствии с настройками. Резервный контроллер пары сервер не запускает
+func (c *ProviderGrpcController) applySettings() {
+	var newGrpcAddress string
+	if c.active && c.port() > 0 {
+		newGrpcAddress = fmt.Sprintf(":%d", c.port())
+	}
+
+	if newGrpcAddress != c.grpcAddress || chief_cfg.ChiefCfg.ProviderTls != c.grpcTls {
+		c.grpcAddress = newGrpcAddress
+		c.grpcTls = chief_cfg.ChiefCfg.ProviderTls
+		c.stopGrpcServer()
+
+		if c.grpcAddress != "" {
+			grpcServer, err := NewProviderGrpcServer(c.fmtpServer)
+			if err != nil {
+				logger.PrintfErr("Ошибка создания GRPC сервера для провайдеров %s: %v", c.dataType, err)
+				logger.SetDebugParam(c.srvStateKey, srvStateErrorValue, logger.StateErrorColor)
+				// сервер создается повторно по тикеру
+				c.grpcAddress = ""
+				return
+			}
+			c.grpcServer = grpcServer
+			c.grpcServed = true
+			go c.startGrpcServer(c.grpcServer, c.grpcAddress)
+		} else if !c.active {
+			logger.SetDebugParam(c.srvStateKey, srvStateErrorValue+" Резервный контроллер.", logger.StateDefaultColor)
+		} else {
+			logger.SetDebugParam(c.srvStateKey, srvStateErrorValue+" Не задан порт.", logger.StateErrorColor)
+		}
+	}
+}
+
+// состояния провайдеров из настроек
+func (c *ProviderGrpcController) providerStates() []chief_state.ProviderState {
+	var states []chief_state.ProviderState
+	if !c.active {
+		return states
+	}
+
+	activeProviders := c.fmtpServer.ActiveProviders()
+
+	for _, val := range chief_cfg.ChiefCfg.ProviderSettingsByTransport(c.dataType, chief_settings.ProviderTransportGrpc) {
+		curState := chief_state.ProviderState{
+			ProviderID:    val.ID,
+			ProviderType:  val.DataType,
+			ProviderIPs:   val.IPAddresses,
+			ProviderState: chief_state.StateError,
+			Backlog:       c.fmtpServer.Backlog(val.ID),
+		}
+		if host, ok := activeProviders[val.ID]; ok {
+			curState.ProviderState = chief_state.StateOk
+			curState.ClientAddresses = host
+		}
+
+		states = append(states, curState)
+	}
+	return states
+}
+
+// Work реализация работы
+func (c *ProviderGrpcController) Work() {
+
+	for {
+		select {
+
+		// получены новые настройки контроллера
+		case <-c.SettsChangedChan:
+			c.applySettings()
+
+		// изменена роль контроллера в паре
+		case active := <-c.ActiveChan:
+			if active != c.active {
+				c.active = active
+				c.applySettings()
+			}
+
+		// ошибка работы GRPC сервера
+		case grpcServer := <-c.grpcFailedChan:
+			c.grpcServerFailed(grpcServer)
+
+		// повторный запуск GRPC сервера после ошибки
+		case <-c.grpcRestartTicker.C:
+			c.applySettings()
+
+		// получен новый пакет для отправки провайдеру
+		case incomeData := <-c.ToFdpsChan:
+			c.fmtpServer.AppendMsg(incomeData)
+
+		// сработал тикер проверки состояния контроллера
+		case <-c.checkStateTicker.C:
+			chief_state.SetGrpcProviderState(c.dataType, c.providerStates())
+
+		// сработал тикер проверки валидности сообщений для провайдера
+		case <-c.checkMsgForFdpsTicker.C:
+			c.fmtpServer.CleanOldMsg()
+
+		case msgFromFdps := <-c.fmtpServer.FromFdpsChan:
+			c.FromFdpsChan <- msgFromFdps
+
+			logger.PrintfInfo("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityInfo, c.dataType,
+				fmt.Sprintf("Получено сообщение от провайдера %s: %s", c.dataType, msgFromFdps.PbMsg.Txt)))
+		}
+	}
+}
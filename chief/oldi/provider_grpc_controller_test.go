@@ -0,0 +1,51 @@
+package oldi
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"fmtp/chief/chief_settings"
+	chief_cfg "fmtp/configurator"
+)
+
+func TestGrpcServerRestartAfterListenError(t *testing.T) {
+	busy, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	prevPort := chief_cfg.ChiefCfg.OldiProviderPort
+	chief_cfg.ChiefCfg.OldiProviderPort = busy.Addr().(*net.TCPAddr).Port
+	defer func() { chief_cfg.ChiefCfg.OldiProviderPort = prevPort }()
+
+	c := NewProviderGrpcController(chief_settings.OLDIProvider)
+	c.applySettings()
+	if !c.grpcServed {
+		t.Fatalf("server not started")
+	}
+
+	select {
+	case srv := <-c.grpcFailedChan:
+		c.grpcServerFailed(srv)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("listen error not reported")
+	}
+	if c.grpcServed || c.grpcAddress != "" {
+		t.Fatalf("server state not reset: served %v address %q", c.grpcServed, c.grpcAddress)
+	}
+
+	// the next restart tick starts the server again
+	busy.Close()
+	c.applySettings()
+	defer c.stopGrpcServer()
+	if !c.grpcServed || c.grpcAddress == "" {
+		t.Fatalf("server not restarted")
+	}
+	select {
+	case <-c.grpcFailedChan:
+		t.Fatalf("restarted server failed")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,62 @@
+package oldi
+
+import (
+	"fmt"
+	"time"
+
+	"fmtp/chief/chief_settings"
+	pb "fmtp/chief/proto/fmtp"
+	"fmtp/fmtp_log"
+
+	"lemz.com/fdps/logger"
+)
+
+// providerQueue очередь сообщений провайдера, получающего сообщения через RecvMsq.
+// У каждого провайдера своя очередь, поэтому сообщения не делятся между провайдерами.
+type providerQueue struct {
+	providerID int
+	msgs       []*pb.Msg
+}
+
+func newProviderQueue(providerID int) *providerQueue {
+	return &providerQueue{providerID: providerID, msgs: make([]*pb.Msg, 0)}
+}
+
+// pop извлечь из очереди не более maxCount сообщений
+func (pq *providerQueue) pop(maxCount int) []*pb.Msg {
+	count := len(pq.msgs)
+	if count > maxCount {
+		count = maxCount
+	}
+	retValue := make([]*pb.Msg, count)
+	copy(retValue, pq.msgs[:count])
+
+	for idx := 0; idx < count; idx++ {
+		pq.msgs[idx] = nil
+	}
+	pq.msgs = pq.msgs[count:]
+	return retValue
+}
+
+// cleanOld удаление сообщений, хранящихся в очереди дольше ttl. Возвращает кол-во удаленных.
+func (pq *providerQueue) cleanOld(nowTime time.Time, ttl time.Duration, dataType string) int {
+	removed := 0
+	for len(pq.msgs) > 0 && pq.msgs[0].Rrtime.AsTime().UTC().Add(ttl).Before(nowTime) {
+		logger.PrintfWarn("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityWarning, dataType,
+			fmt.Sprintf("Сообщение удалено из очереди на отправку провайдеру (ID %d) по истечении %v: %s", pq.providerID, ttl, pq.msgs[0].Txt)))
+		pq.msgs[0] = nil
+		pq.msgs = pq.msgs[1:]
+		removed++
+	}
+	return removed
+}
+
+// providerHasHost адрес клиента есть среди адресов провайдера из настроек
+func providerHasHost(sett chief_settings.ProviderSettings, host string) bool {
+	for _, ipVal := range sett.IPAddresses {
+		if ipVal == host {
+			return true
+		}
+	}
+	return false
+}
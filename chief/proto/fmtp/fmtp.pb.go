@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.27.1-devel
+// 	protoc-gen-go v1.27.1
 // 	protoc        v3.18.0
 // source: fmtp.proto
 
@@ -249,6 +249,437 @@ func (x *SvcResult) GetErrormessage() string {
 	return ""
 }
 
+// первое сообщение провайдера в потоке MsgStream
+type StreamHello struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Providerid   int32  `protobuf:"varint,1,opt,name=providerid,proto3" json:"providerid,omitempty"`     // идентификатор провайдера (из настроек контроллера)
+	Lastackedseq uint64 `protobuf:"varint,2,opt,name=lastackedseq,proto3" json:"lastackedseq,omitempty"` // номер последнего подтвержденного провайдером сообщения (для возобновления после переподключения)
+	Window       uint32 `protobuf:"varint,3,opt,name=window,proto3" json:"window,omitempty"`             // макс. кол-во отправленных провайдеру и не подтвержденных сообщений
+	Sessionid    string `protobuf:"bytes,4,opt,name=sessionid,proto3" json:"sessionid,omitempty"`        // идентификатор сессии из StreamWelcome предыдущего подключения (пусто - новая сессия)
+}
+
+func (x *StreamHello) Reset() {
+	*x = StreamHello{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fmtp_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamHello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamHello) ProtoMessage() {}
+
+func (x *StreamHello) ProtoReflect() protoreflect.Message {
+	mi := &file_fmtp_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamHello.ProtoReflect.Descriptor instead.
+func (*StreamHello) Descriptor() ([]byte, []int) {
+	return file_fmtp_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *StreamHello) GetProviderid() int32 {
+	if x != nil {
+		return x.Providerid
+	}
+	return 0
+}
+
+func (x *StreamHello) GetLastackedseq() uint64 {
+	if x != nil {
+		return x.Lastackedseq
+	}
+	return 0
+}
+
+func (x *StreamHello) GetWindow() uint32 {
+	if x != nil {
+		return x.Window
+	}
+	return 0
+}
+
+func (x *StreamHello) GetSessionid() string {
+	if x != nil {
+		return x.Sessionid
+	}
+	return ""
+}
+
+// ответ контроллера на StreamHello. Если идентификатор сессии отличается от переданного провайдером,
+// нумерация сообщений контроллера начата заново и lastackedseq провайдера не учитывается
+type StreamWelcome struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Sessionid   string `protobuf:"bytes,1,opt,name=sessionid,proto3" json:"sessionid,omitempty"`      // идентификатор сессии
+	Lastrecvseq uint64 `protobuf:"varint,2,opt,name=lastrecvseq,proto3" json:"lastrecvseq,omitempty"` // номер последнего принятого контроллером сообщения провайдера в этой сессии
+}
+
+func (x *StreamWelcome) Reset() {
+	*x = StreamWelcome{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fmtp_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamWelcome) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamWelcome) ProtoMessage() {}
+
+func (x *StreamWelcome) ProtoReflect() protoreflect.Message {
+	mi := &file_fmtp_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamWelcome.ProtoReflect.Descriptor instead.
+func (*StreamWelcome) Descriptor() ([]byte, []int) {
+	return file_fmtp_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StreamWelcome) GetSessionid() string {
+	if x != nil {
+		return x.Sessionid
+	}
+	return ""
+}
+
+func (x *StreamWelcome) GetLastrecvseq() uint64 {
+	if x != nil {
+		return x.Lastrecvseq
+	}
+	return 0
+}
+
+// сообщение с порядковым номером в потоке MsgStream
+type StreamMsg struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Seq uint64 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"` // порядковый номер сообщения в потоке отправителя
+	Msg *Msg   `protobuf:"bytes,2,opt,name=msg,proto3" json:"msg,omitempty"`  // сообщение
+}
+
+func (x *StreamMsg) Reset() {
+	*x = StreamMsg{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fmtp_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamMsg) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamMsg) ProtoMessage() {}
+
+func (x *StreamMsg) ProtoReflect() protoreflect.Message {
+	mi := &file_fmtp_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamMsg.ProtoReflect.Descriptor instead.
+func (*StreamMsg) Descriptor() ([]byte, []int) {
+	return file_fmtp_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StreamMsg) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *StreamMsg) GetMsg() *Msg {
+	if x != nil {
+		return x.Msg
+	}
+	return nil
+}
+
+// подтверждение получения сообщения в потоке MsgStream
+type StreamAck struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Seq          uint64 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`                  // номер подтверждаемого сообщения
+	Errormessage string `protobuf:"bytes,2,opt,name=errormessage,proto3" json:"errormessage,omitempty"` // сообщение об ошибке (пустое, если сообщение принято)
+}
+
+func (x *StreamAck) Reset() {
+	*x = StreamAck{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fmtp_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamAck) ProtoMessage() {}
+
+func (x *StreamAck) ProtoReflect() protoreflect.Message {
+	mi := &file_fmtp_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamAck.ProtoReflect.Descriptor instead.
+func (*StreamAck) Descriptor() ([]byte, []int) {
+	return file_fmtp_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StreamAck) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *StreamAck) GetErrormessage() string {
+	if x != nil {
+		return x.Errormessage
+	}
+	return ""
+}
+
+// сообщение провайдер -> контроллер
+type StreamReq struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Body:
+	//	*StreamReq_Hello
+	//	*StreamReq_Msg
+	//	*StreamReq_Ack
+	Body isStreamReq_Body `protobuf_oneof:"body"`
+}
+
+func (x *StreamReq) Reset() {
+	*x = StreamReq{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fmtp_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamReq) ProtoMessage() {}
+
+func (x *StreamReq) ProtoReflect() protoreflect.Message {
+	mi := &file_fmtp_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamReq.ProtoReflect.Descriptor instead.
+func (*StreamReq) Descriptor() ([]byte, []int) {
+	return file_fmtp_proto_rawDescGZIP(), []int{8}
+}
+
+func (m *StreamReq) GetBody() isStreamReq_Body {
+	if m != nil {
+		return m.Body
+	}
+	return nil
+}
+
+func (x *StreamReq) GetHello() *StreamHello {
+	if x, ok := x.GetBody().(*StreamReq_Hello); ok {
+		return x.Hello
+	}
+	return nil
+}
+
+func (x *StreamReq) GetMsg() *StreamMsg {
+	if x, ok := x.GetBody().(*StreamReq_Msg); ok {
+		return x.Msg
+	}
+	return nil
+}
+
+func (x *StreamReq) GetAck() *StreamAck {
+	if x, ok := x.GetBody().(*StreamReq_Ack); ok {
+		return x.Ack
+	}
+	return nil
+}
+
+type isStreamReq_Body interface {
+	isStreamReq_Body()
+}
+
+type StreamReq_Hello struct {
+	Hello *StreamHello `protobuf:"bytes,1,opt,name=hello,proto3,oneof"` // идентификация провайдера (первое сообщение)
+}
+
+type StreamReq_Msg struct {
+	Msg *StreamMsg `protobuf:"bytes,2,opt,name=msg,proto3,oneof"` // сообщение для FMTP канала
+}
+
+type StreamReq_Ack struct {
+	Ack *StreamAck `protobuf:"bytes,3,opt,name=ack,proto3,oneof"` // подтверждение получения сообщения от контроллера
+}
+
+func (*StreamReq_Hello) isStreamReq_Body() {}
+
+func (*StreamReq_Msg) isStreamReq_Body() {}
+
+func (*StreamReq_Ack) isStreamReq_Body() {}
+
+// сообщение контроллер -> провайдер
+type StreamResp struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Body:
+	//	*StreamResp_Msg
+	//	*StreamResp_Ack
+	//	*StreamResp_Welcome
+	Body isStreamResp_Body `protobuf_oneof:"body"`
+}
+
+func (x *StreamResp) Reset() {
+	*x = StreamResp{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_fmtp_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamResp) ProtoMessage() {}
+
+func (x *StreamResp) ProtoReflect() protoreflect.Message {
+	mi := &file_fmtp_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamResp.ProtoReflect.Descriptor instead.
+func (*StreamResp) Descriptor() ([]byte, []int) {
+	return file_fmtp_proto_rawDescGZIP(), []int{9}
+}
+
+func (m *StreamResp) GetBody() isStreamResp_Body {
+	if m != nil {
+		return m.Body
+	}
+	return nil
+}
+
+func (x *StreamResp) GetMsg() *StreamMsg {
+	if x, ok := x.GetBody().(*StreamResp_Msg); ok {
+		return x.Msg
+	}
+	return nil
+}
+
+func (x *StreamResp) GetAck() *StreamAck {
+	if x, ok := x.GetBody().(*StreamResp_Ack); ok {
+		return x.Ack
+	}
+	return nil
+}
+
+func (x *StreamResp) GetWelcome() *StreamWelcome {
+	if x, ok := x.GetBody().(*StreamResp_Welcome); ok {
+		return x.Welcome
+	}
+	return nil
+}
+
+type isStreamResp_Body interface {
+	isStreamResp_Body()
+}
+
+type StreamResp_Msg struct {
+	Msg *StreamMsg `protobuf:"bytes,1,opt,name=msg,proto3,oneof"` // сообщение из FMTP канала
+}
+
+type StreamResp_Ack struct {
+	Ack *StreamAck `protobuf:"bytes,2,opt,name=ack,proto3,oneof"` // подтверждение получения сообщения от провайдера
+}
+
+type StreamResp_Welcome struct {
+	Welcome *StreamWelcome `protobuf:"bytes,3,opt,name=welcome,proto3,oneof"` // ответ на StreamHello (первое сообщение)
+}
+
+func (*StreamResp_Msg) isStreamResp_Body() {}
+
+func (*StreamResp_Ack) isStreamResp_Body() {}
+
+func (*StreamResp_Welcome) isStreamResp_Body() {}
+
 var File_fmtp_proto protoreflect.FileDescriptor
 
 var file_fmtp_proto_rawDesc = []byte{
@@ -274,17 +705,64 @@ var file_fmtp_proto_rawDesc = []byte{
 	0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x22, 0x2f, 0x0a,
 	0x09, 0x53, 0x76, 0x63, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x22, 0x0a, 0x0c, 0x65, 0x72,
 	0x72, 0x6f, 0x72, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x0c, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x32, 0x80,
-	0x01, 0x0a, 0x0b, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x39,
-	0x0a, 0x07, 0x53, 0x65, 0x6e, 0x64, 0x4d, 0x73, 0x67, 0x12, 0x14, 0x2e, 0x46, 0x6d, 0x74, 0x70,
-	0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x4d, 0x73, 0x67, 0x4c, 0x69, 0x73, 0x74, 0x1a,
-	0x16, 0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x76,
-	0x63, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0x00, 0x12, 0x36, 0x0a, 0x07, 0x52, 0x65, 0x63,
-	0x76, 0x4d, 0x73, 0x71, 0x12, 0x13, 0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69,
-	0x63, 0x65, 0x2e, 0x53, 0x76, 0x63, 0x52, 0x65, 0x71, 0x1a, 0x14, 0x2e, 0x46, 0x6d, 0x74, 0x70,
-	0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x4d, 0x73, 0x67, 0x4c, 0x69, 0x73, 0x74, 0x22,
-	0x00, 0x42, 0x0c, 0x5a, 0x0a, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x66, 0x6d, 0x74, 0x70, 0x62,
-	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x52, 0x0c, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x87,
+	0x01, 0x0a, 0x0b, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x48, 0x65, 0x6c, 0x6c, 0x6f, 0x12, 0x1e,
+	0x0a, 0x0a, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x0a, 0x70, 0x72, 0x6f, 0x76, 0x69, 0x64, 0x65, 0x72, 0x69, 0x64, 0x12, 0x22,
+	0x0a, 0x0c, 0x6c, 0x61, 0x73, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x64, 0x73, 0x65, 0x71, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x0c, 0x6c, 0x61, 0x73, 0x74, 0x61, 0x63, 0x6b, 0x65, 0x64, 0x73,
+	0x65, 0x71, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x06, 0x77, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x65,
+	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x73,
+	0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x69, 0x64, 0x22, 0x4f, 0x0a, 0x0d, 0x53, 0x74, 0x72, 0x65,
+	0x61, 0x6d, 0x57, 0x65, 0x6c, 0x63, 0x6f, 0x6d, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x65, 0x73,
+	0x73, 0x69, 0x6f, 0x6e, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x73, 0x65,
+	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x69, 0x64, 0x12, 0x20, 0x0a, 0x0b, 0x6c, 0x61, 0x73, 0x74, 0x72,
+	0x65, 0x63, 0x76, 0x73, 0x65, 0x71, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x6c, 0x61,
+	0x73, 0x74, 0x72, 0x65, 0x63, 0x76, 0x73, 0x65, 0x71, 0x22, 0x41, 0x0a, 0x09, 0x53, 0x74, 0x72,
+	0x65, 0x61, 0x6d, 0x4d, 0x73, 0x67, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x03, 0x73, 0x65, 0x71, 0x12, 0x22, 0x0a, 0x03, 0x6d, 0x73, 0x67, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76,
+	0x69, 0x63, 0x65, 0x2e, 0x4d, 0x73, 0x67, 0x52, 0x03, 0x6d, 0x73, 0x67, 0x22, 0x41, 0x0a, 0x09,
+	0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x41, 0x63, 0x6b, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x73, 0x65, 0x71, 0x12, 0x22, 0x0a, 0x0c, 0x65,
+	0x72, 0x72, 0x6f, 0x72, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0c, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22,
+	0x9d, 0x01, 0x0a, 0x09, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x52, 0x65, 0x71, 0x12, 0x30, 0x0a,
+	0x05, 0x68, 0x65, 0x6c, 0x6c, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x46,
+	0x6d, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x48, 0x65, 0x6c, 0x6c, 0x6f, 0x48, 0x00, 0x52, 0x05, 0x68, 0x65, 0x6c, 0x6c, 0x6f, 0x12,
+	0x2a, 0x0a, 0x03, 0x6d, 0x73, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x46,
+	0x6d, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x4d, 0x73, 0x67, 0x48, 0x00, 0x52, 0x03, 0x6d, 0x73, 0x67, 0x12, 0x2a, 0x0a, 0x03, 0x61,
+	0x63, 0x6b, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x41, 0x63, 0x6b,
+	0x48, 0x00, 0x52, 0x03, 0x61, 0x63, 0x6b, 0x42, 0x06, 0x0a, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x22,
+	0xa4, 0x01, 0x0a, 0x0a, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x52, 0x65, 0x73, 0x70, 0x12, 0x2a,
+	0x0a, 0x03, 0x6d, 0x73, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x46, 0x6d,
+	0x74, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d,
+	0x4d, 0x73, 0x67, 0x48, 0x00, 0x52, 0x03, 0x6d, 0x73, 0x67, 0x12, 0x2a, 0x0a, 0x03, 0x61, 0x63,
+	0x6b, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65,
+	0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x41, 0x63, 0x6b, 0x48,
+	0x00, 0x52, 0x03, 0x61, 0x63, 0x6b, 0x12, 0x36, 0x0a, 0x07, 0x77, 0x65, 0x6c, 0x63, 0x6f, 0x6d,
+	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65,
+	0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x57, 0x65, 0x6c, 0x63,
+	0x6f, 0x6d, 0x65, 0x48, 0x00, 0x52, 0x07, 0x77, 0x65, 0x6c, 0x63, 0x6f, 0x6d, 0x65, 0x42, 0x06,
+	0x0a, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x32, 0xc4, 0x01, 0x0a, 0x0b, 0x46, 0x6d, 0x74, 0x70, 0x53,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x39, 0x0a, 0x07, 0x53, 0x65, 0x6e, 0x64, 0x4d, 0x73,
+	0x67, 0x12, 0x14, 0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e,
+	0x4d, 0x73, 0x67, 0x4c, 0x69, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65,
+	0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x76, 0x63, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22,
+	0x00, 0x12, 0x36, 0x0a, 0x07, 0x52, 0x65, 0x63, 0x76, 0x4d, 0x73, 0x71, 0x12, 0x13, 0x2e, 0x46,
+	0x6d, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x76, 0x63, 0x52, 0x65,
+	0x71, 0x1a, 0x14, 0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e,
+	0x4d, 0x73, 0x67, 0x4c, 0x69, 0x73, 0x74, 0x22, 0x00, 0x12, 0x42, 0x0a, 0x09, 0x4d, 0x73, 0x67,
+	0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x16, 0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x52, 0x65, 0x71, 0x1a, 0x17,
+	0x2e, 0x46, 0x6d, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x53, 0x74, 0x72,
+	0x65, 0x61, 0x6d, 0x52, 0x65, 0x73, 0x70, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x42, 0x0c, 0x5a,
+	0x0a, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x66, 0x6d, 0x74, 0x70, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
 }
 
 var (
@@ -299,27 +777,42 @@ func file_fmtp_proto_rawDescGZIP() []byte {
 	return file_fmtp_proto_rawDescData
 }
 
-var file_fmtp_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_fmtp_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_fmtp_proto_goTypes = []interface{}{
 	(*Msg)(nil),                   // 0: FmtpService.Msg
 	(*MsgList)(nil),               // 1: FmtpService.MsgList
 	(*SvcReq)(nil),                // 2: FmtpService.SvcReq
 	(*SvcResult)(nil),             // 3: FmtpService.SvcResult
-	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
+	(*StreamHello)(nil),           // 4: FmtpService.StreamHello
+	(*StreamWelcome)(nil),         // 5: FmtpService.StreamWelcome
+	(*StreamMsg)(nil),             // 6: FmtpService.StreamMsg
+	(*StreamAck)(nil),             // 7: FmtpService.StreamAck
+	(*StreamReq)(nil),             // 8: FmtpService.StreamReq
+	(*StreamResp)(nil),            // 9: FmtpService.StreamResp
+	(*timestamppb.Timestamp)(nil), // 10: google.protobuf.Timestamp
 }
 var file_fmtp_proto_depIdxs = []int32{
-	4, // 0: FmtpService.Msg.rrtime:type_name -> google.protobuf.Timestamp
-	4, // 1: FmtpService.Msg.rqtime:type_name -> google.protobuf.Timestamp
-	0, // 2: FmtpService.MsgList.list:type_name -> FmtpService.Msg
-	1, // 3: FmtpService.FmtpService.SendMsg:input_type -> FmtpService.MsgList
-	2, // 4: FmtpService.FmtpService.RecvMsq:input_type -> FmtpService.SvcReq
-	3, // 5: FmtpService.FmtpService.SendMsg:output_type -> FmtpService.SvcResult
-	1, // 6: FmtpService.FmtpService.RecvMsq:output_type -> FmtpService.MsgList
-	5, // [5:7] is the sub-list for method output_type
-	3, // [3:5] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	10, // 0: FmtpService.Msg.rrtime:type_name -> google.protobuf.Timestamp
+	10, // 1: FmtpService.Msg.rqtime:type_name -> google.protobuf.Timestamp
+	0,  // 2: FmtpService.MsgList.list:type_name -> FmtpService.Msg
+	0,  // 3: FmtpService.StreamMsg.msg:type_name -> FmtpService.Msg
+	4,  // 4: FmtpService.StreamReq.hello:type_name -> FmtpService.StreamHello
+	6,  // 5: FmtpService.StreamReq.msg:type_name -> FmtpService.StreamMsg
+	7,  // 6: FmtpService.StreamReq.ack:type_name -> FmtpService.StreamAck
+	6,  // 7: FmtpService.StreamResp.msg:type_name -> FmtpService.StreamMsg
+	7,  // 8: FmtpService.StreamResp.ack:type_name -> FmtpService.StreamAck
+	5,  // 9: FmtpService.StreamResp.welcome:type_name -> FmtpService.StreamWelcome
+	1,  // 10: FmtpService.FmtpService.SendMsg:input_type -> FmtpService.MsgList
+	2,  // 11: FmtpService.FmtpService.RecvMsq:input_type -> FmtpService.SvcReq
+	8,  // 12: FmtpService.FmtpService.MsgStream:input_type -> FmtpService.StreamReq
+	3,  // 13: FmtpService.FmtpService.SendMsg:output_type -> FmtpService.SvcResult
+	1,  // 14: FmtpService.FmtpService.RecvMsq:output_type -> FmtpService.MsgList
+	9,  // 15: FmtpService.FmtpService.MsgStream:output_type -> FmtpService.StreamResp
+	13, // [13:16] is the sub-list for method output_type
+	10, // [10:13] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
 }
 
 func init() { file_fmtp_proto_init() }
@@ -376,6 +869,88 @@ func file_fmtp_proto_init() {
 				return nil
 			}
 		}
+		file_fmtp_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamHello); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fmtp_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamWelcome); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fmtp_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamMsg); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fmtp_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamAck); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fmtp_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamReq); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_fmtp_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamResp); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_fmtp_proto_msgTypes[8].OneofWrappers = []interface{}{
+		(*StreamReq_Hello)(nil),
+		(*StreamReq_Msg)(nil),
+		(*StreamReq_Ack)(nil),
+	}
+	file_fmtp_proto_msgTypes[9].OneofWrappers = []interface{}{
+		(*StreamResp_Msg)(nil),
+		(*StreamResp_Ack)(nil),
+		(*StreamResp_Welcome)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -383,7 +958,7 @@ func file_fmtp_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_fmtp_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
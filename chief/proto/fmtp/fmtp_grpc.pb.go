@@ -24,6 +24,8 @@ const _ = grpc.SupportPackageIsVersion7
 type FmtpServiceClient interface {
 	SendMsg(ctx context.Context, in *MsgList, opts ...grpc.CallOption) (*SvcResult, error)
 	RecvMsq(ctx context.Context, in *SvcReq, opts ...grpc.CallOption) (*MsgList, error)
+	// двунаправленный поток сообщений (без периодического опроса RecvMsq)
+	MsgStream(ctx context.Context, opts ...grpc.CallOption) (FmtpService_MsgStreamClient, error)
 }
 
 type fmtpServiceClient struct {
@@ -52,12 +54,45 @@ func (c *fmtpServiceClient) RecvMsq(ctx context.Context, in *SvcReq, opts ...grp
 	return out, nil
 }
 
+func (c *fmtpServiceClient) MsgStream(ctx context.Context, opts ...grpc.CallOption) (FmtpService_MsgStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FmtpService_ServiceDesc.Streams[0], "/FmtpService.FmtpService/MsgStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fmtpServiceMsgStreamClient{stream}
+	return x, nil
+}
+
+type FmtpService_MsgStreamClient interface {
+	Send(*StreamReq) error
+	Recv() (*StreamResp, error)
+	grpc.ClientStream
+}
+
+type fmtpServiceMsgStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *fmtpServiceMsgStreamClient) Send(m *StreamReq) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *fmtpServiceMsgStreamClient) Recv() (*StreamResp, error) {
+	m := new(StreamResp)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // FmtpServiceServer is the server API for FmtpService service.
 // All implementations should embed UnimplementedFmtpServiceServer
 // for forward compatibility
 type FmtpServiceServer interface {
 	SendMsg(context.Context, *MsgList) (*SvcResult, error)
 	RecvMsq(context.Context, *SvcReq) (*MsgList, error)
+	// двунаправленный поток сообщений (без периодического опроса RecvMsq)
+	MsgStream(FmtpService_MsgStreamServer) error
 }
 
 // UnimplementedFmtpServiceServer should be embedded to have forward compatible implementations.
@@ -70,6 +105,9 @@ func (UnimplementedFmtpServiceServer) SendMsg(context.Context, *MsgList) (*SvcRe
 func (UnimplementedFmtpServiceServer) RecvMsq(context.Context, *SvcReq) (*MsgList, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RecvMsq not implemented")
 }
+func (UnimplementedFmtpServiceServer) MsgStream(FmtpService_MsgStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method MsgStream not implemented")
+}
 
 // UnsafeFmtpServiceServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to FmtpServiceServer will
@@ -118,6 +156,32 @@ func _FmtpService_RecvMsq_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FmtpService_MsgStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FmtpServiceServer).MsgStream(&fmtpServiceMsgStreamServer{stream})
+}
+
+type FmtpService_MsgStreamServer interface {
+	Send(*StreamResp) error
+	Recv() (*StreamReq, error)
+	grpc.ServerStream
+}
+
+type fmtpServiceMsgStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *fmtpServiceMsgStreamServer) Send(m *StreamResp) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *fmtpServiceMsgStreamServer) Recv() (*StreamReq, error) {
+	m := new(StreamReq)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // FmtpService_ServiceDesc is the grpc.ServiceDesc for FmtpService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -134,6 +198,13 @@ var FmtpService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _FmtpService_RecvMsq_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "MsgStream",
+			Handler:       _FmtpService_MsgStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "fmtp.proto",
 }
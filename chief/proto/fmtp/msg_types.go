@@ -0,0 +1,13 @@
+package fmtp
+
+// типы сообщений (поле Tp), передаваемых провайдеру
+const (
+	// MsgTpOperational сообщение поверх FMTP
+	MsgTpOperational = "operational"
+
+	// MsgTpLamAck получено логическое подтверждение (LAM) на сообщение с идентификатором Id
+	MsgTpLamAck = "lam_ack"
+
+	// MsgTpLamTimeout не получено логическое подтверждение (LAM) на сообщение с идентификатором Id
+	MsgTpLamTimeout = "lam_timeout"
+)
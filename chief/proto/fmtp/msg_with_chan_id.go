@@ -3,4 +3,8 @@ package fmtp
 type MsgWithChanId struct {
 	PbMsg  *Msg
 	ChanId int
+
+	DataType   string // тип провайдера, от которого получено сообщение ("OLDI" | "AODB")
+	RouteChans []int  // каналы маршрута сообщения в порядке приоритета (пусто - только ChanId)
+	FanOut     bool   // отправка во все каналы маршрута в состоянии data_ready
 }
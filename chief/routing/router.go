@@ -0,0 +1,109 @@
+package routing
+
+import (
+	"fmt"
+	"strings"
+
+	"fmtp/chief/chief_settings"
+	pb "fmtp/chief/proto/fmtp"
+)
+
+// DefaultRuleIdx номер правила для маршрута по умолчанию (каналы с удаленным ATC, равным CID)
+const DefaultRuleIdx = -1
+
+// Route маршрут сообщения провайдера в FMTP каналы
+type Route struct {
+	RuleIdx  int   // номер сработавшего правила маршрутизации (DefaultRuleIdx - маршрут по умолчанию)
+	Channels []int // идентификаторы каналов в порядке приоритета
+	FanOut   bool  // отправка во все каналы маршрута в состоянии data_ready
+}
+
+// Resolve определение маршрута сообщения от провайдера заданного типа.
+// Правила маршрутизации проверяются по порядку, используется первое подходящее,
+// в маршрут попадают только каналы правила того же типа, что и провайдер.
+// Если ни одно правило не подошло, сообщение направляется в каналы того же типа с удаленным ATC, равным CID.
+func Resolve(setts *chief_settings.ChiefSettings, msg *pb.Msg, dataType string) (Route, error) {
+	for idx, val := range setts.RoutingRules {
+		if !val.Matches(msg.Cid, dataType, msg.Tp) {
+			continue
+		}
+		if chIds := channelsOfType(setts, val.Channels, dataType); len(chIds) > 0 {
+			return Route{RuleIdx: idx, Channels: chIds, FanOut: val.FanOut}, nil
+		}
+	}
+
+	retValue := Route{RuleIdx: DefaultRuleIdx}
+	for _, val := range setts.ChannelSetts {
+		if val.RemoteATC == msg.Cid && val.DataType == dataType {
+			retValue.Channels = append(retValue.Channels, val.Id)
+		}
+	}
+	if len(retValue.Channels) == 0 {
+		return retValue, fmt.Errorf("Не найден FMTP канал для отправки сообщения. CID (remote ATC): %s", msg.Cid)
+	}
+	return retValue, nil
+}
+
+// каналы из списка, имеющие заданный тип (порядок сохраняется, отсутствующие в настройках каналы пропускаются)
+func channelsOfType(setts *chief_settings.ChiefSettings, chIds []int, dataType string) []int {
+	var retValue []int
+	for _, chID := range chIds {
+		for _, val := range setts.ChannelSetts {
+			if val.Id == chID {
+				if val.DataType == dataType {
+					retValue = append(retValue, chID)
+				}
+				break
+			}
+		}
+	}
+	return retValue
+}
+
+// Select выбор каналов для отправки сообщения с учетом готовности каналов.
+// Без FanOut выбирается первый готовый канал (failover - признак того, что это не основной канал маршрута),
+// с FanOut - все готовые каналы.
+func (r Route) Select(isReady func(chId int) bool) (targets []int, failover bool) {
+	for idx, val := range r.Channels {
+		if !isReady(val) {
+			continue
+		}
+		if !r.FanOut {
+			return []int{val}, idx > 0
+		}
+		targets = append(targets, val)
+	}
+	return targets, false
+}
+
+// String описание маршрута для журнала
+func (r Route) String() string {
+	var chIds []string
+	for _, val := range r.Channels {
+		chIds = append(chIds, fmt.Sprint(val))
+	}
+
+	var ruleStr string
+	if r.RuleIdx == DefaultRuleIdx {
+		ruleStr = "по умолчанию"
+	} else {
+		ruleStr = fmt.Sprintf("правило %d", r.RuleIdx+1)
+	}
+
+	retValue := fmt.Sprintf("%s, каналы [%s]", ruleStr, strings.Join(chIds, ", "))
+	if r.FanOut {
+		retValue += ", во все каналы"
+	}
+	return retValue
+}
+
+// Packet формирование пакета для передачи сообщения в FMTP каналы по маршруту
+func (r Route) Packet(msg *pb.Msg, dataType string) pb.MsgWithChanId {
+	return pb.MsgWithChanId{
+		PbMsg:      msg,
+		ChanId:     r.Channels[0],
+		DataType:   dataType,
+		RouteChans: r.Channels,
+		FanOut:     r.FanOut,
+	}
+}
@@ -0,0 +1,94 @@
+package routing
+
+import (
+	"reflect"
+	"testing"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/chief/chief_settings"
+	pb "fmtp/chief/proto/fmtp"
+)
+
+func testSettings() *chief_settings.ChiefSettings {
+	return &chief_settings.ChiefSettings{
+		ChannelSetts: []channel_settings.ChannelSettings{
+			{Id: 1, DataType: chief_settings.OLDIProvider, RemoteATC: "UUUU"},
+			{Id: 2, DataType: chief_settings.AODBProvider, RemoteATC: "UUUU"},
+			{Id: 3, DataType: chief_settings.OLDIProvider, RemoteATC: "UUUU"},
+			{Id: 4, DataType: chief_settings.AODBProvider, RemoteATC: "UEEE"},
+		},
+		RoutingRules: []chief_settings.RouteRule{
+			// rule without data type lists channels of both types
+			{Cid: "UUUU", Channels: []int{2, 1, 3}},
+			// rule with channels of another type only
+			{Cid: "UEEE", Channels: []int{4}},
+		},
+	}
+}
+
+func TestResolveFiltersDataType(t *testing.T) {
+	setts := testSettings()
+
+	cases := []struct {
+		cid      string
+		dataType string
+		ruleIdx  int
+		channels []int
+	}{
+		{"UUUU", chief_settings.OLDIProvider, 0, []int{1, 3}},
+		{"UUUU", chief_settings.AODBProvider, 0, []int{2}},
+		{"UEEE", chief_settings.AODBProvider, 1, []int{4}},
+	}
+
+	for idx, val := range cases {
+		route, err := Resolve(setts, &pb.Msg{Cid: val.cid}, val.dataType)
+		if err != nil {
+			t.Fatalf("case %d: %v", idx, err)
+		}
+		if route.RuleIdx != val.ruleIdx || !reflect.DeepEqual(route.Channels, val.channels) {
+			t.Fatalf("case %d: rule %d channels %v, want %d %v", idx, route.RuleIdx, route.Channels, val.ruleIdx, val.channels)
+		}
+	}
+
+	// OLDI message matches only a rule with AODB channels and there is no OLDI channel for the CID
+	if _, err := Resolve(setts, &pb.Msg{Cid: "UEEE"}, chief_settings.OLDIProvider); err == nil {
+		t.Fatalf("message routed to a channel of another data type")
+	}
+}
+
+func TestResolveDefaultRoute(t *testing.T) {
+	setts := testSettings()
+	setts.RoutingRules = nil
+
+	route, err := Resolve(setts, &pb.Msg{Cid: "UUUU"}, chief_settings.AODBProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if route.RuleIdx != DefaultRuleIdx || !reflect.DeepEqual(route.Channels, []int{2}) {
+		t.Fatalf("default route %v", route)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	ready := map[int]bool{3: true, 5: true}
+	isReady := func(chId int) bool { return ready[chId] }
+
+	targets, failover := Route{Channels: []int{1, 3, 5}}.Select(isReady)
+	if !reflect.DeepEqual(targets, []int{3}) || !failover {
+		t.Fatalf("failover: targets %v failover %v", targets, failover)
+	}
+
+	targets, failover = Route{Channels: []int{5, 3}}.Select(isReady)
+	if !reflect.DeepEqual(targets, []int{5}) || failover {
+		t.Fatalf("primary: targets %v failover %v", targets, failover)
+	}
+
+	targets, _ = Route{Channels: []int{1, 3, 5}, FanOut: true}.Select(isReady)
+	if !reflect.DeepEqual(targets, []int{3, 5}) {
+		t.Fatalf("fan-out: targets %v", targets)
+	}
+
+	if targets, _ = (Route{Channels: []int{1}}).Select(isReady); len(targets) != 0 {
+		t.Fatalf("no ready channel: targets %v", targets)
+	}
+}
@@ -21,7 +21,11 @@ type TkyController struct {
 var tkyCntrl TkyController
 
 func genTkyState() StateForTky {
-	var retState StateForTky
+	retState := StateForTky{
+		ChiefRole:  chief_state.CommonChiefState.Role,
+		ChiefNode:  chief_state.CommonChiefState.NodeID,
+		LeaderNode: chief_state.CommonChiefState.LeaderNode,
+	}
 
 	for _, val := range chief_state.CommonChiefState.ChannelStates {
 		retState.DaemonStates = append(retState.DaemonStates,
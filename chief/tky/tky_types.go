@@ -1,6 +1,9 @@
 package tky
 
 type StateForTky struct {
+	ChiefRole      string // роль контроллера в паре ("single" | "leader" | "standby")
+	ChiefNode      string // имя экземпляра контроллера
+	LeaderNode     string // имя ведущего экземпляра пары
 	DaemonStates   []DaemonState
 	ProviderStates []ProviderState
 }
@@ -0,0 +1,290 @@
+package chief_channel
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/configurator"
+
+	"lemz.com/fdps/logger"
+	"lemz.com/fdps/utils"
+)
+
+// время ожидания ответа docker при поиске контейнеров каналов
+const adoptDockerTimeout = 10 * time.Second
+
+// префикс имени docker контейнеров каналов, запущенных без меток
+const legacyContainerPrefix = "fmtp_channel_"
+
+// имя docker контейнера канала, запущенного без меток: "fmtp_channel_<локальный ATC>_<удаленный ATC>_<ID канала>"
+var legacyContainerName = regexp.MustCompile("^/?" + legacyContainerPrefix + ".+_([0-9]+)$")
+
+// adoptCandidate экземпляр FMTP канала (docker контейнер или процесс), запущенный до перезапуска контроллера
+type adoptCandidate struct {
+	ChannelID    int
+	Runner       string // способ запуска ("docker" | "process")
+	SettingsHash string // хэш настроек, с которыми запущен канал
+	ContainerID  string // идентификатор docker контейнера
+	Pid          int    // идентификатор процесса
+	BinaryPath   string // путь к исполняемому файлу процесса
+	Token        string // токен, выданный каналу при запуске (пусто - канал запущен контроллером старой версии)
+	Legacy       bool   // docker контейнер запущен контроллером без поддержки меток (найден по имени и образу)
+}
+
+func (ac adoptCandidate) String() string {
+	if ac.Runner == channel_settings.RunnerDocker {
+		return fmt.Sprintf("docker контейнер %.12s", ac.ContainerID)
+	}
+	return fmt.Sprintf("процесс %d (%s)", ac.Pid, ac.BinaryPath)
+}
+
+// adoptStore экземпляры каналов, найденные при старте контроллера и ожидающие получения настроек.
+// Экземпляры, запущенные с текущими настройками, подхватываются, остальные останавливаются.
+type adoptStore struct {
+	sync.Mutex
+	items map[int]adoptCandidate // ключ - ID канала
+}
+
+func newAdoptStore(candidates []adoptCandidate) *adoptStore {
+	retValue := &adoptStore{items: make(map[int]adoptCandidate)}
+	for _, val := range candidates {
+		if prev, ok := retValue.items[val.ChannelID]; ok {
+			logger.PrintfWarn("Найдено несколько экземпляров FMTP канала с ID = %d. Останавливается %s.", val.ChannelID, prev)
+			stopStaleChannel(prev)
+		}
+		retValue.items[val.ChannelID] = val
+	}
+	return retValue
+}
+
+// take извлечение экземпляра канала
+func (s *adoptStore) take(channelID int) (adoptCandidate, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	val, ok := s.items[channelID]
+	delete(s.items, channelID)
+	return val, ok
+}
+
+// takeAll извлечение всех оставшихся экземпляров
+func (s *adoptStore) takeAll() []adoptCandidate {
+	s.Lock()
+	defer s.Unlock()
+
+	var retValue []adoptCandidate
+	for _, val := range s.items {
+		retValue = append(retValue, val)
+	}
+	s.items = make(map[int]adoptCandidate)
+	return retValue
+}
+
+// settingsHash хэш настроек запуска канала. Экземпляр, запущенный с другими настройками, не подхватывается
+func settingsHash(runner string, chSett channel_settings.ChannelSettings, opts RunOptions) string {
+	hashData := struct {
+		Runner    string
+		Settings  channel_settings.ChannelSettings
+		ChiefPort int
+		Image     string                             `json:",omitempty"`
+		Profile   *channel_settings.ContainerProfile `json:",omitempty"`
+	}{Runner: runner, Settings: chSett, ChiefPort: opts.ChiefPort}
+
+	if runner == channel_settings.RunnerDocker {
+		hashData.Image = channelImageName(chSett)
+		hashData.Profile = &opts.Profile
+	}
+	data, _ := json.Marshal(hashData)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// поиск экземпляров каналов, запущенных до перезапуска контроллера
+func discoverChannels(withDocker bool) []adoptCandidate {
+	retValue := discoverProcesses()
+	if withDocker {
+		retValue = append(retValue, discoverContainers()...)
+	}
+	for _, val := range retValue {
+		logger.PrintfInfo("Найден запущенный ранее FMTP канал с ID = %d: %s.", val.ChannelID, val)
+	}
+	return retValue
+}
+
+// поиск docker контейнеров каналов по метке с ID канала, либо по имени и образу (контейнеры, запущенные контроллером без поддержки меток).
+// Контейнеры без метки хэша настроек не подхватываются, а перезапускаются.
+func discoverContainers() []adoptCandidate {
+	ctx, cancel := context.WithTimeout(context.Background(), adoptDockerTimeout)
+	defer cancel()
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		logger.PrintfErr("Ошибка создания клиента сервиса docker. Ошибка: %v", err)
+		return nil
+	}
+	defer cli.Close()
+
+	containers := make(map[string]types.Container) // ключ - идентификатор контейнера
+	for _, filter := range []filters.KeyValuePair{
+		filters.Arg("label", channel_settings.LabelChannelID),
+		filters.Arg("name", legacyContainerPrefix),
+	} {
+		found, err := cli.ContainerList(ctx, types.ContainerListOptions{Filters: filters.NewArgs(filter)})
+		if err != nil {
+			logger.PrintfErr("Ошибка получения списка docker контейнеров FMTP каналов. Ошибка: %v.", err)
+			return nil
+		}
+		for _, val := range found {
+			containers[val.ID] = val
+		}
+	}
+
+	var retValue []adoptCandidate
+	for _, val := range containers {
+		chIDText, labeled := val.Labels[channel_settings.LabelChannelID]
+		if !labeled {
+			if chIDText = legacyChannelID(val); chIDText == "" {
+				continue
+			}
+		}
+		chID, convErr := strconv.Atoi(chIDText)
+		if convErr != nil {
+			continue
+		}
+		retValue = append(retValue, adoptCandidate{
+			ChannelID:    chID,
+			Runner:       channel_settings.RunnerDocker,
+			SettingsHash: val.Labels[channel_settings.LabelSettings],
+			ContainerID:  val.ID,
+			Token:        containerToken(ctx, cli, val.ID),
+			Legacy:       !labeled,
+		})
+	}
+	return retValue
+}
+
+// ID канала из имени docker контейнера без меток. Пусто - контейнер не является контейнером FMTP канала
+// (имя не соответствует формату или контейнер создан не из образа канала)
+func legacyChannelID(cnt types.Container) string {
+	if !isChannelImage(cnt.Image) {
+		return ""
+	}
+	for _, name := range cnt.Names {
+		if match := legacyContainerName.FindStringSubmatch(name); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+// признак docker образа FMTP канала. Образ указывается с адресом реестра и версией ("<реестр>/fmtp_channel:<версия>"),
+// поэтому сравнивается только имя образа
+func isChannelImage(image string) bool {
+	if pos := strings.Index(image, "@"); pos >= 0 {
+		image = image[:pos]
+	}
+	if pos := strings.LastIndex(image, "/"); pos >= 0 {
+		image = image[pos+1:]
+	}
+	if pos := strings.Index(image, ":"); pos >= 0 {
+		image = image[:pos]
+	}
+	return image == configurator.ChannelImageName
+}
+
+// токен канала из переменных окружения docker контейнера
+func containerToken(ctx context.Context, cli *client.Client, containerID string) string {
+	info, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil || info.Config == nil {
+		return ""
+	}
+	for _, val := range info.Config.Env {
+		if strings.HasPrefix(val, ChannelTokenEnv+"=") {
+			return strings.TrimPrefix(val, ChannelTokenEnv+"=")
+		}
+	}
+	return ""
+}
+
+// поиск процессов каналов по файлам сведений о запущенных процессах
+func discoverProcesses() []adoptCandidate {
+	var retValue []adoptCandidate
+	for _, info := range readProcessInfos() {
+		if !processAlive(info.Pid, info.BinaryPath) {
+			removeProcessFiles(info.ChannelID)
+			if err := utils.RemoveBinary(info.BinaryPath); err != nil {
+				logger.PrintfErr("%v", err)
+			}
+			continue
+		}
+		retValue = append(retValue, adoptCandidate{
+			ChannelID:    info.ChannelID,
+			Runner:       channel_settings.RunnerProcess,
+			SettingsHash: info.SettingsHash,
+			Pid:          info.Pid,
+			BinaryPath:   info.BinaryPath,
+			Token:        info.Token,
+		})
+	}
+	return retValue
+}
+
+// остановка экземпляра канала, который не может быть подхвачен
+func stopStaleChannel(cand adoptCandidate) {
+	logger.PrintfInfo("Остановка запущенного ранее FMTP канала с ID = %d: %s.", cand.ChannelID, cand)
+
+	switch cand.Runner {
+	case channel_settings.RunnerDocker:
+		ctx, cancel := context.WithTimeout(context.Background(), adoptDockerTimeout)
+		defer cancel()
+
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			logger.PrintfErr("Ошибка создания клиента сервиса docker. Ошибка: %v", err)
+			return
+		}
+		defer cli.Close()
+
+		// контейнер без меток только останавливается (удаляется docker, т.к. запущен с AutoRemove).
+		// Принудительно удаляются только контейнеры с меткой ID канала
+		if cand.Legacy {
+			if stopErr := cli.ContainerStop(ctx, cand.ContainerID, nil); stopErr != nil {
+				logger.PrintfErr("Ошибка остановки docker контейнера %.12s. Ошибка: %v.", cand.ContainerID, stopErr)
+			}
+			return
+		}
+
+		// удаление с остановкой, чтобы имя контейнера было свободно при запуске канала
+		if rmErr := cli.ContainerRemove(ctx, cand.ContainerID, types.ContainerRemoveOptions{Force: true}); rmErr != nil {
+			logger.PrintfErr("Ошибка удаления docker контейнера %.12s. Ошибка: %v.", cand.ContainerID, rmErr)
+		}
+
+	case channel_settings.RunnerProcess:
+		if proc, err := os.FindProcess(cand.Pid); err == nil {
+			if killErr := proc.Kill(); killErr != nil {
+				logger.PrintfErr("Ошибка завершения процесса %d FMTP канала. Ошибка: %v.", cand.Pid, killErr)
+			}
+			if done, watchErr := watchProcess(cand.Pid); watchErr == nil {
+				<-done
+			}
+		}
+		removeProcessFiles(cand.ChannelID)
+		if err := utils.RemoveBinary(cand.BinaryPath); err != nil {
+			logger.PrintfErr("%v", err)
+		}
+	}
+}
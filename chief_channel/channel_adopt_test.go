@@ -0,0 +1,31 @@
+package chief_channel
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestLegacyChannelID(t *testing.T) {
+	cases := []struct {
+		image string
+		name  string
+		chID  string
+	}{
+		{"fmtp_channel:1.2.0", "/fmtp_channel_UUWW_EGLL_12", "12"},
+		{"registry:5000/fdps/fmtp_channel:1.2.0", "/fmtp_channel_UU_WW_EG_LL_3", "3"},
+		{"fmtp_channel@sha256:abcd", "/fmtp_channel_UUWW_EGLL_4", "4"},
+		{"fmtp_channel:1.2.0", "/fmtp_channel_UUWW_EGLL_x", ""},
+		{"fmtp_channel:1.2.0", "/fmtp_channel_12", ""},
+		{"fmtp_channel:1.2.0", "/my_fmtp_channel_UUWW_EGLL_12", ""},
+		{"fmtp_channel:1.2.0", "/fmtp_channel_UUWW_EGLL_12_backup", ""},
+		{"postgres:13", "/fmtp_channel_UUWW_EGLL_12", ""},
+		{"fmtp_channel_tools:1.0", "/fmtp_channel_UUWW_EGLL_12", ""},
+	}
+	for _, val := range cases {
+		got := legacyChannelID(types.Container{Image: val.image, Names: []string{val.name}})
+		if got != val.chID {
+			t.Fatalf("%s %s: channel id %q, want %q", val.image, val.name, got, val.chID)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package chief_channel
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/channel/channel_state"
+	"fmtp/channel/fmtp_states"
+	"fmtp/fmtp"
+	"fmtp/fmtp_log"
+
+	"lemz.com/fdps/logger"
+)
+
+// макс. кол-во сообщений от контроллера каналов, ожидающих передачи контроллеру состояния
+const maxPendingFmtpMessages = 1024
+
+// ChannelApp логика приложения FMTP канал: обмен сообщениями с контроллером каналов и работа контроллера FMTP состояний.
+// Используется приложением FMTP канал (отдельный процесс или docker контейнер) и при запуске канала в процессе контроллера.
+type ChannelApp struct {
+	ReceiveChan <-chan []byte                    // данные от контроллера каналов
+	SendChan    chan<- []byte                    // данные для контроллера каналов
+	LogChan     <-chan fmtp_log.LogMessage       // сообщения для журнала от клиента контроллера каналов (nil - нет)
+	setts       channel_settings.ChannelSettings // настройки FMTP канала
+
+	stateCntrl   *fmtp_states.StateController // контроллер состояния канала FMTP
+	cntrlErrChan chan error                   // канал для передачи ошибки (паники) контроллера состояния
+	standalone   bool                         // отдельное приложение: вывод в собственный журнал и на web страницу канала
+	stopChan     <-chan struct{}              // канал остановки работы (передается в Work)
+
+	protocolVersion int      // согласованная с контроллером версия протокола (0 - контроллер старой версии)
+	capabilities    []string // согласованные с контроллером возможности
+
+	ackEnabled   bool    // подтверждаемая доставка сообщений поверх FMTP (согласовано при рукопожатии)
+	out          *outbox // сообщения канала, не подтвержденные контроллером
+	in           inbox   // последнее сообщение, полученное от контроллера
+	chiefSession string  // идентификатор экземпляра контроллера каналов
+
+	toFmtp []fmtp.FmtpMessage // сообщения от контроллера, ожидающие передачи контроллеру состояния
+}
+
+// NewChannelApp конструктор. initSetts - начальные настройки канала (ID, ATC, тип данных), остальные настройки запрашиваются у контроллера.
+// standalone - канал работает отдельным приложением (false - в процессе контроллера).
+func NewChannelApp(initSetts channel_settings.ChannelSettings, recvChan <-chan []byte, sendChan chan<- []byte, standalone bool) *ChannelApp {
+	return &ChannelApp{
+		ReceiveChan:  recvChan,
+		SendChan:     sendChan,
+		setts:        initSetts,
+		cntrlErrChan: make(chan error, 1),
+		standalone:   standalone,
+		out:          newOutbox(),
+	}
+}
+
+// Work реализация работы. Завершается при закрытии stopChan (или получении из него значения).
+// Возвращает ошибку, если работа контроллера состояния завершилась аварийно или контроллер отклонил подключение канала.
+func (a *ChannelApp) Work(stopChan <-chan struct{}) error {
+	a.stopChan = stopChan
+	defer func() {
+		if a.stateCntrl != nil {
+			a.stateCntrl.Stop()
+		}
+		if a.out.len() > 0 {
+			logger.PrintfErr("Завершение FMTP канала с ID = %d. Не подтверждено контроллером сообщений: %d.", a.setts.Id, a.out.len())
+		}
+	}()
+
+	for {
+		select {
+		// получены данные от контроллера каналов
+		case curData := <-a.ReceiveChan:
+			if err := a.processChiefData(curData); err != nil {
+				return err
+			}
+
+		// получено сообщение для журнала от клиента контроллера каналов
+		case curLogMsg := <-a.LogChan:
+			a.sendLog(curLogMsg)
+
+		// остановка канала
+		case <-stopChan:
+			return nil
+
+		// аварийное завершение контроллера состояния
+		case cntrlErr := <-a.cntrlErrChan:
+			return cntrlErr
+
+		// получено текущее состояние канала
+		case curState := <-a.stateChan():
+			if a.standalone {
+				if curState.FmtpState == "data_ready" {
+					logger.SetDebugParam("FMTP состояние:", curState.FmtpState, channel_state.WebOkColor)
+				} else {
+					logger.SetDebugParam("FMTP состояние:", curState.FmtpState, channel_state.WebErrorColor)
+				}
+			}
+
+			// отправляем heartbeat сообщение контроллеру (chief)
+			curState.UnackedIn = a.out.len()
+			if dataToSend, err := json.Marshal(CreateChannelHeartbeatMsg(curState)); err == nil {
+				a.send(dataToSend)
+			}
+
+		// получено сообщение для журнала от контроллера состояния
+		case curLogMsg := <-a.logChan():
+			a.sendLog(curLogMsg)
+
+		// получено сообщение поверх FMTP от контроллера состояния
+		case curDataMessage := <-a.dataChan():
+			a.sendData(CreateChannelDataMsg(a.setts.Id, curDataMessage))
+
+		// передано контроллеру состояния сообщение от контроллера каналов
+		case a.fmtpSendChan() <- a.nextToFmtp():
+			a.toFmtp[0] = fmtp.FmtpMessage{}
+			a.toFmtp = a.toFmtp[1:]
+		}
+	}
+}
+
+// обработка данных от контроллера каналов. Возвращает ошибку, если контроллер отклонил подключение канала
+func (a *ChannelApp) processChiefData(curData []byte) error {
+	var headerMsg HeaderMsg
+
+	if err := json.Unmarshal(curData, &headerMsg); err != nil {
+		a.createLogMessage(fmtp_log.SeverityError,
+			fmt.Sprintf("От контроллера получено сообщение неизвестного формата. Сообщение: <%s>. Ошибка: <%s>.",
+				string(curData), err.Error()))
+		return nil
+	}
+
+	switch headerMsg.Header {
+	case AnswerSettingsHeader:
+		var answerMsg SettingsAnswerMsg
+		if err := json.Unmarshal(curData, &answerMsg); err != nil {
+			a.createLogMessage(fmtp_log.SeverityError,
+				fmt.Sprintf("Получено сообщение неизвестного формата. Сообщение: <%s>. Ошибка: <%s>.", string(curData), err.Error()))
+			return nil
+		}
+		a.protocolVersion = answerMsg.ProtocolVersion
+		a.capabilities = answerMsg.Capabilities
+		a.syncDelivery(answerMsg)
+
+		// повторный ответ на рукопожатие после восстановления связи с контроллером.
+		// Контроллер состояния уже запущен, при изменении настроек канал перезапускается контроллером каналов
+		if a.stateCntrl != nil {
+			a.createLogMessage(fmtp_log.SeverityDebug,
+				fmt.Sprintf("Восстановлено подключение к контроллеру. Версия протокола: %d.", a.protocolVersion))
+			return nil
+		}
+
+		a.setts = answerMsg.ChannelSettings
+		if checkErr := a.setts.CheckSettings(); checkErr != nil {
+			a.createLogMessage(fmtp_log.SeverityError,
+				fmt.Sprintf("Получены некорректные настройки. Настройки: <%s>. Ошибка: <%s>", a.setts.ToLogMessage(), checkErr.Error()))
+			return nil
+		}
+
+		a.createLogMessage(fmtp_log.SeverityDebug,
+			fmt.Sprintf("Получены настройки. Версия протокола: %d. Настройки: <%s>", a.protocolVersion, a.setts.ToLogMessage()))
+
+		// контроллер состояния запускается один раз, при изменении настроек канал перезапускается контроллером каналов
+		a.stateCntrl = fmtp_states.NewStateController()
+		a.stateCntrl.WebDebugParams = a.standalone
+		go a.runStateController(a.setts)
+
+		if a.standalone {
+			a.showSettings()
+		}
+
+	case HandshakeRejectHeader:
+		var rejectMsg HandshakeRejectMsg
+		if err := json.Unmarshal(curData, &rejectMsg); err != nil {
+			rejectMsg.Reason = string(curData)
+		}
+		return fmt.Errorf("%w. Версия протокола контроллера: %d. Причина: %s", ErrHandshakeRejected, rejectMsg.ProtocolVersion, rejectMsg.Reason)
+
+	case FdpsMessageHeader:
+		var curDataMsg DataMsg
+
+		if err := json.Unmarshal(curData, &curDataMsg); err != nil {
+			a.createLogMessage(fmtp_log.SeverityError,
+				fmt.Sprintf("От контроллера получено сообщение неизвестного формата. Сообщение: <%s>. Ошибка: <%s>.",
+					string(curData), err.Error()))
+			return nil
+		}
+		if !a.acceptSeq(curDataMsg.Seq) {
+			return nil
+		}
+		a.queueToFmtp(curDataMsg.FmtpMessage)
+
+	case AckHeader:
+		var ackMsg AckMsg
+		if err := json.Unmarshal(curData, &ackMsg); err == nil {
+			a.out.ack(ackMsg.Ack)
+		}
+	}
+	return nil
+}
+
+// согласование подтверждаемой доставки после рукопожатия: подтверждение полученных сообщений
+// и повторная передача сообщений, не подтвержденных контроллером
+func (a *ChannelApp) syncDelivery(answerMsg SettingsAnswerMsg) {
+	a.ackEnabled = hasCapability(answerMsg.Capabilities, CapabilityAck)
+	if !a.ackEnabled {
+		// контроллер старой версии: неподтвержденные сообщения передаются без номеров
+		for _, val := range a.out.unacked() {
+			val.Seq = 0
+			if dataToSend, err := json.Marshal(val); err == nil {
+				a.send(dataToSend)
+			}
+		}
+		a.out = newOutbox()
+		a.in = inbox{}
+		a.chiefSession = ""
+		return
+	}
+
+	// контроллер перезапущен - нумерация сообщений начинается заново
+	if a.chiefSession != answerMsg.SessionID {
+		a.in = inbox{}
+		a.out.restart()
+		a.chiefSession = answerMsg.SessionID
+	}
+	a.out.ack(answerMsg.Ack)
+
+	if dataToSend, err := json.Marshal(CreateAckMsg(a.setts.Id, a.in.lastSeq, true)); err == nil {
+		a.send(dataToSend)
+	}
+	if a.out.len() > 0 {
+		a.createLogMessage(fmtp_log.SeverityInfo,
+			fmt.Sprintf("Повторная передача контроллеру неподтвержденных сообщений: %d.", a.out.len()))
+	}
+	for _, val := range a.out.unacked() {
+		if dataToSend, err := json.Marshal(val); err == nil {
+			a.send(dataToSend)
+		}
+	}
+}
+
+// отправка сообщения поверх FMTP контроллеру (с номером, если согласована подтверждаемая доставка)
+func (a *ChannelApp) sendData(msg DataMsg) {
+	if a.ackEnabled {
+		var dropped int
+		if msg, dropped = a.out.push(msg); dropped > 0 {
+			a.createLogMessage(fmtp_log.SeverityError,
+				fmt.Sprintf("Переполнена очередь неподтвержденных сообщений (%d). Удалено сообщений: %d.", maxUnackedMessages, dropped))
+		}
+	}
+	if dataToSend, err := json.Marshal(msg); err == nil {
+		a.send(dataToSend)
+	}
+}
+
+// проверка номера сообщения от контроллера и отправка подтверждения. Возвращает false для повторно полученного сообщения
+func (a *ChannelApp) acceptSeq(seq uint64) bool {
+	if seq == 0 {
+		return true
+	}
+	ok, gap := a.in.accept(seq)
+
+	if dataToSend, err := json.Marshal(CreateAckMsg(a.setts.Id, a.in.lastSeq, false)); err == nil {
+		a.send(dataToSend)
+	}
+	if gap > 0 {
+		a.createLogMessage(fmtp_log.SeverityWarning,
+			fmt.Sprintf("Не получено %d сообщений контроллера (удалены из-за переполнения очереди неподтвержденных сообщений).", gap))
+	}
+	return ok
+}
+
+// запуск контроллера состояния. Паника контроллера передается в Work, чтобы не завершать процесс контроллера каналов
+func (a *ChannelApp) runStateController(setts channel_settings.ChannelSettings) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.cntrlErrChan <- fmt.Errorf("Аварийное завершение контроллера FMTP состояний: %v\n%s", r, debug.Stack())
+		}
+	}()
+	a.stateCntrl.Work(setts)
+}
+
+// вывод настроек на web страницу канала
+func (a *ChannelApp) showSettings() {
+	logger.SetDebugParam("Локальный - удаленный ATC:", fmt.Sprintf("%s - %s", a.setts.LocalATC, a.setts.RemoteATC), channel_state.WebDefaultColor)
+	logger.SetDebugParam("Тип данных:", a.setts.DataType, channel_state.WebDefaultColor)
+	logger.SetDebugParam("Кодировка:", a.setts.DataEncoding, channel_state.WebDefaultColor)
+	logger.SetDebugParam("Формат сообщений:", a.setts.PayloadFormat, channel_state.WebDefaultColor)
+
+	if a.setts.NetRole == "server" {
+		logger.SetDebugParam("Тип подключения:", "TCP сервер", channel_state.WebDefaultColor)
+		logger.SetDebugParam("Локальный порт:", strconv.Itoa(a.setts.LocalPort), channel_state.WebDefaultColor)
+	} else {
+		logger.SetDebugParam("Тип подключения:", "TCP клиент", channel_state.WebDefaultColor)
+		logger.SetDebugParam("Удаленный IP адрес:", a.setts.RemoteAddress, channel_state.WebDefaultColor)
+		logger.SetDebugParam("Удаленный порт:", strconv.Itoa(a.setts.RemotePort), channel_state.WebDefaultColor)
+	}
+
+	logger.SetVersion(a.setts.Version)
+}
+
+// постановка сообщения в очередь на передачу контроллеру состояния. Сообщение передается в цикле Work,
+// чтобы занятый контроллер состояния не блокировал обмен с контроллером каналов и остановку канала.
+// При переполнении очереди удаляются самые старые сообщения
+func (a *ChannelApp) queueToFmtp(msg fmtp.FmtpMessage) {
+	if len(a.toFmtp) >= maxPendingFmtpMessages {
+		dropped := len(a.toFmtp) - maxPendingFmtpMessages + 1
+		a.toFmtp = append([]fmtp.FmtpMessage(nil), a.toFmtp[dropped:]...)
+		a.createLogMessage(fmtp_log.SeverityError,
+			fmt.Sprintf("Переполнена очередь сообщений для отправки по FMTP (%d). Удалено сообщений: %d.", maxPendingFmtpMessages, dropped))
+	}
+	a.toFmtp = append(a.toFmtp, msg)
+}
+
+// канал передачи сообщений контроллеру состояния (nil, если передавать нечего или контроллер состояния не запущен)
+func (a *ChannelApp) fmtpSendChan() chan fmtp.FmtpMessage {
+	if a.stateCntrl == nil || len(a.toFmtp) == 0 {
+		return nil
+	}
+	return a.stateCntrl.FmtpDataSendChan
+}
+
+// первое сообщение в очереди на передачу контроллеру состояния
+func (a *ChannelApp) nextToFmtp() fmtp.FmtpMessage {
+	if len(a.toFmtp) == 0 {
+		return fmtp.FmtpMessage{}
+	}
+	return a.toFmtp[0]
+}
+
+// каналы контроллера состояния (nil до получения настроек)
+func (a *ChannelApp) stateChan() chan channel_state.ChannelState {
+	if a.stateCntrl == nil {
+		return nil
+	}
+	return a.stateCntrl.FmtpStateChan
+}
+
+func (a *ChannelApp) logChan() chan fmtp_log.LogMessage {
+	if a.stateCntrl == nil {
+		return nil
+	}
+	return a.stateCntrl.LogMessageChan
+}
+
+func (a *ChannelApp) dataChan() chan fmtp.FmtpMessage {
+	if a.stateCntrl == nil {
+		return nil
+	}
+	return a.stateCntrl.FmtpDataReceiveChan
+}
+
+// создание сообщения журнала для отправки контроллеру
+func (a *ChannelApp) createLogMessage(severity string, text string) {
+	a.sendLog(fmtp_log.LogChannelST(severity, text))
+}
+
+// дополнение сообщения журнала сведениями о канале и отправка контроллеру
+func (a *ChannelApp) sendLog(logMsg fmtp_log.LogMessage) {
+	a.completeLogMessage(&logMsg)
+
+	if dataToSend, err := json.Marshal(CreateChannelLogMsg(logMsg)); err == nil {
+		a.send(dataToSend)
+	}
+}
+
+// отправка данных контроллеру каналов (прерывается при остановке, чтобы не блокировать остановку канала контроллером)
+func (a *ChannelApp) send(data []byte) {
+	select {
+	case a.SendChan <- data:
+	case <-a.stopChan:
+	}
+}
+
+// дополнение сообщения журнала сведениями о канала Id, RemoteAtc, LocalAtc, DataType
+func (a *ChannelApp) completeLogMessage(logMsg *fmtp_log.LogMessage) {
+	logMsg.ChannelId = a.setts.Id
+	logMsg.ChannelLocName = a.setts.LocalATC
+	logMsg.ChannelRemName = a.setts.RemoteATC
+	logMsg.DataType = a.setts.DataType
+
+	// в процессе контроллера сообщение выводится в журнал контроллером при получении
+	if !a.standalone {
+		return
+	}
+
+	switch logMsg.Severity {
+	case fmtp_log.SeverityDebug:
+		logger.PrintfDebug("FMTP FORMAT %v", *logMsg)
+	case fmtp_log.SeverityInfo:
+		logger.PrintfInfo("FMTP FORMAT %v", *logMsg)
+	case fmtp_log.SeverityWarning:
+		logger.PrintfWarn("FMTP FORMAT %v", *logMsg)
+	case fmtp_log.SeverityError:
+		logger.PrintfErr("FMTP FORMAT %v", *logMsg)
+	default:
+		logger.PrintfDebug("FMTP FORMAT %v", *logMsg)
+	}
+}
@@ -0,0 +1,164 @@
+package chief_channel
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/channel/fmtp_states"
+	"fmtp/fmtp"
+)
+
+// application with a state controller that is not running: FMTP data is read by the test only
+func newTestApp(sendChan chan []byte) *ChannelApp {
+	app := NewChannelApp(channel_settings.ChannelSettings{Id: 1}, nil, sendChan, false)
+	app.stateCntrl = fmtp_states.NewStateController()
+	app.stateCntrl.FmtpDataSendChan = make(chan fmtp.FmtpMessage)
+	return app
+}
+
+func chiefData(t *testing.T, msgText string) []byte {
+	t.Helper()
+	data, err := json.Marshal(CreateChiefDataMsg(1, msgText))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestChiefDataDoesNotBlock(t *testing.T) {
+	sendChan := make(chan []byte, 16)
+	app := newTestApp(sendChan)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for idx := 0; idx < maxPendingFmtpMessages+5; idx++ {
+			if err := app.processChiefData(chiefData(t, fmt.Sprint(idx))); err != nil {
+				t.Errorf("message %d: %v", idx, err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("chief data blocked by busy state controller")
+	}
+
+	if len(app.toFmtp) != maxPendingFmtpMessages {
+		t.Fatalf("%d messages queued, want %d", len(app.toFmtp), maxPendingFmtpMessages)
+	}
+	if app.toFmtp[0].Text != "5" {
+		t.Fatalf("oldest queued message %q, want 5", app.toFmtp[0].Text)
+	}
+	if len(sendChan) != 5 {
+		t.Fatalf("%d drop reports, want 5", len(sendChan))
+	}
+}
+
+func TestWorkDeliversChiefData(t *testing.T) {
+	recvChan := make(chan []byte)
+	sendChan := make(chan []byte, 16)
+	app := newTestApp(sendChan)
+	app.ReceiveChan = recvChan
+
+	stopChan := make(chan struct{})
+	workErr := make(chan error, 1)
+	go func() {
+		workErr <- app.Work(stopChan)
+	}()
+
+	for idx := 0; idx < 3; idx++ {
+		recvChan <- chiefData(t, fmt.Sprint(idx))
+	}
+	for idx := 0; idx < 3; idx++ {
+		select {
+		case msg := <-app.stateCntrl.FmtpDataSendChan:
+			if msg.Text != fmt.Sprint(idx) {
+				t.Fatalf("message %q, want %d", msg.Text, idx)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("message %d not delivered to state controller", idx)
+		}
+	}
+
+	close(stopChan)
+	if err := <-workErr; err != nil {
+		t.Fatalf("work: %v", err)
+	}
+}
+
+// start in-process channel and read its settings request
+func startInProcess(t *testing.T, stopChan chan struct{}) (*sync.Map, <-chan *ChannelExit) {
+	t.Helper()
+	links := new(sync.Map)
+	recvChan := make(chan []byte, 16)
+	runner := &inProcessRunner{links: links, recvChan: recvChan}
+
+	exitChan := make(chan *ChannelExit, 1)
+	go func() {
+		exitChan <- runner.Run(channel_settings.ChannelSettings{Id: 7}, RunOptions{Token: "token"}, stopChan)
+	}()
+
+	var req SettingsRequestMsg
+	select {
+	case data := <-recvChan:
+		if err := json.Unmarshal(data, &req); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no settings request")
+	}
+	if req.Header != RequestSettingsHeader || req.ChannelID != 7 || req.Token != "token" || req.SessionID == "" {
+		t.Fatalf("settings request %+v", req)
+	}
+	if _, ok := links.Load(7); !ok {
+		t.Fatalf("channel link not registered")
+	}
+	return links, exitChan
+}
+
+func waitExit(t *testing.T, exitChan <-chan *ChannelExit) *ChannelExit {
+	t.Helper()
+	select {
+	case exit := <-exitChan:
+		return exit
+	case <-time.After(5 * time.Second):
+		t.Fatalf("in-process channel did not exit")
+	}
+	return nil
+}
+
+func TestInProcessRunnerStop(t *testing.T) {
+	stopChan := make(chan struct{})
+	links, exitChan := startInProcess(t, stopChan)
+
+	close(stopChan)
+	if exit := waitExit(t, exitChan); exit != nil {
+		t.Fatalf("stopped channel exit %v", exit)
+	}
+	if _, ok := links.Load(7); ok {
+		t.Fatalf("channel link not removed")
+	}
+}
+
+func TestInProcessRunnerReject(t *testing.T) {
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	links, exitChan := startInProcess(t, stopChan)
+
+	link, _ := links.Load(7)
+	data, _ := json.Marshal(CreateHandshakeRejectMsg(7, "bad token"))
+	link.(chan []byte) <- data
+
+	exit := waitExit(t, exitChan)
+	if exit == nil || exit.ChannelID != 7 || exit.ExitCode != StateControllerFailed {
+		t.Fatalf("rejected channel exit %v", exit)
+	}
+	if _, ok := links.Load(7); ok {
+		t.Fatalf("channel link not removed")
+	}
+}
@@ -0,0 +1,183 @@
+package chief_channel
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"fmtp/channel/channel_state"
+	"fmtp/configurator"
+
+	"lemz.com/fdps/logger"
+	"lemz.com/fdps/web_sock"
+)
+
+// ErrHandshakeRejected контроллер отклонил подключение канала
+var ErrHandshakeRejected = errors.New("Контроллер отклонил подключение FMTP канала")
+
+// длина токена канала (байт)
+const channelTokenSize = 16
+
+// время до закрытия соединения после отправки отказа в подключении (канал должен успеть получить сообщение)
+const rejectCloseDelay = time.Second
+
+// соединение, не передававшее данных дольше этого времени, считается оборванным и может быть заменено новым соединением канала
+const staleConnTimeout = 3 * channel_state.StateSendInterval
+
+// newChannelToken токен, выдаваемый каналу при запуске
+func newChannelToken() string {
+	buf := make([]byte, channelTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		logger.PrintfErr("Ошибка формирования токена FMTP канала. Ошибка: %v.", err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// newSessionID идентификатор экземпляра канала или контроллера каналов для нумерации сообщений поверх FMTP
+func newSessionID() string {
+	return newChannelToken()[:channelTokenSize]
+}
+
+// tokenStore токены запущенных каналов. Заполняется при запуске и подхвате каналов (из горутины запуска) и проверяется в Work
+type tokenStore struct {
+	sync.Mutex
+	items map[int]string // ключ - ID канала
+}
+
+func newTokenStore() *tokenStore {
+	return &tokenStore{items: make(map[int]string)}
+}
+
+func (s *tokenStore) set(channelID int, token string) {
+	s.Lock()
+	defer s.Unlock()
+	s.items[channelID] = token
+}
+
+func (s *tokenStore) remove(channelID int) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.items, channelID)
+}
+
+// known признак наличия токена канала (канал запущен или подхвачен контроллером)
+func (s *tokenStore) known(channelID int) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.items[channelID]
+	return ok
+}
+
+// issued признак запуска канала с токеном (канал не может подключаться без токена)
+func (s *tokenStore) issued(channelID int) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.items[channelID] != ""
+}
+
+// verify проверка токена канала
+func (s *tokenStore) verify(channelID int, token string) bool {
+	s.Lock()
+	defer s.Unlock()
+	expected, ok := s.items[channelID]
+	return ok && expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
+
+// channelConn сведения о WebSocket соединении канала, прошедшем рукопожатие
+type channelConn struct {
+	ChannelID       int
+	ProtocolVersion int       // согласованная версия протокола
+	Capabilities    []string  // согласованные возможности
+	LastSeen        time.Time // время получения последних данных
+}
+
+// handshake проверка запроса настроек канала (рукопожатия). Возвращает причину отказа (пусто - подключение принято).
+// Соединения каналов, запущенных в процессе контроллера (sock == nil), не проверяются.
+// Подключение без токена допускается только для каналов, запущенных без токена (подхваченные каналы контроллера старой версии),
+// если токен не требуется настройками контроллера (обновление каналов и контроллера в разное время).
+// Повторное подключение канала с токеном заменяет соединение, по которому давно не было данных (обрыв не обнаружен сервером).
+func (cc *ChiefChannelServer) handshake(req SettingsRequestMsg, sock *websocket.Conn) string {
+	if sock == nil {
+		return ""
+	}
+
+	if !cc.tokens.known(req.ChannelID) {
+		return "канал с указанным ID не запущен контроллером"
+	}
+	// каналы старых версий и каналы, запущенные контроллером старой версии, передают запрос без токена
+	if req.Token == "" {
+		if cc.tokens.issued(req.ChannelID) {
+			return "канал запущен с токеном, а запрос передан без токена"
+		}
+		if configurator.ChiefCfg.ChannelAuthRequired {
+			return "канал запущен без токена, а контроллер требует токен канала"
+		}
+	} else if !cc.tokens.verify(req.ChannelID, req.Token) {
+		return "неверный токен канала"
+	}
+
+	// канал уже подключен другим соединением
+	if prevSock, ok := cc.wsClients[req.ChannelID]; ok && prevSock != sock {
+		prevConn := cc.wsConns[prevSock]
+		if req.Token == "" || (prevConn != nil && time.Since(prevConn.LastSeen) < staleConnTimeout) {
+			return fmt.Sprintf("канал с ID = %d уже подключен (%s)", req.ChannelID, prevSock.RemoteAddr())
+		}
+		logger.PrintfWarn("Соединение FMTP канала с ID = %d (%s) заменено новым соединением (%s).",
+			req.ChannelID, prevSock.RemoteAddr(), sock.RemoteAddr())
+		cc.unbindConn(prevSock)
+	}
+	return ""
+}
+
+// bindConn привязка соединения к каналу после рукопожатия
+func (cc *ChiefChannelServer) bindConn(sock *websocket.Conn, conn channelConn) {
+	if prevConn, ok := cc.wsConns[sock]; ok && prevConn.ChannelID != conn.ChannelID {
+		cc.unbindConn(sock)
+	}
+	conn.LastSeen = time.Now()
+	cc.wsClients[conn.ChannelID] = sock
+	cc.wsConns[sock] = &conn
+}
+
+// unbindConn отвязка соединения от канала (соединение закрыто или заменено)
+func (cc *ChiefChannelServer) unbindConn(sock *websocket.Conn) {
+	if conn, ok := cc.wsConns[sock]; ok {
+		if cc.wsClients[conn.ChannelID] == sock {
+			delete(cc.wsClients, conn.ChannelID)
+		}
+		delete(cc.wsConns, sock)
+	}
+}
+
+// connChannelID ID канала, к которому привязано соединение (sock == nil - канал в процессе контроллера, ID из сообщения)
+func (cc *ChiefChannelServer) connChannelID(sock *websocket.Conn, msgChannelID int) (int, bool) {
+	if sock == nil {
+		return msgChannelID, true
+	}
+	conn, ok := cc.wsConns[sock]
+	if !ok {
+		return 0, false
+	}
+	conn.LastSeen = time.Now()
+	return conn.ChannelID, true
+}
+
+// rejectConn отправка отказа в подключении и закрытие соединения
+func (cc *ChiefChannelServer) rejectConn(req SettingsRequestMsg, sock *websocket.Conn, reason string) {
+	logger.PrintfWarn("Отклонено подключение FMTP канала с ID = %d (%s). Версия протокола: %d. Причина: %s.",
+		req.ChannelID, sock.RemoteAddr(), req.Version(), reason)
+
+	if hasCapability(req.Capabilities, CapabilityReject) {
+		if data, err := json.Marshal(CreateHandshakeRejectMsg(req.ChannelID, reason)); err == nil {
+			cc.wsServer.SendDataChan <- web_sock.WsPackage{Data: data, Sock: sock}
+		}
+	}
+	time.AfterFunc(rejectCloseDelay, func() { sock.Close() })
+}
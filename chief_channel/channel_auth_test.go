@@ -0,0 +1,58 @@
+package chief_channel
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"fmtp/configurator"
+)
+
+func TestHandshakeTokens(t *testing.T) {
+	prevRequired := configurator.ChiefCfg.ChannelAuthRequired
+	defer func() { configurator.ChiefCfg.ChannelAuthRequired = prevRequired }()
+
+	cc := &ChiefChannelServer{
+		wsClients: make(map[int]*websocket.Conn),
+		wsConns:   make(map[*websocket.Conn]*channelConn),
+		tokens:    newTokenStore(),
+	}
+	cc.tokens.set(1, "token")
+	cc.tokens.set(2, "") // adopted channel started by an old chief without a token
+	sock := new(websocket.Conn)
+
+	cases := []struct {
+		name     string
+		required bool
+		chID     int
+		token    string
+		accepted bool
+	}{
+		{"valid token", false, 1, "token", true},
+		{"wrong token", false, 1, "other", false},
+		{"missing token for channel with token", false, 1, "", false},
+		{"missing token for channel without token", false, 2, "", true},
+		{"missing token when required", true, 2, "", false},
+		{"token for channel without token", false, 2, "token", false},
+		{"unknown channel", false, 3, "token", false},
+		{"unknown channel without token", false, 3, "", false},
+	}
+	for _, val := range cases {
+		configurator.ChiefCfg.ChannelAuthRequired = val.required
+		reason := cc.handshake(CreateSettingsRequestMsg(val.chID, val.token, "session"), sock)
+		if (reason == "") != val.accepted {
+			t.Fatalf("%s: reason %q, accepted %v", val.name, reason, val.accepted)
+		}
+	}
+
+	// in-process channels are not checked
+	if reason := cc.handshake(CreateSettingsRequestMsg(3, "", "session"), nil); reason != "" {
+		t.Fatalf("in-process channel rejected: %s", reason)
+	}
+
+	// heartbeat binding of old channels only for channels without a token
+	configurator.ChiefCfg.ChannelAuthRequired = false
+	if cc.legacyHeartbeatBind(1) || !cc.legacyHeartbeatBind(2) || cc.legacyHeartbeatBind(3) {
+		t.Fatalf("legacy heartbeat binding allowed for channel with token")
+	}
+}
@@ -0,0 +1,82 @@
+package chief_channel
+
+// макс. кол-во неподтвержденных сообщений в очереди повторной передачи (при превышении удаляются самые старые)
+const maxUnackedMessages = 10000
+
+// outbox очередь отправленных сообщений поверх FMTP, ожидающих подтверждения получения.
+// Используется в одной горутине (Work контроллера каналов или приложения канала).
+type outbox struct {
+	nextSeq uint64    // номер следующего сообщения
+	pending []DataMsg // неподтвержденные сообщения в порядке номеров
+}
+
+func newOutbox() *outbox {
+	return &outbox{nextSeq: 1}
+}
+
+// push присвоение номера сообщению и добавление в очередь.
+// Возвращает сообщение с номером и кол-во удаленных из очереди неподтвержденных сообщений (очередь переполнена)
+func (o *outbox) push(msg DataMsg) (DataMsg, int) {
+	msg.Seq = o.nextSeq
+	o.nextSeq++
+	o.pending = append(o.pending, msg)
+
+	dropped := 0
+	if len(o.pending) > maxUnackedMessages {
+		dropped = len(o.pending) - maxUnackedMessages
+		o.pending = append([]DataMsg(nil), o.pending[dropped:]...)
+	}
+	return msg, dropped
+}
+
+// ack удаление подтвержденных сообщений (с номером до seq включительно)
+func (o *outbox) ack(seq uint64) {
+	idx := 0
+	for idx < len(o.pending) && o.pending[idx].Seq <= seq {
+		idx++
+	}
+	if idx > 0 {
+		o.pending = append([]DataMsg(nil), o.pending[idx:]...)
+	}
+}
+
+// restart нумерация неподтвержденных сообщений заново (получатель перезапущен, его нумерация начата с начала)
+func (o *outbox) restart() {
+	o.nextSeq = 1
+	for idx := range o.pending {
+		o.pending[idx].Seq = o.nextSeq
+		o.nextSeq++
+	}
+}
+
+// unacked неподтвержденные сообщения для повторной передачи
+func (o *outbox) unacked() []DataMsg {
+	return o.pending
+}
+
+// drain извлечение всех сообщений из очереди
+func (o *outbox) drain() []DataMsg {
+	retValue := o.pending
+	o.pending = nil
+	return retValue
+}
+
+func (o *outbox) len() int {
+	return len(o.pending)
+}
+
+// inbox номер последнего полученного сообщения поверх FMTP для отбрасывания повторов
+type inbox struct {
+	lastSeq uint64
+}
+
+// accept проверка номера полученного сообщения.
+// Возвращает false для повторно полученного сообщения и кол-во пропущенных номеров (сообщения удалены отправителем из-за переполнения очереди)
+func (in *inbox) accept(seq uint64) (bool, uint64) {
+	if seq <= in.lastSeq {
+		return false, 0
+	}
+	gap := seq - in.lastSeq - 1
+	in.lastSeq = seq
+	return true, gap
+}
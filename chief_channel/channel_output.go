@@ -0,0 +1,215 @@
+package chief_channel
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/fmtp_log"
+
+	"lemz.com/fdps/logger"
+)
+
+// параметры сбора вывода FMTP каналов
+const (
+	outputTailLines     = 50                     // кол-во сохраняемых последних строк вывода канала (для отчета о завершении)
+	outputLogLimit      = 50                     // макс. кол-во строк вывода канала, передаваемых в журнал за секунду
+	outputFollowPeriod  = 300 * time.Millisecond // период чтения файлов вывода процесса канала
+	outputFileMaxSize   = 10 << 20               // размер файла вывода процесса, после прочтения которого файл очищается
+	outputMaxLineLength = 4096                   // макс. длина строки вывода, передаваемой в журнал
+	outputWaitTimeout   = 2 * time.Second        // время ожидания окончания вывода завершенного docker контейнера
+)
+
+// потоки вывода канала
+const (
+	streamStdout = "stdout"
+	streamStderr = "stderr"
+)
+
+// channelOutput вывод FMTP канала (stdout и stderr процесса или docker контейнера):
+// строки передаются в журнал контроллера с привязкой к каналу, последние строки хранятся для отчета о завершении
+type channelOutput struct {
+	sync.Mutex
+	chSett channel_settings.ChannelSettings
+	tail   *outputTail
+
+	windowStart time.Time // начало текущей секунды ограничения кол-ва строк
+	windowLines int       // кол-во строк, переданных в журнал за текущую секунду
+	dropped     int       // кол-во строк, не переданных в журнал из-за ограничения
+}
+
+func newChannelOutput(chSett channel_settings.ChannelSettings) *channelOutput {
+	return &channelOutput{chSett: chSett, tail: newOutputTail(outputTailLines)}
+}
+
+// Writer io.Writer для потока вывода канала
+func (o *channelOutput) Writer(stream string) *lineWriter {
+	return &lineWriter{onLine: func(line string) { o.line(stream, line) }}
+}
+
+// followProcess чтение файлов вывода процесса канала. Возвращает функцию остановки чтения (файлы дочитываются)
+func (o *channelOutput) followProcess(channelID int, fromEnd bool) func() {
+	stopChan := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, stream := range []string{streamStdout, streamStderr} {
+		wg.Add(1)
+		go func(stream string) {
+			defer wg.Done()
+			followFile(processOutputPath(channelID, stream), o.Writer(stream), fromEnd, stopChan)
+		}(stream)
+	}
+	return func() {
+		close(stopChan)
+		wg.Wait()
+	}
+}
+
+// String последние строки вывода
+func (o *channelOutput) String() string {
+	return o.tail.String()
+}
+
+// обработка строки вывода
+func (o *channelOutput) line(stream string, text string) {
+	o.tail.Write([]byte(text + "\n"))
+
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+
+	o.Lock()
+	now := time.Now()
+	if now.Sub(o.windowStart) >= time.Second {
+		if o.dropped > 0 {
+			o.log(fmtp_log.SeverityWarning, fmt.Sprintf("Пропущено строк вывода канала: %d (ограничение %d строк в секунду).", o.dropped, outputLogLimit))
+		}
+		o.windowStart, o.windowLines, o.dropped = now, 0, 0
+	}
+	if o.windowLines >= outputLogLimit {
+		o.dropped++
+		o.Unlock()
+		return
+	}
+	o.windowLines++
+	o.Unlock()
+
+	if len(text) > outputMaxLineLength {
+		text = text[:outputMaxLineLength] + "..."
+	}
+	o.log(outputSeverity(stream, text), fmt.Sprintf("[%s] %s", stream, text))
+}
+
+// передача сообщения в журнал контроллера от имени канала
+func (o *channelOutput) log(severity string, text string) {
+	logMsg := fmtp_log.LogChannelST(severity, text)
+	logMsg.ChannelId = o.chSett.Id
+	logMsg.ChannelLocName = o.chSett.LocalATC
+	logMsg.ChannelRemName = o.chSett.RemoteATC
+	logMsg.DataType = o.chSett.DataType
+
+	switch severity {
+	case fmtp_log.SeverityDebug:
+		logger.PrintfDebug("FMTP FORMAT %#v", logMsg)
+	case fmtp_log.SeverityWarning:
+		logger.PrintfWarn("FMTP FORMAT %#v", logMsg)
+	case fmtp_log.SeverityError:
+		logger.PrintfErr("FMTP FORMAT %#v", logMsg)
+	default:
+		logger.PrintfInfo("FMTP FORMAT %#v", logMsg)
+	}
+}
+
+// важность строки вывода: паника и фатальные ошибки - ошибка, stderr - предупреждение, stdout - отладка
+func outputSeverity(stream string, text string) string {
+	if strings.HasPrefix(text, "panic:") || strings.HasPrefix(text, "fatal error:") || strings.Contains(text, "FATAL") {
+		return fmtp_log.SeverityError
+	}
+	if stream == streamStderr {
+		return fmtp_log.SeverityWarning
+	}
+	return fmtp_log.SeverityDebug
+}
+
+// lineWriter io.Writer, разбивающий поток на строки
+type lineWriter struct {
+	partial string // последняя незавершенная строка
+	onLine  func(line string)
+}
+
+// Write реализация io.Writer
+func (w *lineWriter) Write(p []byte) (int, error) {
+	lines := strings.Split(w.partial+string(p), "\n")
+	w.partial = lines[len(lines)-1]
+	for _, val := range lines[:len(lines)-1] {
+		w.onLine(strings.TrimRight(val, "\r"))
+	}
+	return len(p), nil
+}
+
+// Flush передача незавершенной строки
+func (w *lineWriter) Flush() {
+	if w.partial != "" {
+		w.onLine(w.partial)
+		w.partial = ""
+	}
+}
+
+// followFile чтение дописываемого файла вывода процесса канала до закрытия stopChan (после закрытия файл дочитывается).
+// fromEnd - чтение с конца файла (вывод подхваченного процесса, полученный до перезапуска контроллера, не передается).
+// Прочитанный файл размером более outputFileMaxSize очищается (процесс пишет в файл в режиме добавления).
+func followFile(path string, w *lineWriter, fromEnd bool, stopChan <-chan struct{}) {
+	file, err := os.Open(path)
+	if err != nil {
+		logger.PrintfErr("Ошибка открытия файла вывода FMTP канала %s. Ошибка: %v.", path, err)
+		return
+	}
+	defer file.Close()
+
+	var offset int64
+	if fromEnd {
+		if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			offset = 0
+		}
+	}
+
+	ticker := time.NewTicker(outputFollowPeriod)
+	defer ticker.Stop()
+
+	buf := make([]byte, 32*1024)
+	readAvailable := func() {
+		// файл очищен - читаем с начала
+		if stat, statErr := file.Stat(); statErr == nil && stat.Size() < offset {
+			offset = 0
+		}
+		for {
+			n, readErr := file.ReadAt(buf, offset)
+			if n > 0 {
+				w.Write(buf[:n])
+				offset += int64(n)
+			}
+			if readErr != nil || n == 0 {
+				break
+			}
+		}
+		if offset > outputFileMaxSize {
+			if truncErr := os.Truncate(path, 0); truncErr == nil {
+				offset = 0
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			readAvailable()
+		case <-stopChan:
+			readAvailable()
+			w.Flush()
+			return
+		}
+	}
+}
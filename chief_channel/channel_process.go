@@ -0,0 +1,95 @@
+package chief_channel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"lemz.com/fdps/logger"
+	"lemz.com/fdps/utils"
+)
+
+// максимальный размер считываемого окончания файла вывода процесса канала
+const outputTailBytes = 16 * 1024
+
+// processInfo сведения о запущенном процессе FMTP канала.
+// Сохраняются в файл, чтобы подхватить процесс после перезапуска контроллера.
+type processInfo struct {
+	ChannelID    int    `json:"ChannelID"`
+	Pid          int    `json:"Pid"`
+	BinaryPath   string `json:"BinaryPath"`
+	SettingsHash string `json:"SettingsHash"`
+	Token        string `json:"Token,omitempty"` // токен, выданный каналу при запуске
+}
+
+// каталог файлов сведений о запущенных процессах каналов
+func processRunDir() string {
+	return utils.AppPath() + "/run"
+}
+
+func processInfoPath(channelID int) string {
+	return filepath.Join(processRunDir(), fmt.Sprintf("channel_%d.json", channelID))
+}
+
+// файлы, в которые перенаправляется вывод процесса канала (процесс продолжает работу при завершении контроллера)
+func processOutputPath(channelID int, stream string) string {
+	return filepath.Join(processRunDir(), fmt.Sprintf("channel_%d.%s", channelID, stream))
+}
+
+// открытие файла вывода процесса канала. Режим добавления, чтобы после очистки файла контроллером процесс писал с начала
+func openProcessOutput(channelID int, stream string) (*os.File, error) {
+	return os.OpenFile(processOutputPath(channelID, stream), os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0644)
+}
+
+func saveProcessInfo(info processInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	// файл содержит токен канала
+	return ioutil.WriteFile(processInfoPath(info.ChannelID), data, 0600)
+}
+
+// чтение сведений о запущенных процессах каналов
+func readProcessInfos() []processInfo {
+	paths, _ := filepath.Glob(filepath.Join(processRunDir(), "channel_*.json"))
+
+	var retValue []processInfo
+	for _, val := range paths {
+		var info processInfo
+		data, err := ioutil.ReadFile(val)
+		if err == nil {
+			err = json.Unmarshal(data, &info)
+		}
+		if err != nil {
+			logger.PrintfErr("Ошибка чтения сведений о процессе FMTP канала из файла %s. Ошибка: %v.", val, err)
+			os.Remove(val)
+			continue
+		}
+		retValue = append(retValue, info)
+	}
+	return retValue
+}
+
+func removeProcessFiles(channelID int) {
+	os.Remove(processInfoPath(channelID))
+	os.Remove(processOutputPath(channelID, streamStdout))
+	os.Remove(processOutputPath(channelID, streamStderr))
+}
+
+// запись окончания файла вывода процесса канала в w
+func copyFileTail(path string, w io.Writer) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if stat, statErr := file.Stat(); statErr == nil && stat.Size() > outputTailBytes {
+		file.Seek(-outputTailBytes, io.SeekEnd)
+	}
+	io.Copy(w, file)
+}
@@ -0,0 +1,66 @@
+//go:build !windows
+// +build !windows
+
+package chief_channel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// интервал проверки работы подхваченного процесса канала
+const processWatchInterval = time.Second
+
+// атрибуты процесса канала: отдельная группа процессов, чтобы сигнал группе процессов контроллера не завершал каналы
+func channelProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+func processExists(proc *os.Process) bool {
+	err := proc.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processAlive признак работы процесса с исполняемым файлом binaryPath (защита от повторного использования pid)
+func processAlive(pid int, binaryPath string) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil || !processExists(proc) {
+		return false
+	}
+	// /proc есть не во всех системах, без него исполняемый файл не проверяется
+	if exePath, linkErr := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); linkErr == nil {
+		absPath, _ := filepath.Abs(binaryPath)
+		return exePath == absPath
+	}
+	return true
+}
+
+// watchProcess канал, закрываемый при завершении процесса (процесс может быть запущен другим экземпляром контроллера)
+func watchProcess(pid int) (<-chan struct{}, error) {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	if !processExists(proc) {
+		return nil, fmt.Errorf("Процесс %d не найден.", pid)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(processWatchInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if !processExists(proc) {
+				return
+			}
+		}
+	}()
+	return done, nil
+}
@@ -0,0 +1,39 @@
+//go:build windows
+// +build windows
+
+package chief_channel
+
+import (
+	"os"
+	"syscall"
+)
+
+// атрибуты процесса канала: отдельная группа процессов, чтобы Ctrl+C в консоли контроллера не завершал каналы
+func channelProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// processAlive признак работы процесса (в Windows процесс открывается только если он существует)
+func processAlive(pid int, binaryPath string) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	proc.Release()
+	return true
+}
+
+// watchProcess канал, закрываемый при завершении процесса (в Windows можно ожидать завершения не дочернего процесса)
+func watchProcess(pid int) (<-chan struct{}, error) {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proc.Wait()
+	}()
+	return done, nil
+}
@@ -0,0 +1,434 @@
+package chief_channel
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/configurator"
+
+	"lemz.com/fdps/logger"
+	"lemz.com/fdps/utils"
+)
+
+// RunOptions параметры запуска FMTP канала, не входящие в настройки канала
+type RunOptions struct {
+	ChiefPort    int                               // порт WS сервера контроллера для связи с каналом
+	Profile      channel_settings.ContainerProfile // профиль docker контейнера
+	SettingsHash string                            // хэш настроек запуска канала
+	Adopt        *adoptCandidate                   // экземпляр канала, запущенный до перезапуска контроллера (nil - запуск нового)
+	Token        string                            // токен канала для подключения к контроллеру (передается через ChannelTokenEnv)
+}
+
+// ChannelRunner способ запуска FMTP канала (отдельный процесс, docker контейнер, в процессе контроллера)
+type ChannelRunner interface {
+	// Run запуск канала и ожидание его завершения.
+	// При штатной остановке (закрытии stopChan) возвращает nil, иначе - сведения о нештатном завершении.
+	Run(chSett channel_settings.ChannelSettings, opts RunOptions, stopChan <-chan struct{}) *ChannelExit
+}
+
+// аргументы командной строки приложения FMTP канала
+func channelArgs(chSett channel_settings.ChannelSettings, chiefPort int) []string {
+	return []string{strconv.Itoa(chiefPort), strconv.Itoa(chSett.Id), chSett.LocalATC,
+		chSett.RemoteATC, chSett.DataType, chSett.URLPath, strconv.Itoa(chSett.URLPort)}
+}
+
+// processRunner запуск канала отдельным процессом (копия исполняемого файла)
+type processRunner struct{}
+
+// Run реализация ChannelRunner
+func (processRunner) Run(chSett channel_settings.ChannelSettings, opts RunOptions, stopChan <-chan struct{}) *ChannelExit {
+	var (
+		proc       *os.Process
+		binaryPath string
+		waitFunc   func() (int, error) // ожидание завершения процесса: код завершения и ошибка
+		output     = newChannelOutput(chSett)
+		stopOutput func() // остановка чтения вывода процесса
+	)
+
+	if opts.Adopt != nil {
+		binaryPath = opts.Adopt.BinaryPath
+		adoptDone, err := watchProcess(opts.Adopt.Pid)
+		if err == nil {
+			proc, err = os.FindProcess(opts.Adopt.Pid)
+		}
+		if err != nil {
+			cleanupProcess(chSett.Id, binaryPath)
+			return &ChannelExit{ChannelID: chSett.Id, ExitCode: -1, Status: err.Error()}
+		}
+		// код завершения процесса, запущенного другим экземпляром контроллера, недоступен
+		waitFunc = func() (int, error) {
+			<-adoptDone
+			return -1, nil
+		}
+		logger.PrintfInfo("Подхвачено приложение FMTP канала. Процесс: %d. Исполняемый файл: %s. Идентификатор канала: %d.",
+			opts.Adopt.Pid, binaryPath, chSett.Id)
+
+		// вывод, полученный до перезапуска контроллера, в журнал не передается, но сохраняется в последних строках
+		copyFileTail(processOutputPath(chSett.Id, streamStderr), output.tail)
+		stopOutput = output.followProcess(chSett.Id, true)
+	} else {
+		cmd, err := startChannelProcess(chSett, opts)
+		if err != nil {
+			return &ChannelExit{ChannelID: chSett.Id, ExitCode: -1, Status: err.Error()}
+		}
+		proc = cmd.Process
+		binaryPath = cmd.Path
+		stopOutput = output.followProcess(chSett.Id, false)
+		waitFunc = func() (int, error) {
+			err := cmd.Wait()
+			if cmd.ProcessState != nil {
+				return cmd.ProcessState.ExitCode(), err
+			}
+			return -1, err
+		}
+	}
+	defer cleanupProcess(chSett.Id, binaryPath)
+
+	// канал, в который результат завершения отправкится
+	type waitResult struct {
+		exitCode int
+		err      error
+	}
+	done := make(chan waitResult, 1)
+	go func() {
+		exitCode, err := waitFunc()
+		done <- waitResult{exitCode: exitCode, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		stopOutput()
+		exit := &ChannelExit{ChannelID: chSett.Id, ExitCode: res.exitCode, Status: "Процесс завершен.", Output: output.String()}
+		if res.err != nil {
+			exit.Status = res.err.Error()
+		}
+		logger.PrintfErr("Нештатное завершение приложения FMTP канала. Исполняемый файл: %s. Идентификатор канала: %d. %s",
+			binaryPath, chSett.Id, exit)
+		return exit
+
+	case <-stopChan:
+		if err := proc.Kill(); err != nil {
+			logger.PrintfErr("Ошибка завершения выполнения приложения FMTP канала. Ошибка: %v.", err)
+		} else {
+			logger.PrintfDebug("Штатное завершение приложения FMTP канала. Исполняемый файл: %s. Идентификатор канала: %d.",
+				binaryPath, chSett.Id)
+		}
+		<-done
+		stopOutput()
+		return nil
+	}
+}
+
+// запуск процесса FMTP канала. stdout и stderr перенаправляются в файлы, сведения о процессе сохраняются для подхвата после перезапуска контроллера
+func startChannelProcess(chSett channel_settings.ChannelSettings, opts RunOptions) (*exec.Cmd, error) {
+	channelFilePath, err := utils.CopyBinary(chSett.Version, chSett.Id, chSett.LocalATC, chSett.RemoteATC)
+	if err != nil {
+		logger.PrintfErr("%v", err)
+		return nil, err
+	}
+
+	if err = os.MkdirAll(processRunDir(), 0755); err != nil {
+		cleanupProcess(chSett.Id, channelFilePath)
+		return nil, err
+	}
+	stdoutFile, err := openProcessOutput(chSett.Id, streamStdout)
+	if err != nil {
+		cleanupProcess(chSett.Id, channelFilePath)
+		return nil, err
+	}
+	defer stdoutFile.Close()
+
+	stderrFile, err := openProcessOutput(chSett.Id, streamStderr)
+	if err != nil {
+		cleanupProcess(chSett.Id, channelFilePath)
+		return nil, err
+	}
+	defer stderrFile.Close()
+
+	cmd := exec.Command(channelFilePath, channelArgs(chSett, opts.ChiefPort)...)
+	cmd.Stdout = stdoutFile
+	cmd.Stderr = stderrFile
+	cmd.SysProcAttr = channelProcAttr()
+	cmd.Env = append(os.Environ(), ChannelTokenEnv+"="+opts.Token)
+
+	if err = cmd.Start(); err != nil {
+		logger.PrintfErr("Ошибка запуска приложения FMTP канала. Исполняемый файл: %s. Иденификатор канала: %d. Ошибка: %v.",
+			channelFilePath, chSett.Id, err)
+		cleanupProcess(chSett.Id, channelFilePath)
+		return nil, err
+	}
+
+	logger.PrintfDebug("Запущено приложения FMTP канала. Исполняемый файл: %s. Иденификатор канала: %d.",
+		channelFilePath, chSett.Id)
+
+	info := processInfo{ChannelID: chSett.Id, Pid: cmd.Process.Pid, BinaryPath: channelFilePath, SettingsHash: opts.SettingsHash, Token: opts.Token}
+	if err = saveProcessInfo(info); err != nil {
+		logger.PrintfErr("Ошибка сохранения сведений о процессе FMTP канала. Процесс не будет подхвачен после перезапуска контроллера. Ошибка: %v.", err)
+	}
+	return cmd, nil
+}
+
+// удаление файлов завершенного процесса канала
+func cleanupProcess(channelID int, binaryPath string) {
+	removeProcessFiles(channelID)
+	if err := utils.RemoveBinary(binaryPath); err != nil {
+		logger.PrintfErr("%v", err)
+	}
+}
+
+// dockerRunner запуск канала в docker контейнере
+type dockerRunner struct{}
+
+// Run реализация ChannelRunner
+func (dockerRunner) Run(chSett channel_settings.ChannelSettings, opts RunOptions, stopChan <-chan struct{}) *ChannelExit {
+	ctx := context.Background()
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		logger.PrintfErr("Ошибка создания клиента сервиса docker. Ошибка: %v", err)
+		return &ChannelExit{ChannelID: chSett.Id, ExitCode: -1, Status: err.Error()}
+	}
+	defer cli.Close()
+	cli.NegotiateAPIVersion(ctx)
+
+	profile := opts.Profile
+	curContainerName := profile.ContainerNameFor(chSett)
+
+	var containerID string
+	if opts.Adopt != nil {
+		containerID = opts.Adopt.ContainerID
+		logger.PrintfInfo("Подхвачен docker контейнер %s (%.12s).", curContainerName, containerID)
+	} else if containerID, err = createChannelContainer(ctx, cli, chSett, opts); err != nil {
+		return &ChannelExit{ChannelID: chSett.Id, ExitCode: -1, Status: err.Error()}
+	}
+
+	// вывод контейнера (контейнер удаляется после завершения вместе с логами)
+	logsCtx, logsCancel := context.WithCancel(ctx)
+	defer logsCancel()
+	output := newChannelOutput(chSett)
+	outputDone := followContainerLogs(logsCtx, cli, containerID, output, opts.Adopt != nil)
+
+	statusCh, errCh := cli.ContainerWait(ctx, containerID, container.WaitConditionNextExit)
+
+	select {
+	case cntErr := <-errCh:
+		waitOutput(outputDone)
+		exit := &ChannelExit{ChannelID: chSett.Id, ExitCode: -1, Status: "Ошибка ожидания завершения контейнера.", Output: output.String()}
+		if cntErr != nil {
+			logger.PrintfErr("Ошибка в работе docker контейнера %s. Ошибка: %v.", curContainerName, cntErr)
+			exit.Status = cntErr.Error()
+		}
+		removeContainer(ctx, cli, containerID)
+		return exit
+
+	case curStatus := <-statusCh:
+		waitOutput(outputDone)
+		exit := &ChannelExit{ChannelID: chSett.Id, ExitCode: int(curStatus.StatusCode), Status: "Контейнер завершен.",
+			Output: containerOutputTail(ctx, cli, containerID, output)}
+		if curStatus.Error != nil {
+			logger.PrintfErr("Изменен статус docker контейнера %s. Статус: %v. Ошибка: %v.", curContainerName, curStatus.StatusCode, curStatus.Error.Message)
+			exit.Status = curStatus.Error.Message
+		} else {
+			logger.PrintfErr("Изменен статус docker контейнера %s. Статус: %v.", curContainerName, curStatus.StatusCode)
+		}
+		removeContainer(ctx, cli, containerID)
+		return exit
+
+	case <-stopChan:
+		logger.PrintfDebug("Команда завершить docker контейнер %s.", curContainerName)
+
+		if stopErr := cli.ContainerStop(ctx, containerID, nil); stopErr == nil {
+			logger.PrintfDebug("Остановлен docker контейнер %s.", curContainerName)
+		} else {
+			logger.PrintfErr("Ошибка остановки docker контейнера %s. Ошибка %v", curContainerName, stopErr)
+		}
+		removeContainer(ctx, cli, containerID)
+		return nil
+	}
+}
+
+// последние строки вывода завершенного контейнера. Журнал остановленного контейнера дописан docker полностью,
+// поэтому строки читаются из него, а не из потока вывода, который мог не успеть передать последние строки.
+// Если журнал недоступен (драйвер журнала без чтения), используются строки из потока вывода
+func containerOutputTail(ctx context.Context, cli *client.Client, containerID string, output *channelOutput) string {
+	logsOpts := types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Tail: strconv.Itoa(outputTailLines)}
+	logs, err := cli.ContainerLogs(ctx, containerID, logsOpts)
+	if err != nil {
+		return output.String()
+	}
+	defer logs.Close()
+
+	tail := newOutputTail(outputTailLines)
+	if _, err = stdcopy.StdCopy(tail, tail, logs); err != nil {
+		return output.String()
+	}
+	return tail.String()
+}
+
+// удаление завершенного контейнера канала (контейнер создается без автоудаления, чтобы после завершения был доступен журнал)
+func removeContainer(ctx context.Context, cli *client.Client, containerID string) {
+	if err := cli.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{Force: true}); err != nil && !client.IsErrNotFound(err) {
+		logger.PrintfErr("Ошибка удаления docker контейнера %.12s. Ошибка: %v.", containerID, err)
+	}
+}
+
+// followContainerLogs чтение вывода docker контейнера канала. Возвращает канал, закрываемый по окончании вывода.
+// adopted - контейнер подхвачен: вывод, полученный до перезапуска контроллера, в журнал не передается, но сохраняется в последних строках.
+func followContainerLogs(ctx context.Context, cli *client.Client, containerID string, output *channelOutput, adopted bool) <-chan struct{} {
+	done := make(chan struct{})
+
+	logsOpts := types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: true}
+	if adopted {
+		prevOpts := types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Tail: strconv.Itoa(outputTailLines)}
+		if prevLogs, err := cli.ContainerLogs(ctx, containerID, prevOpts); err == nil {
+			stdcopy.StdCopy(output.tail, output.tail, prevLogs)
+			prevLogs.Close()
+		}
+		logsOpts.Tail = "0"
+	}
+
+	logs, err := cli.ContainerLogs(ctx, containerID, logsOpts)
+	if err != nil {
+		logger.PrintfErr("Ошибка получения вывода docker контейнера %.12s. Ошибка: %v.", containerID, err)
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		defer logs.Close()
+
+		stdout, stderr := output.Writer(streamStdout), output.Writer(streamStderr)
+		stdcopy.StdCopy(stdout, stderr, logs)
+		stdout.Flush()
+		stderr.Flush()
+	}()
+	return done
+}
+
+// ожидание окончания вывода завершенного канала, чтобы последние строки попали в сведения о завершении
+func waitOutput(done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(outputWaitTimeout):
+	}
+}
+
+// имя docker образа FMTP канала
+func channelImageName(chSett channel_settings.ChannelSettings) string {
+	var imageName string
+	if len(configurator.ChiefCfg.DockerRegistry) != 0 {
+		imageName = configurator.ChiefCfg.DockerRegistry + "/"
+	}
+	return imageName + configurator.ChannelImageName + ":" + chSett.Version
+}
+
+// создание и запуск docker контейнера FMTP канала. Возвращает идентификатор контейнера
+func createChannelContainer(ctx context.Context, cli *client.Client, chSett channel_settings.ChannelSettings, opts RunOptions) (string, error) {
+	profile := opts.Profile
+	curContainerName := profile.ContainerNameFor(chSett)
+	imageName := channelImageName(chSett)
+
+	labels := profile.LabelsFor(chSett)
+	labels[channel_settings.LabelSettings] = opts.SettingsHash
+
+	// завершенный контейнер канала, не удаленный до перезапуска контроллера, занимает имя контейнера
+	if prev, err := cli.ContainerInspect(ctx, curContainerName); err == nil && prev.State != nil && !prev.State.Running &&
+		prev.Config != nil && prev.Config.Labels[channel_settings.LabelChannelID] == strconv.Itoa(chSett.Id) {
+		removeContainer(ctx, cli, prev.ID)
+	}
+
+	resp, crErr := cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:  imageName,
+			Cmd:    append([]string{"/fdps/fmtp_channel"}, channelArgs(chSett, opts.ChiefPort)...),
+			Env:    append(append([]string(nil), profile.Env...), ChannelTokenEnv+"="+opts.Token),
+			Labels: labels,
+		},
+		&container.HostConfig{
+			Resources: container.Resources{
+				NanoCPUs:   int64(profile.Cpus * 1e9),
+				CPUCount:   profile.CPUCount,
+				CPUPercent: profile.CPUPercent,
+				Memory:     profile.MemoryMB << 20,
+			},
+			NetworkMode:    container.NetworkMode(profile.EffectiveNetworkMode()),
+			LogConfig:      container.LogConfig{Type: profile.LogDriver, Config: profile.LogOptions},
+			ReadonlyRootfs: profile.ReadonlyRootfs,
+			RestartPolicy:  container.RestartPolicy{Name: "no"},
+		},
+		&network.NetworkingConfig{},
+		nil,
+		curContainerName)
+
+	if crErr != nil {
+		logger.PrintfErr("Ошибка создания docker контейнера %s. Используемый образ: %s. Ошибка: %v.", curContainerName, imageName, crErr)
+		return "", crErr
+	}
+	logger.PrintfDebug("Создан docker контейнер %s. Используемый образ: %s. %s", curContainerName, imageName, profile.ToLogMessage())
+
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		logger.PrintfErr("Ошибка запуска docker контейнера %s. Ошибка: %v.", curContainerName, err)
+		return "", err
+	}
+	logger.PrintfDebug("Запущен docker контейнер %s.", curContainerName)
+	return resp.ID, nil
+}
+
+// размер буфера канала связи с каналом, запущенным в процессе контроллера
+const localLinkBufferSize = 1024
+
+// inProcessRunner запуск канала горутинами в процессе контроллера.
+// Обмен с контроллером каналов выполняется теми же сообщениями, что и по WebSocket, но через go каналы.
+type inProcessRunner struct {
+	links    *sync.Map     // ключ - ID канала, значение - chan []byte для передачи данных каналу
+	recvChan chan<- []byte // канал для передачи данных от каналов контроллеру
+}
+
+// Run реализация ChannelRunner
+func (r *inProcessRunner) Run(chSett channel_settings.ChannelSettings, opts RunOptions, stopChan <-chan struct{}) *ChannelExit {
+	link := make(chan []byte, localLinkBufferSize)
+	r.links.Store(chSett.Id, link)
+	defer r.links.Delete(chSett.Id)
+
+	initSetts := channel_settings.ChannelSettings{
+		Id:        chSett.Id,
+		LocalATC:  chSett.LocalATC,
+		RemoteATC: chSett.RemoteATC,
+		DataType:  chSett.DataType,
+	}
+	app := NewChannelApp(initSetts, link, r.recvChan, false)
+
+	// запрос настроек, как при подключении приложения FMTP канала
+	if reqData, err := json.Marshal(CreateSettingsRequestMsg(chSett.Id, opts.Token, newSessionID())); err == nil {
+		select {
+		case r.recvChan <- reqData:
+		case <-stopChan:
+			return nil
+		}
+	}
+
+	logger.PrintfDebug("Запущен FMTP канал в процессе контроллера. Идентификатор канала: %d.", chSett.Id)
+	startTime := time.Now()
+
+	if appErr := app.Work(stopChan); appErr != nil {
+		logger.PrintfErr("Нештатное завершение FMTP канала в процессе контроллера. Идентификатор канала: %d. Время работы: %v. Ошибка: %v.",
+			chSett.Id, time.Since(startTime).Round(time.Second), appErr)
+		return &ChannelExit{ChannelID: chSett.Id, ExitCode: StateControllerFailed, Status: "Аварийное завершение канала.", Output: appErr.Error()}
+	}
+
+	logger.PrintfDebug("Штатное завершение FMTP канала в процессе контроллера. Идентификатор канала: %d.", chSett.Id)
+	return nil
+}
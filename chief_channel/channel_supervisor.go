@@ -0,0 +1,209 @@
+package chief_channel
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"fmtp/channel/channel_state"
+)
+
+// параметры перезапуска FMTP каналов
+const (
+	restartBackoffMin = 2 * time.Second  // начальная задержка перезапуска
+	restartBackoffMax = 5 * time.Minute  // максимальная задержка перезапуска
+	restartJitter     = 0.2              // случайное увеличение задержки перезапуска (доля от задержки)
+	crashLoopWindow   = 10 * time.Minute // интервал, за который подсчитываются нештатные завершения канала
+	crashLoopMaxExits = 5                // кол-во нештатных завершений за интервал, после которого канал считается неисправным
+	stableRunTime     = 2 * time.Minute  // время работы канала, после которого задержка перезапуска сбрасывается
+)
+
+// формат времени завершения канала в состоянии канала
+const exitTimeFormat = "2006-01-02 15:04:05"
+
+// ChannelExit сведения о завершении FMTP канала (без команды контроллера)
+type ChannelExit struct {
+	ChannelID int
+	ExitCode  int       // код завершения процесса / статус docker контейнера (-1 - неизвестен)
+	Status    string    // описание причины завершения
+	Output    string    // последние строки вывода (stdout и stderr)
+	Time      time.Time // время завершения
+}
+
+func (ce ChannelExit) String() string {
+	return fmt.Sprintf("Код завершения: %d. %s", ce.ExitCode, ce.Status)
+}
+
+// IsCrash признак нештатного завершения (ненулевой или неизвестный код завершения)
+func (ce ChannelExit) IsCrash() bool {
+	return ce.ExitCode != 0
+}
+
+// состояние перезапусков FMTP канала
+type channelSupervisor struct {
+	restartCount int           // кол-во перезапусков с момента запуска контроллера (или сброса)
+	exits        []time.Time   // время завершений канала за интервал crashLoopWindow
+	backoff      time.Duration // текущая задержка перезапуска
+	startTime    time.Time     // время последнего запуска
+	failed       bool          // признак неисправности канала (перезапуски прекращены до сброса)
+	lastExit     *ChannelExit  // последнее нештатное завершение
+}
+
+// supervisorStore состояния перезапусков FMTP каналов
+type supervisorStore struct {
+	sync.Mutex
+	items map[int]*channelSupervisor // ключ - ID канала
+}
+
+func newSupervisorStore() *supervisorStore {
+	return &supervisorStore{items: make(map[int]*channelSupervisor)}
+}
+
+func (s *supervisorStore) item(channelID int) *channelSupervisor {
+	if _, ok := s.items[channelID]; !ok {
+		s.items[channelID] = &channelSupervisor{backoff: restartBackoffMin}
+	}
+	return s.items[channelID]
+}
+
+// started фиксация запуска канала
+func (s *supervisorStore) started(channelID int, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.item(channelID).startTime = now
+}
+
+// exited обработка завершения канала.
+// Возвращает задержку перезапуска и признак неисправности канала (перезапуск не выполняется).
+// Завершение с кодом 0 не считается нештатным: канал перезапускается с минимальной задержкой,
+// задержка и счетчик нештатных завершений не увеличиваются.
+func (s *supervisorStore) exited(exit ChannelExit, now time.Time) (time.Duration, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	sup := s.item(exit.ChannelID)
+
+	// канал проработал достаточно долго - начинаем отсчет заново
+	if !sup.startTime.IsZero() && now.Sub(sup.startTime) >= stableRunTime {
+		sup.backoff = restartBackoffMin
+		sup.exits = sup.exits[:0]
+	}
+
+	if !exit.IsCrash() {
+		sup.restartCount++
+		return withJitter(restartBackoffMin), false
+	}
+
+	exit.Time = now
+	sup.lastExit = &exit
+
+	actualExits := sup.exits[:0]
+	for _, val := range sup.exits {
+		if now.Sub(val) < crashLoopWindow {
+			actualExits = append(actualExits, val)
+		}
+	}
+	sup.exits = append(actualExits, now)
+
+	if len(sup.exits) >= crashLoopMaxExits {
+		sup.failed = true
+		return 0, true
+	}
+
+	delay := withJitter(sup.backoff)
+	sup.restartCount++
+	sup.backoff *= 2
+	if sup.backoff > restartBackoffMax {
+		sup.backoff = restartBackoffMax
+	}
+	return delay, false
+}
+
+// isFailed признак неисправности канала
+func (s *supervisorStore) isFailed(channelID int) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if sup, ok := s.items[channelID]; ok {
+		return sup.failed
+	}
+	return false
+}
+
+// reset сброс состояния перезапусков канала (ручной сброс, изменение настроек)
+func (s *supervisorStore) reset(channelID int) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.items, channelID)
+}
+
+// applyTo добавление сведений о перезапусках в состояние канала
+func (s *supervisorStore) applyTo(chState *channel_state.ChannelState) {
+	s.Lock()
+	defer s.Unlock()
+
+	sup, ok := s.items[chState.ChannelID]
+	if !ok {
+		return
+	}
+	chState.RestartCount = sup.restartCount
+	if sup.lastExit != nil {
+		chState.LastExit = sup.lastExit.String()
+		chState.LastExitTime = sup.lastExit.Time.Format(exitTimeFormat)
+		chState.OutputTail = sup.lastExit.Output
+	}
+	if sup.failed {
+		chState.DaemonState = channel_state.ChannelStateFailed
+	}
+}
+
+// задержка со случайным увеличением, чтобы каналы не перезапускались одновременно
+// (задержка не становится меньше заданной, в т.ч. меньше restartBackoffMin)
+func withJitter(delay time.Duration) time.Duration {
+	return delay + time.Duration(float64(delay)*restartJitter*rand.Float64())
+}
+
+// outputTail последние строки вывода канала
+type outputTail struct {
+	sync.Mutex
+	maxLines int
+	lines    []string
+	partial  string // последняя незавершенная строка
+}
+
+func newOutputTail(maxLines int) *outputTail {
+	return &outputTail{maxLines: maxLines}
+}
+
+// Write реализация io.Writer
+func (t *outputTail) Write(p []byte) (int, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	text := t.partial + string(p)
+	lines := strings.Split(text, "\n")
+	t.partial = lines[len(lines)-1]
+	for _, val := range lines[:len(lines)-1] {
+		t.lines = append(t.lines, strings.TrimRight(val, "\r"))
+	}
+	if len(t.lines) > t.maxLines {
+		t.lines = append([]string(nil), t.lines[len(t.lines)-t.maxLines:]...)
+	}
+	return len(p), nil
+}
+
+// String последние строки вывода
+func (t *outputTail) String() string {
+	t.Lock()
+	defer t.Unlock()
+
+	lines := t.lines
+	if t.partial != "" {
+		lines = append(append([]string(nil), lines...), t.partial)
+	}
+	return strings.Join(lines, "\n")
+}
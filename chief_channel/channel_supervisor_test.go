@@ -0,0 +1,124 @@
+package chief_channel
+
+import (
+	"testing"
+	"time"
+)
+
+// delay with jitter must lie in [base, base*(1+restartJitter)]
+func checkDelay(t *testing.T, delay time.Duration, base time.Duration) {
+	t.Helper()
+	if delay < base || delay > base+time.Duration(float64(base)*restartJitter) {
+		t.Fatalf("delay %v out of range for backoff %v", delay, base)
+	}
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	ss := newSupervisorStore()
+	now := time.Now()
+
+	// short runs: backoff doubles with every crash
+	base := restartBackoffMin
+	for idx := 1; idx < crashLoopMaxExits; idx++ {
+		ss.started(1, now)
+		now = now.Add(time.Minute)
+		delay, failed := ss.exited(ChannelExit{ChannelID: 1, ExitCode: 1}, now)
+		if failed {
+			t.Fatalf("exit %d: crash loop detected too early", idx)
+		}
+		checkDelay(t, delay, base)
+		base *= 2
+	}
+
+	// backoff is capped
+	ss.items[1].backoff = restartBackoffMax
+	ss.items[1].exits = nil
+	delay, _ := ss.exited(ChannelExit{ChannelID: 1, ExitCode: 1}, now)
+	checkDelay(t, delay, restartBackoffMax)
+	if ss.items[1].backoff != restartBackoffMax {
+		t.Fatalf("backoff %v above max", ss.items[1].backoff)
+	}
+
+	// long stable run resets the backoff
+	ss.started(1, now)
+	now = now.Add(stableRunTime)
+	delay, _ = ss.exited(ChannelExit{ChannelID: 1, ExitCode: 1}, now)
+	checkDelay(t, delay, restartBackoffMin)
+}
+
+func TestSupervisorCrashWindow(t *testing.T) {
+	ss := newSupervisorStore()
+	now := time.Now()
+
+	// crashes older than the window are forgotten
+	for idx := 0; idx < 3*crashLoopMaxExits; idx++ {
+		now = now.Add(crashLoopWindow / (crashLoopMaxExits - 1))
+		ss.started(1, now.Add(-time.Minute))
+		if _, failed := ss.exited(ChannelExit{ChannelID: 1, ExitCode: 1}, now); failed {
+			t.Fatalf("exit %d: crash loop detected for spread crashes", idx)
+		}
+	}
+}
+
+func TestSupervisorCrashLoop(t *testing.T) {
+	ss := newSupervisorStore()
+	now := time.Now()
+	ss.started(1, now)
+
+	for idx := 1; idx <= crashLoopMaxExits; idx++ {
+		now = now.Add(time.Second)
+		_, failed := ss.exited(ChannelExit{ChannelID: 1, ExitCode: -1}, now)
+		if failed != (idx == crashLoopMaxExits) {
+			t.Fatalf("exit %d: failed %v", idx, failed)
+		}
+	}
+	if !ss.isFailed(1) {
+		t.Fatalf("channel not marked failed")
+	}
+	if ss.isFailed(2) {
+		t.Fatalf("other channel marked failed")
+	}
+
+	ss.reset(1)
+	if ss.isFailed(1) {
+		t.Fatalf("failed state not reset")
+	}
+}
+
+func TestSupervisorCleanExit(t *testing.T) {
+	ss := newSupervisorStore()
+	now := time.Now()
+	ss.started(1, now)
+
+	// clean exits never count as crashes and never grow the backoff
+	for idx := 0; idx < 3*crashLoopMaxExits; idx++ {
+		now = now.Add(time.Second)
+		delay, failed := ss.exited(ChannelExit{ChannelID: 1, ExitCode: 0}, now)
+		if failed {
+			t.Fatalf("clean exit %d counted as crash", idx)
+		}
+		checkDelay(t, delay, restartBackoffMin)
+	}
+
+	// crash after clean exits starts from the minimal backoff
+	delay, failed := ss.exited(ChannelExit{ChannelID: 1, ExitCode: 2}, now)
+	if failed {
+		t.Fatalf("first crash reported as crash loop")
+	}
+	checkDelay(t, delay, restartBackoffMin)
+	if ss.items[1].lastExit == nil || ss.items[1].lastExit.ExitCode != 2 {
+		t.Fatalf("last exit must be the crash")
+	}
+	if ss.items[1].restartCount != 3*crashLoopMaxExits+1 {
+		t.Fatalf("restart count %d", ss.items[1].restartCount)
+	}
+}
+
+func TestOutputTail(t *testing.T) {
+	tail := newOutputTail(2)
+	tail.Write([]byte("first\nsec"))
+	tail.Write([]byte("ond\r\nthird\nlast"))
+	if got := tail.String(); got != "second\nthird\nlast" {
+		t.Fatalf("tail %q", got)
+	}
+}
@@ -18,6 +18,7 @@ type ClientSettings struct {
 	ChiefAddress string // адрес контроллера каналов
 	ChiefPort    int    // порт приема данных контроллера каналов
 	ChannelID    int    // идентификатор канала
+	Token        string // токен, выданный каналу контроллером при запуске
 }
 
 // Client клиент взаимодействия контроллера и канала
@@ -30,8 +31,9 @@ type Client struct {
 	SettChan            chan ClientSettings
 	setts               ClientSettings // текущие настройки канала
 	ws                  *web_sock.WebSockClient
-	sendSettingsRequest bool      // был отправлен запрос настроек. При потере связи с сконтроллером и ее восстановлении настройки не перезапрашиваются
+	sendSettingsRequest bool      // был отправлен запрос настроек. При восстановлении связи запрос (рукопожатие) повторяется, чтобы контроллер привязал новое соединение
 	disconnTime         time.Time // время дисконнекта
+	sessionID           string    // идентификатор экземпляра канала (для нумерации сообщений поверх FMTP)
 	CloseChan           chan struct{}
 }
 
@@ -44,6 +46,7 @@ func NewChiefChannelClient(done chan struct{}) *Client {
 		SettChan:    make(chan ClientSettings),
 		ws:          web_sock.NewWebSockClient(done),
 		CloseChan:   make(chan struct{}),
+		sessionID:   newSessionID(),
 	}
 }
 
@@ -82,14 +85,14 @@ func (c *Client) Work() {
 				if !c.sendSettingsRequest {
 					c.LogChan <- fmtp_log.LogChannelST(fmtp_log.SeverityDebug,
 						fmt.Sprintf("Запущен FMTP канал id = %d.", c.setts.ChannelID))
+				}
 
-					if dataToSend, err := json.Marshal(CreateSettingsRequestMsg(c.setts.ChannelID)); err == nil {
-						c.LogChan <- fmtp_log.LogChannelST(fmtp_log.SeverityDebug,
-							fmt.Sprintf("Запрос настроек от FMTP канала id = %d.", c.setts.ChannelID))
+				if dataToSend, err := json.Marshal(CreateSettingsRequestMsg(c.setts.ChannelID, c.setts.Token, c.sessionID)); err == nil {
+					c.LogChan <- fmtp_log.LogChannelST(fmtp_log.SeverityDebug,
+						fmt.Sprintf("Запрос настроек от FMTP канала id = %d. Версия протокола: %d.", c.setts.ChannelID, ProtocolVersion))
 
-						c.SendChan <- dataToSend
-						c.sendSettingsRequest = true
-					}
+					c.SendChan <- dataToSend
+					c.sendSettingsRequest = true
 				}
 				connStateStr = "Подключен"
 				logger.SetDebugParam("Подключение к контролеру:", connStateStr, channel_state.WebOkColor)
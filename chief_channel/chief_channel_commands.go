@@ -0,0 +1,101 @@
+package chief_channel
+
+import (
+	"errors"
+
+	"lemz.com/fdps/logger"
+)
+
+// команды управления FMTP каналом
+const (
+	ChannelCmdStart   = "start"   // запуск канала
+	ChannelCmdStop    = "stop"    // остановка канала (канал не перезапускается до команды запуска)
+	ChannelCmdRestart = "restart" // перезапуск канала
+	ChannelCmdReset   = "reset"   // сброс счетчиков перезапусков и признака неисправности канала, запуск канала
+)
+
+var (
+	ErrChannelNotFound       = errors.New("Канал отсутствует в настройках.")
+	ErrChannelNotWorking     = errors.New("Канал выключен в настройках.")
+	ErrChannelAlreadyRunning = errors.New("Канал уже запущен.")
+	ErrChannelNotRunning     = errors.New("Канал не запущен.")
+	ErrUnknownChannelCmd     = errors.New("Неизвестная команда управления каналом.")
+)
+
+// ChannelCommand команда управления FMTP каналом
+type ChannelCommand struct {
+	ChannelID  int
+	Cmd        string     // команда (ChannelCmdStart | ChannelCmdStop | ChannelCmdRestart)
+	ResultChan chan error // канал для передачи результата выполнения команды
+}
+
+// NewChannelCommand конструктор
+func NewChannelCommand(channelID int, cmd string) ChannelCommand {
+	return ChannelCommand{ChannelID: channelID, Cmd: cmd, ResultChan: make(chan error, 1)}
+}
+
+// выполнение команды управления каналом
+func (cc *ChiefChannelServer) processCommand(cmd ChannelCommand) error {
+	chSett, settsOk := cc.channelSettsByID(cmd.ChannelID)
+	if !settsOk {
+		return ErrChannelNotFound
+	}
+
+	isRunning := cc.channelRunning(cmd.ChannelID)
+
+	switch cmd.Cmd {
+	case ChannelCmdStart:
+		if !chSett.IsWorking {
+			return ErrChannelNotWorking
+		}
+		if isRunning {
+			return ErrChannelAlreadyRunning
+		}
+		delete(cc.stoppedByCmd, cmd.ChannelID)
+		cc.supervisors.reset(cmd.ChannelID)
+		cc.initChannelState(chSett)
+		cc.startChannelsByIDs([]int{cmd.ChannelID})
+
+	case ChannelCmdStop:
+		if !isRunning {
+			return ErrChannelNotRunning
+		}
+		cc.stoppedByCmd[cmd.ChannelID] = struct{}{}
+		cc.stopChannelsByIDs([]int{cmd.ChannelID})
+
+		stoppedSett := chSett
+		stoppedSett.IsWorking = false
+		cc.initChannelState(stoppedSett)
+
+	case ChannelCmdRestart:
+		if !chSett.IsWorking {
+			return ErrChannelNotWorking
+		}
+		delete(cc.stoppedByCmd, cmd.ChannelID)
+		cc.supervisors.reset(cmd.ChannelID)
+		cc.stopChannelsByIDs([]int{cmd.ChannelID})
+		cc.initChannelState(chSett)
+
+		// канал запускается после завершения остановки (контейнер удален, имя контейнера свободно)
+		cc.startChannelsByIDs([]int{cmd.ChannelID})
+
+	case ChannelCmdReset:
+		cc.supervisors.reset(cmd.ChannelID)
+		if chSett.IsWorking && !isRunning && !cc.isStoppedByCmd(cmd.ChannelID) {
+			cc.initChannelState(chSett)
+			cc.startChannelsByIDs([]int{cmd.ChannelID})
+		}
+
+	default:
+		return ErrUnknownChannelCmd
+	}
+
+	logger.PrintfInfo("Выполнена команда управления каналом (%s). Идентификатор канала: %d.", cmd.Cmd, cmd.ChannelID)
+	return nil
+}
+
+// признак остановки канала командой управления
+func (cc *ChiefChannelServer) isStoppedByCmd(channelID int) bool {
+	_, ok := cc.stoppedByCmd[channelID]
+	return ok
+}
@@ -0,0 +1,162 @@
+package chief_channel
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"fmtp/chief/chief_metrics"
+	"fmtp/fmtp_log"
+
+	"lemz.com/fdps/logger"
+)
+
+// channelDelivery состояние подтверждаемой доставки сообщений поверх FMTP между контроллером и каналом
+type channelDelivery struct {
+	out         *outbox // сообщения контроллера, не подтвержденные каналом
+	in          inbox   // последнее сообщение, полученное от канала
+	peerSession string  // идентификатор экземпляра канала
+}
+
+// состояние доставки сообщений канала (создается при первом обращении)
+func (cc *ChiefChannelServer) delivery(chId int) *channelDelivery {
+	d, ok := cc.deliveries[chId]
+	if !ok {
+		d = &channelDelivery{out: newOutbox()}
+		cc.deliveries[chId] = d
+	}
+	return d
+}
+
+// признак подтверждаемой доставки сообщений в канал (согласовано при рукопожатии)
+func (cc *ChiefChannelServer) ackEnabled(chId int) bool {
+	sock, ok := cc.wsClients[chId]
+	if !ok {
+		return false
+	}
+	conn, ok := cc.wsConns[sock]
+	return ok && hasCapability(conn.Capabilities, CapabilityAck)
+}
+
+// рукопожатие канала с подтверждаемой доставкой: при смене экземпляра канала нумерация сообщений начинается заново.
+// Возвращает номер последнего полученного от канала сообщения
+func (cc *ChiefChannelServer) deliveryHandshake(chId int, sessionID string) uint64 {
+	d := cc.delivery(chId)
+	if d.peerSession != sessionID {
+		if d.peerSession != "" && d.out.len() > 0 {
+			logger.PrintfInfo("FMTP канал с ID = %d перезапущен. Неподтвержденных сообщений для повторной передачи: %d.", chId, d.out.len())
+		}
+		d.in = inbox{}
+		d.out.restart()
+		d.peerSession = sessionID
+	}
+	return d.in.lastSeq
+}
+
+// отправка сообщения поверх FMTP в канал (с номером, если согласована подтверждаемая доставка).
+// Сообщение для неподключенного канала сохраняется в очереди канала и передается после рукопожатия.
+// Возвращает true, если сообщение передано каналу
+func (cc *ChiefChannelServer) sendDataMsgToChannel(chId int, msg DataMsg) bool {
+	connected := cc.channelConnected(chId)
+	if !connected || cc.ackEnabled(chId) {
+		var dropped int
+		if msg, dropped = cc.delivery(chId).out.push(msg); dropped > 0 {
+			cc.deliveryDropped(chId, dropped)
+		}
+	}
+	if !connected {
+		return false
+	}
+
+	data, mrshErr := json.Marshal(msg)
+	if mrshErr != nil {
+		logger.PrintfErr("Ошибка формирования сообщения для FMTP канала. Ошибка: %v", mrshErr)
+		return false
+	}
+	return cc.sendDataToChannel(chId, data)
+}
+
+// передача сообщений, сохраненных в очереди до подключения канала, каналу без подтверждаемой доставки
+// (канал старой версии или канал в процессе контроллера). Сообщения передаются без номеров и удаляются из очереди
+func (cc *ChiefChannelServer) flushOutbox(chId int) {
+	d, ok := cc.deliveries[chId]
+	if !ok || d.out.len() == 0 {
+		return
+	}
+	logger.PrintfInfo("Передача в FMTP канал с ID = %d сообщений, полученных до подключения канала: %d.", chId, d.out.len())
+	for _, val := range d.out.drain() {
+		val.Seq = 0
+		if data, err := json.Marshal(val); err == nil {
+			cc.sendDataToChannel(chId, data)
+		}
+	}
+}
+
+// обработка подтверждения получения сообщений каналом. После рукопожатия неподтвержденные сообщения передаются повторно
+func (cc *ChiefChannelServer) processAck(chId int, ackMsg AckMsg) {
+	d := cc.delivery(chId)
+	d.out.ack(ackMsg.Ack)
+
+	if !ackMsg.Sync || d.out.len() == 0 {
+		return
+	}
+	logger.PrintfInfo("Повторная передача в FMTP канал с ID = %d неподтвержденных сообщений: %d.", chId, d.out.len())
+	for _, val := range d.out.unacked() {
+		if data, err := json.Marshal(val); err == nil {
+			cc.sendDataToChannel(chId, data)
+		}
+	}
+	cc.deliveryMetric(chId, chief_metrics.ChanTpRetransmit, d.out.len())
+}
+
+// проверка номера сообщения от канала и отправка подтверждения. Возвращает false для повторно полученного сообщения
+func (cc *ChiefChannelServer) acceptChannelSeq(chId int, seq uint64) bool {
+	if seq == 0 {
+		return true
+	}
+	d := cc.delivery(chId)
+	ok, gap := d.in.accept(seq)
+
+	if ackData, err := json.Marshal(CreateAckMsg(chId, d.in.lastSeq, false)); err == nil {
+		cc.sendDataToChannel(chId, ackData)
+	}
+
+	if !ok {
+		logger.PrintfDebug("Отброшено повторно полученное сообщение FMTP канала с ID = %d. Номер: %d.", chId, seq)
+		cc.deliveryMetric(chId, chief_metrics.ChanTpDeliveryDup, 1)
+	} else if gap > 0 {
+		chSett, _ := cc.channelSettsByID(chId)
+		logger.PrintfWarn("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityWarning, chSett.DataType, fmt.Sprintf(
+			"Не получено %d сообщений FMTP канала с ID = %d (удалены каналом из-за переполнения очереди неподтвержденных сообщений).", gap, chId)))
+		cc.deliveryMetric(chId, chief_metrics.ChanTpDeliveryGap, int(gap))
+	}
+	return ok
+}
+
+// неподтвержденные сообщения удалены из-за переполнения очереди
+func (cc *ChiefChannelServer) deliveryDropped(chId int, dropped int) {
+	chSett, _ := cc.channelSettsByID(chId)
+	logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, chSett.DataType, fmt.Sprintf(
+		"Переполнена очередь неподтвержденных сообщений FMTP канала с ID = %d (%d). Удалено сообщений: %d.", chId, maxUnackedMessages, dropped)))
+	cc.deliveryMetric(chId, chief_metrics.ChanTpDeliveryDrop, dropped)
+}
+
+func (cc *ChiefChannelServer) deliveryMetric(chId int, tp string, count int) {
+	chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+		Tp:     tp,
+		LocAtc: cc.chStates[chId].LocalName,
+		RemAtc: cc.chStates[chId].RemoteName,
+		Count:  count,
+	}
+}
+
+// кол-во неподтвержденных сообщений: сообщения контроллера и сообщения каналов (по данным каналов)
+func (cc *ChiefChannelServer) unackedMetrics() chief_metrics.UnackedMetrics {
+	var retValue chief_metrics.UnackedMetrics
+	for _, d := range cc.deliveries {
+		retValue.ToChannels += d.out.len()
+	}
+	for _, val := range cc.chStates {
+		retValue.FromChannels += val.UnackedIn
+	}
+	return retValue
+}
@@ -0,0 +1,154 @@
+package chief_channel
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/chief/chief_metrics"
+
+	"lemz.com/fdps/web_sock"
+)
+
+var drainMetricsOnce sync.Once
+
+// chief channel server with channel 1 in settings and no running Work
+func newDeliveryServer() *ChiefChannelServer {
+	drainMetricsOnce.Do(func() {
+		go func() {
+			for range chief_metrics.ChanMetricsChan {
+			}
+		}()
+	})
+	cc := &ChiefChannelServer{
+		channelSetts: channel_settings.ChannelSettingsWithPort{
+			ChSettings: []channel_settings.ChannelSettings{{Id: 1, IsWorking: true}},
+		},
+		restartChan:   make(chan int, 10),
+		supervisors:   newSupervisorStore(),
+		ChannelBinMap: new(sync.Map),
+		stoppedByCmd:  make(map[int]struct{}),
+		wsServer:      &web_sock.WebSockServer{SendDataChan: make(chan web_sock.WsPackage, 16)},
+		wsClients:     make(map[int]*websocket.Conn),
+		wsConns:       make(map[*websocket.Conn]*channelConn),
+		tokens:        newTokenStore(),
+		sessionID:     newSessionID(),
+		deliveries:    make(map[int]*channelDelivery),
+		chStates:      make(map[int]сhannelStateTime),
+		localLinks:    new(sync.Map),
+	}
+	cc.tokens.set(1, "token")
+	return cc
+}
+
+func marshalMsg(t *testing.T, msg interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// next data message sent to the channel (other messages are skipped)
+func nextDataMsg(t *testing.T, data <-chan []byte) DataMsg {
+	t.Helper()
+	for {
+		select {
+		case cur := <-data:
+			var msg DataMsg
+			if err := json.Unmarshal(cur, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Header == FdpsMessageHeader {
+				return msg
+			}
+		default:
+			t.Fatalf("no data message sent to channel")
+		}
+	}
+}
+
+func wsData(cc *ChiefChannelServer) <-chan []byte {
+	retValue := make(chan []byte, cap(cc.wsServer.SendDataChan))
+	for len(cc.wsServer.SendDataChan) > 0 {
+		retValue <- (<-cc.wsServer.SendDataChan).Data
+	}
+	return retValue
+}
+
+func TestOutboxAckedChannel(t *testing.T) {
+	cc := newDeliveryServer()
+
+	// disconnected channel: messages are kept in the outbox
+	for _, val := range []string{"first", "second", "third"} {
+		if cc.sendDataMsgToChannel(1, CreateChiefDataMsg(1, val)) {
+			t.Fatalf("message %s sent to disconnected channel", val)
+		}
+	}
+
+	// channel failed to connect and is restarted: outbox is kept
+	cc.processChannelExit(ChannelExit{ChannelID: 1, ExitCode: FailToConnect})
+	if cc.deliveries[1].out.len() != 3 {
+		t.Fatalf("outbox %d after restart, want 3", cc.deliveries[1].out.len())
+	}
+
+	// handshake of the new channel instance, outbox is resent on the sync ack
+	sock := new(websocket.Conn)
+	cc.processChannelData(marshalMsg(t, CreateSettingsRequestMsg(1, "token", "session")), sock)
+	if _, bound := cc.wsConns[sock]; !bound {
+		t.Fatalf("channel connection not bound")
+	}
+	cc.processChannelData(marshalMsg(t, CreateAckMsg(1, 0, true)), sock)
+
+	sent := wsData(cc)
+	for idx, val := range []string{"first", "second", "third"} {
+		msg := nextDataMsg(t, sent)
+		if msg.Text != val || msg.Seq != uint64(idx+1) {
+			t.Fatalf("resent message %q seq %d, want %q seq %d", msg.Text, msg.Seq, val, idx+1)
+		}
+	}
+
+	// connected channel: message is sent and kept until acked
+	if !cc.sendDataMsgToChannel(1, CreateChiefDataMsg(1, "fourth")) {
+		t.Fatalf("message not sent to connected channel")
+	}
+	if msg := nextDataMsg(t, wsData(cc)); msg.Seq != 4 {
+		t.Fatalf("message seq %d, want 4", msg.Seq)
+	}
+	cc.processChannelData(marshalMsg(t, CreateAckMsg(1, 4, false)), sock)
+	if cc.deliveries[1].out.len() != 0 {
+		t.Fatalf("outbox %d after ack, want 0", cc.deliveries[1].out.len())
+	}
+}
+
+func TestOutboxFlushedWithoutAck(t *testing.T) {
+	cc := newDeliveryServer()
+
+	for _, val := range []string{"first", "second"} {
+		cc.sendDataMsgToChannel(1, CreateChiefDataMsg(1, val))
+	}
+
+	// in-process channel connects: outbox is flushed right after the handshake
+	link := make(chan []byte, 16)
+	cc.localLinks.Store(1, link)
+	cc.processChannelData(marshalMsg(t, CreateSettingsRequestMsg(1, "token", "session")), nil)
+
+	for _, val := range []string{"first", "second"} {
+		msg := nextDataMsg(t, link)
+		if msg.Text != val || msg.Seq != 0 {
+			t.Fatalf("flushed message %q seq %d, want %q without seq", msg.Text, msg.Seq, val)
+		}
+	}
+	if cc.deliveries[1].out.len() != 0 {
+		t.Fatalf("outbox %d after flush, want 0", cc.deliveries[1].out.len())
+	}
+
+	// connected channel without acks: nothing is kept
+	if !cc.sendDataMsgToChannel(1, CreateChiefDataMsg(1, "third")) || cc.deliveries[1].out.len() != 0 {
+		t.Fatalf("message to connected channel kept in outbox")
+	}
+}
@@ -0,0 +1,107 @@
+package chief_channel
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/chief/chief_metrics"
+	pb "fmtp/chief/proto/fmtp"
+	"fmtp/fmtp_log"
+	"fmtp/oldi_msg"
+
+	"lemz.com/fdps/logger"
+)
+
+// обработка OLDI сообщения, полученного из канала (номер сообщения, LAM на отправленные сообщения, формирование LAM)
+func (cc *ChiefChannelServer) processChannelOldiMsg(chSett channel_settings.ChannelSettings, oldiMsg oldi_msg.Message) {
+	cc.checkInNumber(chSett, oldiMsg)
+
+	if chSett.LamEnabled && oldiMsg.Title == oldi_msg.TitleLAM {
+		if acked, ok := cc.lams.acknowledged(chSett.Id, oldiMsg); ok {
+			logger.PrintfDebug("FMTP FORMAT %#v", channelLogMessage(chSett, fmtp_log.SeverityDebug,
+				fmt.Sprintf("Получен LAM на сообщение. %s.", acked.Summary)))
+
+			cc.sendLamStatus(chSett, acked, pb.MsgTpLamAck)
+			chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+				Tp:     chief_metrics.ChanTpLamAck,
+				LocAtc: chSett.LocalATC,
+				RemAtc: chSett.RemoteATC,
+				Count:  1,
+			}
+		} else {
+			logger.PrintfWarn("FMTP FORMAT %#v", channelLogMessage(chSett, fmtp_log.SeverityWarning,
+				fmt.Sprintf("Получен LAM на неизвестное сообщение. Ссылка: %s.", oldiMsg.Reference.String())))
+		}
+	}
+
+	if chSett.LamGenerate && oldiMsg.NeedLam() {
+		lam := createLam(oldiMsg, cc.seqs.nextOut(chSett))
+		lamText := FormatPayload(payloadFormat(chSett), lam)
+
+		if cc.sendToChannel(chSett.Id, lamText) {
+			logger.PrintfDebug("FMTP FORMAT %#v", channelLogMessage(chSett, fmtp_log.SeverityDebug,
+				fmt.Sprintf("Сформирован LAM на сообщение %s: %s.", oldiMsg.Number.String(), lamText)))
+
+			chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+				Tp:     chief_metrics.ChanTpLamGenerated,
+				LocAtc: chSett.LocalATC,
+				RemAtc: chSett.RemoteATC,
+				Count:  1,
+			}
+		}
+	}
+}
+
+// проверка истечения времени ожидания LAM
+func (cc *ChiefChannelServer) checkLamTimeouts() {
+	for _, val := range cc.lams.expired(time.Now()) {
+		chSett, ok := cc.channelSettsByID(val.ChannelID)
+		if !ok {
+			continue
+		}
+
+		logger.PrintfErr("FMTP FORMAT %#v", channelLogMessage(chSett, fmtp_log.SeverityError,
+			fmt.Sprintf("Не получен LAM на сообщение в течении %d сек. %s.", chSett.LamTimeout, val.Summary)))
+
+		cc.sendLamStatus(chSett, val, pb.MsgTpLamTimeout)
+		chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+			Tp:     chief_metrics.ChanTpLamTimeout,
+			LocAtc: chSett.LocalATC,
+			RemAtc: chSett.RemoteATC,
+			Count:  1,
+		}
+	}
+}
+
+// отправка провайдеру состояния подтверждения сообщения.
+// Отправка не блокирует обработку каналов: при заполненной очереди состояние не отправляется
+func (cc *ChiefChannelServer) sendLamStatus(chSett channel_settings.ChannelSettings, msg lamWaiting, msgTp string) {
+	select {
+	case cc.ToFdpsPacketChan <- &pb.Msg{
+		Cid:    chSett.RemoteATC,
+		Tp:     msgTp,
+		Id:     msg.ProviderID,
+		Txt:    msg.Text,
+		Rrtime: timestamppb.Now(),
+	}:
+	default:
+		logger.PrintfWarn("FMTP FORMAT %#v", channelLogMessage(chSett, fmtp_log.SeverityWarning,
+			fmt.Sprintf("Переполнена очередь сообщений провайдеру OLDI. Состояние подтверждения %s не отправлено. %s.", msgTp, msg.Summary)))
+	}
+}
+
+// отправка сообщения поверх FMTP в канал
+func (cc *ChiefChannelServer) sendToChannel(channelID int, text string) bool {
+	if !cc.channelConnected(channelID) {
+		logger.PrintfErr("Не найдено WebSocket соединение канала для отправки сообщения.")
+		return false
+	}
+	if cc.chStates[channelID].ChannelState.FmtpState != chValidStStr {
+		return false
+	}
+
+	return cc.sendDataMsgToChannel(channelID, CreateChiefDataMsg(channelID, text))
+}
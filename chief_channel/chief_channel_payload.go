@@ -0,0 +1,102 @@
+package chief_channel
+
+import (
+	"fmtp/adexp"
+	"fmtp/channel/channel_settings"
+	"fmtp/chief/chief_settings"
+	"fmtp/fmtp_log"
+	"fmtp/oldi_msg"
+
+	"lemz.com/fdps/logger"
+)
+
+// направление передачи OLDI сообщения (для журнала)
+const (
+	toChannelDirection   = "провайдер -> канал"
+	fromChannelDirection = "канал -> провайдер"
+)
+
+// ParsePayload разбор OLDI сообщения с учетом формата сообщений канала (ICAO или ADEXP)
+func ParsePayload(payloadFormat string, text string) (oldi_msg.Message, error) {
+	if payloadFormat == channel_settings.PayloadAdexp {
+		adexpMsg, err := adexp.Parse(text)
+		if err != nil {
+			return oldi_msg.NewMessage(""), err
+		}
+		return adexp.ToOldi(adexpMsg)
+	}
+	return oldi_msg.Parse(text)
+}
+
+// FormatPayload текст OLDI сообщения в формате сообщений канала (ICAO или ADEXP)
+func FormatPayload(payloadFormat string, msg oldi_msg.Message) string {
+	if payloadFormat == channel_settings.PayloadAdexp {
+		adexpMsg := adexp.FromOldi(msg)
+		return adexpMsg.String()
+	}
+	return msg.String()
+}
+
+// RenumberPayload замена номера OLDI сообщения (поле 3b / REFDATA) без изменения остальных полей
+func RenumberPayload(payloadFormat string, text string, num oldi_msg.MessageNumber) (string, error) {
+	if payloadFormat == channel_settings.PayloadAdexp {
+		adexpMsg, err := adexp.Parse(text)
+		if err != nil {
+			return text, err
+		}
+		adexpMsg.Set(adexp.NumberField(adexp.KeyRefData, num))
+		return adexpMsg.String(), nil
+	}
+
+	oldiMsg, err := oldi_msg.Parse(text)
+	if err != nil {
+		return text, err
+	}
+	oldiMsg.Number = num
+	return oldiMsg.String(), nil
+}
+
+// формат OLDI сообщений канала (по умолчанию ICAO)
+func payloadFormat(chSett channel_settings.ChannelSettings) string {
+	if chSett.PayloadFormat == "" {
+		return channel_settings.PayloadIcao
+	}
+	return chSett.PayloadFormat
+}
+
+// проверка OLDI сообщения, передаваемого через канал, на соответствие формату сообщений канала.
+// Возвращает разобранное сообщение и признак успешного разбора.
+func inspectPayload(chSett channel_settings.ChannelSettings, direction string, text string) (oldi_msg.Message, bool) {
+	if chSett.DataType != chief_settings.OLDIProvider {
+		return oldi_msg.NewMessage(""), false
+	}
+
+	oldiMsg, err := ParsePayload(payloadFormat(chSett), text)
+	if err != nil {
+		logger.PrintfWarn("Некорректное OLDI сообщение (%s). Канал: %s - %s. Формат: %s. Сообщение: %s. Ошибка: %v",
+			direction, chSett.LocalATC, chSett.RemoteATC, payloadFormat(chSett), text, err)
+		return oldiMsg, false
+	}
+	logger.PrintfDebug("OLDI сообщение (%s). Канал: %s - %s. Формат: %s. %s.",
+		direction, chSett.LocalATC, chSett.RemoteATC, payloadFormat(chSett), oldiMsg.ToLogMessage())
+	return oldiMsg, true
+}
+
+// сообщение журнала контроллера, относящееся к каналу
+func channelLogMessage(chSett channel_settings.ChannelSettings, severity string, text string) fmtp_log.LogMessage {
+	retValue := fmtp_log.LogCntrlSDT(severity, chSett.DataType, text)
+	retValue.ChannelId = chSett.Id
+	retValue.ChannelLocName = chSett.LocalATC
+	retValue.ChannelRemName = chSett.RemoteATC
+	return retValue
+}
+
+// настройки канала по идентификатору
+func (cc *ChiefChannelServer) channelSettsByID(channelID int) (channel_settings.ChannelSettings, bool) {
+	for _, val := range cc.channelSetts.ChSettings {
+		if val.Id == channelID {
+			return val, true
+		}
+	}
+	return channel_settings.ChannelSettings{}, false
+}
@@ -9,21 +9,52 @@ import (
 
 // коды завершения приложения канала
 const (
-	InvalidParamCount = 1001 // приложению передано неверное кол-во аргументов
-	InvalidNetPort    = 1002 // невалидное значение сетевого порта для связи с контроллером
-	InvalidDaemonID   = 1003 // невалидное значение идентификатора канала
-	InvalidWebPort    = 1004 // невалидное значение порта web странички
-	FailToConnect     = 1005 // канал не смог подключиться к серверу (chief) в течении минуты
+	InvalidParamCount     = 1001 // приложению передано неверное кол-во аргументов
+	InvalidNetPort        = 1002 // невалидное значение сетевого порта для связи с контроллером
+	InvalidDaemonID       = 1003 // невалидное значение идентификатора канала
+	InvalidWebPort        = 1004 // невалидное значение порта web странички
+	FailToConnect         = 1005 // канал не смог подключиться к серверу (chief) в течении минуты
+	StateControllerFailed = 1006 // аварийное завершение контроллера FMTP состояний
+	HandshakeRejected     = 1007 // контроллер отклонил подключение канала
 )
 
+// версии протокола взаимодействия контроллера и канала
+const (
+	// LegacyProtocolVersion каналы и контроллеры без рукопожатия: запрос настроек без версии и токена
+	LegacyProtocolVersion = 1
+
+	// ProtocolVersion текущая версия: запрос настроек является рукопожатием (версия, возможности, токен канала),
+	// запрос повторяется при каждом подключении к контроллеру
+	ProtocolVersion = 2
+)
+
+// возможности сторон, согласуемые при рукопожатии (используются те, что поддерживаются обеими сторонами)
+const (
+	// CapabilityReject канал обрабатывает отказ в подключении (завершает работу)
+	CapabilityReject = "reject"
+
+	// CapabilityAck сообщения поверх FMTP нумеруются и подтверждаются получателем,
+	// неподтвержденные сообщения передаются повторно после восстановления связи
+	CapabilityAck = "ack"
+)
+
+// SupportedCapabilities возможности, поддерживаемые текущей версией
+var SupportedCapabilities = []string{CapabilityReject, CapabilityAck}
+
+// ChannelTokenEnv переменная окружения, через которую приложению канала передается токен, выданный при запуске
+const ChannelTokenEnv = "FMTP_CHANNEL_TOKEN"
+
 // от контроллера (chief) могут быть получены сообщения:
-//		- настройки канала
+//		- настройки канала (ответ на рукопожатие)
+//		- отказ в подключении
 // 		- сообщение поверх FMTP
+//		- подтверждение получения сообщений поверх FMTP
 // контроллеру(chief) отправляется соообщение:
-//		- запрос настроек канала
+//		- запрос настроек канала (рукопожатие)
 //		- сообщение для журнала
 //		- сообщение о состоянии канала
 //		- сообщение поверх FMTP
+//		- подтверждение получения сообщений поверх FMTP
 
 const (
 	// RequestSettingsHeader заголовок сообщения запроса настроек канала
@@ -32,6 +63,9 @@ const (
 	// AnswerSettingsHeader заголовок сообщения с настройками канала
 	AnswerSettingsHeader = "AnswerSettings"
 
+	// HandshakeRejectHeader заголовок сообщения об отказе в подключении канала
+	HandshakeRejectHeader = "HandshakeReject"
+
 	// ChannelHeartbeatHeader заголовок сообщения о состоянии канала
 	ChannelHeartbeatHeader = "DaemonHeartbeat"
 
@@ -43,6 +77,9 @@ const (
 
 	// ChannelMessageHeader заголовок сообщения поверх FMTP от канала
 	ChannelMessageHeader = "DaemonMessage"
+
+	// AckHeader заголовок подтверждения получения сообщений поверх FMTP
+	AckHeader = "Ack"
 )
 
 // HeaderMsg описание заголовка сообщений, получаемых от контроллера(chief)
@@ -51,28 +88,98 @@ type HeaderMsg struct {
 	Header string `json:"MessageType"` // текст заголовка сообщения
 }
 
-// SettingsRequestMsg сообщение запроса настроек канала
+// SettingsRequestMsg сообщение запроса настроек канала (рукопожатие).
+// Каналы старых версий передают только ChannelID, контроллеры старых версий игнорируют остальные поля.
 // канал -> контроллер (chief)
 type SettingsRequestMsg struct {
 	HeaderMsg
-	ChannelID int `json:"ChannelID"` // идентификатор канала
+	ChannelID       int      `json:"ChannelID"`       // идентификатор канала
+	ProtocolVersion int      `json:"ProtocolVersion"` // версия протокола канала (0 - LegacyProtocolVersion)
+	Capabilities    []string `json:"Capabilities"`    // возможности канала
+	Token           string   `json:"Token"`           // токен, выданный каналу при запуске
+	SessionID       string   `json:"SessionID"`       // идентификатор экземпляра канала (нумерация сообщений начинается заново при смене)
 }
 
 // CreateSettingsRequestMsg сформировать сообщение запроса настроек
-func CreateSettingsRequestMsg(chID int) SettingsRequestMsg {
-	return SettingsRequestMsg{HeaderMsg: HeaderMsg{Header: RequestSettingsHeader}, ChannelID: chID}
+func CreateSettingsRequestMsg(chID int, token string, sessionID string) SettingsRequestMsg {
+	return SettingsRequestMsg{
+		HeaderMsg:       HeaderMsg{Header: RequestSettingsHeader},
+		ChannelID:       chID,
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    SupportedCapabilities,
+		Token:           token,
+		SessionID:       sessionID,
+	}
+}
+
+// Version версия протокола канала
+func (m SettingsRequestMsg) Version() int {
+	if m.ProtocolVersion < LegacyProtocolVersion {
+		return LegacyProtocolVersion
+	}
+	return m.ProtocolVersion
 }
 
 // SettingsAnswerMsg ответ на запроса настроек канала
 // контроллер (chief) -> канал
 type SettingsAnswerMsg struct {
 	HeaderMsg
-	channel_settings.ChannelSettings // настройки канала
+	channel_settings.ChannelSettings          // настройки канала
+	ProtocolVersion                  int      `json:"ProtocolVersion"` // согласованная версия протокола (0 - контроллер старой версии)
+	Capabilities                     []string `json:"Capabilities"`    // согласованные возможности
+	SessionID                        string   `json:"SessionID"`       // идентификатор экземпляра контроллера каналов
+	Ack                              uint64   `json:"Ack"`             // номер последнего сообщения канала, полученного контроллером
 }
 
 // CreateSettingsAnswerMsg сформировать ответ на запрос настроек
-func CreateSettingsAnswerMsg(chSett channel_settings.ChannelSettings) SettingsAnswerMsg {
-	return SettingsAnswerMsg{HeaderMsg{Header: AnswerSettingsHeader}, chSett}
+func CreateSettingsAnswerMsg(chSett channel_settings.ChannelSettings, version int, capabilities []string) SettingsAnswerMsg {
+	return SettingsAnswerMsg{HeaderMsg: HeaderMsg{Header: AnswerSettingsHeader}, ChannelSettings: chSett, ProtocolVersion: version, Capabilities: capabilities}
+}
+
+// HandshakeRejectMsg отказ в подключении канала
+// контроллер (chief) -> канал
+type HandshakeRejectMsg struct {
+	HeaderMsg
+	ChannelID       int    `json:"ChannelID"`       // идентификатор канала из запроса
+	ProtocolVersion int    `json:"ProtocolVersion"` // версия протокола контроллера
+	Reason          string `json:"Reason"`          // причина отказа
+}
+
+// CreateHandshakeRejectMsg сформировать сообщение об отказе в подключении
+func CreateHandshakeRejectMsg(chID int, reason string) HandshakeRejectMsg {
+	return HandshakeRejectMsg{HeaderMsg: HeaderMsg{Header: HandshakeRejectHeader}, ChannelID: chID, ProtocolVersion: ProtocolVersion, Reason: reason}
+}
+
+// negotiateVersion версия протокола, поддерживаемая обеими сторонами
+func negotiateVersion(peerVersion int) int {
+	if peerVersion < ProtocolVersion {
+		return peerVersion
+	}
+	return ProtocolVersion
+}
+
+// negotiateCapabilities возможности, поддерживаемые обеими сторонами
+func negotiateCapabilities(peerCapabilities []string) []string {
+	var retValue []string
+	for _, val := range peerCapabilities {
+		for _, supported := range SupportedCapabilities {
+			if val == supported {
+				retValue = append(retValue, val)
+				break
+			}
+		}
+	}
+	return retValue
+}
+
+// hasCapability признак наличия возможности в списке
+func hasCapability(capabilities []string, capability string) bool {
+	for _, val := range capabilities {
+		if val == capability {
+			return true
+		}
+	}
+	return false
 }
 
 // ChannelHeartbeatMsg сообщение о состоянии канала
@@ -103,8 +210,9 @@ func CreateChannelLogMsg(log fmtp_log.LogMessage) ChannelLogMsg {
 // канал <-> контроллер (chief)
 type DataMsg struct {
 	HeaderMsg
-	ChannelID        int `json:"ChannelID"` // идентификатор канала
-	fmtp.FmtpMessage     // сообщение для канала
+	ChannelID        int    `json:"ChannelID"`     // идентификатор канала
+	Seq              uint64 `json:"Seq,omitempty"` // номер сообщения (0 - без подтверждения получения)
+	fmtp.FmtpMessage        // сообщение для канала
 }
 
 // CreateChiefDataMsg сформировать сообщение поверх FMTP от контроллера
@@ -116,3 +224,17 @@ func CreateChiefDataMsg(chID int, msgText string) DataMsg {
 func CreateChannelDataMsg(chID int, message fmtp.FmtpMessage) DataMsg {
 	return DataMsg{HeaderMsg: HeaderMsg{Header: ChannelMessageHeader}, ChannelID: chID, FmtpMessage: message}
 }
+
+// AckMsg подтверждение получения сообщений поверх FMTP (получены все сообщения с номером до Ack включительно)
+// канал <-> контроллер (chief)
+type AckMsg struct {
+	HeaderMsg
+	ChannelID int    `json:"ChannelID"` // идентификатор канала
+	Ack       uint64 `json:"Ack"`       // номер последнего полученного сообщения
+	Sync      bool   `json:"Sync"`      // подтверждение после рукопожатия: запрос повторной передачи неподтвержденных сообщений
+}
+
+// CreateAckMsg сформировать подтверждение получения сообщений
+func CreateAckMsg(chID int, ack uint64, sync bool) AckMsg {
+	return AckMsg{HeaderMsg: HeaderMsg{Header: AckHeader}, ChannelID: chID, Ack: ack, Sync: sync}
+}
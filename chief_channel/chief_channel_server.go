@@ -1,20 +1,15 @@
 package chief_channel
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
 	"reflect"
 	"strconv"
 	"sync"
 	"time"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/client"
 	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"fmtp/channel/channel_settings"
 	"fmtp/channel/channel_state"
@@ -22,6 +17,7 @@ import (
 	"fmtp/chief/chief_settings"
 	"fmtp/chief/chief_state"
 	pb "fmtp/chief/proto/fmtp"
+	"fmtp/chief/routing"
 	"fmtp/configurator"
 	"fmtp/fmtp"
 	"fmtp/fmtp_log"
@@ -37,11 +33,10 @@ const (
 	srvStateErrorValue = "Не запущен."
 )
 
-// сведения об исполняемом файле канала
+// сведения о запущенном канале
 type channelBin struct {
-	filePath string        // путь к исполняемому файлу
 	killChan chan struct{} // канал, исользуемый для завершения выполнения
-	//startPerform bool          // выполнене запуск канала
+	doneChan chan struct{} // канал, закрываемый после завершения выполнения
 }
 
 // состояния каналов FMTP с отметкой времени
@@ -56,20 +51,42 @@ type ChiefChannelServer struct {
 	channelSetts     channel_settings.ChannelSettingsWithPort      // текущие настройки каналов и орт для связи с каналами
 	statesSendTicker *time.Ticker                                  // тикер отправки состояния каналов
 
-	FromFdpsPacketChan chan pb.MsgWithChanId // канал для приема сообщений от провайдера OLDI
+	FromFdpsPacketChan chan pb.MsgWithChanId // канал для приема сообщений от провайдеров OLDI и AODB
 	ToFdpsPacketChan   chan *pb.Msg          // канал для отправки сообщений провайдеру OLDI
+	ToAodbPacketChan   chan *pb.Msg          // канал для отправки сообщений провайдеру AODB
 
 	ChannelBinMap *sync.Map // ключ - идентификатор каналаб значение типа сhannelBin
 
-	killerChan chan struct{} // канал, по которому передается сигнал о завершение работы канала
+	stoppedChan  chan int         // канал, по которому передаются ID каналов, остановка которых завершена
+	stopping     map[int]struct{} // каналы, остановка которых выполняется
+	startPending map[int]struct{} // каналы, запуск которых отложен до завершения остановки
+
+	CommandChan  chan ChannelCommand // канал для приема команд управления каналами
+	stoppedByCmd map[int]struct{}    // каналы, остановленные командой управления (не перезапускаются автоматически)
+
+	runners       map[string]ChannelRunner // способы запуска каналов, ключ - способ запуска из настроек канала
+	localLinks    *sync.Map                // ключ - ID канала, запущенного в процессе контроллера, значение - chan []byte для передачи данных каналу
+	localRecvChan chan []byte              // канал для приема данных от каналов, запущенных в процессе контроллера
+
+	adoptions *adoptStore // экземпляры каналов, запущенные до перезапуска контроллера (подхватываются при получении настроек)
+
+	exitChan    chan ChannelExit // канал, по которому передаются сведения о нештатном завершении каналов
+	restartChan chan int         // канал, по которому передаются ID каналов для перезапуска после задержки
+	supervisors *supervisorStore // состояния перезапусков каналов
 
 	wsServer *web_sock.WebSockServer
 
-	wsClients map[int]*websocket.Conn
+	wsClients map[int]*websocket.Conn          // соединения каналов, прошедших рукопожатие, ключ - ID канала
+	wsConns   map[*websocket.Conn]*channelConn // сведения о соединениях каналов
+	tokens    *tokenStore                      // токены, выданные каналам при запуске
+
+	sessionID  string                   // идентификатор экземпляра контроллера каналов (передается каналам при рукопожатии)
+	deliveries map[int]*channelDelivery // состояние подтверждаемой доставки сообщений, ключ - ID канала
 
 	chStates map[int]сhannelStateTime // ключ - ID канала
 
-	oldiIdent  int // идентификатор сообщения, отправляемого OLDI cервису
+	seqs       *sequenceStore // номера OLDI сообщений каналов
+	lams       *lamTracker    // контроль получения LAM
 	withDocker bool
 }
 
@@ -79,7 +96,7 @@ var chValidStStr = chValidSt.ToString()
 
 // NewChiefChannelServer конструктор
 func NewChiefChannelServer(done chan struct{}, workWithDocker bool) *ChiefChannelServer {
-	return &ChiefChannelServer{
+	cc := &ChiefChannelServer{
 		ChannelSettsChan: make(chan channel_settings.ChannelSettingsWithPort, 10),
 		channelSetts: channel_settings.ChannelSettingsWithPort{
 			ChSettings: make([]channel_settings.ChannelSettings, 0),
@@ -88,18 +105,46 @@ func NewChiefChannelServer(done chan struct{}, workWithDocker bool) *ChiefChanne
 		statesSendTicker:   time.NewTicker(time.Second),
 		FromFdpsPacketChan: make(chan pb.MsgWithChanId, 1024),
 		ToFdpsPacketChan:   make(chan *pb.Msg, 1024),
-		killerChan:         make(chan struct{}),
+		ToAodbPacketChan:   make(chan *pb.Msg, 1024),
+		exitChan:           make(chan ChannelExit, 100),
+		restartChan:        make(chan int, 100),
+		supervisors:        newSupervisorStore(),
 		ChannelBinMap:      new(sync.Map),
+		stoppedChan:        make(chan int, 100),
+		stopping:           make(map[int]struct{}),
+		startPending:       make(map[int]struct{}),
+		CommandChan:        make(chan ChannelCommand, 10),
+		stoppedByCmd:       make(map[int]struct{}),
 		wsServer:           web_sock.NewWebSockServer(done),
 		wsClients:          make(map[int]*websocket.Conn),
+		wsConns:            make(map[*websocket.Conn]*channelConn),
+		tokens:             newTokenStore(),
+		sessionID:          newSessionID(),
+		deliveries:         make(map[int]*channelDelivery),
 		chStates:           make(map[int]сhannelStateTime),
-		oldiIdent:          1,
+		seqs:               newSequenceStore(),
+		lams:               newLamTracker(),
+		localLinks:         new(sync.Map),
+		localRecvChan:      make(chan []byte, localLinkBufferSize),
 		withDocker:         workWithDocker,
 	}
+
+	cc.runners = map[string]ChannelRunner{
+		channel_settings.RunnerProcess:   processRunner{},
+		channel_settings.RunnerDocker:    dockerRunner{},
+		channel_settings.RunnerInProcess: &inProcessRunner{links: cc.localLinks, recvChan: cc.localRecvChan},
+	}
+	return cc
 }
 
 // Work реализация работы
 func (cc *ChiefChannelServer) Work() {
+	// каналы, запущенные до перезапуска контроллера, продолжают работу до получения настроек
+	cc.adoptions = newAdoptStore(discoverChannels(cc.withDocker))
+	for _, val := range cc.adoptions.items {
+		cc.tokens.set(val.ChannelID, val.Token)
+	}
+
 	go cc.wsServer.Work("/" + utils.FmtpChannelWsUrlPath)
 
 	for {
@@ -127,7 +172,7 @@ func (cc *ChiefChannelServer) Work() {
 						needToStartIds = append(needToStartIds, val.Id)
 					}
 				}
-			} else if !reflect.DeepEqual(cc.channelSetts.ChSettings, newSetts.ChSettings) {
+			} else if !reflect.DeepEqual(cc.channelSetts, newSetts) {
 
 				var oldIt, newIt channel_settings.ChannelSettings
 
@@ -143,7 +188,7 @@ func (cc *ChiefChannelServer) Work() {
 
 					// есть в новых, есть в старых
 					if newInOld {
-						if oldIt != newIt {
+						if oldIt != newIt || cc.containerProfileChanged(oldIt, newIt, newSetts) {
 							if oldIt.IsWorking {
 								needToStopIds = append(needToStopIds, oldIt.Id)
 							}
@@ -177,120 +222,82 @@ func (cc *ChiefChannelServer) Work() {
 					}
 				}
 			}
+			// каналы, остановленные командой управления, не запускаем
+			var startIds []int
+			for _, val := range needToStartIds {
+				if cc.isStoppedByCmd(val) {
+					logger.PrintfDebug("Канал с ID = %d остановлен командой управления и не будет запущен.", val)
+				} else {
+					startIds = append(startIds, val)
+				}
+			}
+			needToStartIds = startIds
+
 			// если просто cc.channelSetts = newSetts написать, то по приходу новых настроек cc.channelSetts. уже будет ссылаться на них
 			cc.channelSetts.ChSettings = append([]channel_settings.ChannelSettings(nil), newSetts.ChSettings...)
 			cc.channelSetts.ChPort = newSetts.ChPort
+			cc.channelSetts.ContainerProfiles = append([]channel_settings.ContainerProfile(nil), newSetts.ContainerProfiles...)
+			cc.channelSetts.DefaultContainerProfile = newSetts.DefaultContainerProfile
 
-			// останавливаем каналы FMTP
+			// каналы, удаленные из настроек, исключаем из остановленных командой
+			for chId := range cc.stoppedByCmd {
+				if _, ok := cc.channelSettsByID(chId); !ok {
+					delete(cc.stoppedByCmd, chId)
+				}
+			}
+			// при изменении настроек канала счетчики перезапусков сбрасываются
+			for _, val := range needToStopIds {
+				cc.supervisors.reset(val)
+			}
+			for _, val := range needToStartIds {
+				cc.supervisors.reset(val)
+			}
+
+			// останавливаем каналы FMTP (остановка выполняется без ожидания завершения каналов)
 			if len(needToStopIds) > 0 {
 				cc.stopChannelsByIDs(needToStopIds)
 			}
-			// костыль - не успевает удалиться старый контейнер, при создании нового - конфликн имен
-			time.AfterFunc(2*time.Second, func() {
-				// запускаем каналы FMTP
-				if len(needToStartIds) > 0 {
-					cc.startChannelsByIDs(needToStartIds)
+			// запускаем каналы FMTP (останавливаемые каналы запускаются после завершения остановки)
+			if len(needToStartIds) > 0 {
+				cc.startChannelsByIDs(needToStartIds)
+			}
+			// запущенные ранее каналы, отсутствующие в настройках или остановленные, завершаем
+			for _, val := range cc.adoptions.takeAll() {
+				if !cc.channelRunning(val.ChannelID) {
+					cc.tokens.remove(val.ChannelID)
 				}
-			})
+				go stopStaleChannel(val)
+			}
 
-		// получен новый пакет от провайдера OLDI
+		// завершена остановка канала
+		case chId := <-cc.stoppedChan:
+			cc.channelStopped(chId)
+
+		// получен новый пакет от провайдера OLDI или AODB
 		case oldiPkg := <-cc.FromFdpsPacketChan:
 			cc.ProcessOldiPacket(oldiPkg)
 
-		// получены данные от WS сервера
-		case curWsPkg := <-cc.wsServer.ReceiveDataChan:
-			var curHdr HeaderMsg
-			var unmErr error
-			if unmErr = json.Unmarshal(curWsPkg.Data, &curHdr); unmErr == nil {
-				switch curHdr.Header {
-
-				case RequestSettingsHeader:
-					var reqSettsMsg SettingsRequestMsg
-					if err := json.Unmarshal(curWsPkg.Data, &reqSettsMsg); err == nil {
-						cc.wsClients[reqSettsMsg.ChannelID] = curWsPkg.Sock
-
-						var channelSetts channel_settings.ChannelSettings
-					SETTSL:
-						for _, curSetts := range cc.channelSetts.ChSettings {
-							if curSetts.Id == reqSettsMsg.ChannelID {
-								channelSetts = curSetts
-								break SETTSL
-							}
-						}
-
-						if settsData, errMarsh := json.Marshal(CreateSettingsAnswerMsg(channelSetts)); errMarsh == nil {
-							cc.wsServer.SendDataChan <- web_sock.WsPackage{Data: settsData, Sock: cc.wsClients[channelSetts.Id]}
-						}
-					}
-
-				case ChannelHeartbeatHeader:
-					var curHbtMsg ChannelHeartbeatMsg
-					if err := json.Unmarshal(curWsPkg.Data, &curHbtMsg); err == nil {
-						cc.chStates[curHbtMsg.ChannelID] = сhannelStateTime{ChannelState: curHbtMsg.ChannelState, Time: time.Now()}
-					}
-
-					// если каналы были запущены на момент старта контроллера, то
-					// при получении Heartbeat проверяем клиентские сообщения
-					if _, ok := cc.wsClients[curHbtMsg.ChannelID]; !ok {
-						cc.wsClients[curHbtMsg.ChannelID] = curWsPkg.Sock
-					}
-
-				case ChannelLogHeader:
-					var curLogMsg ChannelLogMsg
-					if err := json.Unmarshal(curWsPkg.Data, &curLogMsg); err == nil {
-						switch curLogMsg.LogMessage.Severity {
-						case fmtp_log.SeverityDebug:
-							logger.PrintfDebug("FMTP FORMAT %#v", curLogMsg.LogMessage)
-						case fmtp_log.SeverityInfo:
-							logger.PrintfInfo("FMTP FORMAT %#v", curLogMsg.LogMessage)
-						case fmtp_log.SeverityWarning:
-							logger.PrintfWarn("FMTP FORMAT %#v", curLogMsg.LogMessage)
-						case fmtp_log.SeverityError:
-							logger.PrintfErr("FMTP FORMAT %#v", curLogMsg.LogMessage)
-						}
-					}
-
-				case ChannelMessageHeader:
-
-					var dataMsg DataMsg
-					if err := json.Unmarshal(curWsPkg.Data, &dataMsg); err == nil {
-						var localAtc string
-						var remoteAtc string
-						var channelType string
-						for _, val := range cc.channelSetts.ChSettings {
-							if val.Id == dataMsg.ChannelID {
-								localAtc = val.LocalATC
-								remoteAtc = val.RemoteATC
-								channelType = val.DataType
-								break
-							}
-						}
+		// получена команда управления каналом
+		case cmd := <-cc.CommandChan:
+			cmd.ResultChan <- cc.processCommand(cmd)
 
-						if channelType == chief_settings.OLDIProvider {
-							var oldiPkg pb.Msg
-							oldiPkg.Id = strconv.Itoa(cc.oldiIdent)
-							oldiPkg.Cid = remoteAtc
-							oldiPkg.Txt = dataMsg.Text
+		// нештатное завершение канала
+		case exit := <-cc.exitChan:
+			cc.processChannelExit(exit)
 
-							cc.oldiIdent++
-							if cc.oldiIdent > 1000 {
-								cc.oldiIdent = 1
-							}
-							cc.ToFdpsPacketChan <- &oldiPkg
+		// истекла задержка перезапуска канала
+		case chId := <-cc.restartChan:
+			if cc.needRestart(chId) {
+				cc.startChannelsByIDs([]int{chId})
+			}
 
-							chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
-								Tp:     chief_metrics.ChanTpRecv,
-								LocAtc: localAtc,
-								RemAtc: remoteAtc,
-								Count:  1,
-							}
-						}
-					}
-				}
+		// получены данные от WS сервера
+		case curWsPkg := <-cc.wsServer.ReceiveDataChan:
+			cc.processChannelData(curWsPkg.Data, curWsPkg.Sock)
 
-			} else {
-				logger.PrintfErr("Ошибка разбора сообщения от приложения FMTP канала. Ошибка: %s.", unmErr)
-			}
+		// получены данные от канала, запущенного в процессе контроллера
+		case curData := <-cc.localRecvChan:
+			cc.processChannelData(curData, nil)
 
 		// получен подключенный клиент от WS сервера
 		case curClnt := <-cc.wsServer.ClntConnChan:
@@ -300,6 +307,7 @@ func (cc *ChiefChannelServer) Work() {
 		// получен отключенный клиент от WS сервера
 		case curClnt := <-cc.wsServer.ClntDisconnChan:
 			logger.PrintfDebug("WS сервер для взаимодействия с FMTP каналами. Отключен клиент с адресом: %s.", curClnt.RemoteAddr().String())
+			cc.unbindConn(curClnt)
 			//userhub_web.ClientDisconn(userhub_web.FromWebSock(curClnt))
 
 		// получен отклоненный клиент от WS сервера
@@ -321,12 +329,15 @@ func (cc *ChiefChannelServer) Work() {
 			}
 
 		case <-cc.statesSendTicker.C:
+			cc.checkLamTimeouts()
+			cc.seqs.save()
+
 			// удаляем из мэпки состояний старые состояния
 			for channelId, val := range cc.chStates {
 				if val.Time.Add(10 * channel_state.StateSendInterval).Before(time.Now()) {
 					// если состояния удалили и в настройках канал должен быть запущен, то добавляем состояние
 					for _, setts := range cc.channelSetts.ChSettings {
-						if setts.Id == channelId && setts.IsWorking {
+						if setts.Id == channelId && setts.IsWorking && !cc.isStoppedByCmd(channelId) {
 							delete(cc.chStates, channelId)
 							cc.initChannelState(setts)
 							break
@@ -338,257 +349,404 @@ func (cc *ChiefChannelServer) Work() {
 			// отправляем heartbeat контроллеру
 			var channelStates []channel_state.ChannelState
 			for key := range cc.chStates {
-				channelStates = append(channelStates, cc.chStates[key].ChannelState)
+				curState := cc.chStates[key].ChannelState
+				cc.supervisors.applyTo(&curState)
+				cc.applyRunnerInfo(&curState)
+				if d, ok := cc.deliveries[key]; ok {
+					curState.UnackedOut = d.out.len()
+				}
+				channelStates = append(channelStates, curState)
 			}
 			chief_state.SetChannelsState(channelStates)
+			chief_metrics.UnackedMetricsChan <- cc.unackedMetrics()
 		}
 	}
 }
 
-// ProcessOldiPacket обработка пакета OLDI
-func (cc *ChiefChannelServer) ProcessOldiPacket(msgWithId pb.MsgWithChanId) {
+// обработка данных от FMTP канала (sock - WebSocket соединение канала, nil - канал запущен в процессе контроллера)
+func (cc *ChiefChannelServer) processChannelData(data []byte, sock *websocket.Conn) {
+	var curHdr HeaderMsg
+	var unmErr error
+	if unmErr = json.Unmarshal(data, &curHdr); unmErr == nil {
+		switch curHdr.Header {
+
+		case RequestSettingsHeader:
+			var reqSettsMsg SettingsRequestMsg
+			if err := json.Unmarshal(data, &reqSettsMsg); err == nil {
+				if reason := cc.handshake(reqSettsMsg, sock); reason != "" {
+					cc.rejectConn(reqSettsMsg, sock, reason)
+					return
+				}
+
+				version := negotiateVersion(reqSettsMsg.Version())
+				capabilities := negotiateCapabilities(reqSettsMsg.Capabilities)
+				if sock != nil {
+					cc.bindConn(sock, channelConn{ChannelID: reqSettsMsg.ChannelID, ProtocolVersion: version, Capabilities: capabilities})
+					if reqSettsMsg.Token == "" {
+						logger.PrintfWarn("FMTP канал с ID = %d подключен без токена (версия протокола %d). Канал необходимо перезапустить контроллером текущей версии.",
+							reqSettsMsg.ChannelID, reqSettsMsg.Version())
+					}
+				}
+
+				var channelSetts channel_settings.ChannelSettings
+			SETTSL:
+				for _, curSetts := range cc.channelSetts.ChSettings {
+					if curSetts.Id == reqSettsMsg.ChannelID {
+						channelSetts = curSetts
+						break SETTSL
+					}
+				}
 
-	if sock, ok := cc.wsClients[msgWithId.ChanId]; ok {
-		if oldiData, mrshErr := json.Marshal(CreateChiefDataMsg(msgWithId.ChanId, msgWithId.PbMsg.Txt)); mrshErr != nil {
-			logger.PrintfErr("Ошибка формирования сообщения для FMTP канала. Ошибка: %v", mrshErr)
-		} else {
-			if cc.chStates[msgWithId.ChanId].ChannelState.FmtpState == chValidStStr {
-				cc.wsServer.SendDataChan <- web_sock.WsPackage{Data: oldiData, Sock: sock}
-
-				chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
-					Tp:     chief_metrics.ChanTpSend,
-					LocAtc: cc.chStates[msgWithId.ChanId].LocalName,
-					RemAtc: cc.chStates[msgWithId.ChanId].RemoteName,
-					Count:  1,
+				answerMsg := CreateSettingsAnswerMsg(channelSetts, version, capabilities)
+				answerMsg.SessionID = cc.sessionID
+				if hasCapability(capabilities, CapabilityAck) {
+					answerMsg.Ack = cc.deliveryHandshake(reqSettsMsg.ChannelID, reqSettsMsg.SessionID)
+				}
+				if settsData, errMarsh := json.Marshal(answerMsg); errMarsh == nil {
+					cc.sendDataToChannel(reqSettsMsg.ChannelID, settsData)
+				}
+				// при подтверждаемой доставке сообщения очереди передаются повторно по подтверждению канала после рукопожатия
+				if !cc.ackEnabled(reqSettsMsg.ChannelID) {
+					cc.flushOutbox(reqSettsMsg.ChannelID)
 				}
 			}
-		}
-	} else {
-		logger.PrintfErr("Не найдено WebSocket соединение канала для отправки сообщения.")
-	}
-}
 
-// останавливаем каналы с указанным ID
-func (cc *ChiefChannelServer) stopChannelsByIDs(idsToStop []int) {
-STOPL:
-	for _, stopID := range idsToStop {
-		if val, ok := cc.ChannelBinMap.Load(stopID); ok {
-			val.(channelBin).killChan <- struct{}{}
-			<-cc.killerChan
+		case ChannelHeartbeatHeader:
+			var curHbtMsg ChannelHeartbeatMsg
+			if err := json.Unmarshal(data, &curHbtMsg); err == nil {
+				// каналы старых версий, запущенные на момент старта контроллера, не повторяют запрос настроек -
+				// соединение привязывается по первому сообщению о состоянии (если токен канала не требуется)
+				if _, bound := cc.wsConns[sock]; !bound && sock != nil && cc.legacyHeartbeatBind(curHbtMsg.ChannelID) {
+					cc.bindConn(sock, channelConn{ChannelID: curHbtMsg.ChannelID, ProtocolVersion: LegacyProtocolVersion})
+					cc.flushOutbox(curHbtMsg.ChannelID)
+				}
 
-			if !cc.withDocker {
-				if err := utils.RemoveBinary(val.(channelBin).filePath); err != nil {
-					logger.PrintfErr("%v", err)
-					continue STOPL
+				chId, ok := cc.connChannelID(sock, curHbtMsg.ChannelID)
+				if !ok || chId != curHbtMsg.ChannelID {
+					cc.dropUnboundData(sock, curHdr.Header, curHbtMsg.ChannelID)
+					return
+				}
+				curState := curHbtMsg.ChannelState
+				if conn, ok := cc.wsConns[sock]; ok {
+					curState.ProtocolVersion = conn.ProtocolVersion
 				}
+				cc.chStates[chId] = сhannelStateTime{ChannelState: curState, Time: time.Now()}
 			}
-			close(val.(channelBin).killChan)
-			cc.ChannelBinMap.Delete(stopID)
-		}
-	}
-}
 
-// запускаем каналы с указанным ID
-func (cc *ChiefChannelServer) startChannelsByIDs(idsToStart []int) {
-STARTL:
-	for _, startID := range idsToStart {
-	STARTL2:
-		for _, newIt := range cc.channelSetts.ChSettings {
-			if startID == newIt.Id {
-				if cc.withDocker {
-					cc.ChannelBinMap.Store(startID, channelBin{killChan: make(chan struct{})})
-
-					if val, ok := cc.ChannelBinMap.Load(startID); ok {
-						go cc.startChannelContainer(newIt, val.(channelBin))
-					}
+		case ChannelLogHeader:
+			var curLogMsg ChannelLogMsg
+			if err := json.Unmarshal(data, &curLogMsg); err == nil {
+				chId, ok := cc.connChannelID(sock, curLogMsg.ChannelId)
+				if !ok {
+					cc.dropUnboundData(sock, curHdr.Header, curLogMsg.ChannelId)
+					return
+				}
+				curLogMsg.ChannelId = chId
+
+				switch curLogMsg.LogMessage.Severity {
+				case fmtp_log.SeverityDebug:
+					logger.PrintfDebug("FMTP FORMAT %#v", curLogMsg.LogMessage)
+				case fmtp_log.SeverityInfo:
+					logger.PrintfInfo("FMTP FORMAT %#v", curLogMsg.LogMessage)
+				case fmtp_log.SeverityWarning:
+					logger.PrintfWarn("FMTP FORMAT %#v", curLogMsg.LogMessage)
+				case fmtp_log.SeverityError:
+					logger.PrintfErr("FMTP FORMAT %#v", curLogMsg.LogMessage)
+				}
+			}
 
-				} else {
-					channelFilePath, err := utils.CopyBinary(newIt.Version, newIt.Id, newIt.LocalATC, newIt.RemoteATC)
-					if err != nil {
-						logger.PrintfErr("%v", err)
-						continue STARTL
+		case AckHeader:
+			var ackMsg AckMsg
+			if err := json.Unmarshal(data, &ackMsg); err == nil {
+				chId, ok := cc.connChannelID(sock, ackMsg.ChannelID)
+				if !ok || chId != ackMsg.ChannelID {
+					cc.dropUnboundData(sock, curHdr.Header, ackMsg.ChannelID)
+					return
+				}
+				cc.processAck(chId, ackMsg)
+			}
+
+		case ChannelMessageHeader:
+
+			var dataMsg DataMsg
+			if err := json.Unmarshal(data, &dataMsg); err == nil {
+				chId, ok := cc.connChannelID(sock, dataMsg.ChannelID)
+				if !ok || chId != dataMsg.ChannelID {
+					cc.dropUnboundData(sock, curHdr.Header, dataMsg.ChannelID)
+					return
+				}
+				if !cc.acceptChannelSeq(chId, dataMsg.Seq) {
+					return
+				}
+				chSett, _ := cc.channelSettsByID(chId)
+				localAtc := chSett.LocalATC
+				remoteAtc := chSett.RemoteATC
+
+				if chSett.DataType == chief_settings.OLDIProvider || chSett.DataType == chief_settings.AODBProvider {
+					var fdpsPkg pb.Msg
+					fdpsPkg.Id = strconv.Itoa(cc.seqs.nextProviderID())
+					fdpsPkg.Cid = remoteAtc
+					fdpsPkg.Txt = dataMsg.Text
+					fdpsPkg.Tp = pb.MsgTpOperational
+					fdpsPkg.Rrtime = timestamppb.Now()
+
+					if chSett.DataType == chief_settings.OLDIProvider {
+						if oldiMsg, ok := inspectPayload(chSett, fromChannelDirection, dataMsg.Text); ok {
+							cc.processChannelOldiMsg(chSett, oldiMsg)
+						}
+						cc.ToFdpsPacketChan <- &fdpsPkg
+					} else {
+						cc.ToAodbPacketChan <- &fdpsPkg
 					}
-					cc.ChannelBinMap.Store(startID, channelBin{filePath: channelFilePath, killChan: make(chan struct{})})
 
-					if val, ok := cc.ChannelBinMap.Load(startID); ok {
-						go cc.startChannelProcess(channelFilePath, newIt, val.(channelBin))
+					chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+						Tp:     chief_metrics.ChanTpRecv,
+						LocAtc: localAtc,
+						RemAtc: remoteAtc,
+						Count:  1,
 					}
 				}
-				break STARTL2
 			}
 		}
+
+	} else {
+		logger.PrintfErr("Ошибка разбора сообщения от приложения FMTP канала. Ошибка: %s.", unmErr)
 	}
 }
 
-// запуск исполняемого файла fmtp канала
-func (cc *ChiefChannelServer) startChannelProcess(channelFilePath string, chSett channel_settings.ChannelSettings, binInfo channelBin) {
-	cmd := exec.Command(channelFilePath, strconv.Itoa(cc.channelSetts.ChPort), strconv.Itoa(chSett.Id), chSett.LocalATC,
-		chSett.RemoteATC, chSett.DataType, chSett.URLPath, strconv.Itoa(chSett.URLPort))
+// ProcessOldiPacket обработка пакета от провайдера: выбор каналов маршрута и отправка в них сообщения
+func (cc *ChiefChannelServer) ProcessOldiPacket(msgWithId pb.MsgWithChanId) {
+	route := routing.Route{RuleIdx: routing.DefaultRuleIdx, Channels: msgWithId.RouteChans, FanOut: msgWithId.FanOut}
+	if len(route.Channels) == 0 {
+		route.Channels = []int{msgWithId.ChanId}
+	}
 
-	if err := cmd.Start(); err != nil {
-		logger.PrintfErr("Ошибка запуска приложения FMTP канала. Исполняемый файл: %s. Иденификатор канала: %d. Ошибка: %v.",
-			channelFilePath, chSett.Id, err)
+	targets, failover := route.Select(cc.channelReady)
+	if len(targets) == 0 {
+		logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, msgWithId.DataType,
+			fmt.Sprintf("Нет FMTP канала в состоянии data_ready для отправки сообщения. CID (remote ATC): %s. Маршрут: %s.", msgWithId.PbMsg.Cid, route)))
+		chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+			Tp:     chief_metrics.ChanTpRouteNone,
+			RemAtc: msgWithId.PbMsg.Cid,
+			Count:  1,
+		}
 		return
 	}
 
-	logger.PrintfDebug("Запущено приложения FMTP канала. Исполняемый файл: %s. Иденификатор канала: %d.",
-		channelFilePath, chSett.Id)
-
-	// канал, в который ошибка завершения отправкится
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
-
-	select {
-	case err := <-done:
-		if err != nil {
-			logger.PrintfErr("Нештатное завершение приложения FMTP канала. Исполняемый файл: %s. Идентификатор канала: %d. Ошибка: %s.",
-				channelFilePath, chSett.Id, err.Error())
-
-			if val, ok := cc.ChannelBinMap.Load(chSett.Id); ok {
-				close(val.(channelBin).killChan)
-				cc.ChannelBinMap.Delete(chSett.Id)
-			}
-
-			if _, ok := cc.chStates[chSett.Id]; ok {
-				curState := cc.chStates[chSett.Id]
-				curState.ChannelState.DaemonState = channel_state.ChannelStateError
-				cc.chStates[chSett.Id] = curState
+	if failover || len(targets) > 1 {
+		metricTp := chief_metrics.ChanTpRouteFanOut
+		if failover {
+			metricTp = chief_metrics.ChanTpRouteFailover
+		}
+		logger.PrintfInfo("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityInfo, msgWithId.DataType,
+			fmt.Sprintf("Сообщение с CID %s направлено в каналы %v (%s). Маршрут: %s.", msgWithId.PbMsg.Cid, targets, metricTp, route)))
+
+		for _, chId := range targets {
+			chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+				Tp:     metricTp,
+				LocAtc: cc.chStates[chId].LocalName,
+				RemAtc: cc.chStates[chId].RemoteName,
+				Count:  1,
 			}
 		}
-		cc.checkChannelWorking(chSett.Id)
-		return
+	} else {
+		logger.PrintfDebug("Сообщение с CID %s направлено в канал %d. Маршрут: %s.", msgWithId.PbMsg.Cid, targets[0], route)
+	}
 
-	case <-binInfo.killChan:
-		if err := cmd.Process.Kill(); err != nil {
-			logger.PrintfErr("Ошибка завершения выполнения приложения FMTP канала. Ошибка: %v.", err)
-		} else {
-			logger.PrintfDebug("Штатное завершение приложения FMTP канала. Исполняемый файл: %s. Идентификатор канала: %d.",
-				channelFilePath, chSett.Id)
-		}
-		time.Sleep(1 * time.Second)
-		cc.killerChan <- struct{}{}
-		return
+	for _, chId := range targets {
+		cc.sendPacketToChannel(chId, msgWithId.PbMsg)
 	}
 }
 
-// запуск docker контейнера fmtp канала
-func (cc *ChiefChannelServer) startChannelContainer(chSett channel_settings.ChannelSettings, binInfo channelBin) {
-	ctx := context.Background()
+// признак готовности канала к передаче сообщений (подключен и в состоянии data_ready)
+func (cc *ChiefChannelServer) channelReady(chId int) bool {
+	if !cc.channelConnected(chId) {
+		return false
+	}
+	chState, ok := cc.chStates[chId]
+	return ok && chState.ChannelState.FmtpState == chValidStStr
+}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		logger.PrintfErr("Ошибка создания клиента сервиса docker. Ошибка: %v", err)
-		if val, ok := cc.ChannelBinMap.Load(chSett.Id); ok {
-			close(val.(channelBin).killChan)
-			cc.ChannelBinMap.Delete(chSett.Id)
+// отправка сообщения провайдера в канал (неподключенному каналу - после его подключения)
+func (cc *ChiefChannelServer) sendPacketToChannel(chId int, pbMsg *pb.Msg) {
+	msgText := pbMsg.Txt
+	chSett, settsOk := cc.channelSettsByID(chId)
+	oldiMsg, parseOk := inspectPayload(chSett, toChannelDirection, msgText)
+
+	// присвоение номера сообщению до регистрации ожидания LAM
+	if settsOk && parseOk && chSett.OldiNumbering {
+		oldiMsg.Number = cc.outNumber(chSett, oldiMsg.Number)
+		if renumbered, err := RenumberPayload(payloadFormat(chSett), msgText, oldiMsg.Number); err == nil {
+			msgText = renumbered
 		}
-		return
-	} else {
-		defer cli.Close()
-		cli.NegotiateAPIVersion(ctx)
 	}
 
-	curContainerName := "fmtp_channel_" + chSett.LocalATC + "_" + chSett.RemoteATC + "_" + strconv.Itoa(chSett.Id)
-	var imageName string
+	if settsOk && parseOk {
+		cc.lams.sent(chSett, oldiMsg, pbMsg.Id, msgText)
+	}
+	if cc.sendDataMsgToChannel(chId, CreateChiefDataMsg(chId, msgText)) {
+		chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+			Tp:     chief_metrics.ChanTpSend,
+			LocAtc: cc.chStates[chId].LocalName,
+			RemAtc: cc.chStates[chId].RemoteName,
+			Count:  1,
+		}
+	} else if !cc.channelConnected(chId) {
+		logger.PrintfWarn("Не найдено соединение FMTP канала с ID = %d. Сообщение будет передано после подключения канала.", chId)
+	}
+}
 
-	if len(configurator.ChiefCfg.DockerRegistry) != 0 {
-		imageName = configurator.ChiefCfg.DockerRegistry + "/"
+// признак подключения канала к контроллеру (WebSocket соединение или канал в процессе контроллера)
+func (cc *ChiefChannelServer) channelConnected(chId int) bool {
+	if _, ok := cc.localLinks.Load(chId); ok {
+		return true
 	}
-	imageName += configurator.ChannelImageName + ":" + chSett.Version
+	_, ok := cc.wsClients[chId]
+	return ok
+}
 
-	resp, crErr := cli.ContainerCreate(ctx,
-		&container.Config{
-			Image: imageName,
-			Cmd: []string{"/fdps/fmtp_channel", strconv.Itoa(cc.channelSetts.ChPort), strconv.Itoa(chSett.Id), chSett.LocalATC,
-				chSett.RemoteATC, chSett.DataType, chSett.URLPath, strconv.Itoa(chSett.URLPort)},
-		},
-		&container.HostConfig{
-			Resources: container.Resources{
-				CPUCount:   1,
-				CPUPercent: 10,
-				Memory:     100 * 1 << 20, // 100 MB
-			},
-			NetworkMode:   "host",
-			RestartPolicy: container.RestartPolicy{Name: "no"},
-			AutoRemove:    true,
-		},
-		&network.NetworkingConfig{},
-		nil,
-		curContainerName)
-
-	if crErr != nil {
-		logger.PrintfErr("Ошибка создания docker контейнера %s. Используемый образ: %s. Ошибка: %v.", curContainerName, imageName, crErr)
-		if val, ok := cc.ChannelBinMap.Load(chSett.Id); ok {
-			close(val.(channelBin).killChan)
-			cc.ChannelBinMap.Delete(chSett.Id)
+// отправка данных каналу. Возвращает false, если канал не подключен или его очередь заполнена
+func (cc *ChiefChannelServer) sendDataToChannel(chId int, data []byte) bool {
+	if link, ok := cc.localLinks.Load(chId); ok {
+		select {
+		case link.(chan []byte) <- data:
+			return true
+		default:
+			logger.PrintfErr("Переполнена очередь сообщений FMTP канала с ID = %d, запущенного в процессе контроллера.", chId)
+			return false
 		}
-		return
-	} else {
-		logger.PrintfDebug("Создан docker контейнер %s. Используемый образ: %s.", curContainerName, imageName)
 	}
+	if sock, ok := cc.wsClients[chId]; ok {
+		cc.wsServer.SendDataChan <- web_sock.WsPackage{Data: data, Sock: sock}
+		return true
+	}
+	return false
+}
 
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		logger.PrintfErr("Ошибка запуска docker контейнера %s. Ошибка: %v.", curContainerName, err)
-		if val, ok := cc.ChannelBinMap.Load(chSett.Id); ok {
-			close(val.(channelBin).killChan)
-			cc.ChannelBinMap.Delete(chSett.Id)
+// останавливаем каналы с указанным ID. Завершение каналов ожидается вне Work (остановка docker контейнера
+// может длиться несколько секунд), о завершении остановки сообщается через stoppedChan
+func (cc *ChiefChannelServer) stopChannelsByIDs(idsToStop []int) {
+	for _, stopID := range idsToStop {
+		delete(cc.startPending, stopID)
+		if val, ok := cc.ChannelBinMap.Load(stopID); ok {
+			bin := val.(channelBin)
+			close(bin.killChan)
+			cc.ChannelBinMap.Delete(stopID)
+			cc.stopping[stopID] = struct{}{}
+
+			go func(chId int) {
+				<-bin.doneChan
+				cc.stoppedChan <- chId
+			}(stopID)
 		}
-		return
-	} else {
-		logger.PrintfDebug("Запущен docker контейнер %s.", curContainerName)
+		cc.tokens.remove(stopID)
+		delete(cc.deliveries, stopID)
+		if sock, ok := cc.wsClients[stopID]; ok {
+			cc.unbindConn(sock)
+		}
+		cc.lams.resetChannel(stopID)
 	}
+}
 
-	statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+// завершена остановка канала: запуск канала, отложенный до завершения остановки
+func (cc *ChiefChannelServer) channelStopped(chId int) {
+	delete(cc.stopping, chId)
+	if _, ok := cc.startPending[chId]; ok {
+		delete(cc.startPending, chId)
+		cc.startChannelsByIDs([]int{chId})
+	}
+}
 
-	for {
-		select {
-		case cntErr := <-errCh:
-			if cntErr != nil {
-				logger.PrintfErr("Ошибка в работе docker контейнера %s. Ошибка: %v.", curContainerName, cntErr)
-			}
+// признак работы канала (канал выполняется или будет запущен после завершения остановки)
+func (cc *ChiefChannelServer) channelRunning(chId int) bool {
+	if _, ok := cc.startPending[chId]; ok {
+		return true
+	}
+	_, ok := cc.ChannelBinMap.Load(chId)
+	return ok
+}
 
-			if val, ok := cc.ChannelBinMap.Load(chSett.Id); ok {
-				close(val.(channelBin).killChan)
-				cc.ChannelBinMap.Delete(chSett.Id)
+// запускаем каналы с указанным ID. Канал, остановка которого не завершена, запускается после ее завершения
+func (cc *ChiefChannelServer) startChannelsByIDs(idsToStart []int) {
+	for _, startID := range idsToStart {
+		if _, ok := cc.stopping[startID]; ok {
+			cc.startPending[startID] = struct{}{}
+			continue
+		}
+		if chSett, ok := cc.channelSettsByID(startID); ok {
+			cc.supervisors.started(startID, time.Now())
+
+			bin := channelBin{killChan: make(chan struct{}), doneChan: make(chan struct{})}
+			cc.ChannelBinMap.Store(startID, bin)
+			runnerName := cc.runnerName(chSett)
+			opts := RunOptions{ChiefPort: cc.channelSetts.ChPort, Profile: cc.channelSetts.ContainerProfileFor(chSett), Token: newChannelToken()}
+			opts.SettingsHash = settingsHash(runnerName, chSett, opts)
+
+			// канал, запущенный до перезапуска контроллера, подхватывается, если не изменились настройки
+			if cand, ok := cc.adoptions.take(startID); ok {
+				if cand.Runner == runnerName && cand.SettingsHash == opts.SettingsHash {
+					opts.Adopt = &cand
+					opts.Token = cand.Token
+				} else {
+					logger.PrintfInfo("Настройки FMTP канала с ID = %d изменены, запущенный ранее канал будет перезапущен.", startID)
+					stopStaleChannel(cand)
+				}
 			}
-			return
+			cc.tokens.set(startID, opts.Token)
+			go cc.runChannel(cc.channelRunner(chSett), chSett, opts, bin)
+		}
+	}
+}
 
-		case curStatus := <-statusCh:
-			if curStatus.Error != nil {
-				logger.PrintfErr("Изменен статус docker контейнера %s. Статус: %v. Ошибка: %v.", curContainerName, curStatus.StatusCode, curStatus.Error.Message)
-			} else {
-				logger.PrintfErr("Изменен статус docker контейнера %s. Статус: %v.", curContainerName, curStatus.StatusCode)
-			}
-			if val, ok := cc.ChannelBinMap.Load(chSett.Id); ok {
-				close(val.(channelBin).killChan)
-				cc.ChannelBinMap.Delete(chSett.Id)
-			}
+// способ запуска канала (по умолчанию - docker контейнер, если контроллер работает с docker, иначе отдельный процесс)
+func (cc *ChiefChannelServer) runnerName(chSett channel_settings.ChannelSettings) string {
+	if _, ok := cc.runners[chSett.Runner]; ok {
+		return chSett.Runner
+	}
+	if cc.withDocker {
+		return channel_settings.RunnerDocker
+	}
+	return channel_settings.RunnerProcess
+}
 
-			cc.checkChannelWorking(chSett.Id)
-			return
+func (cc *ChiefChannelServer) channelRunner(chSett channel_settings.ChannelSettings) ChannelRunner {
+	return cc.runners[cc.runnerName(chSett)]
+}
 
-		case <-binInfo.killChan:
-			logger.PrintfDebug("Команда завершить docker контейнер %s.", curContainerName)
+// добавление способа запуска и профиля контейнера в состояние канала
+func (cc *ChiefChannelServer) applyRunnerInfo(chState *channel_state.ChannelState) {
+	chSett, ok := cc.channelSettsByID(chState.ChannelID)
+	if !ok {
+		return
+	}
+	chState.Runner = cc.runnerName(chSett)
+	if chState.Runner == channel_settings.RunnerDocker {
+		chState.ContainerProfile = cc.channelSetts.ContainerProfileFor(chSett).Name
+	}
+}
 
-			//var stopDur time.Duration = 100 * time.Millisecond
+// признак изменения профиля docker контейнера канала (для каналов, запускаемых в docker контейнере)
+func (cc *ChiefChannelServer) containerProfileChanged(oldSett channel_settings.ChannelSettings, newSett channel_settings.ChannelSettings,
+	newSetts channel_settings.ChannelSettingsWithPort) bool {
+	if cc.runnerName(newSett) != channel_settings.RunnerDocker {
+		return false
+	}
+	return !reflect.DeepEqual(cc.channelSetts.ContainerProfileFor(oldSett), newSetts.ContainerProfileFor(newSett))
+}
 
-			if stopErr := cli.ContainerStop(ctx, resp.ID, nil); stopErr == nil {
-				logger.PrintfDebug("Остановлен docker контейнер %s.", curContainerName)
+// выполнение канала. При нештатном завершении сведения передаются для перезапуска
+func (cc *ChiefChannelServer) runChannel(runner ChannelRunner, chSett channel_settings.ChannelSettings, opts RunOptions, bin channelBin) {
+	defer close(bin.doneChan)
 
-				// if rmErr := cli.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{}); rmErr == nil {
-				// 	logger.PrintfInfo("Удален docker контейнер %s.", curContainerName)
-				// } else {
-				// 	logger.PrintfErr("Ошибка удаления docker контейнера %s.Ошибка: %v", curContainerName, rmErr)
-				// }
-			} else {
-				logger.PrintfErr("Ошибка остановки docker контейнера %s. Ошибка %v", curContainerName, stopErr)
-			}
-			cc.killerChan <- struct{}{}
-			return
-		}
+	exit := runner.Run(chSett, opts, bin.killChan)
+	if exit == nil {
+		return
+	}
+	// канал мог быть уже остановлен и запущен заново
+	if val, ok := cc.ChannelBinMap.Load(chSett.Id); ok && val.(channelBin) == bin {
+		cc.ChannelBinMap.Delete(chSett.Id)
 	}
+	cc.exitChan <- *exit
 }
 
 func (cc *ChiefChannelServer) initChannelState(chSett channel_settings.ChannelSettings) {
@@ -611,21 +769,65 @@ func (cc *ChiefChannelServer) initChannelState(chSett channel_settings.ChannelSe
 		Time: time.Now()}
 }
 
-// проверка работыканала. Если возникла ошбка, проверяем в настройках, должен ли работать канал
-// если должен, то запускаем его
-func (cc *ChiefChannelServer) checkChannelWorking(channelId int) {
+// обработка нештатного завершения канала: перезапуск с увеличивающейся задержкой,
+// при частых завершениях канал считается неисправным и не перезапускается до сброса командой управления
+func (cc *ChiefChannelServer) processChannelExit(exit ChannelExit) {
+	if curState, ok := cc.chStates[exit.ChannelID]; ok {
+		curState.ChannelState.DaemonState = channel_state.ChannelStateError
+		cc.chStates[exit.ChannelID] = curState
+	}
 
-	for _, setts := range cc.channelSetts.ChSettings {
-		if setts.Id == channelId && setts.IsWorking {
-			if _, ok := cc.ChannelBinMap.Load(setts.Id); !ok {
-				logger.PrintfWarn("Необходим перезапуск канала с ID = %d", channelId)
+	chSett, settsOk := cc.channelSettsByID(exit.ChannelID)
+	if !settsOk || !chSett.IsWorking || cc.isStoppedByCmd(exit.ChannelID) {
+		return
+	}
 
-				// костыль - не успевает удалиться старый контейнер, при создании нового - конфликн имен
-				time.AfterFunc(2*time.Second, func() {
-					cc.startChannelsByIDs([]int{channelId})
-				})
-			}
-			break
+	delay, failed := cc.supervisors.exited(exit, time.Now())
+	if failed {
+		logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, chSett.DataType,
+			fmt.Sprintf("Канал с ID = %d неисправен: %d нештатных завершений за %v. Перезапуск прекращен до сброса. %s Вывод: %s",
+				exit.ChannelID, crashLoopMaxExits, crashLoopWindow, exit, exit.Output)))
+		chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+			Tp:     chief_metrics.ChanTpCrashLoop,
+			LocAtc: chSett.LocalATC,
+			RemAtc: chSett.RemoteATC,
+			Count:  1,
 		}
+		return
 	}
+
+	logger.PrintfWarn("Необходим перезапуск канала с ID = %d. Задержка перезапуска: %v.", exit.ChannelID, delay.Round(time.Millisecond))
+	chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+		Tp:     chief_metrics.ChanTpRestart,
+		LocAtc: chSett.LocalATC,
+		RemAtc: chSett.RemoteATC,
+		Count:  1,
+	}
+	time.AfterFunc(delay, func() {
+		cc.restartChan <- exit.ChannelID
+	})
+}
+
+// признак необходимости перезапуска канала после задержки
+func (cc *ChiefChannelServer) needRestart(channelId int) bool {
+	chSett, settsOk := cc.channelSettsByID(channelId)
+	if !settsOk || !chSett.IsWorking || cc.isStoppedByCmd(channelId) || cc.supervisors.isFailed(channelId) {
+		return false
+	}
+	return !cc.channelRunning(channelId)
+}
+
+// признак привязки соединения канала старой версии по сообщению о состоянии (только для каналов, запущенных без токена)
+func (cc *ChiefChannelServer) legacyHeartbeatBind(channelID int) bool {
+	if configurator.ChiefCfg.ChannelAuthRequired || !cc.tokens.known(channelID) || cc.tokens.issued(channelID) {
+		return false
+	}
+	_, bound := cc.wsClients[channelID]
+	return !bound
+}
+
+// сообщение от соединения, не прошедшего рукопожатие (или от имени другого канала), отбрасывается
+func (cc *ChiefChannelServer) dropUnboundData(sock *websocket.Conn, header string, channelID int) {
+	logger.PrintfDebug("Отброшено сообщение %s от FMTP канала с ID = %d (%s): соединение не прошло рукопожатие или привязано к другому каналу.",
+		header, channelID, sock.RemoteAddr())
 }
@@ -0,0 +1,126 @@
+package chief_channel
+
+import (
+	"testing"
+	"time"
+
+	"fmtp/channel/channel_settings"
+)
+
+// runner whose channels stop only when the test releases them
+type slowStopRunner struct {
+	started chan int
+	release chan struct{}
+}
+
+func (r *slowStopRunner) Run(chSett channel_settings.ChannelSettings, opts RunOptions, stopChan <-chan struct{}) *ChannelExit {
+	r.started <- chSett.Id
+	<-stopChan
+	<-r.release
+	return nil
+}
+
+func newStopServer(runner *slowStopRunner, ids ...int) *ChiefChannelServer {
+	cc := newDeliveryServer()
+	cc.channelSetts.ChSettings = nil
+	for _, id := range ids {
+		cc.channelSetts.ChSettings = append(cc.channelSetts.ChSettings,
+			channel_settings.ChannelSettings{Id: id, IsWorking: true, Runner: "slow"})
+	}
+	cc.runners = map[string]ChannelRunner{"slow": runner}
+	cc.adoptions = newAdoptStore(nil)
+	cc.lams = newLamTracker()
+	cc.stoppedChan = make(chan int, 10)
+	cc.stopping = make(map[int]struct{})
+	cc.startPending = make(map[int]struct{})
+	return cc
+}
+
+func waitStarted(t *testing.T, runner *slowStopRunner, want int) {
+	t.Helper()
+	select {
+	case id := <-runner.started:
+		if id != want {
+			t.Fatalf("started channel %d, want %d", id, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("channel %d not started", want)
+	}
+}
+
+func TestStopChannelsDoesNotWait(t *testing.T) {
+	runner := &slowStopRunner{started: make(chan int, 10), release: make(chan struct{})}
+	cc := newStopServer(runner, 1, 2)
+	cc.startChannelsByIDs([]int{1, 2})
+	for idx := 0; idx < 2; idx++ {
+		select {
+		case <-runner.started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("channels not started")
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		cc.stopChannelsByIDs([]int{1, 2})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stop waited for channels to finish")
+	}
+	if cc.channelRunning(1) || cc.channelRunning(2) {
+		t.Fatalf("stopped channels reported running")
+	}
+
+	// restart of a channel that is still stopping is deferred
+	cc.startChannelsByIDs([]int{1})
+	if !cc.channelRunning(1) || cc.needRestart(1) {
+		t.Fatalf("deferred start not tracked")
+	}
+	select {
+	case id := <-runner.started:
+		t.Fatalf("channel %d started before its stop completed", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(runner.release)
+	for idx := 0; idx < 2; idx++ {
+		select {
+		case id := <-cc.stoppedChan:
+			cc.channelStopped(id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("stop completion not reported")
+		}
+	}
+	waitStarted(t, runner, 1)
+	if len(cc.stopping) != 0 || len(cc.startPending) != 0 {
+		t.Fatalf("stopping %v, pending %v", cc.stopping, cc.startPending)
+	}
+	if _, ok := cc.ChannelBinMap.Load(2); ok {
+		t.Fatalf("channel 2 started without a request")
+	}
+}
+
+func TestStopCancelsDeferredStart(t *testing.T) {
+	runner := &slowStopRunner{started: make(chan int, 10), release: make(chan struct{})}
+	close(runner.release)
+	cc := newStopServer(runner, 1)
+	cc.startChannelsByIDs([]int{1})
+	waitStarted(t, runner, 1)
+
+	cc.stopChannelsByIDs([]int{1})
+	cc.startChannelsByIDs([]int{1})
+	cc.stopChannelsByIDs([]int{1})
+
+	select {
+	case id := <-cc.stoppedChan:
+		cc.channelStopped(id)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stop completion not reported")
+	}
+	if cc.channelRunning(1) {
+		t.Fatalf("channel started after its deferred start was cancelled")
+	}
+}
@@ -0,0 +1,102 @@
+package chief_channel
+
+import (
+	"time"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/oldi_msg"
+)
+
+// время ожидания LAM, если в настройках канала не задано
+const defaultLamTimeout = 10 * time.Second
+
+// lamWaiting OLDI сообщение, отправленное в канал и ожидающее LAM
+type lamWaiting struct {
+	ChannelID  int                    // идентификатор канала
+	Number     oldi_msg.MessageNumber // номер отправленного сообщения
+	Summary    string                 // краткое описание сообщения для журнала
+	ProviderID string                 // идентификатор сообщения провайдера
+	Text       string                 // текст сообщения
+	Deadline   time.Time              // время, до которого должен быть получен LAM
+}
+
+// lamTracker контроль получения логических подтверждений (LAM) на отправленные в каналы OLDI сообщения
+type lamTracker struct {
+	waiting map[int]map[int]lamWaiting // ключ - ID канала, значение - ожидающие LAM сообщения (ключ - номер сообщения)
+}
+
+func newLamTracker() *lamTracker {
+	return &lamTracker{
+		waiting: make(map[int]map[int]lamWaiting),
+	}
+}
+
+// sent регистрация отправленного в канал сообщения. Возвращает false, если сообщение не требует LAM.
+func (lt *lamTracker) sent(chSett channel_settings.ChannelSettings, oldiMsg oldi_msg.Message, providerID string, text string) bool {
+	if !chSett.LamEnabled || !oldiMsg.NeedLam() {
+		return false
+	}
+
+	timeout := time.Duration(chSett.LamTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultLamTimeout
+	}
+
+	if _, ok := lt.waiting[chSett.Id]; !ok {
+		lt.waiting[chSett.Id] = make(map[int]lamWaiting)
+	}
+	lt.waiting[chSett.Id][oldiMsg.Number.Number] = lamWaiting{
+		ChannelID:  chSett.Id,
+		Number:     oldiMsg.Number,
+		Summary:    oldiMsg.ToLogMessage(),
+		ProviderID: providerID,
+		Text:       text,
+		Deadline:   time.Now().Add(timeout),
+	}
+	return true
+}
+
+// acknowledged обработка LAM, полученного из канала. Возвращает сообщение, на которое получено подтверждение.
+func (lt *lamTracker) acknowledged(channelID int, lam oldi_msg.Message) (lamWaiting, bool) {
+	if lam.Title != oldi_msg.TitleLAM || lam.Reference.IsEmpty() {
+		return lamWaiting{}, false
+	}
+	if chWaiting, ok := lt.waiting[channelID]; ok {
+		if val, ok := chWaiting[lam.Reference.Number]; ok {
+			delete(chWaiting, lam.Reference.Number)
+			return val, true
+		}
+	}
+	return lamWaiting{}, false
+}
+
+// expired сообщения, для которых истекло время ожидания LAM (удаляются из списка ожидания)
+func (lt *lamTracker) expired(now time.Time) []lamWaiting {
+	var retValue []lamWaiting
+	for _, chWaiting := range lt.waiting {
+		for num, val := range chWaiting {
+			if now.After(val.Deadline) {
+				retValue = append(retValue, val)
+				delete(chWaiting, num)
+			}
+		}
+	}
+	return retValue
+}
+
+// resetChannel удаление ожидающих LAM сообщений канала (при остановке канала)
+func (lt *lamTracker) resetChannel(channelID int) {
+	delete(lt.waiting, channelID)
+}
+
+// createLam формирование LAM с номером num на полученное из канала сообщение
+func createLam(received oldi_msg.Message, num int) oldi_msg.Message {
+	retValue := oldi_msg.NewMessage(oldi_msg.TitleLAM)
+	retValue.Number = oldi_msg.MessageNumber{
+		Sender:   received.Number.Receiver,
+		Receiver: received.Number.Sender,
+		Number:   num,
+	}
+	retValue.Reference = received.Number
+	return retValue
+}
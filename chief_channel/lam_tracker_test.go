@@ -0,0 +1,116 @@
+package chief_channel
+
+import (
+	"testing"
+	"time"
+
+	"fmtp/channel/channel_settings"
+	pb "fmtp/chief/proto/fmtp"
+	"fmtp/oldi_msg"
+)
+
+func oldiMsg(title string, num int) oldi_msg.Message {
+	msg := oldi_msg.NewMessage(title)
+	msg.Number = oldi_msg.MessageNumber{Sender: "LOC", Receiver: "REM", Number: num}
+	return msg
+}
+
+func lamFor(num int) oldi_msg.Message {
+	lam := oldi_msg.NewMessage(oldi_msg.TitleLAM)
+	lam.Number = oldi_msg.MessageNumber{Sender: "REM", Receiver: "LOC", Number: 1}
+	lam.Reference = oldi_msg.MessageNumber{Sender: "LOC", Receiver: "REM", Number: num}
+	return lam
+}
+
+func TestLamTrackerSent(t *testing.T) {
+	tests := []struct {
+		name  string
+		sett  channel_settings.ChannelSettings
+		msg   oldi_msg.Message
+		track bool
+	}{
+		{"lam disabled", channel_settings.ChannelSettings{Id: 1}, oldiMsg(oldi_msg.TitleACT, 1), false},
+		{"act", channel_settings.ChannelSettings{Id: 1, LamEnabled: true}, oldiMsg(oldi_msg.TitleACT, 1), true},
+		{"lam itself", channel_settings.ChannelSettings{Id: 1, LamEnabled: true}, oldiMsg(oldi_msg.TitleLAM, 2), false},
+		{"no number", channel_settings.ChannelSettings{Id: 1, LamEnabled: true}, oldi_msg.NewMessage(oldi_msg.TitleACT), false},
+	}
+	for _, tt := range tests {
+		lt := newLamTracker()
+		if got := lt.sent(tt.sett, tt.msg, "p", "text"); got != tt.track {
+			t.Fatalf("%s: tracked %v, want %v", tt.name, got, tt.track)
+		}
+	}
+}
+
+func TestLamTrackerAckAndTimeout(t *testing.T) {
+	sett := channel_settings.ChannelSettings{Id: 1, LamEnabled: true, LamTimeout: 5}
+	other := channel_settings.ChannelSettings{Id: 2, LamEnabled: true}
+	lt := newLamTracker()
+	lt.sent(sett, oldiMsg(oldi_msg.TitleACT, 10), "p10", "act10")
+	lt.sent(sett, oldiMsg(oldi_msg.TitleACT, 11), "p11", "act11")
+	lt.sent(other, oldiMsg(oldi_msg.TitleACT, 10), "o10", "act10")
+
+	tests := []struct {
+		name      string
+		channelID int
+		lam       oldi_msg.Message
+		wantID    string
+		wantOk    bool
+	}{
+		{"not a lam", 1, oldiMsg(oldi_msg.TitleACT, 10), "", false},
+		{"no reference", 1, oldi_msg.NewMessage(oldi_msg.TitleLAM), "", false},
+		{"unknown number", 1, lamFor(99), "", false},
+		{"other channel", 3, lamFor(10), "", false},
+		{"matched", 1, lamFor(10), "p10", true},
+		{"repeated", 1, lamFor(10), "", false},
+	}
+	for _, tt := range tests {
+		got, ok := lt.acknowledged(tt.channelID, tt.lam)
+		if ok != tt.wantOk || got.ProviderID != tt.wantID {
+			t.Fatalf("%s: %q %v, want %q %v", tt.name, got.ProviderID, ok, tt.wantID, tt.wantOk)
+		}
+	}
+
+	now := time.Now()
+	if exp := lt.expired(now); len(exp) != 0 {
+		t.Fatalf("%d expired before timeout", len(exp))
+	}
+	// channel 2 uses the default timeout, channel 1 the configured 5 sec
+	exp := lt.expired(now.Add(6 * time.Second))
+	if len(exp) != 1 || exp[0].ProviderID != "p11" {
+		t.Fatalf("expired %+v, want p11", exp)
+	}
+	exp = lt.expired(now.Add(defaultLamTimeout + time.Second))
+	if len(exp) != 1 || exp[0].ProviderID != "o10" {
+		t.Fatalf("expired %+v, want o10", exp)
+	}
+	if exp = lt.expired(now.Add(time.Hour)); len(exp) != 0 {
+		t.Fatalf("expired reported twice: %+v", exp)
+	}
+
+	lt.sent(other, oldiMsg(oldi_msg.TitleACT, 12), "o12", "act12")
+	lt.resetChannel(2)
+	if _, ok := lt.acknowledged(2, lamFor(12)); ok {
+		t.Fatalf("acknowledged after channel reset")
+	}
+}
+
+func TestSendLamStatusDoesNotBlock(t *testing.T) {
+	cc := &ChiefChannelServer{ToFdpsPacketChan: make(chan *pb.Msg, 1)}
+	sett := channel_settings.ChannelSettings{Id: 1, RemoteATC: "REM"}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cc.sendLamStatus(sett, lamWaiting{ProviderID: "p1"}, pb.MsgTpLamAck)
+		cc.sendLamStatus(sett, lamWaiting{ProviderID: "p2"}, pb.MsgTpLamAck)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("lam status send blocked on full queue")
+	}
+	if msg := <-cc.ToFdpsPacketChan; msg.Id != "p1" || msg.Cid != "REM" {
+		t.Fatalf("lam status %+v", msg)
+	}
+}
@@ -0,0 +1,212 @@
+package chief_channel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/chief/chief_metrics"
+	"fmtp/fmtp_log"
+	"fmtp/oldi_msg"
+
+	"lemz.com/fdps/logger"
+	"lemz.com/fdps/utils"
+)
+
+var sequenceFile = utils.AppPath() + "/config/oldi_sequences.json"
+
+// кол-во номеров, резервируемых в файле за один раз. Номера выдаются только после сохранения резерва,
+// поэтому после аварийного завершения номера не повторяются (остаток резерва пропускается)
+const seqReserveBlock = 100
+
+// результат проверки номера входящего сообщения
+const (
+	seqOk        = iota // номер следует за предыдущим
+	seqGap              // пропущены номера
+	seqDuplicate        // повтор ранее полученного номера
+)
+
+// linkSequence номера OLDI сообщений одного канала
+type linkSequence struct {
+	OutNumber int `json:"OutNumber"` // последний зарезервированный номер отправляемых в канал сообщений
+	InNumber  int `json:"InNumber"`  // номер последнего полученного из канала сообщения
+
+	outCur  int // номер последнего отправленного в канал сообщения
+	outLeft int // кол-во зарезервированных и не выданных номеров
+}
+
+// sequenceStore номера OLDI сообщений каналов и идентификаторы сообщений провайдерам, сохраняемые в файл
+type sequenceStore struct {
+	Channels   map[string]*linkSequence `json:"Channels"`   // ключ - идентификатор канала
+	ProviderID int                      `json:"ProviderID"` // последний зарезервированный идентификатор сообщения провайдеру
+
+	providerCur  int  // идентификатор последнего сообщения, переданного провайдеру
+	providerLeft int  // кол-во зарезервированных и не выданных идентификаторов
+	dirty        bool // есть не сохраненные изменения
+}
+
+func newSequenceStore() *sequenceStore {
+	retValue := &sequenceStore{Channels: make(map[string]*linkSequence)}
+
+	if data, err := ioutil.ReadFile(sequenceFile); err == nil {
+		if err := json.Unmarshal(data, retValue); err != nil {
+			logger.PrintfErr("Ошибка разбора файла номеров OLDI сообщений. Ошибка: %v.", err)
+		}
+		if retValue.Channels == nil {
+			retValue.Channels = make(map[string]*linkSequence)
+		}
+	}
+
+	// выдача продолжается после зарезервированных номеров
+	for _, val := range retValue.Channels {
+		val.outCur = val.OutNumber
+	}
+	retValue.providerCur = retValue.ProviderID
+	return retValue
+}
+
+func (ss *sequenceStore) link(chSett channel_settings.ChannelSettings) *linkSequence {
+	key := strconv.Itoa(chSett.Id)
+	if _, ok := ss.Channels[key]; !ok {
+		ss.Channels[key] = &linkSequence{}
+	}
+	return ss.Channels[key]
+}
+
+// следующий номер OLDI сообщения (1..MaxNumber)
+func nextNumber(num int) int {
+	if num >= oldi_msg.MaxNumber || num < 1 {
+		return 1
+	}
+	return num + 1
+}
+
+// номер OLDI сообщения через count номеров после num (с учетом перехода через MaxNumber)
+func advanceNumber(num int, count int) int {
+	if num < 1 {
+		num = oldi_msg.MaxNumber
+	}
+	return (num-1+count)%oldi_msg.MaxNumber + 1
+}
+
+// nextOut номер очередного отправляемого в канал сообщения
+func (ss *sequenceStore) nextOut(chSett channel_settings.ChannelSettings) int {
+	ls := ss.link(chSett)
+	if ls.outLeft == 0 {
+		ls.OutNumber = advanceNumber(ls.outCur, seqReserveBlock)
+		ls.outLeft = seqReserveBlock
+		ss.dirty = true
+		ss.save()
+	}
+	ls.outCur = nextNumber(ls.outCur)
+	ls.outLeft--
+	return ls.outCur
+}
+
+// nextProviderID идентификатор очередного сообщения, передаваемого провайдеру (общий для всех каналов)
+func (ss *sequenceStore) nextProviderID() int {
+	if ss.providerLeft == 0 {
+		ss.ProviderID = ss.providerCur + seqReserveBlock
+		ss.providerLeft = seqReserveBlock
+		ss.dirty = true
+		ss.save()
+	}
+	ss.providerCur++
+	ss.providerLeft--
+	return ss.providerCur
+}
+
+// checkIn проверка номера полученного из канала сообщения.
+// Возвращает результат проверки и кол-во пропущенных номеров.
+func (ss *sequenceStore) checkIn(chSett channel_settings.ChannelSettings, num int) (int, int) {
+	ls := ss.link(chSett)
+	prev := ls.InNumber
+
+	// первое сообщение канала
+	if prev == 0 {
+		ls.InNumber = num
+		ss.dirty = true
+		return seqOk, 0
+	}
+
+	// расстояние от предыдущего номера с учетом перехода через MaxNumber
+	dist := (num - prev + oldi_msg.MaxNumber) % oldi_msg.MaxNumber
+	switch {
+	case dist == 1:
+		ls.InNumber = num
+		ss.dirty = true
+		return seqOk, 0
+	case dist == 0 || dist > oldi_msg.MaxNumber/2:
+		return seqDuplicate, 0
+	default:
+		ls.InNumber = num
+		ss.dirty = true
+		return seqGap, dist - 1
+	}
+}
+
+// save сохранение номеров в файл, если были изменения.
+// Файл записывается через временный, чтобы при аварийном завершении не остался частично записанный файл
+func (ss *sequenceStore) save() {
+	if !ss.dirty {
+		return
+	}
+	data, err := json.Marshal(ss)
+	if err != nil {
+		logger.PrintfErr("Ошибка формирования файла номеров OLDI сообщений. Ошибка: %v.", err)
+		return
+	}
+	tmpFile := sequenceFile + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, utils.JsonPrettyPrint(data), 0640); err == nil {
+		err = os.Rename(tmpFile, sequenceFile)
+	}
+	if err != nil {
+		logger.PrintfErr("Ошибка сохранения файла номеров OLDI сообщений. Ошибка: %v.", err)
+		return
+	}
+	ss.dirty = false
+}
+
+// номер отправляемого в канал сообщения. Отправитель и получатель сохраняются из исходного номера (если задан)
+func (cc *ChiefChannelServer) outNumber(chSett channel_settings.ChannelSettings, cur oldi_msg.MessageNumber) oldi_msg.MessageNumber {
+	retValue := oldi_msg.MessageNumber{Sender: chSett.LocalATC, Receiver: chSett.RemoteATC, Number: cc.seqs.nextOut(chSett)}
+	if !cur.IsEmpty() {
+		retValue.Sender = cur.Sender
+		retValue.Receiver = cur.Receiver
+	}
+	return retValue
+}
+
+// проверка номера полученного из канала сообщения
+func (cc *ChiefChannelServer) checkInNumber(chSett channel_settings.ChannelSettings, oldiMsg oldi_msg.Message) {
+	if oldiMsg.Number.IsEmpty() {
+		return
+	}
+
+	result, missed := cc.seqs.checkIn(chSett, oldiMsg.Number.Number)
+	switch result {
+	case seqGap:
+		logger.PrintfErr("FMTP FORMAT %#v", channelLogMessage(chSett, fmtp_log.SeverityError,
+			fmt.Sprintf("Нарушена последовательность номеров OLDI сообщений. Пропущено номеров: %d. %s.", missed, oldiMsg.ToLogMessage())))
+
+		chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+			Tp:     chief_metrics.ChanTpSeqGap,
+			LocAtc: chSett.LocalATC,
+			RemAtc: chSett.RemoteATC,
+			Count:  missed,
+		}
+	case seqDuplicate:
+		logger.PrintfWarn("FMTP FORMAT %#v", channelLogMessage(chSett, fmtp_log.SeverityWarning,
+			fmt.Sprintf("Повтор номера OLDI сообщения. %s.", oldiMsg.ToLogMessage())))
+
+		chief_metrics.ChanMetricsChan <- chief_metrics.ChanMetrics{
+			Tp:     chief_metrics.ChanTpSeqDup,
+			LocAtc: chSett.LocalATC,
+			RemAtc: chSett.RemoteATC,
+			Count:  1,
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package chief_channel
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"fmtp/channel/channel_settings"
+	"fmtp/oldi_msg"
+)
+
+// sequence file in the test temp dir
+func useTempSequenceFile(t *testing.T) {
+	prev := sequenceFile
+	sequenceFile = filepath.Join(t.TempDir(), "oldi_sequences.json")
+	t.Cleanup(func() { sequenceFile = prev })
+}
+
+func TestSequenceCheckIn(t *testing.T) {
+	useTempSequenceFile(t)
+	chSett := channel_settings.ChannelSettings{Id: 1, LocalATC: "UUWV", RemoteATC: "ULLL"}
+
+	cases := []struct {
+		num     int
+		result  int
+		missed  int
+		inAfter int
+	}{
+		{5, seqOk, 0, 5},
+		{6, seqOk, 0, 6},
+		{6, seqDuplicate, 0, 6},
+		{3, seqDuplicate, 0, 6},
+		{10, seqGap, 3, 10},
+		{oldi_msg.MaxNumber, seqDuplicate, 0, 10}, // far behind - treated as old
+		{400, seqGap, 389, 400},
+		{800, seqGap, 399, 800},
+		{oldi_msg.MaxNumber, seqGap, oldi_msg.MaxNumber - 801, oldi_msg.MaxNumber},
+		{1, seqOk, 0, 1},
+		{oldi_msg.MaxNumber, seqDuplicate, 0, 1},
+	}
+
+	ss := newSequenceStore()
+	for idx, val := range cases {
+		result, missed := ss.checkIn(chSett, val.num)
+		if result != val.result || missed != val.missed || ss.link(chSett).InNumber != val.inAfter {
+			t.Fatalf("case %d (num %d): got result %d missed %d in %d, want %d %d %d",
+				idx, val.num, result, missed, ss.link(chSett).InNumber, val.result, val.missed, val.inAfter)
+		}
+	}
+}
+
+func TestSequenceChannelsAndProviderIDs(t *testing.T) {
+	useTempSequenceFile(t)
+	// parallel channels of one link
+	first := channel_settings.ChannelSettings{Id: 1, LocalATC: "UUWV", RemoteATC: "ULLL"}
+	second := channel_settings.ChannelSettings{Id: 2, LocalATC: "UUWV", RemoteATC: "ULLL"}
+
+	ss := newSequenceStore()
+	if ss.nextOut(first) != 1 || ss.nextOut(first) != 2 || ss.nextOut(second) != 1 {
+		t.Fatalf("numbers of parallel channels must be independent")
+	}
+
+	ids := make(map[int]bool)
+	for idx := 0; idx < 2*seqReserveBlock; idx++ {
+		id := ss.nextProviderID()
+		if ids[id] {
+			t.Fatalf("provider message id %d reused", id)
+		}
+		ids[id] = true
+	}
+}
+
+func TestSequenceNoReuseAfterCrash(t *testing.T) {
+	useTempSequenceFile(t)
+	chSett := channel_settings.ChannelSettings{Id: 7, LocalATC: "UUWV", RemoteATC: "ULLL"}
+
+	ss := newSequenceStore()
+	var lastOut, lastID int
+	for idx := 0; idx < 3; idx++ {
+		lastOut = ss.nextOut(chSett)
+		lastID = ss.nextProviderID()
+	}
+	// crash: the ticker save was never called
+
+	restarted := newSequenceStore()
+	if out := restarted.nextOut(chSett); out <= lastOut {
+		t.Fatalf("out number %d after restart reuses issued ones (last %d)", out, lastOut)
+	}
+	if id := restarted.nextProviderID(); id <= lastID {
+		t.Fatalf("provider id %d after restart reuses issued ones (last %d)", id, lastID)
+	}
+
+	info, err := os.Stat(sequenceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("sequence file mode %v, want 0640", info.Mode().Perm())
+	}
+}
+
+func TestSequenceReserveWrap(t *testing.T) {
+	useTempSequenceFile(t)
+	chSett := channel_settings.ChannelSettings{Id: 3}
+
+	ss := newSequenceStore()
+	ss.link(chSett).outCur = oldi_msg.MaxNumber - 1
+	if ss.nextOut(chSett) != oldi_msg.MaxNumber || ss.nextOut(chSett) != 1 {
+		t.Fatalf("number must wrap from %d to 1", oldi_msg.MaxNumber)
+	}
+	if want := advanceNumber(oldi_msg.MaxNumber-1, seqReserveBlock); ss.link(chSett).OutNumber != want {
+		t.Fatalf("reserved %d, want %d", ss.link(chSett).OutNumber, want)
+	}
+}
+
+func TestSequenceFileContinued(t *testing.T) {
+	useTempSequenceFile(t)
+	saved := `{"Channels": {"4": {"OutNumber": 40, "InNumber": 12}}, "ProviderID": 500}`
+	if err := ioutil.WriteFile(sequenceFile, []byte(saved), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	ss := newSequenceStore()
+	chSett := channel_settings.ChannelSettings{Id: 4, LocalATC: "UUWV", RemoteATC: "ULLL"}
+	if out := ss.nextOut(chSett); out != 41 {
+		t.Fatalf("out number %d, want 41 (continued from saved file)", out)
+	}
+	if result, _ := ss.checkIn(chSett, 13); result != seqOk {
+		t.Fatalf("in number 13 after 12: result %d", result)
+	}
+	if id := ss.nextProviderID(); id != 501 {
+		t.Fatalf("provider id %d, want 501", id)
+	}
+}
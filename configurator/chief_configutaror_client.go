@@ -9,6 +9,7 @@ import (
 	"fmtp/chief/chief_settings"
 	"fmtp/chief/chief_state"
 	"fmtp/chief/chief_web"
+	"fmtp/fmtp_log"
 
 	"lemz.com/fdps/logger"
 	"lemz.com/fdps/utils"
@@ -30,26 +31,33 @@ type ChiefConfiguratorClient struct {
 	sendHeartbeatTicker    *time.Ticker
 	withDocker             bool
 	channelVersions        []string // список версий приложений/docker бразов FMTP канала
+	rejectedTimestamp      string   // метка времени настроек конфигуратора, отклоненных при проверке
+
+	settsWatcher    *settingsFileWatcher // отслеживание локального файла настроек (только в автономном режиме)
+	settsFileTicker *time.Ticker         // тикер проверки локального файла настроек
 }
 
-func NewChiefClient(workWithDocker bool) *ChiefConfiguratorClient {
-	return &ChiefConfiguratorClient{
+// NewChiefClient конструктор. Если задан standaloneSettingsFile, контроллер работает в автономном режиме:
+// настройки считываются из указанного файла (JSON или YAML) и применяются при его изменении, конфигуратор не используется.
+func NewChiefClient(workWithDocker bool, standaloneSettingsFile string) *ChiefConfiguratorClient {
+	retValue := &ChiefConfiguratorClient{
 		ConfiguratorClient:     ConfiguratorClient{postResultChan: make(chan httpResult, 1)},
 		ChiefSettChangedChan:   make(chan struct{}, 1),
 		readLocalSettingsTimer: time.NewTimer(time.Minute),
 		sendHeartbeatTicker:    time.NewTicker(time.Second),
 		withDocker:             workWithDocker,
 	}
+	if standaloneSettingsFile != "" {
+		retValue.readLocalSettingsTimer.Stop()
+		retValue.settsWatcher = &settingsFileWatcher{path: standaloneSettingsFile}
+		retValue.settsFileTicker = time.NewTicker(settingsFileCheckInterval)
+	}
+	return retValue
 }
 
+// Work реализация работы. Запущенные ранее контейнеры FMTP каналов не останавливаются:
+// контроллер каналов подхватывает их при получении настроек.
 func (c *ChiefConfiguratorClient) Work() {
-	if c.withDocker {
-		// останавливаем и удаляем ранее запущенные контейнеры fmtp каналов
-		if stopErr := utils.StopContainers(ChannelImageName); stopErr != nil {
-			logger.PrintfErr("Ошибка остановки docker контейнеров приложения FMTP канал. Ошибка: %s.", stopErr.Error())
-		}
-	}
-
 	for {
 		select {
 
@@ -63,16 +71,25 @@ func (c *ChiefConfiguratorClient) Work() {
 					switch msgHeader.Header {
 					// ответ на запрос настроек
 					case ChiefSettsAnswerHdr:
-						ChiefCfg = chief_settings.ChiefSettings{CntrlID: -1, IPAddr: "", IsInitialised: false}
-						if unmErr = json.Unmarshal(postRes.result, &ChiefCfg); unmErr != nil {
-							logger.PrintfErr("Ошибка разбора (unmarshall) ответа на запрос настроек. Сообщение: %s. Ошибка: %s.", string(postRes.result), unmErr.Error())
+						newSetts := chief_settings.ChiefSettings{CntrlID: -1, IPAddr: "", IsInitialised: false}
+						if unmErr = json.Unmarshal(postRes.result, &newSetts); unmErr != nil {
+							logger.PrintfErr("Ошибка разбора (unmarshall) ответа на запрос настроек. Ошибка: %s.", unmErr.Error())
+						} else if decErr := newSetts.DecryptSecrets(); decErr != nil {
+							logger.PrintfErr("Ошибка расшифровки секретов в настройках от конфигуратора. Ошибка: %s.", decErr.Error())
 						} else {
-							ChiefCfg.IsInitialised = true
-							logger.PrintfDebug("Получены настройки от конфигуратора. %+v.", ChiefCfg)
+							logger.PrintfDebug("Получены настройки от конфигуратора. %+v.", newSetts.Redacted())
+							if !c.applySettings(newSetts, chief_state.SettingsFromConfigurator) {
+								c.rejectedTimestamp = newSetts.Timestamp
+								break
+							}
+							c.rejectedTimestamp = ""
 
 							c.readLocalSettingsTimer.Stop()
 
-							ChiefCfg.SaveToFile()
+							if saveErr := newSetts.SaveToFile(); saveErr != nil {
+								logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, fmtp_log.ChannelTypeNone,
+									fmt.Sprintf("Ошибка сохранения настроек от конфигуратора в файл. Ошибка: %v", saveErr)))
+							}
 
 							c.initAfterGetSettings()
 
@@ -87,7 +104,8 @@ func (c *ChiefConfiguratorClient) Work() {
 							logger.PrintfErr("Ошибка разбора (unmarshall) ответа на сообщение о состоянии контроллера. Сообщение: %s. Ошибка: %s.",
 								string(postRes.result), unmErr.Error())
 						} else {
-							if curMsg.ConfigTimestamp != ChiefCfg.Timestamp {
+							// отклоненные настройки повторно не запрашиваем до их изменения в конфигураторе
+							if curMsg.ConfigTimestamp != ChiefCfg.Timestamp && curMsg.ConfigTimestamp != c.rejectedTimestamp {
 								go c.postToConfigurator(c.configUrls.SettingsURLStr, CreateChiefSettsRequestMsg(c.channelVersions))
 							}
 						}
@@ -106,7 +124,7 @@ func (c *ChiefConfiguratorClient) Work() {
 
 		// сработал таймер отправки состояния (heartbeat)
 		case <-c.sendHeartbeatTicker.C:
-			if ChiefCfg.IsInitialised {
+			if (ChiefCfg.IsInitialised || c.rejectedTimestamp != "") && !c.isStandalone() {
 				go c.postToConfigurator(c.configUrls.HeartbeatURLStr,
 					ChiefHbtMsg{
 						ChiefHdr:   ChiefHdr{Header: ChiefHbtHdr},
@@ -116,14 +134,21 @@ func (c *ChiefConfiguratorClient) Work() {
 
 		// сработал таймер считывания настроек из файла
 		case <-c.readLocalSettingsTimer.C:
-			if fileErr := ChiefCfg.ReadFromFile(); fileErr != nil {
+			fileSetts := chief_settings.ChiefSettings{CntrlID: -1, IPAddr: "127.0.0.1", IsInitialised: false}
+			if fileErr := fileSetts.ReadFromFile(); fileErr != nil {
 				logger.PrintfErr("Ошибка чтения настроек контроллера из файла. Ошибка: %s.", fileErr.Error())
 			} else {
 				logger.PrintfWarn("Настройки контроллера считаны из файла.")
-				// отправляем настройки
-				c.sendSettings()
+				if c.applySettings(fileSetts, chief_state.SettingsFromFile) {
+					// отправляем настройки
+					c.sendSettings()
+				}
 			}
 
+		// сработал тикер проверки локального файла настроек (автономный режим)
+		case <-c.settsFileTickerChan():
+			c.checkStandaloneSettings()
+
 		// получены настроки URL из web
 		case c.configUrls = <-chief_web.UrlConfigChan:
 			c.setUrls()
@@ -133,6 +158,12 @@ func (c *ChiefConfiguratorClient) Work() {
 
 // Start запуск взаимодействия с конфигуратором
 func (c *ChiefConfiguratorClient) Start() {
+	if c.isStandalone() {
+		logger.PrintfInfo("Контроллер работает в автономном режиме. Файл настроек: %s.", c.settsWatcher.path)
+		c.initBeforeGetSettings()
+		return
+	}
+
 	c.getUrls()
 	chief_web.SetUrlConfig(c.configUrls)
 
@@ -188,12 +219,40 @@ func (cc *ChiefConfiguratorClient) initAfterGetSettings() {
 			// если появились новые версии, заново запрашиваем настройки
 			if !reflect.DeepEqual(cc.channelVersions, newVersions) {
 				cc.channelVersions = newVersions
+				if cc.isStandalone() {
+					// повторно применяем локальный файл настроек с учетом новых версий
+					cc.settsWatcher.reset()
+					return
+				}
 				go cc.postToConfigurator(cc.configUrls.SettingsURLStr, CreateChiefSettsRequestMsg(cc.channelVersions))
 			}
 		}
 	}
 }
 
+// проверка и применение новых настроек. Каналы и провайдеры с ошибками не применяются.
+// При ошибках в общих настройках контроллера текущие настройки не изменяются, возвращается false.
+func (cc *ChiefConfiguratorClient) applySettings(newSetts chief_settings.ChiefSettings, source string) bool {
+	problems := newSetts.Validate(cc.channelVersions)
+	for _, val := range problems {
+		if val.Severity == chief_settings.ProblemError {
+			logger.PrintfErr("Ошибка в настройках контроллера. %s", val.String())
+		} else {
+			logger.PrintfWarn("Предупреждение в настройках контроллера. %s", val.String())
+		}
+	}
+	chief_state.SetSettingsState(source, problems)
+
+	if problems.HasFatal() {
+		logger.PrintfErr("Настройки контроллера не применены из-за ошибок в общих настройках.")
+		return false
+	}
+
+	ChiefCfg = newSetts.WithoutInvalid(problems)
+	ChiefCfg.IsInitialised = true
+	return true
+}
+
 // отправляе настройки каналам, провайдерам, клиенту логгера
 func (cc *ChiefConfiguratorClient) sendSettings() {
 	// добавляем в настройки URL
@@ -215,7 +274,11 @@ func (cc *ChiefConfiguratorClient) sendSettings() {
 		if val.DataType == chief_settings.AODBProvider {
 			ChiefCfg.ProvidersSetts[ind].LocalPort = ChiefCfg.AodbProviderPort
 		} else if val.DataType == chief_settings.OLDIProvider {
-			ChiefCfg.ProvidersSetts[ind].LocalPort = ChiefCfg.OldiProviderPort
+			if val.ProviderTransport() == chief_settings.ProviderTransportTcp {
+				ChiefCfg.ProvidersSetts[ind].LocalPort = ChiefCfg.OldiProviderTcpPort
+			} else {
+				ChiefCfg.ProvidersSetts[ind].LocalPort = ChiefCfg.OldiProviderPort
+			}
 		}
 	}
 	cc.ChiefSettChangedChan <- struct{}{}
@@ -0,0 +1,90 @@
+package configurator
+
+import (
+	"os"
+	"time"
+
+	"fmtp/chief/chief_settings"
+	"fmtp/chief/chief_state"
+
+	"lemz.com/fdps/logger"
+)
+
+// интервал проверки изменения локального файла настроек
+const settingsFileCheckInterval = 2 * time.Second
+
+// settingsFileWatcher отслеживание изменений локального файла настроек (по времени изменения и размеру)
+type settingsFileWatcher struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// changed признак изменения файла с момента предыдущей проверки
+func (w *settingsFileWatcher) changed() (bool, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return false, nil
+	}
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	return true, nil
+}
+
+// reset сброс сохраненного состояния файла (при следующей проверке файл считается измененным)
+func (w *settingsFileWatcher) reset() {
+	w.modTime = time.Time{}
+	w.size = 0
+}
+
+// признак работы в автономном режиме (без конфигуратора)
+func (c *ChiefConfiguratorClient) isStandalone() bool {
+	return c.settsWatcher != nil
+}
+
+// проверка изменения локального файла настроек и применение новых настроек
+func (c *ChiefConfiguratorClient) checkStandaloneSettings() {
+	changed, err := c.settsWatcher.changed()
+	if err != nil {
+		c.setStandaloneError("Ошибка чтения локального файла настроек. " + err.Error())
+		return
+	}
+	if !changed {
+		return
+	}
+
+	newSetts, err := chief_settings.ReadSettingsFile(c.settsWatcher.path)
+	if err != nil {
+		c.setStandaloneError(err.Error())
+		return
+	}
+
+	if !c.applySettings(newSetts, chief_state.SettingsFromStandalone) {
+		return
+	}
+	logger.PrintfInfo("Применены настройки из локального файла %s.", c.settsWatcher.path)
+
+	c.initAfterGetSettings()
+	c.sendSettings()
+}
+
+// ошибка чтения / разбора локального файла настроек. Текущие настройки не изменяются
+func (c *ChiefConfiguratorClient) setStandaloneError(errText string) {
+	logger.PrintfErr("Ошибка в локальном файле настроек %s. %s", c.settsWatcher.path, errText)
+	chief_state.SetSettingsState(chief_state.SettingsFromStandalone, chief_settings.SettingsProblems{{
+		Severity: chief_settings.ProblemError,
+		Object:   chief_settings.ProblemObjFile,
+		Message:  errText,
+	}})
+}
+
+// канал тикера проверки локального файла настроек (nil - не автономный режим)
+func (c *ChiefConfiguratorClient) settsFileTickerChan() <-chan time.Time {
+	if c.settsFileTicker == nil {
+		return nil
+	}
+	return c.settsFileTicker.C
+}
@@ -2,8 +2,10 @@ package configurator
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
+	"fmtp/fmtp_log"
 	"fmtp/ora_logger/logger_settings"
 	"fmtp/ora_logger/logger_state"
 
@@ -47,12 +49,18 @@ func (c *LoggerConfiguratorClient) Work() {
 					case LogggerSettsAnswerHdr:
 						LoggerCfg.IsInitialised = false
 						if unmErr = json.Unmarshal(postRes.result, &LoggerCfg); unmErr != nil {
-							logger.PrintfErr("Ошибка разбора (unmarshall) ответа на запрос настроек. Сообщение: %s. Ошибка: %s.", string(postRes.result), unmErr.Error())
+							logger.PrintfErr("Ошибка разбора (unmarshall) ответа на запрос настроек. Ошибка: %s.", unmErr.Error())
+						} else if decErr := LoggerCfg.DecryptSecrets(); decErr != nil {
+							logger.PrintfErr("Ошибка расшифровки секретов в настройках от конфигуратора. Ошибка: %s.", decErr.Error())
 						} else {
+							logger.PrintfDebug("Получены настройки от конфигуратора. %+v.", LoggerCfg.Redacted())
 							LoggerCfg.IsInitialised = true
 							c.readLocalSettingsTimer.Stop()
 
-							LoggerCfg.SaveToFile()
+							if saveErr := LoggerCfg.SaveToFile(); saveErr != nil {
+								logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, fmtp_log.ChannelTypeNone,
+									fmt.Sprintf("Ошибка сохранения настроек от конфигуратора в файл. Ошибка: %v", saveErr)))
+							}
 
 							// отправляем настройки
 							c.sendSettings()
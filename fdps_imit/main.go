@@ -7,10 +7,12 @@ import (
 	"sync"
 	"time"
 
+	"fmtp/chief/oldi"
 	pb "fmtp/chief/proto/fmtp"
 	"fmtp/fdps_imit/settings"
 
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 
 	"google.golang.org/grpc"
@@ -54,6 +56,15 @@ func main() {
 	defer conn.Close()
 	gc := pb.NewFmtpServiceClient(conn)
 
+	// контекст вызовов с идентификатором и токеном провайдера
+	baseCtx := context.Background()
+	if setts.ProviderID != 0 {
+		baseCtx = metadata.AppendToOutgoingContext(baseCtx, oldi.ProviderIDKey, strconv.Itoa(setts.ProviderID))
+	}
+	if setts.ProviderToken != "" {
+		baseCtx = metadata.AppendToOutgoingContext(baseCtx, oldi.ProviderTokenKey, setts.ProviderToken)
+	}
+
 	sendTicker := time.NewTicker(time.Duration(setts.SendIntervalMsec) * time.Millisecond)
 	recvTicker := time.NewTicker(time.Duration(setts.RecvIntervalMsec) * time.Millisecond)
 	var msgId int64
@@ -123,7 +134,7 @@ func main() {
 		case <-sendTicker.C:
 			if len(msgs.List) > 0 {
 				expectMutex.Lock()
-				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(time.Second*10))
+				ctx, cancel := context.WithTimeout(baseCtx, time.Duration(time.Second*10))
 				defer cancel()
 				_, err := gc.SendMsg(ctx, &msgs)
 				if err != nil {
@@ -140,7 +151,7 @@ func main() {
 		case <-recvTicker.C:
 			curTime := time.Now().UTC()
 
-			r, err := gc.RecvMsq(context.Background(), &pb.SvcReq{Data: fmt.Sprintf("any data. recv time: %s ", curTime.Format("2006-01-02 15:04:05"))})
+			r, err := gc.RecvMsq(baseCtx, &pb.SvcReq{Data: fmt.Sprintf("any data. recv time: %s ", curTime.Format("2006-01-02 15:04:05"))})
 			if err != nil {
 				logger.PrintfErr("Error RecvMsq: %v", err)
 			}
@@ -4,7 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
+
+	"fmtp/secret"
 
 	"lemz.com/fdps/utils"
 )
@@ -12,6 +13,8 @@ import (
 type Settings struct {
 	FmtpCntrlAddress string `json:"FmtpCntrlAddress"`
 	FmtpCntrlPort    int    `json:"FmtpCntrlPort"`
+	ProviderID       int    `json:"ProviderID"`    // идентификатор провайдера, передаваемый контроллеру (0 - не передается)
+	ProviderToken    string `json:"ProviderToken"` // токен провайдера, передаваемый контроллеру (пусто - не передается)
 	SendIntervalMsec int    `json:"SendIntervalMsec"`
 	RecvIntervalMsec int    `json:"RecvIntervalMsec"`
 
@@ -37,14 +40,18 @@ func (s *Settings) ReadFromFile() error {
 		fmt.Println(err.Error())
 		return err
 	}
-	return nil
+	return secret.DecryptFields(&s.ProviderToken)
 }
 
-// SaveToFile сохранение настроек в файл
+// SaveToFile сохранение настроек в файл (токен провайдера сохраняется в зашифрованном виде)
 func (s *Settings) SaveToFile() error {
-	if confData, errMrsh := json.Marshal(s); errMrsh != nil {
+	encSetts := *s
+	if errEnc := secret.EncryptFields(&encSetts.ProviderToken); errEnc != nil {
+		return errEnc
+	}
+	if confData, errMrsh := json.Marshal(encSetts); errMrsh != nil {
 		return errMrsh
-	} else if errWriteSetts := ioutil.WriteFile(loggerSettingsFile, utils.JsonPrettyPrint(confData), os.ModePerm); errWriteSetts != nil {
+	} else if errWriteSetts := secret.WriteFile(loggerSettingsFile, utils.JsonPrettyPrint(confData)); errWriteSetts != nil {
 		return errWriteSetts
 	}
 	return nil
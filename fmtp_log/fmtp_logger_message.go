@@ -110,6 +110,12 @@ type LogMessageWithColor struct {
 	MsgColor string // цвет в таблице логов
 }
 
+// сообщение журнала с идентификатором записи в потоке Redis (для подтверждения записи в БД)
+type LogMessageWithID struct {
+	LogMessage
+	StreamID string // идентификатор записи в потоке
+}
+
 // конструктор для использования к FMTP канале
 func CreateMessage(severity string, packetType string,
 	direction string, text string) LogMessage {
@@ -10,13 +10,17 @@ replace (
 )
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/docker/docker v20.10.12+incompatible
 	github.com/go-redis/redis/v8 v8.11.4
 	github.com/godror/godror v0.30.2
-	github.com/golang-collections/go-datastructures v0.0.0-20150211160725-59788d5eb259
 	github.com/gorilla/websocket v1.5.0
+	github.com/lib/pq v1.10.4
+	github.com/mattn/go-sqlite3 v1.14.16
+	golang.org/x/sys v0.0.0-20220114195835-da31bd327af9
 	google.golang.org/grpc v1.44.0
 	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.4.0
 	lemz.com/fdps/logger v1.0.2
 	lemz.com/fdps/prom_metrics v1.0.2
 	lemz.com/fdps/utils v1.0.0
@@ -25,6 +29,7 @@ require (
 
 require (
 	github.com/Microsoft/go-winio v0.5.1 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/containerd/containerd v1.6.0 // indirect
@@ -49,8 +54,8 @@ require (
 	github.com/prometheus/common v0.32.1 // indirect
 	github.com/prometheus/procfs v0.7.3 // indirect
 	github.com/sirupsen/logrus v1.8.1 // indirect
+	github.com/yuin/gopher-lua v0.0.0-20220504180219-658193537a64 // indirect
 	golang.org/x/net v0.0.0-20211216030914-fe4d6282115f // indirect
-	golang.org/x/sys v0.0.0-20220114195835-da31bd327af9 // indirect
 	golang.org/x/text v0.3.7 // indirect
 	google.golang.org/genproto v0.0.0-20211208223120-3a66f561d7aa // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
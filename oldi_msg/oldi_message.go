@@ -0,0 +1,241 @@
+package oldi_msg
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// типы (заголовки) OLDI сообщений
+const (
+	TitleABI = "ABI" // Advance Boundary Information
+	TitleACT = "ACT" // Activate
+	TitleREV = "REV" // Revision
+	TitlePAC = "PAC" // Preliminary Activate
+	TitleMAC = "MAC" // Message for Abrogation of Coordination
+	TitleLAM = "LAM" // Logical Acknowledgement Message
+	TitleSBY = "SBY" // Stand-by
+	TitleRJC = "RJC" // Reject Coordination
+	TitleCOF = "COF" // Change of Frequency
+)
+
+// NoNumber признак отсутствия номера сообщения
+const NoNumber = -1
+
+// MaxNumber максимальный номер OLDI сообщения (номер передается тремя цифрами)
+const MaxNumber = 999
+
+// ICAO поле 3: тип сообщения, номер сообщения (отправитель/получатель/номер), ссылка на сообщение.
+var field3Regexp = regexp.MustCompile(`^([A-Z]{3})(?:([A-Z0-9]+)/([A-Z]+)(\d{3}))?(?:([A-Z0-9]+)/([A-Z]+)(\d{3}))?$`)
+
+// MessageNumber номер OLDI сообщения (поле 3b/3c)
+type MessageNumber struct {
+	Sender   string // идентификатор органа ОВД отправителя
+	Receiver string // идентификатор органа ОВД получателя
+	Number   int    // порядковый номер сообщения (NoNumber - номер отсутствует)
+}
+
+// IsEmpty признак отсутствия номера
+func (mn MessageNumber) IsEmpty() bool {
+	return mn.Number == NoNumber
+}
+
+// String номер в формате ICAO (SENDER/RECEIVER001)
+func (mn MessageNumber) String() string {
+	if mn.IsEmpty() {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s%03d", mn.Sender, mn.Receiver, mn.Number)
+}
+
+// EstimateData расчетные данные о пролете точки (ICAO поле 14)
+type EstimateData struct {
+	Point string // точка
+	Time  string // время пролета (HHMM)
+	Level string // эшелон (F330, A045, ...)
+	Extra string // дополнительные сведения (условия пролета точки и т.д.)
+}
+
+// IsEmpty признак отсутствия данных
+func (ed EstimateData) IsEmpty() bool {
+	return ed.Point == "" && ed.Time == "" && ed.Level == "" && ed.Extra == ""
+}
+
+// Message OLDI сообщение в формате полей ICAO
+type Message struct {
+	Title     string        // тип сообщения (ACT, ABI, LAM, ...)
+	Number    MessageNumber // номер сообщения (поле 3b)
+	Reference MessageNumber // ссылка на сообщение (поле 3c, для LAM, SBY, RJC ...)
+	Arcid     string        // опознавательный индекс ВС (поле 7a)
+	SsrCode   string        // режим и код ВОРЛ (поле 7b/c, например A1234)
+	Adep      string        // аэродром вылета (поле 13)
+	Estimate  EstimateData  // расчетные данные (поле 14)
+	Ades      string        // аэродром назначения (поле 16)
+	Other     []string      // остальные поля сообщения без разбора
+}
+
+// NewMessage пустое сообщение заданного типа
+func NewMessage(title string) Message {
+	return Message{
+		Title:     title,
+		Number:    MessageNumber{Number: NoNumber},
+		Reference: MessageNumber{Number: NoNumber},
+	}
+}
+
+// HasFlightData признак наличия в сообщении полей 7, 13, 14, 16
+func (m *Message) HasFlightData() bool {
+	switch m.Title {
+	case TitleLAM, TitleSBY, TitleRJC:
+		return false
+	}
+	return true
+}
+
+// NeedLam требуется ли логическое подтверждение (LAM) для сообщения данного типа
+func (m *Message) NeedLam() bool {
+	switch m.Title {
+	case TitleLAM, TitleSBY, TitleRJC, "":
+		return false
+	}
+	return !m.Number.IsEmpty()
+}
+
+// Parse разбор текста OLDI сообщения в формате ICAO: "(ACTLFPB/EGLL123-AFR123/A1234-LFPG-ABNUR/1230F330-EGLL)"
+func Parse(text string) (Message, error) {
+	retValue := NewMessage("")
+
+	body := strings.TrimSpace(text)
+	if !strings.HasPrefix(body, "(") || !strings.HasSuffix(body, ")") {
+		return retValue, errors.New("Сообщение не заключено в скобки.")
+	}
+	body = strings.TrimSpace(body[1 : len(body)-1])
+
+	fields := strings.Split(body, "-")
+	for idx := range fields {
+		fields[idx] = strings.TrimSpace(fields[idx])
+	}
+
+	if err := retValue.parseField3(fields[0]); err != nil {
+		return retValue, err
+	}
+	fields = fields[1:]
+
+	if !retValue.HasFlightData() {
+		retValue.Other = fields
+		return retValue, nil
+	}
+
+	if len(fields) > 0 {
+		arcidSsr := strings.SplitN(fields[0], "/", 2)
+		retValue.Arcid = arcidSsr[0]
+		if len(arcidSsr) == 2 {
+			retValue.SsrCode = arcidSsr[1]
+		}
+	}
+	if len(fields) > 1 {
+		retValue.Adep = fields[1]
+	}
+	if len(fields) > 2 {
+		retValue.Estimate = parseEstimate(fields[2])
+	}
+	if len(fields) > 3 {
+		retValue.Ades = fields[3]
+	}
+	if len(fields) > 4 {
+		retValue.Other = fields[4:]
+	}
+
+	if retValue.Arcid == "" {
+		return retValue, fmt.Errorf("Не задан опознавательный индекс ВС (поле 7). Тип сообщения: %s.", retValue.Title)
+	}
+	return retValue, nil
+}
+
+// разбор поля 3 (тип, номер сообщения, ссылка)
+func (m *Message) parseField3(field string) error {
+	subMatch := field3Regexp.FindStringSubmatch(field)
+	if subMatch == nil {
+		return fmt.Errorf("Некорректное значение поля 3 (тип и номер сообщения): %s.", field)
+	}
+	m.Title = subMatch[1]
+	if subMatch[4] != "" {
+		num, _ := strconv.Atoi(subMatch[4])
+		m.Number = MessageNumber{Sender: subMatch[2], Receiver: subMatch[3], Number: num}
+	}
+	if subMatch[7] != "" {
+		num, _ := strconv.Atoi(subMatch[7])
+		m.Reference = MessageNumber{Sender: subMatch[5], Receiver: subMatch[6], Number: num}
+	}
+	return nil
+}
+
+// разбор поля 14: точка/время, эшелон и доп. сведения ("ABNUR/1230F330")
+func parseEstimate(field string) EstimateData {
+	var retValue EstimateData
+
+	pointAndData := strings.SplitN(field, "/", 2)
+	retValue.Point = pointAndData[0]
+	if len(pointAndData) < 2 {
+		return retValue
+	}
+
+	data := pointAndData[1]
+	if len(data) >= 4 {
+		retValue.Time = data[:4]
+		data = data[4:]
+	}
+	if len(data) >= 4 && (data[0] == 'F' || data[0] == 'A' || data[0] == 'S' || data[0] == 'M') {
+		retValue.Level = data[:4]
+		data = data[4:]
+	}
+	retValue.Extra = data
+	return retValue
+}
+
+// String сообщение в формате ICAO
+func (m *Message) String() string {
+	var sb strings.Builder
+
+	sb.WriteString("(")
+	sb.WriteString(m.Title)
+	sb.WriteString(m.Number.String())
+	sb.WriteString(m.Reference.String())
+
+	if m.HasFlightData() {
+		sb.WriteString("-" + m.Arcid)
+		if m.SsrCode != "" {
+			sb.WriteString("/" + m.SsrCode)
+		}
+		sb.WriteString("-" + m.Adep)
+		sb.WriteString("-" + m.Estimate.Point)
+		if m.Estimate.Time != "" || m.Estimate.Level != "" || m.Estimate.Extra != "" {
+			sb.WriteString("/" + m.Estimate.Time + m.Estimate.Level + m.Estimate.Extra)
+		}
+		sb.WriteString("-" + m.Ades)
+	}
+
+	for _, val := range m.Other {
+		sb.WriteString("-" + val)
+	}
+	sb.WriteString(")")
+
+	return sb.String()
+}
+
+// ToLogMessage краткое описание сообщения для журнала
+func (m *Message) ToLogMessage() string {
+	retValue := "Тип: " + m.Title
+	if !m.Number.IsEmpty() {
+		retValue += ", номер: " + m.Number.String()
+	}
+	if !m.Reference.IsEmpty() {
+		retValue += ", ссылка: " + m.Reference.String()
+	}
+	if m.Arcid != "" {
+		retValue += ", ВС: " + m.Arcid
+	}
+	return retValue
+}
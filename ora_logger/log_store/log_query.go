@@ -0,0 +1,190 @@
+package log_store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"fmtp/fmtp_log"
+)
+
+// таблицы для поиска логов
+const (
+	QueryTableOnline  = "online"  // последние логи
+	QueryTableStorage = "storage" // все логи за время хранения
+)
+
+// SortColumns столбцы, по которым возможна сортировка результатов поиска
+var SortColumns = []string{"DateTime", "Severity", "DaemonID", "LocalName", "RemoteName", "FmtpType", "Direction", "CntrlIP", "Source", "DataType"}
+
+// LogQuery параметры поиска логов. Пустые значения не ограничивают поиск
+type LogQuery struct {
+	Table        string   // таблица (QueryTableOnline, QueryTableStorage)
+	From         string   // начало интервала времени (в формате fmtp_log.LogTimeFormat, UTC)
+	To           string   // окончание интервала времени (в формате fmtp_log.LogTimeFormat, UTC)
+	ControllerIP string   // IP адрес контроллера
+	ChannelID    *int     // идентификатор канала
+	LocalName    string   // локальное имя канала (ATC)
+	RemoteName   string   // удаленное имя канала (ATC)
+	Severities   []string // серьезность (любая из перечисленных)
+	FmtpType     string   // тип FMTP пакета
+	Direction    string   // направление сообщения
+	Text         string   // подстрока текста (без учета регистра)
+
+	SortBy   string // столбец сортировки (SortColumns)
+	SortDesc bool   // сортировка по убыванию
+	Offset   int    // кол-во пропускаемых логов
+	Limit    int    // макс. кол-во логов в результате
+}
+
+// LogPage результат поиска логов
+type LogPage struct {
+	Total int                   // общее кол-во логов, удовлетворяющих условиям поиска
+	Logs  []fmtp_log.LogMessage // логи в заданном интервале результатов
+}
+
+// sqlDialect отличия текста запросов поиска в различных БД
+type sqlDialect struct {
+	placeholder func(num int) string // привязанная переменная с номером num (с 1)
+	// ограничение интервала результатов: текст и значения переменных в порядке следования в тексте (с номера firstNum)
+	paging func(offset int, limit int, firstNum int) (string, []interface{})
+}
+
+var (
+	oracleDialect = sqlDialect{
+		placeholder: func(num int) string { return fmt.Sprintf(":%d", num) },
+		paging: func(offset int, limit int, firstNum int) (string, []interface{}) {
+			return fmt.Sprintf("OFFSET :%d ROWS FETCH NEXT :%d ROWS ONLY", firstNum, firstNum+1), []interface{}{offset, limit}
+		},
+	}
+	postgresDialect = sqlDialect{
+		placeholder: func(num int) string { return fmt.Sprintf("$%d", num) },
+		paging: func(offset int, limit int, firstNum int) (string, []interface{}) {
+			return fmt.Sprintf("LIMIT $%d OFFSET $%d", firstNum, firstNum+1), []interface{}{limit, offset}
+		},
+	}
+	sqliteDialect = sqlDialect{
+		placeholder: func(num int) string { return "?" },
+		paging: func(offset int, limit int, firstNum int) (string, []interface{}) {
+			return "LIMIT ? OFFSET ?", []interface{}{limit, offset}
+		},
+	}
+)
+
+// текст условий поиска и значения привязанных переменных
+func (d sqlDialect) where(q LogQuery) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, val interface{}) {
+		args = append(args, val)
+		conds = append(conds, fmt.Sprintf(cond, d.placeholder(len(args))))
+	}
+
+	if q.From != "" {
+		add("DateTime >= %s", q.From)
+	}
+	if q.To != "" {
+		add("DateTime <= %s", q.To)
+	}
+	if q.ControllerIP != "" {
+		add("CntrlIP = %s", q.ControllerIP)
+	}
+	if q.ChannelID != nil {
+		add("DaemonID = %s", int64(*q.ChannelID))
+	}
+	if q.LocalName != "" {
+		add("LocalName = %s", q.LocalName)
+	}
+	if q.RemoteName != "" {
+		add("RemoteName = %s", q.RemoteName)
+	}
+	if len(q.Severities) > 0 {
+		sevConds := make([]string, 0, len(q.Severities))
+		for _, val := range q.Severities {
+			args = append(args, val)
+			sevConds = append(sevConds, "Severity = "+d.placeholder(len(args)))
+		}
+		conds = append(conds, "("+strings.Join(sevConds, " OR ")+")")
+	}
+	if q.FmtpType != "" {
+		add("FmtpType = %s", q.FmtpType)
+	}
+	if q.Direction != "" {
+		add("Direction = %s", q.Direction)
+	}
+	if q.Text != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q.Text)
+		add(`UPPER(Text) LIKE UPPER(%s) ESCAPE '\'`, "%"+escaped+"%")
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// таблица поиска
+func (q LogQuery) tableName() string {
+	if q.Table == QueryTableOnline {
+		return onlineLogTableName
+	}
+	return storageLogTableName
+}
+
+// сортировка результатов (по столбцу из SortColumns, затем по порядку записи)
+func (q LogQuery) orderBy() string {
+	column := "DateTime"
+	for _, val := range SortColumns {
+		if strings.EqualFold(val, q.SortBy) {
+			column = val
+			break
+		}
+	}
+	direction := "ASC"
+	if q.SortDesc {
+		direction = "DESC"
+	}
+	return fmt.Sprintf(" ORDER BY %[1]s %[2]s, LogId %[2]s", column, direction)
+}
+
+// поиск логов в БД db
+func queryLogs(ctx context.Context, db *sql.DB, d sqlDialect, q LogQuery) (LogPage, error) {
+	var retValue LogPage
+	where, args := d.where(q)
+
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+q.tableName()+where, args...).Scan(&retValue.Total); err != nil {
+		return retValue, err
+	}
+	if retValue.Total == 0 || q.Limit <= 0 || q.Offset >= retValue.Total {
+		return retValue, nil
+	}
+
+	paging, pagingArgs := d.paging(q.Offset, q.Limit, len(args)+1)
+	rows, err := db.QueryContext(ctx, "SELECT "+logColumns+" FROM "+q.tableName()+where+q.orderBy()+" "+paging,
+		append(args, pagingArgs...)...)
+	if err != nil {
+		return retValue, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cntrlIP, locName, remName, dataType, source, fmtpType, direction sql.NullString
+		var channelID sql.NullInt64
+		var msg fmtp_log.LogMessage
+		if err = rows.Scan(&cntrlIP, &channelID, &locName, &remName, &dataType, &source, &msg.Severity,
+			&fmtpType, &direction, &msg.DateTime, &msg.Text); err != nil {
+			return retValue, err
+		}
+		msg.ControllerIP = cntrlIP.String
+		msg.ChannelId = int(channelID.Int64)
+		msg.ChannelLocName = locName.String
+		msg.ChannelRemName = remName.String
+		msg.DataType = dataType.String
+		msg.Source = source.String
+		msg.FmtpType = fmtpType.String
+		msg.Direction = direction.String
+		retValue.Logs = append(retValue.Logs, msg)
+	}
+	return retValue, rows.Err()
+}
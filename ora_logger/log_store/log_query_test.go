@@ -0,0 +1,37 @@
+package log_store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDialectWhere(t *testing.T) {
+	channelID := 5
+	tests := []struct {
+		name     string
+		dialect  sqlDialect
+		q        LogQuery
+		wantText string
+		wantArgs []interface{}
+	}{
+		{"empty", oracleDialect, LogQuery{}, "", nil},
+		{"oracle interval", oracleDialect, LogQuery{From: "a", To: "b"},
+			" WHERE DateTime >= :1 AND DateTime <= :2", []interface{}{"a", "b"}},
+		{"postgres channel and severities", postgresDialect, LogQuery{ChannelID: &channelID, Severities: []string{"ERROR", "WARN"}},
+			" WHERE DaemonID = $1 AND (Severity = $2 OR Severity = $3)", []interface{}{int64(5), "ERROR", "WARN"}},
+		{"sqlite names", sqliteDialect, LogQuery{ControllerIP: "ip", LocalName: "loc", RemoteName: "rem", FmtpType: "t", Direction: "d"},
+			" WHERE CntrlIP = ? AND LocalName = ? AND RemoteName = ? AND FmtpType = ? AND Direction = ?",
+			[]interface{}{"ip", "loc", "rem", "t", "d"}},
+		{"text escaped", postgresDialect, LogQuery{Text: `50%_a\b`},
+			` WHERE UPPER(Text) LIKE UPPER($1) ESCAPE '\'`, []interface{}{`%50\%\_a\\b%`}},
+	}
+	for _, tt := range tests {
+		text, args := tt.dialect.where(tt.q)
+		if text != tt.wantText {
+			t.Fatalf("%s: where %q, want %q", tt.name, text, tt.wantText)
+		}
+		if !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Fatalf("%s: args %v, want %v", tt.name, args, tt.wantArgs)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package log_store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"fmtp/fmtp_log"
+)
+
+// типы хранилищ логов
+const (
+	StoreOracle   = "oracle"
+	StorePostgres = "postgres"
+	StoreSQLite   = "sqlite"
+)
+
+// StoreTypes поддерживаемые типы хранилищ логов
+var StoreTypes = []string{StoreOracle, StorePostgres, StoreSQLite}
+
+const (
+	onlineLogTableName  = "fmtp_online"  // последние логи (для оперативного просмотра)
+	storageLogTableName = "fmtp_storage" // все логи за время хранения
+
+	// формат времени для сравнения со временем лога (логи хранятся строкой в формате fmtp_log.LogTimeFormat)
+	timeFormat = "2006-01-02 15:04:05"
+)
+
+// таблицы, в которые записываются логи
+var logTableNames = []string{onlineLogTableName, storageLogTableName}
+
+// LogStore хранилище логов.
+// Методы вызываются из одной горутины (подпрограммы выполнения запросов контроллера), кроме Close и Query.
+type LogStore interface {
+	// Open подключение к хранилищу и обновление схемы БД
+	Open() error
+	// Close отключение от хранилища
+	Close()
+	// InsertBatch запись логов во все таблицы (одной транзакцией)
+	InsertBatch(logMsgs []fmtp_log.LogMessage) error
+	// EnforceCount удаление самых старых логов сверх заданного кол-ва
+	EnforceCount(maxOnlineCount int, maxStorageCount int) error
+	// EnforceRetention удаление логов, сформированных раньше oldest
+	EnforceRetention(oldest time.Time) error
+	// Health проверка подключения к хранилищу
+	Health() error
+	// Query поиск логов (может выполняться одновременно из нескольких горутин)
+	Query(ctx context.Context, q LogQuery) (LogPage, error)
+	// IsConnError признак ошибки, связанной с потерей подключения (остальные ошибки относятся к запросу)
+	IsConnError(err error) bool
+}
+
+// Settings настройки подключения к хранилищу логов
+type Settings struct {
+	Type        string // тип хранилища (StoreTypes)
+	Hostname    string // адрес/название хоста (oracle, postgres)
+	Port        int    // порт подключения к БД (oracle, postgres)
+	ServiceName string // название сервиса (oracle) или БД (postgres)
+	UserName    string // пользователь БД (oracle, postgres)
+	Password    string // пароль для подключения к БД (oracle, postgres)
+	Path        string // путь к файлу БД (sqlite)
+}
+
+// NewLogStore хранилище логов по типу, заданному в настройках
+func NewLogStore(setts Settings) (LogStore, error) {
+	switch setts.Type {
+	case StoreOracle, "":
+		return newOracleStore(setts), nil
+	case StorePostgres:
+		return newPostgresStore(setts), nil
+	case StoreSQLite:
+		return newSQLiteStore(setts), nil
+	}
+	return nil, fmt.Errorf("неизвестный тип хранилища логов: %q (допустимые значения: %s)", setts.Type, strings.Join(StoreTypes, ", "))
+}
+
+// значения столбцов лога в порядке logColumns
+func logValues(msg fmtp_log.LogMessage) []interface{} {
+	return []interface{}{msg.ControllerIP, int64(msg.ChannelId), msg.ChannelLocName, msg.ChannelRemName, msg.DataType,
+		msg.Source, msg.Severity, msg.FmtpType, msg.Direction, msg.DateTime, msg.Text}
+}
+
+// столбцы таблиц логов, заполняемые при записи
+const logColumns = "CntrlIP, DaemonID, LocalName, RemoteName, DataType, Source, Severity, FmtpType, Direction, DateTime, Text"
+
+// запись логов построчно подготовленными запросами insertQueries (по запросу на таблицу) одной транзакцией
+func insertRows(db *sql.DB, insertQueries []string, logMsgs []fmtp_log.LogMessage) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, query := range insertQueries {
+		stmt, errPrep := tx.Prepare(query)
+		if errPrep != nil {
+			tx.Rollback()
+			return errPrep
+		}
+		for _, val := range logMsgs {
+			if _, err = stmt.Exec(logValues(val)...); err != nil {
+				stmt.Close()
+				tx.Rollback()
+				return err
+			}
+		}
+		stmt.Close()
+	}
+	return tx.Commit()
+}
+
+// признак ошибки подключения, общий для всех драйверов
+func isCommonConnError(err error, connErrTexts ...string) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	errText := err.Error()
+	for _, val := range append([]string{"database is closed"}, connErrTexts...) {
+		if strings.Contains(errText, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// текущее время в формате времени логов (для служебных записей)
+func nowString() string {
+	return time.Now().UTC().Format(fmtp_log.LogTimeFormat)
+}
@@ -0,0 +1,72 @@
+package log_store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"lemz.com/fdps/logger"
+)
+
+// таблица версий схемы БД хранилища логов
+const migrationsTableName = "fmtp_log_migrations"
+
+// migration изменение схемы БД. Запросы и сохранение версии выполняются одной транзакцией
+// (в Oracle DDL запросы фиксируются сразу, поэтому запросы изменений должны допускать повторное выполнение)
+type migration struct {
+	version     int
+	description string
+	queries     []string
+}
+
+// migrator параметры обновления схемы БД, зависящие от типа БД
+type migrator struct {
+	createTableQuery string      // запрос создания таблицы версий (если отсутствует)
+	versionQuery     string      // запрос текущей версии схемы
+	saveQuery        string      // запрос сохранения версии схемы (параметры: версия, описание, время)
+	migrations       []migration // изменения схемы в порядке версий
+}
+
+// run выполнение изменений схемы с версией больше текущей
+func (m migrator) run(db *sql.DB, storeType string) error {
+	if _, err := db.Exec(m.createTableQuery); err != nil {
+		return fmt.Errorf("ошибка создания таблицы версий схемы БД: %v", err)
+	}
+
+	var curVersion sql.NullInt64
+	if err := db.QueryRow(m.versionQuery).Scan(&curVersion); err != nil {
+		return fmt.Errorf("ошибка чтения версии схемы БД: %v", err)
+	}
+
+	for _, val := range m.migrations {
+		if int64(val.version) <= curVersion.Int64 {
+			continue
+		}
+		if err := m.apply(db, val); err != nil {
+			return err
+		}
+		logger.PrintfInfo("Схема БД хранилища логов (%s) обновлена до версии %d: %s.", storeType, val.version, val.description)
+	}
+	return nil
+}
+
+// выполнение изменения схемы одной транзакцией (при ошибке схема остается в предыдущей версии)
+func (m migrator) apply(db *sql.DB, mgr migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка обновления схемы БД до версии %d (%s): %v", mgr.version, mgr.description, err)
+	}
+	for _, query := range mgr.queries {
+		if _, err = tx.Exec(query); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("ошибка обновления схемы БД до версии %d (%s): %v", mgr.version, mgr.description, err)
+		}
+	}
+	if _, err = tx.Exec(m.saveQuery, mgr.version, mgr.description, nowString()); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("ошибка сохранения версии схемы БД %d: %v", mgr.version, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка сохранения версии схемы БД %d: %v", mgr.version, err)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package log_store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/godror/godror"
+
+	"fmtp/fmtp_log"
+)
+
+// oracleStore хранилище логов в БД Oracle (процедуры обслуживания в пакете LOG_PROC_PKG)
+type oracleStore struct {
+	setts       Settings
+	db          *sql.DB
+	insertStmts []*sql.Stmt // подготовленные запросы записи логов (по запросу на таблицу)
+}
+
+func newOracleStore(setts Settings) *oracleStore {
+	return &oracleStore{setts: setts}
+}
+
+// строка подключения к БД в формате
+// user/pass@(DESCRIPTION=(ADDRESS_LIST=(ADDRESS=(PROTOCOL=tcp)(HOST=hostname)(PORT=port)))(CONNECT_DATA=(SERVICE_NAME=sn)))
+func (s *oracleStore) connString() string {
+	return s.setts.UserName + "/" +
+		s.setts.Password + "@" +
+		"(DESCRIPTION=(ADDRESS_LIST=(ADDRESS=(PROTOCOL=tcp)(HOST=" + s.setts.Hostname +
+		")(PORT=" + strconv.Itoa(s.setts.Port) +
+		")))(CONNECT_DATA=(SERVICE_NAME=" + s.setts.ServiceName + ")))"
+}
+
+func (s *oracleStore) Open() error {
+	var err error
+	if s.db, err = sql.Open("godror", s.connString()); err != nil {
+		return err
+	}
+	if err = s.db.Ping(); err != nil {
+		s.Close()
+		return err
+	}
+	if err = oracleMigrator.run(s.db, StoreOracle); err != nil {
+		s.Close()
+		return err
+	}
+
+	// запросы записи логов разбираются БД один раз на подключение
+	for _, val := range logTableNames {
+		stmt, errPrep := s.db.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (:1, :2, :3, :4, :5, :6, :7, :8, :9, :10, :11)", val, logColumns))
+		if errPrep != nil {
+			s.Close()
+			return errPrep
+		}
+		s.insertStmts = append(s.insertStmts, stmt)
+	}
+	return nil
+}
+
+func (s *oracleStore) Close() {
+	for _, val := range s.insertStmts {
+		val.Close()
+	}
+	s.insertStmts = nil
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+// InsertBatch значения передаются массивами привязанных переменных (по массиву на столбец)
+func (s *oracleStore) InsertBatch(logMsgs []fmtp_log.LogMessage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	args := oracleInsertArgs(logMsgs)
+	for _, val := range s.insertStmts {
+		if _, err = tx.Stmt(val).Exec(args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *oracleStore) EnforceCount(maxOnlineCount int, maxStorageCount int) error {
+	_, err := s.db.Exec("BEGIN LOG_PROC_PKG.CHECK_LOG_COUNT(:1, :2); COMMIT; END;", maxOnlineCount, maxStorageCount)
+	return err
+}
+
+// EnforceRetention процедура пакета LOG_PROC_PKG удаляет только логи fmtp_storage (пакет мог быть создан скриптами pl_sql),
+// логи fmtp_online удаляются отдельным запросом
+func (s *oracleStore) EnforceRetention(oldest time.Time) error {
+	_, err := s.db.Exec("BEGIN LOG_PROC_PKG.CHECK_LOG_LIFETIME(:1); DELETE FROM "+onlineLogTableName+" WHERE DateTime < :2; COMMIT; END;",
+		oldest.Format(timeFormat), oldest.Format(timeFormat))
+	return err
+}
+
+func (s *oracleStore) Health() error {
+	_, err := s.db.Exec("SELECT 'heartbeat' FROM dual")
+	return err
+}
+
+func (s *oracleStore) Query(ctx context.Context, q LogQuery) (LogPage, error) {
+	return queryLogs(ctx, s.db, oracleDialect, q)
+}
+
+func (s *oracleStore) IsConnError(err error) bool {
+	return isCommonConnError(err, "server is not accepting clients",
+		"ORA-03113", "ORA-03114", "ORA-03135", "ORA-12514", "ORA-12541", "ORA-12537", "ORA-01012")
+}
+
+// значения столбцов для запроса добавления логов (массив значений на каждый столбец)
+func oracleInsertArgs(logMsgs []fmtp_log.LogMessage) []interface{} {
+	count := len(logMsgs)
+	var (
+		cntrlIPs    = make([]string, count)
+		channelIDs  = make([]int64, count)
+		localNames  = make([]string, count)
+		remoteNames = make([]string, count)
+		dataTypes   = make([]string, count)
+		sources     = make([]string, count)
+		severities  = make([]string, count)
+		fmtpTypes   = make([]string, count)
+		directions  = make([]string, count)
+		dateTimes   = make([]string, count)
+		texts       = make([]string, count)
+	)
+	for idx, val := range logMsgs {
+		cntrlIPs[idx] = val.ControllerIP
+		channelIDs[idx] = int64(val.ChannelId)
+		localNames[idx] = val.ChannelLocName
+		remoteNames[idx] = val.ChannelRemName
+		dataTypes[idx] = val.DataType
+		sources[idx] = val.Source
+		severities[idx] = val.Severity
+		fmtpTypes[idx] = val.FmtpType
+		directions[idx] = val.Direction
+		dateTimes[idx] = val.DateTime
+		texts[idx] = val.Text
+	}
+	return []interface{}{cntrlIPs, channelIDs, localNames, remoteNames, dataTypes, sources, severities,
+		fmtpTypes, directions, dateTimes, texts}
+}
+
+// PL/SQL блок создания объекта схемы, если объект с таким типом и названием отсутствует.
+// В Oracle нет CREATE ... IF NOT EXISTS, а схема могла быть создана ранее скриптами pl_sql/fmtp_log_schema
+func oracleCreateIfAbsent(objType string, objName string, ddl string) string {
+	return fmt.Sprintf(`DECLARE cnt NUMBER;
+	BEGIN
+		SELECT COUNT(*) INTO cnt FROM user_objects WHERE object_type = '%s' AND object_name = '%s';
+		IF cnt = 0 THEN
+			EXECUTE IMMEDIATE '%s';
+		END IF;
+	END;`, objType, strings.ToUpper(objName), strings.ReplaceAll(ddl, "'", "''"))
+}
+
+// запросы создания таблицы логов tableName с последовательностью и триггером для идентификатора
+func oracleLogTableQueries(tableName string) []string {
+	return []string{
+		oracleCreateIfAbsent("TABLE", tableName, fmt.Sprintf(`CREATE TABLE %[1]s
+			( LogId NUMBER NOT NULL,
+			CntrlIP NVARCHAR2(15),
+			DaemonID NUMBER,
+			LocalName NVARCHAR2(10),
+			RemoteName NVARCHAR2(10),
+			DataType NVARCHAR2(15),
+			Source NVARCHAR2(15),
+			Severity NVARCHAR2(15) NOT NULL,
+			FmtpType NVARCHAR2(15),
+			Direction NVARCHAR2(15),
+			DateTime NVARCHAR2(30) NOT NULL,
+			Text NVARCHAR2(2000) NOT NULL,
+			CONSTRAINT %[1]s_PK PRIMARY KEY(LogId))`, tableName)),
+		oracleCreateIfAbsent("SEQUENCE", tableName+"_ID_SEQ",
+			fmt.Sprintf("CREATE SEQUENCE %s_ID_SEQ START WITH 1 NOCACHE ORDER", tableName)),
+		fmt.Sprintf(`CREATE OR REPLACE TRIGGER %[1]s_ID_TRG BEFORE
+			INSERT ON %[1]s
+			FOR EACH ROW
+			WHEN(NEW.LOGID IS NULL)
+			BEGIN
+			:NEW.LOGID := %[1]s_ID_SEQ.NEXTVAL;
+			END;`, tableName),
+		fmt.Sprintf(`CREATE OR REPLACE VIEW %[1]s_vw AS SELECT
+			CntrlIP as cntrlip,
+			DaemonID as daemonid,
+			DataType as datatype,
+			LocalName as localname,
+			RemoteName as remotename,
+			Direction as direction,
+			FmtpType as fmtptype,
+			Severity as severity,
+			Source as source,
+			DateTime as datetime,
+			Text as text
+			from %[1]s`, tableName),
+	}
+}
+
+// пакет процедур обслуживания таблиц логов создается только при отсутствии
+// (пакет, созданный скриптом pl_sql/fmtp_log_schema, содержит также процедуры для схемы fdps)
+var oracleLogProcPkgQueries = []string{
+	oracleCreateIfAbsent("PACKAGE", "LOG_PROC_PKG", `CREATE PACKAGE LOG_PROC_PKG AS
+		procedure check_log_count( max_online_log_count in number, max_storage_log_count in number );
+		procedure check_log_lifetime( oldest_storage_log_date in fmtp_storage.datetime%type );
+	END;`),
+	oracleCreateIfAbsent("PACKAGE BODY", "LOG_PROC_PKG", `CREATE PACKAGE BODY LOG_PROC_PKG AS
+		procedure check_log_count( max_online_log_count in number, max_storage_log_count in number )
+		as
+			cur_online_log_count number;
+			cur_storage_log_count number;
+			min_online_log_id number;
+			min_storage_log_id number;
+		begin
+			select count(*) into cur_online_log_count from fmtp_online;
+			if cur_online_log_count > max_online_log_count then
+				select min(logid) into min_online_log_id from fmtp_online;
+				delete from fmtp_online where logid < (min_online_log_id + cur_online_log_count - max_online_log_count);
+			end if;
+			select count(*) into cur_storage_log_count from fmtp_storage;
+			if cur_storage_log_count > max_storage_log_count then
+				select min(logid) into min_storage_log_id from fmtp_storage;
+				delete from fmtp_storage where logid < (min_storage_log_id + cur_storage_log_count - max_storage_log_count);
+			end if;
+		end check_log_count;
+
+		procedure check_log_lifetime( oldest_storage_log_date in fmtp_storage.datetime%type )
+		as
+		begin
+			delete from fmtp_storage where datetime < oldest_storage_log_date;
+		end check_log_lifetime;
+	END;`),
+}
+
+var oracleMigrator = migrator{
+	createTableQuery: oracleCreateIfAbsent("TABLE", migrationsTableName, fmt.Sprintf(`CREATE TABLE %[1]s
+		( Version NUMBER NOT NULL,
+		Description NVARCHAR2(200),
+		AppliedAt NVARCHAR2(30),
+		CONSTRAINT %[1]s_PK PRIMARY KEY(Version))`, migrationsTableName)),
+	versionQuery: "SELECT MAX(Version) FROM " + migrationsTableName,
+	saveQuery:    "INSERT INTO " + migrationsTableName + " (Version, Description, AppliedAt) VALUES (:1, :2, :3)",
+	migrations: []migration{
+		{
+			version:     1,
+			description: "таблицы логов и пакет LOG_PROC_PKG",
+			queries: append(append(oracleLogTableQueries(onlineLogTableName),
+				oracleLogTableQueries(storageLogTableName)...), oracleLogProcPkgQueries...),
+		},
+	},
+}
@@ -0,0 +1,144 @@
+package log_store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"fmtp/fmtp_log"
+)
+
+// postgresStore хранилище логов в БД PostgreSQL
+type postgresStore struct {
+	setts Settings
+	db    *sql.DB
+}
+
+func newPostgresStore(setts Settings) *postgresStore {
+	return &postgresStore{setts: setts}
+}
+
+// строка подключения к БД в формате key=value (значения экранируются)
+func (s *postgresStore) connString() string {
+	quote := func(val string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(val) + "'"
+	}
+	return fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=disable connect_timeout=10",
+		quote(s.setts.Hostname), s.setts.Port, quote(s.setts.ServiceName), quote(s.setts.UserName), quote(s.setts.Password))
+}
+
+func (s *postgresStore) Open() error {
+	var err error
+	if s.db, err = sql.Open("postgres", s.connString()); err != nil {
+		return err
+	}
+	if err = s.db.Ping(); err != nil {
+		s.Close()
+		return err
+	}
+	if err = postgresMigrator.run(s.db, StorePostgres); err != nil {
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+func (s *postgresStore) Close() {
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+func (s *postgresStore) InsertBatch(logMsgs []fmtp_log.LogMessage) error {
+	insertQueries := make([]string, 0, len(logTableNames))
+	for _, val := range logTableNames {
+		insertQueries = append(insertQueries,
+			fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)", val, logColumns))
+	}
+	return insertRows(s.db, insertQueries, logMsgs)
+}
+
+func (s *postgresStore) EnforceCount(maxOnlineCount int, maxStorageCount int) error {
+	for tableName, maxCount := range map[string]int{onlineLogTableName: maxOnlineCount, storageLogTableName: maxStorageCount} {
+		if _, err := s.db.Exec(fmt.Sprintf(
+			"DELETE FROM %[1]s WHERE LogId <= (SELECT LogId FROM %[1]s ORDER BY LogId DESC OFFSET $1 LIMIT 1)", tableName), maxCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *postgresStore) EnforceRetention(oldest time.Time) error {
+	for _, val := range logTableNames {
+		if _, err := s.db.Exec("DELETE FROM "+val+" WHERE DateTime < $1", oldest.Format(timeFormat)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *postgresStore) Health() error {
+	return s.db.Ping()
+}
+
+func (s *postgresStore) Query(ctx context.Context, q LogQuery) (LogPage, error) {
+	return queryLogs(ctx, s.db, postgresDialect, q)
+}
+
+func (s *postgresStore) IsConnError(err error) bool {
+	// класс 08 - ошибки подключения, 57P - сервер останавливается
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code.Class() == "08" || strings.HasPrefix(string(pqErr.Code), "57P")
+	}
+	return isCommonConnError(err, "connection refused", "connection reset", "broken pipe", "EOF", "i/o timeout")
+}
+
+// запросы создания таблицы логов tableName
+func postgresLogTableQueries(tableName string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+			( LogId BIGSERIAL PRIMARY KEY,
+			CntrlIP VARCHAR(15),
+			DaemonID BIGINT,
+			LocalName VARCHAR(10),
+			RemoteName VARCHAR(10),
+			DataType VARCHAR(15),
+			Source VARCHAR(15),
+			Severity VARCHAR(15) NOT NULL,
+			FmtpType VARCHAR(15),
+			Direction VARCHAR(15),
+			DateTime VARCHAR(30) NOT NULL,
+			Text VARCHAR(2000) NOT NULL)`, tableName),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_datetime_idx ON %[1]s (DateTime)", tableName),
+	}
+}
+
+var postgresMigrator = migrator{
+	createTableQuery: `CREATE TABLE IF NOT EXISTS ` + migrationsTableName + `
+		( Version INTEGER PRIMARY KEY,
+		Description VARCHAR(200),
+		AppliedAt VARCHAR(30))`,
+	versionQuery: "SELECT MAX(Version) FROM " + migrationsTableName,
+	saveQuery:    "INSERT INTO " + migrationsTableName + " (Version, Description, AppliedAt) VALUES ($1, $2, $3)",
+	migrations: []migration{
+		{
+			version:     1,
+			description: "таблицы логов",
+			queries:     append(postgresLogTableQueries(onlineLogTableName), postgresLogTableQueries(storageLogTableName)...),
+		},
+		{
+			version:     2,
+			description: "текст лога без ограничения длины",
+			queries: []string{
+				"ALTER TABLE " + onlineLogTableName + " ALTER COLUMN Text TYPE TEXT",
+				"ALTER TABLE " + storageLogTableName + " ALTER COLUMN Text TYPE TEXT",
+			},
+		},
+	},
+}
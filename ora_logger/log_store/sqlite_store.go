@@ -0,0 +1,153 @@
+package log_store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"fmtp/fmtp_log"
+)
+
+// макс. кол-во подключений для поиска логов
+const sqliteMaxReadConns = 4
+
+// sqliteStore хранилище логов во встроенной БД SQLite (файл на диске логгера).
+// Запись выполняется одним подключением, поиск - отдельными подключениями только для чтения
+// (в режиме WAL чтение не ожидает завершения записи)
+type sqliteStore struct {
+	setts  Settings
+	db     *sql.DB // подключение для записи
+	readDB *sql.DB // подключения для поиска логов
+}
+
+func newSQLiteStore(setts Settings) *sqliteStore {
+	return &sqliteStore{setts: setts}
+}
+
+// строка подключения: журнал WAL и ожидание снятия блокировки файла другим процессом
+func (s *sqliteStore) connString() string {
+	return "file:" + s.setts.Path + "?_journal_mode=WAL&_busy_timeout=5000"
+}
+
+func (s *sqliteStore) Open() error {
+	if s.setts.Path == "" {
+		return fmt.Errorf("не задан путь к файлу БД SQLite")
+	}
+	if err := os.MkdirAll(filepath.Dir(s.setts.Path), 0755); err != nil {
+		return err
+	}
+
+	var err error
+	if s.db, err = sql.Open("sqlite3", s.connString()); err != nil {
+		return err
+	}
+	// запись в файл БД выполняется одним подключением
+	s.db.SetMaxOpenConns(1)
+
+	if err = s.db.Ping(); err != nil {
+		s.Close()
+		return err
+	}
+	if err = sqliteMigrator.run(s.db, StoreSQLite); err != nil {
+		s.Close()
+		return err
+	}
+
+	if s.readDB, err = sql.Open("sqlite3", s.connString()+"&mode=ro"); err != nil {
+		s.Close()
+		return err
+	}
+	s.readDB.SetMaxOpenConns(sqliteMaxReadConns)
+	return nil
+}
+
+func (s *sqliteStore) Close() {
+	if s.readDB != nil {
+		s.readDB.Close()
+	}
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+func (s *sqliteStore) InsertBatch(logMsgs []fmtp_log.LogMessage) error {
+	insertQueries := make([]string, 0, len(logTableNames))
+	for _, val := range logTableNames {
+		insertQueries = append(insertQueries,
+			fmt.Sprintf("INSERT INTO %s (%s) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", val, logColumns))
+	}
+	return insertRows(s.db, insertQueries, logMsgs)
+}
+
+func (s *sqliteStore) EnforceCount(maxOnlineCount int, maxStorageCount int) error {
+	for tableName, maxCount := range map[string]int{onlineLogTableName: maxOnlineCount, storageLogTableName: maxStorageCount} {
+		if _, err := s.db.Exec(fmt.Sprintf(
+			"DELETE FROM %[1]s WHERE LogId <= (SELECT LogId FROM %[1]s ORDER BY LogId DESC LIMIT 1 OFFSET ?)", tableName), maxCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) EnforceRetention(oldest time.Time) error {
+	for _, val := range logTableNames {
+		if _, err := s.db.Exec("DELETE FROM "+val+" WHERE DateTime < ?", oldest.Format(timeFormat)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) Health() error {
+	_, err := s.db.Exec("SELECT 1")
+	return err
+}
+
+func (s *sqliteStore) Query(ctx context.Context, q LogQuery) (LogPage, error) {
+	return queryLogs(ctx, s.readDB, sqliteDialect, q)
+}
+
+func (s *sqliteStore) IsConnError(err error) bool {
+	return isCommonConnError(err, "unable to open database file", "disk I/O error")
+}
+
+// запросы создания таблицы логов tableName
+func sqliteLogTableQueries(tableName string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+			( LogId INTEGER PRIMARY KEY AUTOINCREMENT,
+			CntrlIP TEXT,
+			DaemonID INTEGER,
+			LocalName TEXT,
+			RemoteName TEXT,
+			DataType TEXT,
+			Source TEXT,
+			Severity TEXT NOT NULL,
+			FmtpType TEXT,
+			Direction TEXT,
+			DateTime TEXT NOT NULL,
+			Text TEXT NOT NULL)`, tableName),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %[1]s_datetime_idx ON %[1]s (DateTime)", tableName),
+	}
+}
+
+var sqliteMigrator = migrator{
+	createTableQuery: `CREATE TABLE IF NOT EXISTS ` + migrationsTableName + `
+		( Version INTEGER PRIMARY KEY,
+		Description TEXT,
+		AppliedAt TEXT)`,
+	versionQuery: "SELECT MAX(Version) FROM " + migrationsTableName,
+	saveQuery:    "INSERT INTO " + migrationsTableName + " (Version, Description, AppliedAt) VALUES (?, ?, ?)",
+	migrations: []migration{
+		{
+			version:     1,
+			description: "таблицы логов",
+			queries:     append(sqliteLogTableQueries(onlineLogTableName), sqliteLogTableQueries(storageLogTableName)...),
+		},
+	},
+}
@@ -0,0 +1,104 @@
+package log_store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fmtp/fmtp_log"
+)
+
+func openSQLite(t *testing.T, path string) *sqliteStore {
+	t.Helper()
+	store := newSQLiteStore(Settings{Type: StoreSQLite, Path: path})
+	if err := store.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func testLog(dateTime time.Time, text string) fmtp_log.LogMessage {
+	return fmtp_log.LogMessage{Severity: fmtp_log.SeverityInfo, DateTime: dateTime.Format(fmtp_log.LogTimeFormat), Text: text}
+}
+
+func TestSQLiteRetention(t *testing.T) {
+	store := openSQLite(t, filepath.Join(t.TempDir(), "logs.db"))
+	now := time.Now().UTC()
+
+	if err := store.InsertBatch([]fmtp_log.LogMessage{testLog(now.Add(-48*time.Hour), "old"), testLog(now, "new")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.EnforceRetention(now.Add(-24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{QueryTableOnline, QueryTableStorage} {
+		page, err := store.Query(context.Background(), LogQuery{Table: table, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 1 || page.Logs[0].Text != "new" {
+			t.Fatalf("%s: %d logs after retention, want the new one", table, page.Total)
+		}
+	}
+}
+
+func TestSQLiteQueryDuringWrite(t *testing.T) {
+	store := openSQLite(t, filepath.Join(t.TempDir(), "logs.db"))
+	if err := store.InsertBatch([]fmtp_log.LogMessage{testLog(time.Now().UTC(), "first")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// search is not queued behind an open write transaction
+	tx, err := store.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("INSERT INTO "+onlineLogTableName+" ("+logColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		logValues(testLog(time.Now().UTC(), "second"))...); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	page, err := store.Query(ctx, LogQuery{Table: QueryTableOnline, Limit: 10})
+	if err != nil {
+		t.Fatalf("query during write: %v", err)
+	}
+	if page.Total != 1 {
+		t.Fatalf("%d logs visible, want committed one", page.Total)
+	}
+}
+
+func TestMigrationRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs.db")
+	store := openSQLite(t, path)
+
+	bad := sqliteMigrator
+	bad.migrations = append(append([]migration(nil), sqliteMigrator.migrations...), migration{
+		version:     100,
+		description: "bad",
+		queries:     []string{"CREATE TABLE half_done (Id INTEGER)", "CREATE TABLE broken ("},
+	})
+	if err := bad.run(store.db, StoreSQLite); err == nil {
+		t.Fatalf("bad migration applied")
+	}
+
+	var tables int
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'").Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	var version int
+	if err := store.db.QueryRow(sqliteMigrator.versionQuery).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 || version != len(sqliteMigrator.migrations) {
+		t.Fatalf("failed migration left %d tables, version %d", tables, version)
+	}
+
+	// reopening applies nothing
+	store.Close()
+	openSQLite(t, path)
+}
@@ -0,0 +1,225 @@
+package log_web
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"lemz.com/fdps/logger"
+
+	"fmtp/ora_logger/log_store"
+)
+
+// пути web сервера поиска логов
+const (
+	searchPagePath = "/logs"
+	apiQueryPath   = "/logs/api/query"
+	apiExportPath  = "/logs/api/export"
+)
+
+const (
+	queryTimeout    = 30 * time.Second // макс. время выполнения запроса поиска
+	shutdownTimeout = 5 * time.Second  // время ожидания завершения запросов при остановке сервера
+	restartInterval = 10 * time.Second // период повторного запуска web сервера после ошибки
+)
+
+// errNoStore хранилище логов не задано в настройках
+var errNoStore = errors.New("хранилище логов не задано")
+
+// LogWebCntrl контроллер web сервера поиска логов.
+// Для поиска используется отдельное подключение к хранилищу, чтобы поиск не задерживал запись логов
+type LogWebCntrl struct {
+	sync.Mutex
+
+	SettsChan chan LogWebSettings // канал приема новых настроек контроллера
+
+	curSetts LogWebSettings
+	server   *http.Server       // запущенный web сервер (nil - сервер остановлен или завершен с ошибкой)
+	store    log_store.LogStore // подключение к хранилищу (открывается при первом запросе)
+
+	restartTicker *time.Ticker
+
+	searchPage *SearchPage
+}
+
+func NewLogWebCntrl() *LogWebCntrl {
+	return &LogWebCntrl{
+		SettsChan:     make(chan LogWebSettings, 1),
+		searchPage:    new(SearchPage),
+		restartTicker: time.NewTicker(restartInterval),
+	}
+}
+
+func (c *LogWebCntrl) Run() {
+	c.searchPage.initialize("FDPS-FMTP-LOGGER-SEARCH")
+
+	for {
+		select {
+
+		case newSettings := <-c.SettsChan:
+			c.Lock()
+			if c.curSetts.Store != newSettings.Store {
+				c.closeStore()
+			}
+			isServerChanged := c.curSetts.serverChanged(newSettings) || c.server == nil
+			c.curSetts = newSettings
+			c.Unlock()
+
+			if isServerChanged {
+				c.stopServer()
+				c.startServer()
+			}
+
+		// повторный запуск web сервера после ошибки (например, порт был занят)
+		case <-c.restartTicker.C:
+			// ошибка настроек авторизации повторным запуском не исправляется
+			c.Lock()
+			isStopped := c.server == nil && !c.curSetts.missingAuth()
+			c.Unlock()
+
+			if isStopped {
+				c.startServer()
+			}
+		}
+	}
+}
+
+// запуск web сервера на адресе и порту из текущих настроек
+func (c *LogWebCntrl) startServer() {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.curSetts.Port <= 0 || c.server != nil {
+		return
+	}
+	// логи доступны без авторизации только с локального хоста
+	if c.curSetts.missingAuth() {
+		logger.PrintfErr("Web сервер поиска логов не запущен: для адреса '%s' необходимо задать пользователя и пароль (WebUser, WebPassword).",
+			c.curSetts.Address)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(searchPagePath, c.handleSearchPage)
+	mux.HandleFunc(apiQueryPath, c.handleQuery)
+	mux.HandleFunc(apiExportPath, c.handleExport)
+
+	srv := &http.Server{
+		Addr:         net.JoinHostPort(c.curSetts.Address, strconv.Itoa(c.curSetts.Port)),
+		Handler:      basicAuth(mux, c.curSetts.User, c.curSetts.Password),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 2 * queryTimeout,
+	}
+	c.server = srv
+	logger.PrintfInfo("Запуск web сервера поиска логов на адресе %s", srv.Addr)
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.PrintfErr("Ошибка работы web сервера поиска логов. Ошибка: %v", err)
+
+			// сервер будет запущен повторно
+			c.Lock()
+			if c.server == srv {
+				c.server = nil
+			}
+			c.Unlock()
+		}
+	}()
+}
+
+// остановка web сервера с ожиданием завершения выполняемых запросов
+func (c *LogWebCntrl) stopServer() {
+	c.Lock()
+	srv := c.server
+	c.server = nil
+	c.Unlock()
+
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.PrintfWarn("Ошибка остановки web сервера поиска логов. Ошибка: %v", err)
+	}
+}
+
+// basicAuth проверка пользователя и пароля запроса (при пустом пользователе проверка не выполняется)
+func basicAuth(next http.Handler, user, password string) http.Handler {
+	if user == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqUser, reqPassword, ok := r.BasicAuth()
+		if !ok || !secureEqual(reqUser, user) || !secureEqual(reqPassword, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fmtp logs", charset="UTF-8"`)
+			http.Error(w, "требуется авторизация", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// сравнение строк за время, не зависящее от совпадающей части
+func secureEqual(val, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(val), []byte(expected)) == 1
+}
+
+// поиск логов (подключение к хранилищу выполняется при необходимости)
+func (c *LogWebCntrl) queryLogs(ctx context.Context, q log_store.LogQuery) (log_store.LogPage, error) {
+	store, err := c.openStore()
+	if err != nil {
+		return log_store.LogPage{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	page, err := store.Query(ctx, q)
+	if err != nil && store.IsConnError(err) {
+		// при следующем запросе выполняется повторное подключение
+		c.Lock()
+		if c.store == store {
+			c.closeStore()
+		}
+		c.Unlock()
+	}
+	return page, err
+}
+
+// подключение к хранилищу логов из текущих настроек
+func (c *LogWebCntrl) openStore() (log_store.LogStore, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.store != nil {
+		return c.store, nil
+	}
+	if c.curSetts.Store == (log_store.Settings{}) {
+		return nil, errNoStore
+	}
+
+	store, err := log_store.NewLogStore(c.curSetts.Store)
+	if err != nil {
+		return nil, err
+	}
+	if err = store.Open(); err != nil {
+		logger.PrintfErr("Ошибка подключения к хранилищу логов для поиска. Ошибка: %v", err)
+		return nil, err
+	}
+	c.store = store
+	return c.store, nil
+}
+
+// отключение от хранилища логов (вызывается под блокировкой)
+func (c *LogWebCntrl) closeStore() {
+	if c.store != nil {
+		c.store.Close()
+		c.store = nil
+	}
+}
@@ -0,0 +1,292 @@
+package log_web
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"lemz.com/fdps/logger"
+
+	"fmtp/fmtp_log"
+	"fmtp/ora_logger/log_store"
+)
+
+const (
+	defaultPageSize = 100    // кол-во логов на странице по умолчанию
+	maxPageSize     = 1000   // макс. кол-во логов на странице
+	maxExportCount  = 100000 // макс. кол-во логов при выгрузке
+
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+)
+
+// форматы времени, принимаемые в параметрах from и to (время UTC, если зона не указана),
+// и точность задания времени в формате (окончание интервала включает всю единицу точности)
+var queryTimeLayouts = []struct {
+	layout    string
+	precision time.Duration
+}{
+	{fmtp_log.LogTimeFormat, time.Millisecond},
+	{"2006-01-02 15:04:05", time.Second},
+	{"2006-01-02 15:04", time.Minute},
+	{"2006-01-02T15:04:05.000", time.Millisecond},
+	{"2006-01-02T15:04:05", time.Second},
+	{"2006-01-02T15:04", time.Minute},
+	{time.RFC3339Nano, time.Millisecond},
+	{"2006-01-02", 24 * time.Hour},
+}
+
+// QueryResult ответ на запрос поиска логов
+type QueryResult struct {
+	Total    int                   `json:"Total"`    // общее кол-во найденных логов
+	Page     int                   `json:"Page"`     // номер страницы (с 1)
+	PageSize int                   `json:"PageSize"` // кол-во логов на странице
+	Logs     []fmtp_log.LogMessage `json:"Logs"`     // логи страницы
+}
+
+// параметры поиска из запроса (без интервала результатов)
+func parseLogQuery(values url.Values) (log_store.LogQuery, error) {
+	var retValue log_store.LogQuery
+	var err error
+
+	switch table := values.Get("table"); table {
+	case "", log_store.QueryTableStorage:
+		retValue.Table = log_store.QueryTableStorage
+	case log_store.QueryTableOnline:
+		retValue.Table = log_store.QueryTableOnline
+	default:
+		return retValue, fmt.Errorf("неизвестная таблица логов: %s", table)
+	}
+
+	if retValue.From, err = parseQueryTime(values.Get("from"), false); err != nil {
+		return retValue, fmt.Errorf("неверное начало интервала времени: %v", err)
+	}
+	if retValue.To, err = parseQueryTime(values.Get("to"), true); err != nil {
+		return retValue, fmt.Errorf("неверное окончание интервала времени: %v", err)
+	}
+
+	if channel := strings.TrimSpace(values.Get("channel")); channel != "" {
+		channelID, errConv := strconv.Atoi(channel)
+		if errConv != nil {
+			return retValue, fmt.Errorf("неверный идентификатор канала: %s", channel)
+		}
+		retValue.ChannelID = &channelID
+	}
+
+	retValue.ControllerIP = strings.TrimSpace(values.Get("controller"))
+	retValue.LocalName = strings.TrimSpace(values.Get("local"))
+	retValue.RemoteName = strings.TrimSpace(values.Get("remote"))
+	retValue.FmtpType = strings.TrimSpace(values.Get("fmtp_type"))
+	retValue.Direction = strings.TrimSpace(values.Get("direction"))
+	retValue.Text = values.Get("text")
+	for _, val := range values["severity"] {
+		if val != "" {
+			retValue.Severities = append(retValue.Severities, val)
+		}
+	}
+
+	if retValue.SortBy = values.Get("sort"); retValue.SortBy != "" {
+		isKnown := false
+		for _, val := range log_store.SortColumns {
+			if strings.EqualFold(val, retValue.SortBy) {
+				isKnown = true
+				break
+			}
+		}
+		if !isKnown {
+			return retValue, fmt.Errorf("недопустимый столбец сортировки: %s", retValue.SortBy)
+		}
+	}
+	switch order := values.Get("order"); order {
+	case "", "desc":
+		retValue.SortDesc = true
+	case "asc":
+		retValue.SortDesc = false
+	default:
+		return retValue, fmt.Errorf("неверный порядок сортировки: %s", order)
+	}
+	return retValue, nil
+}
+
+// номер страницы и кол-во логов на странице из запроса
+func parsePaging(values url.Values) (int, int, error) {
+	page, pageSize := 1, defaultPageSize
+	var err error
+
+	if val := values.Get("page"); val != "" {
+		if page, err = strconv.Atoi(val); err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("неверный номер страницы: %s", val)
+		}
+	}
+	if val := values.Get("page_size"); val != "" {
+		if pageSize, err = strconv.Atoi(val); err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return 0, 0, fmt.Errorf("неверное кол-во логов на странице: %s (допустимо 1 - %d)", val, maxPageSize)
+		}
+	}
+	return page, pageSize, nil
+}
+
+// время из параметра запроса в формате хранения логов (UTC).
+// Для окончания интервала (isEnd) время дополняется до конца единицы точности формата
+func parseQueryTime(val string, isEnd bool) (string, error) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return "", nil
+	}
+	for _, fmtVal := range queryTimeLayouts {
+		if tm, err := time.ParseInLocation(fmtVal.layout, val, time.UTC); err == nil {
+			if isEnd {
+				tm = tm.Add(fmtVal.precision - time.Millisecond)
+			}
+			return tm.UTC().Format(fmtp_log.LogTimeFormat), nil
+		}
+	}
+	return "", fmt.Errorf("формат времени не распознан: %s", val)
+}
+
+// страница результатов поиска
+func (c *LogWebCntrl) queryPage(r *http.Request) (log_store.LogQuery, QueryResult, error) {
+	var result QueryResult
+
+	q, err := parseLogQuery(r.URL.Query())
+	if err != nil {
+		return q, result, err
+	}
+	if result.Page, result.PageSize, err = parsePaging(r.URL.Query()); err != nil {
+		return q, result, err
+	}
+	q.Offset = (result.Page - 1) * result.PageSize
+	q.Limit = result.PageSize
+	return q, result, nil
+}
+
+// обработчик запроса поиска логов (ответ в формате JSON)
+func (c *LogWebCntrl) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	q, result, err := c.queryPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logPage, err := c.queryLogs(r.Context(), q)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	result.Total = logPage.Total
+	result.Logs = logPage.Logs
+	if result.Logs == nil {
+		result.Logs = []fmtp_log.LogMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		logger.PrintfWarn("Ошибка отправки результатов поиска логов. Ошибка: %v", err)
+	}
+}
+
+// обработчик запроса выгрузки найденных логов (CSV или JSON файл)
+func (c *LogWebCntrl) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseLogQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatCSV
+	}
+	if format != exportFormatCSV && format != exportFormatJSON {
+		http.Error(w, "неизвестный формат выгрузки: "+format, http.StatusBadRequest)
+		return
+	}
+	// сначала только подсчет логов, чтобы не выбирать логи при превышении ограничения выгрузки
+	q.Limit = 0
+	countPage, err := c.queryLogs(r.Context(), q)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	if countPage.Total > maxExportCount {
+		w.Header().Set("X-Total-Count", strconv.Itoa(countPage.Total))
+		http.Error(w, fmt.Sprintf("найдено %d логов, выгрузка ограничена %d логами. Уточните условия поиска",
+			countPage.Total, maxExportCount), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	q.Limit = maxExportCount
+	logPage, err := c.queryLogs(r.Context(), q)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	fileName := fmt.Sprintf("fmtp_logs_%s.%s", time.Now().UTC().Format("20060102_150405"), format)
+	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	w.Header().Set("X-Total-Count", strconv.Itoa(logPage.Total))
+
+	if format == exportFormatJSON {
+		if logPage.Logs == nil {
+			logPage.Logs = []fmtp_log.LogMessage{}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		err = json.NewEncoder(w).Encode(logPage.Logs)
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		err = writeCSV(w, logPage.Logs)
+	}
+	if err != nil {
+		logger.PrintfWarn("Ошибка выгрузки логов. Ошибка: %v", err)
+	}
+}
+
+// запись логов в формате CSV (первая строка - названия столбцов)
+func writeCSV(w io.Writer, logMsgs []fmtp_log.LogMessage) error {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Write([]string{"DateTime", "ControllerIP", "DaemonID", "LocalName", "RemoteName", "DataType",
+		"Source", "Severity", "FmtpType", "Direction", "Text"})
+	for _, val := range logMsgs {
+		csvWriter.Write([]string{val.DateTime, csvCell(val.ControllerIP), strconv.Itoa(val.ChannelId), csvCell(val.ChannelLocName),
+			csvCell(val.ChannelRemName), csvCell(val.DataType), csvCell(val.Source), csvCell(val.Severity),
+			csvCell(val.FmtpType), csvCell(val.Direction), csvCell(val.Text)})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// значение ячейки CSV. Значения, которые табличный редактор примет за формулу, предваряются апострофом
+func csvCell(val string) string {
+	if val != "" && strings.ContainsRune("=+-@\t\r", rune(val[0])) {
+		return "'" + val
+	}
+	return val
+}
+
+// ответ на запрос при ошибке поиска в хранилище
+func writeQueryError(w http.ResponseWriter, err error) {
+	logger.PrintfWarn("Ошибка поиска логов. Ошибка: %v", err)
+	http.Error(w, "ошибка поиска логов: "+err.Error(), http.StatusServiceUnavailable)
+}
+
+// обработчик страницы поиска логов
+func (c *LogWebCntrl) handleSearchPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != searchPagePath {
+		http.NotFound(w, r)
+		return
+	}
+	c.searchPage.render(w, r, c)
+}
@@ -0,0 +1,166 @@
+package log_web
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"fmtp/fmtp_log"
+	"fmtp/ora_logger/log_store"
+)
+
+func TestParseQueryTime(t *testing.T) {
+	tests := []struct {
+		val     string
+		isEnd   bool
+		want    string
+		wantErr bool
+	}{
+		{"", false, "", false},
+		{" 2024-03-01 10:20:30.123 ", false, "2024-03-01 10:20:30.123", false},
+		{"2024-03-01 10:20:30", true, "2024-03-01 10:20:30.999", false},
+		{"2024-03-01 10:20", true, "2024-03-01 10:20:59.999", false},
+		{"2024-03-01T10:20", false, "2024-03-01 10:20:00.000", false},
+		{"2024-03-01", false, "2024-03-01 00:00:00.000", false},
+		{"2024-03-01", true, "2024-03-01 23:59:59.999", false},
+		{"2024-03-01T13:20:30+03:00", false, "2024-03-01 10:20:30.000", false},
+		{"01.03.2024", false, "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseQueryTime(tt.val, tt.isEnd)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%q: error %v, want error %v", tt.val, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("%q (end %v): %q, want %q", tt.val, tt.isEnd, got, tt.want)
+		}
+	}
+}
+
+func TestParsePaging(t *testing.T) {
+	tests := []struct {
+		query        string
+		wantPage     int
+		wantPageSize int
+		wantErr      bool
+	}{
+		{"", 1, defaultPageSize, false},
+		{"page=3&page_size=50", 3, 50, false},
+		{"page_size=1000", 1, maxPageSize, false},
+		{"page=0", 0, 0, true},
+		{"page=x", 0, 0, true},
+		{"page_size=0", 0, 0, true},
+		{"page_size=1001", 0, 0, true},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		page, pageSize, err := parsePaging(values)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%q: error %v, want error %v", tt.query, err, tt.wantErr)
+		}
+		if page != tt.wantPage || pageSize != tt.wantPageSize {
+			t.Fatalf("%q: page %d size %d, want %d %d", tt.query, page, pageSize, tt.wantPage, tt.wantPageSize)
+		}
+	}
+}
+
+func TestWriteCSVEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	logs := []fmtp_log.LogMessage{
+		{DateTime: "2024-03-01 10:20:30.000", Text: "=HYPERLINK(\"x\")", Source: "+1", FmtpType: "-2", Direction: "@a"},
+		{DateTime: "2024-03-01 10:20:31.000", Text: "plain = text"},
+	}
+	if err := writeCSV(&buf, logs); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("%d lines, want 3", len(lines))
+	}
+	if want := `2024-03-01 10:20:30.000,,0,,,,'+1,,'-2,'@a,"'=HYPERLINK(""x"")"`; lines[1] != want {
+		t.Fatalf("row %q, want %q", lines[1], want)
+	}
+	if !strings.HasSuffix(lines[2], ",plain = text") {
+		t.Fatalf("row %q changed", lines[2])
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		user, password string // settings
+		reqUser        string
+		reqPassword    string
+		wantCode       int
+	}{
+		{"", "", "", "", http.StatusOK},
+		{"log", "secret", "log", "secret", http.StatusOK},
+		{"log", "secret", "log", "wrong", http.StatusUnauthorized},
+		{"log", "secret", "other", "secret", http.StatusUnauthorized},
+		{"log", "secret", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, searchPagePath, nil)
+		if tt.reqUser != "" {
+			req.SetBasicAuth(tt.reqUser, tt.reqPassword)
+		}
+		rec := httptest.NewRecorder()
+		basicAuth(next, tt.user, tt.password).ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode {
+			t.Fatalf("%s/%s: code %d, want %d", tt.reqUser, tt.reqPassword, rec.Code, tt.wantCode)
+		}
+		if tt.wantCode == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("%s/%s: no WWW-Authenticate header", tt.reqUser, tt.reqPassword)
+		}
+	}
+}
+
+// store that answers with a fixed total and records query limits
+type countingStore struct {
+	log_store.LogStore
+	total  int
+	limits []int
+}
+
+func (s *countingStore) Query(ctx context.Context, q log_store.LogQuery) (log_store.LogPage, error) {
+	s.limits = append(s.limits, q.Limit)
+	page := log_store.LogPage{Total: s.total}
+	if q.Limit > 0 {
+		page.Logs = []fmtp_log.LogMessage{{DateTime: "2024-03-01 10:20:30.000", Text: "log"}}
+	}
+	return page, nil
+}
+
+func TestExportCountsFirst(t *testing.T) {
+	tests := []struct {
+		total      int
+		wantCode   int
+		wantLimits []int
+	}{
+		{maxExportCount + 1, http.StatusRequestEntityTooLarge, []int{0}},
+		{1, http.StatusOK, []int{0, maxExportCount}},
+	}
+	for _, tt := range tests {
+		store := &countingStore{total: tt.total}
+		c := NewLogWebCntrl()
+		c.store = store
+
+		rec := httptest.NewRecorder()
+		c.handleExport(rec, httptest.NewRequest(http.MethodGet, apiExportPath+"?format=csv", nil))
+		if rec.Code != tt.wantCode {
+			t.Fatalf("total %d: code %d, want %d", tt.total, rec.Code, tt.wantCode)
+		}
+		if !reflect.DeepEqual(store.limits, tt.wantLimits) {
+			t.Fatalf("total %d: query limits %v, want %v", tt.total, store.limits, tt.wantLimits)
+		}
+		if rec.Header().Get("X-Total-Count") != strconv.Itoa(tt.total) {
+			t.Fatalf("total %d: X-Total-Count %q", tt.total, rec.Header().Get("X-Total-Count"))
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package log_web
+
+import (
+	"net"
+
+	"fmtp/ora_logger/log_store"
+)
+
+// LogWebSettings - настройки web сервера поиска логов
+type LogWebSettings struct {
+	Address  string             // адрес web сервера (пустой - все интерфейсы)
+	Port     int                // порт web сервера (0 - сервер не запускается)
+	User     string             // пользователь для basic авторизации (пустой - без авторизации, только на локальном адресе)
+	Password string             // пароль пользователя
+	Store    log_store.Settings // настройки подключения к хранилищу логов
+}
+
+// признак отсутствия пользователя для адреса, доступного не только с локального хоста (сервер не запускается)
+func (s LogWebSettings) missingAuth() bool {
+	return s.User == "" && !s.isLoopback()
+}
+
+// признак адреса, доступного только с локального хоста
+func (s LogWebSettings) isLoopback() bool {
+	if s.Address == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(s.Address)
+	return ip != nil && ip.IsLoopback()
+}
+
+// изменены настройки запуска web сервера (адрес, порт или авторизация)
+func (s LogWebSettings) serverChanged(other LogWebSettings) bool {
+	return s.Address != other.Address || s.Port != other.Port || s.User != other.User || s.Password != other.Password
+}
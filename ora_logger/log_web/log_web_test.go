@@ -0,0 +1,76 @@
+package log_web
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServerResetOnListenError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	c := NewLogWebCntrl()
+	c.curSetts = LogWebSettings{Address: "127.0.0.1", Port: busy.Addr().(*net.TCPAddr).Port}
+	c.startServer()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.Lock()
+		isStopped := c.server == nil
+		c.Unlock()
+		if isStopped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server not reset after listen error")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	busy.Close()
+	c.startServer()
+	defer c.stopServer()
+	c.Lock()
+	if c.server == nil {
+		c.Unlock()
+		t.Fatalf("server not restarted")
+	}
+	c.Unlock()
+}
+
+func TestMissingAuth(t *testing.T) {
+	tests := []struct {
+		address string
+		user    string
+		want    bool
+	}{
+		{"127.0.0.1", "", false},
+		{"::1", "", false},
+		{"localhost", "", false},
+		{"", "", true},
+		{"0.0.0.0", "", true},
+		{"192.168.1.24", "", true},
+		{"", "log", false},
+		{"192.168.1.24", "log", false},
+	}
+	for _, tt := range tests {
+		setts := LogWebSettings{Address: tt.address, User: tt.user}
+		if got := setts.missingAuth(); got != tt.want {
+			t.Fatalf("%q/%q: %v, want %v", tt.address, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestServerNotStartedWithoutAuth(t *testing.T) {
+	c := NewLogWebCntrl()
+	c.curSetts = LogWebSettings{Address: "", Port: 1}
+	c.startServer()
+	if c.server != nil {
+		c.stopServer()
+		t.Fatalf("server started on all interfaces without credentials")
+	}
+}
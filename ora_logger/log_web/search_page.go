@@ -0,0 +1,277 @@
+package log_web
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"lemz.com/fdps/logger"
+
+	"fmtp/fmtp_log"
+	"fmtp/ora_logger/log_store"
+)
+
+// SearchPage страница поиска логов
+type SearchPage struct {
+	templ *template.Template
+	Title string
+}
+
+// searchOption вариант выбора в форме поиска
+type searchOption struct {
+	Value    string
+	Caption  string
+	Selected bool
+}
+
+// searchView данные страницы поиска для одного запроса
+type searchView struct {
+	Title string
+	Error string
+
+	// значения полей формы поиска
+	From, To, Controller, Channel, Local, Remote, FmtpType, Text, PageSize string
+
+	Tables     []searchOption
+	Severities []searchOption
+	Directions []searchOption
+	SortBy     []searchOption
+	Orders     []searchOption
+
+	IsSearched bool // поиск выполнен
+	Total      int
+	Page       int
+	PageCount  int
+	Logs       []fmtp_log.LogMessageWithColor
+
+	PrevURL, NextURL        string
+	CsvURL, JsonURL, ApiURL string
+}
+
+func (sp *SearchPage) initialize(title string) {
+	var err error
+	if sp.templ, err = template.New("SearchTemplate").Parse(SearchPageTemplate); err != nil {
+		logger.PrintfErr("LogSearch template Parse ERROR: %v", err)
+		return
+	}
+	sp.Title = title
+}
+
+// формирование страницы (поиск выполняется, если в запросе заданы параметры)
+func (sp *SearchPage) render(w http.ResponseWriter, r *http.Request, c *LogWebCntrl) {
+	values := r.URL.Query()
+	view := searchView{
+		Title:      sp.Title,
+		From:       values.Get("from"),
+		To:         values.Get("to"),
+		Controller: values.Get("controller"),
+		Channel:    values.Get("channel"),
+		Local:      values.Get("local"),
+		Remote:     values.Get("remote"),
+		FmtpType:   values.Get("fmtp_type"),
+		Text:       values.Get("text"),
+		PageSize:   values.Get("page_size"),
+		Tables: options(values["table"], [][2]string{
+			{log_store.QueryTableStorage, "Все логи"}, {log_store.QueryTableOnline, "Последние логи"}}),
+		Severities: options(values["severity"], [][2]string{
+			{fmtp_log.SeverityDebug, fmtp_log.SeverityDebug}, {fmtp_log.SeverityInfo, fmtp_log.SeverityInfo},
+			{fmtp_log.SeverityWarning, fmtp_log.SeverityWarning}, {fmtp_log.SeverityError, fmtp_log.SeverityError}}),
+		Directions: options(values["direction"], [][2]string{{"", "Любое"},
+			{fmtp_log.DirectionIncoming, fmtp_log.DirectionIncoming}, {fmtp_log.DirectionOutcoming, fmtp_log.DirectionOutcoming},
+			{fmtp_log.DirectionUnknown, fmtp_log.DirectionUnknown}}),
+		Orders: options(values["order"], [][2]string{{"desc", "По убыванию"}, {"asc", "По возрастанию"}}),
+	}
+	sortColumns := make([][2]string, 0, len(log_store.SortColumns))
+	for _, val := range log_store.SortColumns {
+		sortColumns = append(sortColumns, [2]string{val, val})
+	}
+	view.SortBy = options(values["sort"], sortColumns)
+
+	if len(values) > 0 {
+		sp.search(r, c, values, &view)
+	}
+
+	if err := sp.templ.ExecuteTemplate(w, "SearchTemplate", view); err != nil {
+		logger.PrintfErr("LogSearch template ExecuteTemplate ERROR: %v", err)
+	}
+}
+
+// поиск логов для отображения на странице
+func (sp *SearchPage) search(r *http.Request, c *LogWebCntrl, values url.Values, view *searchView) {
+	q, result, err := c.queryPage(r)
+	if err != nil {
+		view.Error = err.Error()
+		return
+	}
+	logPage, err := c.queryLogs(r.Context(), q)
+	if err != nil {
+		view.Error = "Ошибка поиска логов: " + err.Error()
+		return
+	}
+
+	view.IsSearched = true
+	view.Total = logPage.Total
+	view.Page = result.Page
+	view.PageCount = (logPage.Total + result.PageSize - 1) / result.PageSize
+	for _, val := range logPage.Logs {
+		view.Logs = append(view.Logs, fmtp_log.LogMessageWithColor{LogMessage: val, MsgColor: severityColor(val.Severity)})
+	}
+
+	pageURL := func(path string, page int, format string) string {
+		pageValues := url.Values{}
+		for key, val := range values {
+			pageValues[key] = val
+		}
+		pageValues.Del("page")
+		if page > 1 {
+			pageValues.Set("page", strconv.Itoa(page))
+		}
+		if format != "" {
+			pageValues.Del("page_size")
+			pageValues.Set("format", format)
+		}
+		return path + "?" + pageValues.Encode()
+	}
+	if result.Page > 1 {
+		view.PrevURL = pageURL(searchPagePath, result.Page-1, "")
+	}
+	if result.Page < view.PageCount {
+		view.NextURL = pageURL(searchPagePath, result.Page+1, "")
+	}
+	view.ApiURL = pageURL(apiQueryPath, result.Page, "")
+	view.CsvURL = pageURL(apiExportPath, 0, exportFormatCSV)
+	view.JsonURL = pageURL(apiExportPath, 0, exportFormatJSON)
+}
+
+// варианты выбора с отметкой выбранных значений (если значения не заданы, браузер выбирает первый вариант)
+func options(selected []string, values [][2]string) []searchOption {
+	retValue := make([]searchOption, 0, len(values))
+	for _, val := range values {
+		opt := searchOption{Value: val[0], Caption: val[1]}
+		for _, sel := range selected {
+			if strings.EqualFold(sel, val[0]) {
+				opt.Selected = true
+			}
+		}
+		retValue = append(retValue, opt)
+	}
+	return retValue
+}
+
+// цвет строки лога в таблице результатов
+func severityColor(severity string) string {
+	switch severity {
+	case fmtp_log.SeverityDebug:
+		return fmtp_log.LogDebugColor
+	case fmtp_log.SeverityInfo:
+		return fmtp_log.LogInfoColor
+	case fmtp_log.SeverityWarning:
+		return fmtp_log.LogWarningColor
+	case fmtp_log.SeverityError:
+		return fmtp_log.LogErrorColor
+	}
+	return fmtp_log.LogDefaultColor
+}
+
+var SearchPageTemplate = `{{define "SearchTemplate"}}
+<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<meta charset="UTF-8">
+		<title>{{.Title}}</title>
+	</head>
+	<body style="background-color:#EAECEE;">
+		<font size="4" face="verdana" color="black">
+			<form method="get" action="/logs">
+				<table width="100%" border="1" cellspacing="0" cellpadding="4">
+					<tr>
+						<td>Время с (UTC)</td>
+						<td><input type="datetime-local" step="1" name="from" value="{{.From}}"></td>
+						<td>Время по (UTC)</td>
+						<td><input type="datetime-local" step="1" name="to" value="{{.To}}"></td>
+						<td>Таблица</td>
+						<td><select name="table">{{range .Tables}}<option value="{{.Value}}"{{if .Selected}} selected{{end}}>{{.Caption}}</option>{{end}}</select></td>
+					</tr>
+					<tr>
+						<td>IP контроллера</td>
+						<td><input type="text" name="controller" value="{{.Controller}}"></td>
+						<td>ID канала</td>
+						<td><input type="number" name="channel" value="{{.Channel}}"></td>
+						<td>Серьезность</td>
+						<td rowspan="2"><select name="severity" multiple size="4">{{range .Severities}}<option value="{{.Value}}"{{if .Selected}} selected{{end}}>{{.Caption}}</option>{{end}}</select></td>
+					</tr>
+					<tr>
+						<td>Локальный ATC</td>
+						<td><input type="text" name="local" value="{{.Local}}"></td>
+						<td>Удаленный ATC</td>
+						<td><input type="text" name="remote" value="{{.Remote}}"></td>
+						<td></td>
+					</tr>
+					<tr>
+						<td>Тип FMTP</td>
+						<td><input type="text" name="fmtp_type" value="{{.FmtpType}}"></td>
+						<td>Направление</td>
+						<td><select name="direction">{{range .Directions}}<option value="{{.Value}}"{{if .Selected}} selected{{end}}>{{.Caption}}</option>{{end}}</select></td>
+						<td>Текст</td>
+						<td><input type="text" name="text" value="{{.Text}}"></td>
+					</tr>
+					<tr>
+						<td>Сортировка</td>
+						<td>
+							<select name="sort">{{range .SortBy}}<option value="{{.Value}}"{{if .Selected}} selected{{end}}>{{.Caption}}</option>{{end}}</select>
+							<select name="order">{{range .Orders}}<option value="{{.Value}}"{{if .Selected}} selected{{end}}>{{.Caption}}</option>{{end}}</select>
+						</td>
+						<td>Логов на странице</td>
+						<td><input type="number" name="page_size" min="1" max="1000" placeholder="100" value="{{.PageSize}}"></td>
+						<td colspan="2"><input type="submit" value="Найти"></td>
+					</tr>
+				</table>
+			</form>
+			{{if .Error}}
+				<p style="color:#C0392B;">{{.Error}}</p>
+			{{end}}
+			{{if .IsSearched}}
+				<p>
+					Найдено логов: {{.Total}}{{if .PageCount}}. Страница {{.Page}} из {{.PageCount}}{{end}}
+					{{if .PrevURL}}<a href="{{.PrevURL}}">Предыдущая</a>{{end}}
+					{{if .NextURL}}<a href="{{.NextURL}}">Следующая</a>{{end}}
+				</p>
+				<p>Выгрузка: <a href="{{.CsvURL}}">CSV</a> <a href="{{.JsonURL}}">JSON</a> <a href="{{.ApiURL}}">API</a></p>
+				<table width="100%" border="1" cellspacing="0" cellpadding="4">
+					<tr>
+						<th>Время</th>
+						<th>Контроллер</th>
+						<th>Канал</th>
+						<th>Источник</th>
+						<th>Серьезность</th>
+						<th>Локальный ATC</th>
+						<th>Удаленный ATC</th>
+						<th>Тип данных</th>
+						<th>Тип FMTP</th>
+						<th>Направление</th>
+						<th>Текст</th>
+					</tr>
+					{{range .Logs}}
+						<tr style="background-color:{{.MsgColor}};">
+							<td align="left"> {{.DateTime}} </td>
+							<td align="left"> {{.ControllerIP}} </td>
+							<td align="left"> {{.ChannelId}} </td>
+							<td align="left"> {{.Source}} </td>
+							<td align="left"> {{.Severity}} </td>
+							<td align="left"> {{.ChannelLocName}} </td>
+							<td align="left"> {{.ChannelRemName}} </td>
+							<td align="left"> {{.DataType}} </td>
+							<td align="left"> {{.FmtpType}} </td>
+							<td align="left"> {{.Direction}} </td>
+							<td align="left"> {{.Text}} </td>
+						</tr>
+					{{end}}
+				</table>
+			{{end}}
+		</font>
+	</body>
+</html>
+{{end}}
+`
@@ -4,7 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
+
+	"fmtp/secret"
 
 	"lemz.com/fdps/utils"
 )
@@ -15,14 +16,27 @@ type LoggerSettings struct {
 	LoggerID      string `json:"LoggerID"`
 	Timestamp     string `json:"LoggerConfigTimestamp"`
 
+	LogStoreType string `json:"LogStoreType"` // тип хранилища логов: oracle, postgres, sqlite
+
 	OraHostname    string `json:"OraHostname"`
 	OraPort        int    `json:"OraPort"`
 	OraServiceName string `json:"OraServiceName"`
 	OraUser        string `json:"OraUser"`
 	OraPassword    string `json:"OraPassword"`
 
+	PgHostname string `json:"PgHostname"`
+	PgPort     int    `json:"PgPort"`
+	PgDbName   string `json:"PgDbName"`
+	PgUser     string `json:"PgUser"`
+	PgPassword string `json:"PgPassword"`
+
+	SqlitePath string `json:"SqlitePath"` // путь к файлу БД SQLite (относительный путь - от каталога приложения)
+
+	// настройки хранения и записи логов (для всех типов хранилищ)
 	OraMaxLogStoreCount int `json:"OraMaxLogStoreCount"`
 	OraStoreDays        int `json:"OraStoreDays"`
+	OraBatchSize        int `json:"OraBatchSize"`  // кол-во логов, записываемых за раз
+	OraMaxRetries       int `json:"OraMaxRetries"` // кол-во повторных попыток записи лога, отклоненного БД
 
 	RedisHostname string `json:"RedisHostname"`
 	RedisPort     int    `json:"RedisPort"`
@@ -30,10 +44,17 @@ type LoggerSettings struct {
 	RedisUserName string `json:"RedisUser"`
 	RedisPassword string `json:"RedisPassword"`
 
-	RedisMaxReadCount int `json:"RedisMaxReadCount"`
+	RedisMaxReadCount   int   `json:"RedisMaxReadCount"`
+	RedisStreamMaxCount int64 `json:"RedisStreamMaxCount"` // максимальное число логов в потоке
+	RedisClaimIdleSec   int   `json:"RedisClaimIdleSec"`   // время (сек), после которого логи остановленного логгера обрабатываются другим
 
 	MetricsIntervalSec int    `json:"MetricsIntervalSec"`
 	MetricsGatewayUrl  string `json:"MetricsGatewayUrl"`
+
+	WebAddress  string `json:"WebAddress"`  // адрес web сервера поиска логов (пустой - все интерфейсы)
+	WebPort     int    `json:"WebPort"`     // порт web сервера поиска логов (0 - сервер не запускается)
+	WebUser     string `json:"WebUser"`     // пользователь web сервера поиска логов (пустой - без авторизации, только на локальном адресе)
+	WebPassword string `json:"WebPassword"` // пароль пользователя web сервера поиска логов
 }
 
 var loggerSettingsFile = utils.AppPath() + "/config/logger_settings.json"
@@ -50,33 +71,68 @@ func (s *LoggerSettings) ReadFromFile() error {
 		fmt.Println(err.Error())
 		return err
 	}
-	return nil
+	return s.DecryptSecrets()
 }
 
-// SaveToFile сохранение настроек в файл
+// SaveToFile сохранение настроек в файл (секреты сохраняются в зашифрованном виде)
 func (s *LoggerSettings) SaveToFile() error {
-	if confData, errMrsh := json.Marshal(s); errMrsh != nil {
+	encSetts := *s
+	if errEnc := secret.EncryptFields(encSetts.secretFields()...); errEnc != nil {
+		return errEnc
+	}
+	if confData, errMrsh := json.Marshal(encSetts); errMrsh != nil {
 		return errMrsh
-	} else if errWriteSetts := ioutil.WriteFile(loggerSettingsFile, utils.JsonPrettyPrint(confData), os.ModePerm); errWriteSetts != nil {
+	} else if errWriteSetts := secret.WriteFile(loggerSettingsFile, utils.JsonPrettyPrint(confData)); errWriteSetts != nil {
 		return errWriteSetts
 	}
 	return nil
 }
 
+// указатели на секреты в настройках логгера
+func (s *LoggerSettings) secretFields() []*string {
+	return []*string{&s.OraPassword, &s.PgPassword, &s.RedisPassword, &s.WebPassword}
+}
+
+// DecryptSecrets расшифровка секретов, заданных в виде "enc:..."
+func (s *LoggerSettings) DecryptSecrets() error {
+	return secret.DecryptFields(s.secretFields()...)
+}
+
+// Redacted настройки со скрытыми секретами (для вывода в журнал и на web страницы)
+func (s LoggerSettings) Redacted() LoggerSettings {
+	for _, val := range s.secretFields() {
+		*val = secret.Redact(*val)
+	}
+	return s
+}
+
+// настройки по умолчанию. Пароли по умолчанию не задаются (задаются конфигуратором или администратором)
 func (s *LoggerSettings) setDefault() {
 	s.IsInitialised = false
 	s.IPAddr = "127.0.0.1"
 	s.LoggerID = "-1"
 	s.Timestamp = ""
 
+	s.LogStoreType = "oracle"
+
 	s.OraHostname = "192.168.1.30"
 	s.OraPort = 1521
 	s.OraServiceName = "metplan"
 	s.OraUser = "fmtp_log"
-	s.OraPassword = "log"
+	s.OraPassword = ""
+
+	s.PgHostname = "192.168.1.30"
+	s.PgPort = 5432
+	s.PgDbName = "fmtp_log"
+	s.PgUser = "fmtp_log"
+	s.PgPassword = ""
+
+	s.SqlitePath = "data/fmtp_log.db"
 
 	s.OraMaxLogStoreCount = 1000000
 	s.OraStoreDays = 30
+	s.OraBatchSize = 100
+	s.OraMaxRetries = 3
 
 	s.RedisHostname = "192.168.1.24"
 	s.RedisPort = 6389
@@ -85,7 +141,14 @@ func (s *LoggerSettings) setDefault() {
 	s.RedisPassword = ""
 
 	s.RedisMaxReadCount = 100
+	s.RedisStreamMaxCount = 100000
+	s.RedisClaimIdleSec = 60
 
 	s.MetricsIntervalSec = 1
 	s.MetricsGatewayUrl = "http://192.168.1.24:9100"
+
+	s.WebAddress = "127.0.0.1"
+	s.WebPort = 8094
+	s.WebUser = ""
+	s.WebPassword = ""
 }
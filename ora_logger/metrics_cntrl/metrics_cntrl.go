@@ -8,13 +8,27 @@ import (
 
 const (
 	metricRedisMsg        = "redis_read_msg"
+	metricRedisAck        = "redis_ack_msg"
+	metricRedisClaim      = "redis_claim_msg"
+	metricRedisStreamLen  = "redis_stream_len"
+	metricRedisPending    = "redis_pending_msg"
+	metricRedisLag        = "redis_stream_lag_ms"
 	metricOraQueries      = "ora_exec_queries"
 	metricOraMsgBuffer    = "ora_msg_buffer"
 	metricOraQueriesQueue = "ora_queries_queue"
+	metricOraWriteLag     = "ora_write_lag_ms"
+	metricOraWriteRate    = "ora_write_rate"
 )
 
 type RedisMetrics struct {
-	Msg int
+	Msg     int // кол-во считанных логов
+	Acked   int // кол-во подтвержденных логов
+	Claimed int // кол-во логов, полученных от других логгеров
+
+	Stat      bool // метрики потока заданы
+	StreamLen int  // длина потока
+	Pending   int  // кол-во логов, полученных логгерами и не подтвержденных
+	LagMs     int  // время от добавления в поток самого старого необработанного лога (мс)
 }
 
 const OraTypeLabel = "tp"
@@ -24,6 +38,9 @@ type OraMetrics struct {
 	Labels       map[string]string
 	MsgBuffer    int
 	QueriesQueue int
+	Written      int // кол-во записанных логов (0 - задание не записи логов)
+	LagMs        int // время от формирования самого старого из записанных логов до записи (мс)
+	WriteRate    int // скорость записи логов (шт/с)
 }
 
 type MetricsCntrl struct {
@@ -56,19 +73,37 @@ func (c *MetricsCntrl) Run() {
 		case setts := <-c.SettsChan:
 			prom_metrics.SetSettings(setts)
 			prom_metrics.AppendCounter(metricRedisMsg, "Кол-во считанных сообщений журнала из потока Redis")
+			prom_metrics.AppendCounter(metricRedisAck, "Кол-во подтвержденных сообщений журнала в потоке Redis")
+			prom_metrics.AppendCounter(metricRedisClaim, "Кол-во сообщений журнала, полученных от других логгеров")
+			prom_metrics.AppendGauge(metricRedisStreamLen, "Длина потока Redis")
+			prom_metrics.AppendGauge(metricRedisPending, "Кол-во неподтвержденных сообщений журнала в потоке Redis")
+			prom_metrics.AppendGauge(metricRedisLag, "Отставание обработки потока Redis (мс)")
 			prom_metrics.AppendCounterVec(metricOraQueries, "Кол-во выполненных запросов к Oracle", []string{OraTypeLabel})
 			prom_metrics.AppendGauge(metricOraMsgBuffer, "Размер буфера сообщений журнала контроллера Oracle")
 			prom_metrics.AppendGauge(metricOraQueriesQueue, "Размер очереди запросов контроллера Oracle")
+			prom_metrics.AppendGauge(metricOraWriteLag, "Задержка записи сообщений журнала в Oracle (мс)")
+			prom_metrics.AppendGauge(metricOraWriteRate, "Скорость записи сообщений журнала в Oracle (шт/с)")
 			prom_metrics.Initialize()
 
 		case rdMt := <-c.RedisMetricsChan:
 			prom_metrics.AddToCollector(metricRedisMsg, rdMt.Msg)
+			prom_metrics.AddToCollector(metricRedisAck, rdMt.Acked)
+			prom_metrics.AddToCollector(metricRedisClaim, rdMt.Claimed)
+			if rdMt.Stat {
+				prom_metrics.SetToGauge(metricRedisStreamLen, rdMt.StreamLen)
+				prom_metrics.SetToGauge(metricRedisPending, rdMt.Pending)
+				prom_metrics.SetToGauge(metricRedisLag, rdMt.LagMs)
+			}
 			checkErrFunc()
 
 		case oraMt := <-c.OraMetricsChan:
 			prom_metrics.AddToCounterVec(metricOraQueries, oraMt.Count, oraMt.Labels)
 			prom_metrics.SetToGauge(metricOraMsgBuffer, oraMt.MsgBuffer)
 			prom_metrics.SetToGauge(metricOraQueriesQueue, oraMt.QueriesQueue)
+			if oraMt.Written > 0 {
+				prom_metrics.SetToGauge(metricOraWriteLag, oraMt.LagMs)
+				prom_metrics.SetToGauge(metricOraWriteRate, oraMt.WriteRate)
+			}
 			checkErrFunc()
 		}
 	}
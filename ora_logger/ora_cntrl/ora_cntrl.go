@@ -1,26 +1,29 @@
 package ora_cntrl
 
 import (
-	"database/sql"
-	"strings"
+	"errors"
 	"sync"
 	"time"
 
-	_ "github.com/godror/godror"
-	"github.com/golang-collections/go-datastructures/queue"
 	"lemz.com/fdps/logger"
 
 	"fmtp/fmtp_log"
+	"fmtp/ora_logger/log_store"
 	"fmtp/ora_logger/logger_state"
 	"fmtp/ora_logger/metrics_cntrl"
 )
 
+// errStoreClosed задание не выполнено из-за отключения от хранилища
+var errStoreClosed = errors.New("хранилище логов отключено")
+
 const (
-	timeFormat        = "2006-01-02 15:04:05"
-	insertCountCheck  = 1000 // кол-во запросов INSERT в БД, после чего следует проверить кол-во хранимых сообщений
-	onlineLogMaxCount = 1000 // кол-во хранимых логов в таблице онлайн сообщений
-	maxQueryExec      = 100  //кол-во логов, записываемых за раз
+	insertCountCheck  = 1000  // кол-во запросов INSERT в БД, после чего следует проверить кол-во хранимых сообщений
+	onlineLogMaxCount = 1000  // кол-во хранимых логов в таблице онлайн сообщений
+	maxQueueLen       = 10000 // макс. кол-во заданий в очереди (при превышении задания записи логов не формируются)
+	retryInterval     = 5 * time.Second
 	errMetricLabel    = "error"
+	retryMetricLabel  = "retry"  // повторная попытка записи лога, отклоненного БД
+	rejectMetricLabel = "reject" // лог не записан после всех попыток
 )
 
 ///////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -32,19 +35,29 @@ const (
 	HeartbeatPriority
 )
 
-type queueItem struct {
-	queryText string
-	priority  int
-	countMsg  int
+// oraTask задание на выполнение запроса к хранилищу логов
+type oraTask struct {
+	priority        int
+	logMsgs         []fmtp_log.LogMessageWithID // логи для записи (LogPriority)
+	attempt         int                         // номер повторной попытки записи
+	maxStorageCount int                         // макс. кол-во хранимых логов (CheckLogCountPriority)
+	oldest          time.Time                   // время самого старого хранимого лога (CheckLogLivetimePriority)
 }
 
-func (qi queueItem) Compare(other queue.Item) int {
-	if cast, ok := other.(queueItem); ok {
-		if qi.priority < cast.priority {
-			return 1
-		}
+// кол-во сообщений задания (для метрик)
+func (t oraTask) countMsg() int {
+	if t.priority == LogPriority {
+		return len(t.logMsgs)
 	}
-	return -1
+	return 1
+}
+
+// результат выполнения задания
+type execResult struct {
+	store    log_store.LogStore // подключение, в котором выполнялось задание
+	task     oraTask
+	err      error
+	duration time.Duration
 }
 
 func PriorToString(val int) (priorStr string) {
@@ -67,24 +80,26 @@ func PriorToString(val int) (priorStr string) {
 type OraCntrlr struct {
 	sync.Mutex
 
-	SettsChan      chan OraCntrlSettings      // канал приема новых настроек контроллера
-	ReceiveMsgChan chan []fmtp_log.LogMessage // канал приема новых сообщений
+	SettsChan      chan OraCntrlSettings            // канал приема новых настроек контроллера
+	ReceiveMsgChan chan []fmtp_log.LogMessageWithID // канал приема новых сообщений
 	RequestMsgChan chan struct{}
+	AckChan        chan []string // канал передачи идентификаторов обработанных логов (записанных или отклоненных БД)
 
 	MetricsChan chan metrics_cntrl.OraMetrics
 
 	curSetts OraCntrlSettings
 
-	logMsgBuffer []fmtp_log.LogMessage // очередь логов
-	queryQueue   *queue.PriorityQueue  // очередь сообщений для записи в БД
+	logMsgBuffer []fmtp_log.LogMessageWithID // очередь логов
+	tasks        []oraTask                   // очередь заданий на выполнение запросов к БД
 
-	db         *sql.DB // объект БД
-	dbSuccess  bool    // успешность подключения к БД
-	canExecute bool    // возможность выполнять запросы к БД
+	store     log_store.LogStore // хранилище логов
+	dbSuccess bool               // успешность подключения к БД
+	inFlight  bool               // задание передано на выполнение, результат не получен
 
-	execQueryChan  chan queueItem // канал для передачи запросов записи логов на выполнение
-	execResultChan chan error     // канал для передачи результатов выполнения
-	execTermChan   chan struct{}  // канал для завершения подпрограммы выполнения запросов
+	execQueryChan  chan oraTask    // канал для передачи заданий на выполнение (создается при подключении к БД)
+	execResultChan chan execResult // канал для передачи результатов выполнения
+	execTermChan   chan struct{}   // канал для завершения подпрограммы выполнения запросов (закрывается при отключении от БД)
+	retryChan      chan oraTask    // канал для возврата заданий в очередь после задержки повторной попытки
 
 	logLifetimeTicker *time.Ticker // тикер проверки времени жизни логов
 	pingDbTicker      *time.Ticker // тикер пинга БД
@@ -93,15 +108,13 @@ type OraCntrlr struct {
 
 func NewOraController() *OraCntrlr {
 	return &OraCntrlr{
-		ReceiveMsgChan:    make(chan []fmtp_log.LogMessage, 1024),
+		ReceiveMsgChan:    make(chan []fmtp_log.LogMessageWithID, 1024),
+		AckChan:           make(chan []string, 1024),
 		SettsChan:         make(chan OraCntrlSettings, 1),
 		RequestMsgChan:    make(chan struct{}, 10),
 		MetricsChan:       make(chan metrics_cntrl.OraMetrics, 10),
-		queryQueue:        queue.NewPriorityQueue(10000),
-		canExecute:        false,
-		execQueryChan:     make(chan queueItem, 1),
-		execResultChan:    make(chan error, 1),
-		execTermChan:      make(chan struct{}, 1),
+		execResultChan:    make(chan execResult, 1),
+		retryChan:         make(chan oraTask, 100),
 		pingDbTicker:      time.NewTicker(3 * time.Second),
 		logLifetimeTicker: time.NewTicker(12 * time.Hour),
 	}
@@ -110,45 +123,26 @@ func NewOraController() *OraCntrlr {
 func (c *OraCntrlr) Run() {
 	c.dbSuccess = false
 
-	c.MetricsChan <- metrics_cntrl.OraMetrics{
-		Count:  0,
-		Labels: map[string]string{metrics_cntrl.OraTypeLabel: PriorToString(LogPriority)},
-	}
-	c.MetricsChan <- metrics_cntrl.OraMetrics{
-		Count:  0,
-		Labels: map[string]string{metrics_cntrl.OraTypeLabel: PriorToString(CheckLogCountPriority)},
-	}
-	c.MetricsChan <- metrics_cntrl.OraMetrics{
-		Count:  0,
-		Labels: map[string]string{metrics_cntrl.OraTypeLabel: PriorToString(CheckLogLivetimePriority)},
-	}
-	c.MetricsChan <- metrics_cntrl.OraMetrics{
-		Count:  0,
-		Labels: map[string]string{metrics_cntrl.OraTypeLabel: PriorToString(HeartbeatPriority)},
-	}
-	c.MetricsChan <- metrics_cntrl.OraMetrics{
-		Count:  0,
-		Labels: map[string]string{metrics_cntrl.OraTypeLabel: errMetricLabel},
+	for _, val := range []string{PriorToString(LogPriority), PriorToString(CheckLogCountPriority), PriorToString(CheckLogLivetimePriority),
+		PriorToString(HeartbeatPriority), errMetricLabel, retryMetricLabel, rejectMetricLabel} {
+		c.MetricsChan <- metrics_cntrl.OraMetrics{
+			Count:  0,
+			Labels: map[string]string{metrics_cntrl.OraTypeLabel: val},
+		}
 	}
 
 	for {
 		select {
 
 		case newSettings := <-c.SettsChan:
-			if isDbEqual, isStorEqual := c.curSetts.equal(newSettings); !isDbEqual || !isStorEqual {
+			if isDbEqual, isStorEqual := c.curSetts.equal(newSettings); !isDbEqual || !isStorEqual || c.curSetts != newSettings {
 				c.curSetts = newSettings
 
 				if !isDbEqual {
 					if c.dbSuccess {
 						c.disconnectFromDb()
 					}
-					if err := c.connectToDb(); err != nil {
-						logger.PrintfErr("Ошибка подключения к БД Oracle: %v\n", err)
-						logger_state.SetOraState(logger_state.StateError, err.Error())
-					} else {
-						logger.PrintfDebug("Успешное подключение к БД Oracle")
-						logger_state.SetOraState(logger_state.StateOk, "")
-					}
+					c.reconnect()
 				}
 				if !isStorEqual {
 					c.checkLogCount()
@@ -168,23 +162,20 @@ func (c *OraCntrlr) Run() {
 			}
 			c.checkQueryQueue()
 
-		case execErr := <-c.execResultChan:
-			if execErr != nil {
-				if strings.Contains(execErr.Error(), "database is closed") ||
-					strings.Contains(execErr.Error(), "server is not accepting clients") {
-					c.disconnectFromDb()
-					logger_state.SetOraState(logger_state.StateError, execErr.Error())
-				} else {
-					c.canExecute = true
-				}
-			} else {
-				c.canExecute = true
-			}
+		case res := <-c.execResultChan:
+			c.inFlight = false
+			c.processResult(res)
+			c.checkQueryQueue()
+
+		case task := <-c.retryChan:
+			c.putTask(task, true)
 			c.checkQueryQueue()
 
 		case <-c.pingDbTicker.C:
 			if c.dbSuccess {
 				c.checkHeatrbeat()
+			} else if c.curSetts != (OraCntrlSettings{}) {
+				c.reconnect()
 			}
 
 		case <-c.logLifetimeTicker.C:
@@ -193,140 +184,265 @@ func (c *OraCntrlr) Run() {
 	}
 }
 
+// подключение к БД с выводом результата
+func (c *OraCntrlr) reconnect() {
+	if err := c.connectToDb(); err != nil {
+		logger.PrintfErr("Ошибка подключения к хранилищу логов (%s): %v\n", c.curSetts.storeType(), err)
+		logger_state.SetOraState(logger_state.StateError, err.Error())
+	} else {
+		logger.PrintfDebug("Успешное подключение к хранилищу логов (%s)", c.curSetts.storeType())
+		logger_state.SetOraState(logger_state.StateOk, "")
+	}
+}
+
 func (c *OraCntrlr) connectToDb() error {
 	c.dbSuccess = false
 
-	var errOpen error
-	c.db, errOpen = sql.Open("godror", c.curSetts.ConnString())
-
-	if errOpen != nil {
-		c.disconnectFromDb()
+	store, errNew := log_store.NewLogStore(c.curSetts.StoreSettings())
+	if errNew != nil {
+		return errNew
+	}
+	if errOpen := store.Open(); errOpen != nil {
 		return errOpen
 	}
 
-	errPing := c.db.Ping()
-	if errPing != nil {
-		c.disconnectFromDb()
-		return errPing
-	} else {
-		c.dbSuccess = true
-		c.canExecute = true
-
-		go c.executeQuery()
+	c.store = store
+	c.dbSuccess = true
+	c.execQueryChan = make(chan oraTask, 1)
+	c.execTermChan = make(chan struct{})
+	go c.executeQuery(c.store, c.execQueryChan, c.execTermChan)
 
-		c.checkQueryQueue()
-	}
+	c.checkQueryQueue()
 	return nil
 }
 
+// отключение от хранилища. Хранилище закрывается подпрограммой выполнения запросов после завершения текущего задания
 func (c *OraCntrlr) disconnectFromDb() {
-	c.canExecute = false
 	c.dbSuccess = false
-	c.execTermChan <- struct{}{}
-	c.db.Close()
+	if c.execTermChan != nil {
+		close(c.execTermChan)
+		c.execTermChan = nil
+	}
+	c.store = nil
+}
+
+// добавление задания в очередь. front - в начало очереди заданий с тем же приоритетом (повторное выполнение)
+func (c *OraCntrlr) putTask(task oraTask, front bool) {
+	idx := len(c.tasks)
+	for i, val := range c.tasks {
+		if val.priority > task.priority || (front && val.priority == task.priority) {
+			idx = i
+			break
+		}
+	}
+	c.tasks = append(c.tasks, oraTask{})
+	copy(c.tasks[idx+1:], c.tasks[idx:])
+	c.tasks[idx] = task
+}
+
+// признак наличия в очереди задания с приоритетом priority
+func (c *OraCntrlr) hasTask(priority int) bool {
+	for _, val := range c.tasks {
+		if val.priority == priority {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *OraCntrlr) checkLogCount() {
-	c.queryQueue.Put(queueItem{
-		queryText: oraCheckLogCountQuery(onlineLogMaxCount, c.curSetts.LogStoreMaxCount),
-		priority:  CheckLogCountPriority,
-		countMsg:  1,
-	})
+	c.putTask(oraTask{priority: CheckLogCountPriority, maxStorageCount: c.curSetts.LogStoreMaxCount}, false)
 	c.checkQueryQueue()
 }
 
 func (c *OraCntrlr) checkLogLivetime() {
 	oldLogDate := time.Now().AddDate(0, 0, -c.curSetts.LogStoreDays)
 
-	c.queryQueue.Put(queueItem{
-		queryText: oraCheckLogLivetimeQuery(oldLogDate.Format(timeFormat)),
-		priority:  CheckLogLivetimePriority,
-		countMsg:  1,
-	})
+	c.putTask(oraTask{priority: CheckLogLivetimePriority, oldest: oldLogDate}, false)
 	c.checkQueryQueue()
 }
 
 func (c *OraCntrlr) checkHeatrbeat() {
-	if c.queryQueue.Empty() {
+	if len(c.tasks) == 0 {
 		if len(c.logMsgBuffer) == 0 {
 			c.RequestMsgChan <- struct{}{}
 		}
 
-		c.queryQueue.Put(queueItem{
-			queryText: oraHeartbeatQuery(),
-			priority:  HeartbeatPriority,
-			countMsg:  1,
-		})
+		c.putTask(oraTask{priority: HeartbeatPriority}, false)
 	}
 	c.checkQueryQueue()
 }
 
 func (c *OraCntrlr) checkQueryQueue() {
-	if c.canExecute {
-
-		if c.queryQueue.Empty() {
-			var toQuery []fmtp_log.LogMessage
-
-			if len(c.logMsgBuffer) > 0 {
-				c.Lock()
-				if len(c.logMsgBuffer) > maxQueryExec {
-					toQuery = append(toQuery, c.logMsgBuffer[:maxQueryExec]...)
-					c.logMsgBuffer = c.logMsgBuffer[maxQueryExec:]
-				} else {
-					toQuery = make([]fmtp_log.LogMessage, len(c.logMsgBuffer))
-					copy(toQuery, c.logMsgBuffer)
-					c.logMsgBuffer = c.logMsgBuffer[:0]
-				}
-				c.Unlock()
-
-				if len(toQuery) > 0 {
-					c.queryQueue.Put(queueItem{
-						queryText: oraInsertLogQuery(toQuery...),
-						priority:  LogPriority,
-						countMsg:  len(toQuery),
-					})
-				}
-			} else {
-				c.RequestMsgChan <- struct{}{}
+	if !c.dbSuccess || c.inFlight {
+		return
+	}
+
+	if !c.hasTask(LogPriority) && len(c.tasks) < maxQueueLen {
+		if len(c.logMsgBuffer) > 0 {
+			batchSize := c.curSetts.batchSize()
+
+			c.Lock()
+			if len(c.logMsgBuffer) < batchSize {
+				batchSize = len(c.logMsgBuffer)
 			}
+			toQuery := make([]fmtp_log.LogMessageWithID, batchSize)
+			copy(toQuery, c.logMsgBuffer)
+			c.logMsgBuffer = c.logMsgBuffer[batchSize:]
+			c.Unlock()
+
+			c.putTask(oraTask{priority: LogPriority, logMsgs: toQuery}, false)
+		} else if len(c.tasks) == 0 {
+			c.RequestMsgChan <- struct{}{}
 		}
+	}
 
-		if !c.queryQueue.Empty() {
-			queries, _ := c.queryQueue.Get(1)
-			if len(queries) == 1 {
-				c.canExecute = false
-				c.execQueryChan <- queries[0].(queueItem)
+	if len(c.tasks) > 0 {
+		c.inFlight = true
+		c.execQueryChan <- c.tasks[0]
+		c.tasks = c.tasks[1:]
+	}
+}
+
+// обработка результата выполнения задания
+func (c *OraCntrlr) processResult(res execResult) {
+	if res.err == nil {
+		metrics := metrics_cntrl.OraMetrics{
+			Count:        res.task.countMsg(),
+			Labels:       map[string]string{metrics_cntrl.OraTypeLabel: PriorToString(res.task.priority)},
+			MsgBuffer:    len(c.logMsgBuffer),
+			QueriesQueue: len(c.tasks),
+		}
+		if res.task.priority == LogPriority {
+			metrics.Written = len(res.task.logMsgs)
+			metrics.LagMs = int(writeLag(res.task.logMsgs) / time.Millisecond)
+			if res.duration > 0 {
+				metrics.WriteRate = int(float64(len(res.task.logMsgs)) / res.duration.Seconds())
 			}
+			c.ackLogs(res.task.logMsgs)
+		}
+		c.MetricsChan <- metrics
+		return
+	}
+
+	c.MetricsChan <- metrics_cntrl.OraMetrics{
+		Count:        res.task.countMsg(),
+		Labels:       map[string]string{metrics_cntrl.OraTypeLabel: errMetricLabel},
+		MsgBuffer:    len(c.logMsgBuffer),
+		QueriesQueue: len(c.tasks),
+	}
+
+	// потеря подключения - задание повторяется после переподключения
+	if errors.Is(res.err, errStoreClosed) || res.store.IsConnError(res.err) {
+		// результат от уже закрытого подключения не влияет на текущее
+		if res.store == c.store && c.dbSuccess {
+			logger.PrintfErr("Потеряно подключение к хранилищу логов (%s): %v", c.curSetts.storeType(), res.err)
+			c.disconnectFromDb()
+			logger_state.SetOraState(logger_state.StateError, res.err.Error())
+		}
+		if res.task.priority == LogPriority {
+			c.putTask(res.task, true)
+		}
+		return
+	}
+
+	if res.task.priority != LogPriority {
+		logger.PrintfErr("Ошибка выполнения запроса к хранилищу логов (%s): %v", PriorToString(res.task.priority), res.err)
+		return
+	}
+
+	// запрос записи нескольких логов отклонен - логи записываются частями, чтобы найти отклоняемые
+	if len(res.task.logMsgs) > 1 {
+		half := len(res.task.logMsgs) / 2
+		c.putTask(oraTask{priority: LogPriority, logMsgs: res.task.logMsgs[half:], attempt: res.task.attempt}, true)
+		c.putTask(oraTask{priority: LogPriority, logMsgs: res.task.logMsgs[:half], attempt: res.task.attempt}, true)
+		return
+	}
+
+	if res.task.attempt < c.curSetts.maxRetries() {
+		res.task.attempt++
+		c.MetricsChan <- metrics_cntrl.OraMetrics{
+			Count:        1,
+			Labels:       map[string]string{metrics_cntrl.OraTypeLabel: retryMetricLabel},
+			MsgBuffer:    len(c.logMsgBuffer),
+			QueriesQueue: len(c.tasks),
 		}
+		time.AfterFunc(retryInterval, func() { c.retryChan <- res.task })
+		return
+	}
+
+	logger.PrintfErr("Лог не записан в хранилище после %d попыток. Ошибка: %v. Лог: %s", res.task.attempt+1, res.err, res.task.logMsgs[0].Text)
+	c.ackLogs(res.task.logMsgs)
+	c.MetricsChan <- metrics_cntrl.OraMetrics{
+		Count:        1,
+		Labels:       map[string]string{metrics_cntrl.OraTypeLabel: rejectMetricLabel},
+		MsgBuffer:    len(c.logMsgBuffer),
+		QueriesQueue: len(c.tasks),
 	}
 }
 
-func (c *OraCntrlr) executeQuery() {
+// передача идентификаторов обработанных логов для подтверждения в потоке Redis
+func (c *OraCntrlr) ackLogs(logMsgs []fmtp_log.LogMessageWithID) {
+	ids := make([]string, 0, len(logMsgs))
+	for _, val := range logMsgs {
+		if val.StreamID != "" {
+			ids = append(ids, val.StreamID)
+		}
+	}
+	if len(ids) > 0 {
+		c.AckChan <- ids
+	}
+}
+
+// выполнение заданий до закрытия termChan, после чего хранилище закрывается
+func (c *OraCntrlr) executeQuery(store log_store.LogStore, queryChan chan oraTask, termChan chan struct{}) {
+	defer store.Close()
+
 	for {
 		select {
 
-		case queueIt := <-c.execQueryChan:
-			_, curErr := c.db.Exec(queueIt.queryText)
+		case task := <-queryChan:
+			startTime := time.Now()
+			var curErr error
+			switch task.priority {
+			case LogPriority:
+				logMsgs := make([]fmtp_log.LogMessage, 0, len(task.logMsgs))
+				for _, val := range task.logMsgs {
+					logMsgs = append(logMsgs, val.LogMessage)
+				}
+				curErr = store.InsertBatch(logMsgs)
+			case CheckLogCountPriority:
+				curErr = store.EnforceCount(onlineLogMaxCount, task.maxStorageCount)
+			case CheckLogLivetimePriority:
+				curErr = store.EnforceRetention(task.oldest)
+			case HeartbeatPriority:
+				curErr = store.Health()
+			}
 			if curErr != nil {
 				logger.PrintfDebug("!!! EXEC err %s\n\n", curErr.Error())
-				c.MetricsChan <- metrics_cntrl.OraMetrics{
-					Count:        queueIt.countMsg,
-					Labels:       map[string]string{metrics_cntrl.OraTypeLabel: errMetricLabel},
-					MsgBuffer:    len(c.logMsgBuffer),
-					QueriesQueue: c.queryQueue.Len(),
-				}
-			} else {
-				c.MetricsChan <- metrics_cntrl.OraMetrics{
-					Count:        queueIt.countMsg,
-					Labels:       map[string]string{metrics_cntrl.OraTypeLabel: PriorToString(queueIt.priority)},
-					MsgBuffer:    len(c.logMsgBuffer),
-					QueriesQueue: c.queryQueue.Len(),
-				}
 			}
-			c.execResultChan <- curErr
-
-		case <-c.execTermChan:
+			c.execResultChan <- execResult{store: store, task: task, err: curErr, duration: time.Since(startTime)}
+
+		case <-termChan:
+			// задание, не начатое до отключения, возвращается в очередь
+			select {
+			case task := <-queryChan:
+				c.execResultChan <- execResult{store: store, task: task, err: errStoreClosed}
+			default:
+			}
 			return
 		}
 	}
 }
+
+// время от формирования самого старого лога до записи в БД
+func writeLag(logMsgs []fmtp_log.LogMessageWithID) time.Duration {
+	var retValue time.Duration
+	now := time.Now().UTC()
+	for _, val := range logMsgs {
+		if msgTime, err := time.Parse(fmtp_log.LogTimeFormat, val.DateTime); err == nil && now.Sub(msgTime) > retValue {
+			retValue = now.Sub(msgTime)
+		}
+	}
+	return retValue
+}
@@ -1,22 +1,54 @@
 package ora_cntrl
 
-import "strconv"
+import "fmtp/ora_logger/log_store"
+
+// значения по умолчанию параметров записи логов
+const (
+	defaultBatchSize  = 100 // кол-во логов, записываемых за раз
+	defaultMaxRetries = 3   // кол-во повторных попыток записи лога, отклоненного БД
+)
 
 // OraCntrlSettings - настройки контроллера записи логов в БД
 type OraCntrlSettings struct {
+	StoreType   string `json:"DbType"`        // тип хранилища логов (log_store.StoreTypes)
 	Hostname    string `json:"DbHostname"`    // адрес/название хоста
 	Port        int    `json:"DbPort"`        // порт подключения к БД
-	ServiceName string `json:"DbServiceName"` // название сервиса БД
+	ServiceName string `json:"DbServiceName"` // название сервиса (Oracle) или БД (PostgreSQL)
 	UserName    string `json:"DbUser"`        // пользователь БД
 	Password    string `json:"DbPassword"`    // пароль для подключения к БД
+	Path        string `json:"DbPath"`        // путь к файлу БД (SQLite)
 
 	LogStoreMaxCount int `json:"DbMaxLogStoreCount"` // максимальное число хранимых логов (шт)
 	LogStoreDays     int `json:"DbStoreDays"`        // время хранения логов (дней)
+
+	BatchSize  int `json:"DbBatchSize"`  // кол-во логов, записываемых за раз (0 - defaultBatchSize)
+	MaxRetries int `json:"DbMaxRetries"` // кол-во повторных попыток записи лога, отклоненного БД (0 - defaultMaxRetries, < 0 - без повторов)
+}
+
+// кол-во логов, записываемых за раз
+func (s *OraCntrlSettings) batchSize() int {
+	if s.BatchSize <= 0 {
+		return defaultBatchSize
+	}
+	return s.BatchSize
+}
+
+// кол-во повторных попыток записи лога, отклоненного БД
+func (s *OraCntrlSettings) maxRetries() int {
+	if s.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	if s.MaxRetries < 0 {
+		return 0
+	}
+	return s.MaxRetries
 }
 
 // сравнение настроек в части настроек БД и настроек хранения логов
 func (s *OraCntrlSettings) equal(other OraCntrlSettings) (bool, bool) {
-	isDbEqual := s.Hostname == other.Hostname &&
+	isDbEqual := s.StoreType == other.StoreType &&
+		s.Path == other.Path &&
+		s.Hostname == other.Hostname &&
 		s.Port == other.Port &&
 		s.ServiceName == other.ServiceName &&
 		s.UserName == other.UserName &&
@@ -27,12 +59,23 @@ func (s *OraCntrlSettings) equal(other OraCntrlSettings) (bool, bool) {
 	return isDbEqual, isStorEqual
 }
 
-// ConnString - строка подключения к БД в формате
-// user/pass@(DESCRIPTION=(ADDRESS_LIST=(ADDRESS=(PROTOCOL=tcp)(HOST=hostname)(PORT=port)))(CONNECT_DATA=(SERVICE_NAME=sn)))
-func (s *OraCntrlSettings) ConnString() string {
-	return s.UserName + "/" +
-		s.Password + "@" +
-		"(DESCRIPTION=(ADDRESS_LIST=(ADDRESS=(PROTOCOL=tcp)(HOST=" + s.Hostname +
-		")(PORT=" + strconv.Itoa(s.Port) +
-		")))(CONNECT_DATA=(SERVICE_NAME=" + s.ServiceName + ")))"
+// StoreSettings настройки подключения к хранилищу логов
+func (s *OraCntrlSettings) StoreSettings() log_store.Settings {
+	return log_store.Settings{
+		Type:        s.storeType(),
+		Hostname:    s.Hostname,
+		Port:        s.Port,
+		ServiceName: s.ServiceName,
+		UserName:    s.UserName,
+		Password:    s.Password,
+		Path:        s.Path,
+	}
+}
+
+// тип хранилища логов (по умолчанию Oracle)
+func (s *OraCntrlSettings) storeType() string {
+	if s.StoreType == "" {
+		return log_store.StoreOracle
+	}
+	return s.StoreType
 }
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"fmt"
+	"path/filepath"
+
 	cfg "fmtp/configurator"
+	"fmtp/fmtp_log"
+	"fmtp/ora_logger/log_store"
+	"fmtp/ora_logger/log_web"
 
 	"fmtp/ora_logger/metrics_cntrl"
 	"fmtp/ora_logger/ora_cntrl"
 	"fmtp/ora_logger/redis_cntrl"
+	"fmtp/secret"
 
 	"lemz.com/fdps/logger"
 	"lemz.com/fdps/prom_metrics"
@@ -21,6 +28,7 @@ var (
 	metricsCntrl = metrics_cntrl.NewMetricsCntrl()
 	oraCntrl     = ora_cntrl.NewOraController()
 	redisCntrl   = redis_cntrl.NewRedisController()
+	logWebCntrl  = log_web.NewLogWebCntrl()
 )
 
 func main() {
@@ -29,11 +37,17 @@ func main() {
 		utils.AppendHandler(logger.WebLogger)
 	}
 
+	if keyErr := secret.CheckKey(); keyErr != nil {
+		logger.PrintfErr("FMTP FORMAT %#v", fmtp_log.LogCntrlSDT(fmtp_log.SeverityError, fmtp_log.ChannelTypeNone,
+			fmt.Sprintf("Настройки, содержащие пароли и токены, не будут сохранены в файл. %v", keyErr)))
+	}
+
 	loggerConfClient := cfg.NewLoggerClient()
 
 	go metricsCntrl.Run()
 	go oraCntrl.Run()
 	go redisCntrl.Run()
+	go logWebCntrl.Run()
 
 	go loggerConfClient.Work()
 	go loggerConfClient.Start()
@@ -52,14 +66,15 @@ func main() {
 				CollectLabels:     map[string]string{"host": cfg.LoggerCfg.IPAddr},
 			}
 
-			oraCntrl.SettsChan <- ora_cntrl.OraCntrlSettings{
-				Hostname:         cfg.LoggerCfg.OraHostname,
-				Port:             cfg.LoggerCfg.OraPort,
-				ServiceName:      cfg.LoggerCfg.OraServiceName,
-				UserName:         cfg.LoggerCfg.OraUser,
-				Password:         cfg.LoggerCfg.OraPassword,
-				LogStoreMaxCount: cfg.LoggerCfg.OraMaxLogStoreCount,
-				LogStoreDays:     cfg.LoggerCfg.OraStoreDays,
+			oraSetts := oraCntrlSettings()
+			oraCntrl.SettsChan <- oraSetts
+
+			logWebCntrl.SettsChan <- log_web.LogWebSettings{
+				Address:  cfg.LoggerCfg.WebAddress,
+				Port:     cfg.LoggerCfg.WebPort,
+				User:     cfg.LoggerCfg.WebUser,
+				Password: cfg.LoggerCfg.WebPassword,
+				Store:    oraSetts.StoreSettings(),
 			}
 
 			redisCntrl.SettsChan <- redis_cntrl.RedisCntrlSettings{
@@ -69,7 +84,10 @@ func main() {
 				UserName: cfg.LoggerCfg.RedisUserName,
 				Password: cfg.LoggerCfg.RedisPassword,
 
-				MaxReadCount: cfg.LoggerCfg.RedisMaxReadCount,
+				MaxReadCount:   cfg.LoggerCfg.RedisMaxReadCount,
+				ConsumerName:   cfg.LoggerCfg.IPAddr + "-" + cfg.LoggerCfg.LoggerID,
+				StreamMaxCount: cfg.LoggerCfg.RedisStreamMaxCount,
+				ClaimIdleSec:   cfg.LoggerCfg.RedisClaimIdleSec,
 			}
 
 		case <-oraCntrl.RequestMsgChan:
@@ -78,6 +96,9 @@ func main() {
 		case logMsg := <-redisCntrl.SendMsgChan:
 			oraCntrl.ReceiveMsgChan <- logMsg
 
+		case ids := <-oraCntrl.AckChan:
+			redisCntrl.AckChan <- ids
+
 		case redisMt := <-redisCntrl.MetricsChan:
 			metricsCntrl.RedisMetricsChan <- redisMt
 
@@ -86,3 +107,35 @@ func main() {
 		}
 	}
 }
+
+// настройки контроллера записи логов для хранилища, выбранного в настройках логгера
+func oraCntrlSettings() ora_cntrl.OraCntrlSettings {
+	retValue := ora_cntrl.OraCntrlSettings{
+		StoreType:        cfg.LoggerCfg.LogStoreType,
+		LogStoreMaxCount: cfg.LoggerCfg.OraMaxLogStoreCount,
+		LogStoreDays:     cfg.LoggerCfg.OraStoreDays,
+		BatchSize:        cfg.LoggerCfg.OraBatchSize,
+		MaxRetries:       cfg.LoggerCfg.OraMaxRetries,
+	}
+
+	switch cfg.LoggerCfg.LogStoreType {
+	case log_store.StorePostgres:
+		retValue.Hostname = cfg.LoggerCfg.PgHostname
+		retValue.Port = cfg.LoggerCfg.PgPort
+		retValue.ServiceName = cfg.LoggerCfg.PgDbName
+		retValue.UserName = cfg.LoggerCfg.PgUser
+		retValue.Password = cfg.LoggerCfg.PgPassword
+	case log_store.StoreSQLite:
+		retValue.Path = cfg.LoggerCfg.SqlitePath
+		if retValue.Path != "" && !filepath.IsAbs(retValue.Path) {
+			retValue.Path = filepath.Join(utils.AppPath(), retValue.Path)
+		}
+	default:
+		retValue.Hostname = cfg.LoggerCfg.OraHostname
+		retValue.Port = cfg.LoggerCfg.OraPort
+		retValue.ServiceName = cfg.LoggerCfg.OraServiceName
+		retValue.UserName = cfg.LoggerCfg.OraUser
+		retValue.Password = cfg.LoggerCfg.OraPassword
+	}
+	return retValue
+}
@@ -2,10 +2,13 @@ package redis_cntrl
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"fmtp/fmtp_log"
 	"fmtp/ora_logger/logger_state"
 	"fmtp/ora_logger/metrics_cntrl"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -15,11 +18,17 @@ import (
 const (
 	streamName = "FmtpLog"
 	msgKey     = "msg"
+	groupName  = "FmtpLogger" // группа потребителей потока (общая для всех логгеров)
+
+	redisTimeout  = time.Second      // таймаут выполнения команд Redis
+	maintInterval = 10 * time.Second // период переподключения, обработки логов других логгеров, обрезки потока и метрик
+	maxTrimCount  = 10000            // макс. кол-во логов, удаляемых из потока за одну обрезку
 )
 
 type RedisCntrl struct {
 	RequestMsgChan chan struct{}
-	SendMsgChan    chan []fmtp_log.LogMessage
+	AckChan        chan []string // канал приема идентификаторов логов, записанных в БД
+	SendMsgChan    chan []fmtp_log.LogMessageWithID
 	SettsChan      chan RedisCntrlSettings
 
 	MetricsChan chan metrics_cntrl.RedisMetrics
@@ -27,17 +36,27 @@ type RedisCntrl struct {
 	redisClnt      *redis.Client
 	setts          RedisCntrlSettings
 	successConnect bool
+	groupReady     bool // группа потребителей создана
+
+	pendingCursor string                      // идентификатор, после которого читаются собственные неподтвержденные логи ("" - читаются новые логи)
+	claimCursor   string                      // идентификатор, с которого ищутся логи других логгеров для обработки
+	inWork        map[string]struct{}         // логи, переданные на запись в БД и не подтвержденные в потоке
+	toAck         []string                    // идентификаторы логов для подтверждения в потоке
+	claimed       []fmtp_log.LogMessageWithID // логи других логгеров, ожидающие передачи на запись
 
-	prevReadIds []string
+	maintTicker *time.Ticker
 }
 
 func NewRedisController() *RedisCntrl {
 	return &RedisCntrl{
 		RequestMsgChan: make(chan struct{}, 10),
-		SendMsgChan:    make(chan []fmtp_log.LogMessage, 10),
+		AckChan:        make(chan []string, 1024),
+		SendMsgChan:    make(chan []fmtp_log.LogMessageWithID, 10),
 		SettsChan:      make(chan RedisCntrlSettings, 1),
 		MetricsChan:    make(chan metrics_cntrl.RedisMetrics, 10),
 		successConnect: false,
+		inWork:         make(map[string]struct{}),
+		maintTicker:    time.NewTicker(maintInterval),
 	}
 }
 
@@ -54,13 +73,7 @@ func (c *RedisCntrl) Run() {
 			}
 
 		case <-c.RequestMsgChan:
-			if len(c.prevReadIds) > 0 {
-				if err := c.delLogsFromStream(); err != nil {
-					logger.PrintfErr("Ошибка удаления из потока Redis %v", err)
-				} else {
-					c.prevReadIds = c.prevReadIds[:0]
-				}
-			}
+			c.ackLogs()
 
 			if msgs, err := c.readLogsFromStream(); err != nil {
 				logger.PrintfErr("Ошибка чтения из потока Redis %v", err)
@@ -69,11 +82,30 @@ func (c *RedisCntrl) Run() {
 					c.SendMsgChan <- msgs
 				}
 			}
+
+		case ids := <-c.AckChan:
+			c.toAck = append(c.toAck, ids...)
+			c.ackLogs()
+
+		case <-c.maintTicker.C:
+			if !c.successConnect {
+				if c.setts.Hostname != "" {
+					c.connectToServer()
+				}
+				break
+			}
+			c.ackLogs()
+			c.claimLogs()
+			c.trimStream()
+			c.sendStreamMetrics()
 		}
 	}
 }
 
 func (c *RedisCntrl) connectToServer() {
+	if c.redisClnt != nil {
+		c.redisClnt.Close()
+	}
 	c.redisClnt = redis.NewClient(&redis.Options{
 		Addr:    fmt.Sprintf("%s:%d", c.setts.Hostname, c.setts.Port),
 		Network: "tcp",
@@ -87,44 +119,361 @@ func (c *RedisCntrl) connectToServer() {
 		logger.PrintfDebug("Успешное подключение к Redis серверу")
 		logger_state.SetRedisState(logger_state.StateOk, "")
 	}
+
+	// после подключения сначала обрабатываются собственные логи, полученные ранее и не подтвержденные
+	c.groupReady = false
+	c.pendingCursor = "0"
+	c.claimCursor = "-"
 }
 
-func (c *RedisCntrl) readLogsFromStream() ([]fmtp_log.LogMessage, error) {
-	retMsg := make([]fmtp_log.LogMessage, 0)
-	if c.successConnect {
-		ctx, cancelFunc := context.WithTimeout(context.Background(), time.Second)
-		defer cancelFunc()
-		readSlice := c.redisClnt.XRead(ctx,
-			&redis.XReadArgs{
-				Streams: []string{streamName, "0"},
-				Count:   int64(c.setts.MaxReadCount),
-				Block:   0,
-			})
-
-		for _, xStreamVal := range readSlice.Val() {
-			for _, msgVal := range xStreamVal.Messages {
-				c.prevReadIds = append(c.prevReadIds, msgVal.ID)
-				msg, msgOk := msgVal.Values[msgKey]
-				if msgOk {
-					if msgString, ok := msg.(string); ok {
-						if logMsg, err := fmtp_log.UnmarshalFromString(msgString); err == nil {
-							retMsg = append(retMsg, logMsg)
-						}
-					}
-				}
+// создание группы потребителей (если отсутствует). Логи, добавленные в поток до создания группы, также обрабатываются
+func (c *RedisCntrl) createGroup() error {
+	if c.groupReady {
+		return nil
+	}
+	ctx, cancelFunc := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancelFunc()
+	if err := c.redisClnt.XGroupCreateMkStream(ctx, streamName, groupName, "0").Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	c.groupReady = true
+	return nil
+}
+
+// проверка ошибки команды группы потребителей (поток или группа удалены - группа создается заново)
+func (c *RedisCntrl) checkGroupErr(err error) {
+	if strings.HasPrefix(err.Error(), "NOGROUP") {
+		c.groupReady = false
+		c.pendingCursor = "0"
+	}
+}
+
+func (c *RedisCntrl) readLogsFromStream() ([]fmtp_log.LogMessageWithID, error) {
+	retMsg := make([]fmtp_log.LogMessageWithID, 0)
+	if !c.successConnect {
+		return retMsg, fmt.Errorf("Нет подключения к Redis")
+	}
+	if err := c.createGroup(); err != nil {
+		return retMsg, err
+	}
+
+	if len(c.claimed) > 0 {
+		retMsg, c.claimed = c.claimed, nil
+		c.MetricsChan <- metrics_cntrl.RedisMetrics{Msg: len(retMsg)}
+		return retMsg, nil
+	}
+
+	for len(retMsg) == 0 {
+		startID := ">"
+		if c.pendingCursor != "" {
+			startID = c.pendingCursor
+		}
+
+		ctx, cancelFunc := context.WithTimeout(context.Background(), redisTimeout)
+		readSlice, err := c.redisClnt.XReadGroup(ctx,
+			&redis.XReadGroupArgs{
+				Group:    groupName,
+				Consumer: c.setts.consumerName(),
+				Streams:  []string{streamName, startID},
+				Count:    int64(c.setts.MaxReadCount),
+				Block:    -1,
+			}).Result()
+		cancelFunc()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			c.checkGroupErr(err)
+			return retMsg, err
+		}
+
+		var xMsgs []redis.XMessage
+		for _, xStreamVal := range readSlice {
+			xMsgs = append(xMsgs, xStreamVal.Messages...)
+		}
+		retMsg = append(retMsg, c.takeLogs(xMsgs)...)
+
+		if c.pendingCursor == "" {
+			break
+		}
+		if len(xMsgs) == 0 {
+			c.pendingCursor = ""
+		} else {
+			c.pendingCursor = xMsgs[len(xMsgs)-1].ID
+		}
+	}
+
+	c.MetricsChan <- metrics_cntrl.RedisMetrics{Msg: len(retMsg)}
+	return retMsg, nil
+}
+
+// логи из записей потока, не переданные ранее на запись в БД. Некорректные записи подтверждаются без записи
+func (c *RedisCntrl) takeLogs(xMsgs []redis.XMessage) []fmtp_log.LogMessageWithID {
+	retMsg := make([]fmtp_log.LogMessageWithID, 0, len(xMsgs))
+	for _, msgVal := range xMsgs {
+		if _, ok := c.inWork[msgVal.ID]; ok {
+			continue
+		}
+
+		var logMsg fmtp_log.LogMessage
+		err := fmt.Errorf("отсутствует поле %s", msgKey)
+		if msg, msgOk := msgVal.Values[msgKey]; msgOk {
+			if msgString, ok := msg.(string); ok {
+				logMsg, err = fmtp_log.UnmarshalFromString(msgString)
 			}
 		}
-		c.MetricsChan <- metrics_cntrl.RedisMetrics{Msg: len(retMsg)}
-		return retMsg, readSlice.Err()
+		if err != nil {
+			logger.PrintfErr("Некорректный лог в потоке Redis (ID = %s): %v", msgVal.ID, err)
+			c.toAck = append(c.toAck, msgVal.ID)
+			continue
+		}
+
+		c.inWork[msgVal.ID] = struct{}{}
+		retMsg = append(retMsg, fmtp_log.LogMessageWithID{LogMessage: logMsg, StreamID: msgVal.ID})
+	}
+	return retMsg
+}
+
+// подтверждение обработки логов в потоке. При ошибке подтверждение повторяется позже
+func (c *RedisCntrl) ackLogs() {
+	if len(c.toAck) == 0 || !c.successConnect {
+		return
+	}
+	ctx, cancelFunc := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancelFunc()
+	if err := c.redisClnt.XAck(ctx, streamName, groupName, c.toAck...).Err(); err != nil {
+		logger.PrintfErr("Ошибка подтверждения логов в потоке Redis %v", err)
+		c.checkGroupErr(err)
+		return
+	}
+	for _, val := range c.toAck {
+		delete(c.inWork, val)
+	}
+	c.MetricsChan <- metrics_cntrl.RedisMetrics{Acked: len(c.toAck)}
+	c.toAck = c.toAck[:0]
+}
+
+// получение на обработку логов, не подтвержденных другими логгерами дольше claimIdle (логгер остановлен).
+// Используются XPENDING и XCLAIM: ответ XAUTOCLAIM в Redis 7 go-redis v8 не разбирает
+func (c *RedisCntrl) claimLogs() {
+	if !c.groupReady || c.pendingCursor != "" {
+		return
+	}
+	ctx, cancelFunc := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancelFunc()
+
+	pendInfo, err := c.redisClnt.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: streamName,
+		Group:  groupName,
+		Start:  c.claimCursor,
+		End:    "+",
+		Count:  int64(c.setts.MaxReadCount),
+	}).Result()
+	if err != nil {
+		logger.PrintfErr("Ошибка получения неподтвержденных логов из потока Redis %v", err)
+		c.checkGroupErr(err)
+		return
+	}
+
+	// просмотр списка неподтвержденных логов частями, после последней части - с начала
+	if int64(len(pendInfo)) < int64(c.setts.MaxReadCount) || len(pendInfo) == 0 {
+		c.claimCursor = "-"
+	} else {
+		c.claimCursor = pendInfo[len(pendInfo)-1].ID
+	}
+
+	var ids []string
+	for _, val := range pendInfo {
+		if val.Consumer != c.setts.consumerName() && val.Idle >= c.setts.claimIdle() {
+			ids = append(ids, val.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	// XCLAIM с MinIdle не забирает логи, полученные другим логгером после XPENDING
+	xMsgs, err := c.redisClnt.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   streamName,
+		Group:    groupName,
+		Consumer: c.setts.consumerName(),
+		MinIdle:  c.setts.claimIdle(),
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		logger.PrintfErr("Ошибка получения неподтвержденных логов из потока Redis %v", err)
+		return
+	}
+
+	if claimed := c.takeLogs(xMsgs); len(claimed) > 0 {
+		logger.PrintfInfo("Получено на обработку %d логов, не подтвержденных другими логгерами более %v.", len(claimed), c.setts.claimIdle())
+		c.claimed = append(c.claimed, claimed...)
+		c.MetricsChan <- metrics_cntrl.RedisMetrics{Claimed: len(claimed)}
+	}
+}
+
+// обрезка потока до StreamMaxCount логов (XTRIM MINID). Удаляются только логи, обработанные группой:
+// граница обрезки не превышает самый старый неподтвержденный лог и последний выданный группе лог
+func (c *RedisCntrl) trimStream() {
+	if c.setts.StreamMaxCount <= 0 || !c.groupReady {
+		return
+	}
+	ctx, cancelFunc := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancelFunc()
+
+	minID, err := c.trimBoundary(ctx)
+	if err != nil {
+		logger.PrintfErr("Ошибка обрезки потока Redis %v", err)
+		c.checkGroupErr(err)
+		return
+	}
+	if minID == "" {
+		return
+	}
+	if err = c.redisClnt.XTrimMinID(ctx, streamName, minID).Err(); err != nil {
+		logger.PrintfErr("Ошибка обрезки потока Redis %v", err)
+	}
+}
+
+// идентификатор лога, до которого обрезается поток (пусто - обрезка не требуется)
+func (c *RedisCntrl) trimBoundary(ctx context.Context) (string, error) {
+	streamLen, err := c.redisClnt.XLen(ctx, streamName).Result()
+	if err != nil {
+		return "", err
+	}
+	excess := streamLen - c.setts.StreamMaxCount
+	if excess <= 0 {
+		return "", nil
+	}
+	if excess > maxTrimCount {
+		excess = maxTrimCount
+	}
+
+	// первый лог, остающийся в потоке после удаления лишних
+	oldest, err := c.redisClnt.XRangeN(ctx, streamName, "-", "+", excess+1).Result()
+	if err != nil {
+		return "", err
+	}
+	if int64(len(oldest)) <= excess {
+		return "", nil
+	}
+	retValue := oldest[excess].ID
+
+	// логи, не выданные группе или не подтвержденные, не удаляются
+	pending, lastDeliveredID, err := c.groupInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	if streamIDLess(lastDeliveredID, retValue) {
+		retValue = lastDeliveredID
+	}
+	if pending > 0 {
+		pendInfo, errPend := c.redisClnt.XPending(ctx, streamName, groupName).Result()
+		if errPend != nil {
+			return "", errPend
+		}
+		if streamIDLess(pendInfo.Lower, retValue) {
+			retValue = pendInfo.Lower
+		}
+	}
+	if retValue != oldest[excess].ID {
+		logger.PrintfDebug("Обрезка потока Redis ограничена необработанными логами (граница %s вместо %s).", retValue, oldest[excess].ID)
+	}
+	return retValue, nil
+}
+
+// метрики потока: длина, кол-во неподтвержденных логов и отставание обработки
+func (c *RedisCntrl) sendStreamMetrics() {
+	if !c.groupReady {
+		return
+	}
+	ctx, cancelFunc := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancelFunc()
+
+	streamLen, err := c.redisClnt.XLen(ctx, streamName).Result()
+	if err != nil {
+		return
+	}
+	pending, lastDeliveredID, err := c.groupInfo(ctx)
+	if err != nil {
+		return
+	}
+
+	// самый старый необработанный лог: неподтвержденный или первый после последнего выданного группе
+	var oldestID string
+	if pending > 0 {
+		if pendInfo, errPend := c.redisClnt.XPending(ctx, streamName, groupName).Result(); errPend == nil {
+			oldestID = pendInfo.Lower
+		}
+	} else if xMsgs, errRange := c.redisClnt.XRangeN(ctx, streamName, lastDeliveredID, "+", 2).Result(); errRange == nil {
+		for _, val := range xMsgs {
+			if val.ID != lastDeliveredID {
+				oldestID = val.ID
+				break
+			}
+		}
+	}
+
+	var lagMs int
+	if oldestMs, ok := streamIDTime(oldestID); ok {
+		if lagMs = int(time.Now().UnixNano()/int64(time.Millisecond) - oldestMs); lagMs < 0 {
+			lagMs = 0
+		}
+	}
+
+	c.MetricsChan <- metrics_cntrl.RedisMetrics{
+		Stat:      true,
+		StreamLen: int(streamLen),
+		Pending:   int(pending),
+		LagMs:     lagMs,
+	}
+}
+
+// кол-во неподтвержденных логов группы и идентификатор последнего выданного группе лога.
+// Ответ XINFO GROUPS разбирается без go-redis: в Redis 7 ответ содержит поля, которые go-redis v8 не поддерживает
+func (c *RedisCntrl) groupInfo(ctx context.Context) (int64, string, error) {
+	reply, err := c.redisClnt.Do(ctx, "XINFO", "GROUPS", streamName).Result()
+	if err != nil {
+		return 0, "", err
+	}
+	groups, _ := reply.([]interface{})
+	for _, grVal := range groups {
+		fields, _ := grVal.([]interface{})
+		info := make(map[string]interface{})
+		for idx := 0; idx+1 < len(fields); idx += 2 {
+			if key, ok := fields[idx].(string); ok {
+				info[key] = fields[idx+1]
+			}
+		}
+		if info["name"] != groupName {
+			continue
+		}
+		pending, _ := info["pending"].(int64)
+		lastDeliveredID, _ := info["last-delivered-id"].(string)
+		return pending, lastDeliveredID, nil
+	}
+	return 0, "", fmt.Errorf("группа %s потока %s не найдена", groupName, streamName)
+}
+
+// сравнение идентификаторов записей потока в формате <время мс>-<номер>
+func streamIDLess(left string, right string) bool {
+	leftMs, leftSeq := splitStreamID(left)
+	rightMs, rightSeq := splitStreamID(right)
+	return leftMs < rightMs || (leftMs == rightMs && leftSeq < rightSeq)
+}
+
+func splitStreamID(id string) (uint64, uint64) {
+	parts := strings.SplitN(id, "-", 2)
+	ms, _ := strconv.ParseUint(parts[0], 10, 64)
+	var seq uint64
+	if len(parts) == 2 {
+		seq, _ = strconv.ParseUint(parts[1], 10, 64)
 	}
-	return retMsg, fmt.Errorf("Нет подключения к Redis")
+	return ms, seq
 }
 
-func (c *RedisCntrl) delLogsFromStream() error {
-	if c.successConnect {
-		return c.redisClnt.XDel(context.Background(),
-			streamName,
-			c.prevReadIds...).Err()
+// время добавления записи в поток (мс) по идентификатору записи в формате <время мс>-<номер>
+func streamIDTime(id string) (int64, bool) {
+	if id == "" {
+		return 0, false
 	}
-	return fmt.Errorf("Нет подключения к Redis")
+	ms, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	return ms, err == nil
 }
@@ -1,5 +1,15 @@
 package redis_cntrl
 
+import (
+	"os"
+	"time"
+)
+
+// значения по умолчанию параметров обработки потока
+const (
+	defaultClaimIdle = time.Minute // время без подтверждения, после которого логи другого логгера забираются на обработку
+)
+
 // RedisCntrlSettings - настройки контроллера отправки логов в БД Redis
 type RedisCntrlSettings struct {
 	Hostname string `json:"DbHostname"` // адрес/название хоста
@@ -9,6 +19,10 @@ type RedisCntrlSettings struct {
 	Password string `json:"DbPassword"` // пароль для подключения к БД
 
 	MaxReadCount int `json:"MaxReadCount"` // максимальное кол-во логов, считываемых за один раз
+
+	ConsumerName   string `json:"ConsumerName"`   // имя логгера в группе потребителей потока
+	StreamMaxCount int64  `json:"StreamMaxCount"` // максимальное число логов в потоке (0 - поток не обрезается)
+	ClaimIdleSec   int    `json:"ClaimIdleSec"`   // время без подтверждения (сек), после которого логи другого логгера забираются на обработку
 }
 
 // сравнение настроек в части настроек БД
@@ -18,3 +32,20 @@ func (s *RedisCntrlSettings) equalDb(otherRls RedisCntrlSettings) bool {
 		s.UserName == otherRls.UserName &&
 		s.Password == otherRls.Password
 }
+
+// время без подтверждения, после которого логи другого логгера забираются на обработку
+func (s *RedisCntrlSettings) claimIdle() time.Duration {
+	if s.ClaimIdleSec <= 0 {
+		return defaultClaimIdle
+	}
+	return time.Duration(s.ClaimIdleSec) * time.Second
+}
+
+// имя логгера в группе потребителей (по умолчанию - имя хоста)
+func (s *RedisCntrlSettings) consumerName() string {
+	if s.ConsumerName != "" {
+		return s.ConsumerName
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
@@ -0,0 +1,165 @@
+package redis_cntrl
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"fmtp/fmtp_log"
+)
+
+// controller connected to the test server, metrics are discarded
+func newTestCntrl(t *testing.T, srv *miniredis.Miniredis, consumer string) *RedisCntrl {
+	t.Helper()
+	port, _ := strconv.Atoi(srv.Port())
+	c := NewRedisController()
+	c.maintTicker.Stop()
+	go func() {
+		for range c.MetricsChan {
+		}
+	}()
+	c.setts = RedisCntrlSettings{Hostname: srv.Host(), Port: port, MaxReadCount: 5, ConsumerName: consumer, StreamMaxCount: 3, ClaimIdleSec: 60}
+	c.connectToServer()
+	if !c.successConnect {
+		t.Fatalf("not connected to test server")
+	}
+	t.Cleanup(func() { c.redisClnt.Close() })
+	return c
+}
+
+func addLogs(t *testing.T, c *RedisCntrl, count int) {
+	t.Helper()
+	for idx := 0; idx < count; idx++ {
+		msg := fmtp_log.LogMessage{Severity: fmtp_log.SeverityInfo, Text: strconv.Itoa(idx)}
+		if err := c.redisClnt.XAdd(context.Background(), &redis.XAddArgs{Stream: streamName, Values: map[string]interface{}{msgKey: msg.MarshalToString()}}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readLogs(t *testing.T, c *RedisCntrl) []string {
+	t.Helper()
+	msgs, err := c.readLogsFromStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, val := range msgs {
+		ids = append(ids, val.StreamID)
+	}
+	return ids
+}
+
+func streamLen(t *testing.T, c *RedisCntrl) int64 {
+	t.Helper()
+	retValue, err := c.redisClnt.XLen(context.Background(), streamName).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return retValue
+}
+
+func TestReadAck(t *testing.T) {
+	srv := miniredis.RunT(t)
+	c := newTestCntrl(t, srv, "first")
+	addLogs(t, c, 3)
+
+	ids := readLogs(t, c)
+	if len(ids) != 3 {
+		t.Fatalf("%d logs read, want 3", len(ids))
+	}
+	if again := readLogs(t, c); len(again) != 0 {
+		t.Fatalf("logs in work read again: %v", again)
+	}
+
+	c.toAck = append(c.toAck, ids...)
+	c.ackLogs()
+	if len(c.inWork) != 0 || len(c.toAck) != 0 {
+		t.Fatalf("acked logs still in work")
+	}
+	pending, _, err := c.groupInfo(context.Background())
+	if err != nil || pending != 0 {
+		t.Fatalf("pending %d %v after ack", pending, err)
+	}
+}
+
+func TestTrimKeepsUnprocessed(t *testing.T) {
+	srv := miniredis.RunT(t)
+	c := newTestCntrl(t, srv, "first")
+	addLogs(t, c, 10)
+
+	// nothing processed yet: nothing trimmed
+	c.createGroup()
+	c.trimStream()
+	if got := streamLen(t, c); got != 10 {
+		t.Fatalf("stream length %d before processing, want 10", got)
+	}
+
+	// first five delivered, none acked
+	ids := readLogs(t, c)
+	c.trimStream()
+	if got := streamLen(t, c); got != 10 {
+		t.Fatalf("stream length %d with unacked logs, want 10", got)
+	}
+
+	// trimmed up to the oldest unacked log
+	c.toAck = append(c.toAck, ids[:3]...)
+	c.ackLogs()
+	c.trimStream()
+	if got := streamLen(t, c); got != 7 {
+		t.Fatalf("stream length %d after partial ack, want 7", got)
+	}
+
+	// trimmed up to the last delivered log
+	c.toAck = append(c.toAck, ids[3:]...)
+	c.ackLogs()
+	c.trimStream()
+	if got := streamLen(t, c); got != 6 {
+		t.Fatalf("stream length %d after ack, want 6", got)
+	}
+
+	// all processed: trimmed to StreamMaxCount
+	c.toAck = append(c.toAck, readLogs(t, c)...)
+	c.ackLogs()
+	c.trimStream()
+	if got := streamLen(t, c); got != 3 {
+		t.Fatalf("stream length %d after processing, want 3", got)
+	}
+}
+
+func TestClaimIdleLogs(t *testing.T) {
+	srv := miniredis.RunT(t)
+	startTime := time.Now()
+	srv.SetTime(startTime)
+
+	first := newTestCntrl(t, srv, "first")
+	second := newTestCntrl(t, srv, "second")
+	addLogs(t, first, 3)
+	ids := readLogs(t, first)
+
+	// logs of a working logger are not claimed
+	second.createGroup()
+	second.pendingCursor = ""
+	second.claimLogs()
+	if len(second.claimed) != 0 {
+		t.Fatalf("logs of working logger claimed")
+	}
+
+	// logs of a stopped logger are claimed after ClaimIdleSec
+	srv.SetTime(startTime.Add(2 * time.Minute))
+	second.claimLogs()
+	claimed := readLogs(t, second)
+	if len(claimed) != len(ids) {
+		t.Fatalf("%d logs claimed, want %d", len(claimed), len(ids))
+	}
+
+	second.toAck = append(second.toAck, claimed...)
+	second.ackLogs()
+	if pending, _, _ := second.groupInfo(context.Background()); pending != 0 {
+		t.Fatalf("pending %d after claimed logs acked", pending)
+	}
+}
@@ -0,0 +1,202 @@
+// Package secret шифрование секретов (паролей, токенов) в файлах настроек.
+// Зашифрованное значение хранится в виде "enc:<base64(nonce + шифротекст)>", алгоритм AES-256-GCM.
+// Ключ (32 байта, base64) берется из переменной окружения FMTP_SECRET_KEY, либо из файла ключа
+// (путь задается переменной окружения FMTP_SECRET_KEY_FILE, по умолчанию /etc/fmtp/secret.key).
+// Ключ создается администратором (например, head -c 32 /dev/urandom | base64) и хранится отдельно
+// от файлов настроек. Если ключ не задан, шифрование и расшифровка секретов завершаются ошибкой.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// Prefix префикс зашифрованного значения
+	Prefix = "enc:"
+
+	// KeyEnv переменная окружения с ключом шифрования (base64)
+	KeyEnv = "FMTP_SECRET_KEY"
+
+	// KeyFileEnv переменная окружения с путем к файлу ключа шифрования
+	KeyFileEnv = "FMTP_SECRET_KEY_FILE"
+
+	// Redacted значение, выводимое вместо секрета в журнал и на web страницы
+	Redacted = "******"
+
+	// FilePerm права доступа к файлам, содержащим секреты
+	FilePerm os.FileMode = 0600
+
+	// DefaultKeyFile файл ключа шифрования по умолчанию (вне каталога настроек приложения)
+	DefaultKeyFile = "/etc/fmtp/secret.key"
+
+	keySize = 32
+)
+
+var ErrWrongKey = errors.New("Ошибка расшифровки секрета. Возможно, используется другой ключ шифрования.")
+
+var (
+	keyMutex  sync.Mutex
+	cachedKey []byte
+)
+
+// путь к файлу ключа шифрования
+func keyFilePath() string {
+	if path := os.Getenv(KeyFileEnv); path != "" {
+		return path
+	}
+	return DefaultKeyFile
+}
+
+func decodeKey(keyText string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(keyText))
+	if err != nil {
+		return nil, fmt.Errorf("Некорректный ключ шифрования секретов (ожидается base64). Ошибка: %v", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("Некорректная длина ключа шифрования секретов: %d байт (ожидается %d).", len(key), keySize)
+	}
+	return key, nil
+}
+
+// ключ шифрования (переменная окружения или файл ключа)
+func encryptionKey() ([]byte, error) {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+
+	if cachedKey != nil {
+		return cachedKey, nil
+	}
+
+	var key []byte
+	var err error
+	if keyText := os.Getenv(KeyEnv); keyText != "" {
+		key, err = decodeKey(keyText)
+	} else if data, readErr := ioutil.ReadFile(keyFilePath()); readErr == nil {
+		key, err = decodeKey(string(data))
+	} else if os.IsNotExist(readErr) {
+		err = fmt.Errorf("Не задан ключ шифрования секретов. Задайте ключ (32 байта, base64) в переменной окружения %s "+
+			"или в файле %s (путь к файлу задается переменной окружения %s).", KeyEnv, keyFilePath(), KeyFileEnv)
+	} else {
+		err = fmt.Errorf("Ошибка чтения файла ключа шифрования секретов %s. Ошибка: %v", keyFilePath(), readErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cachedKey = key
+	return cachedKey, nil
+}
+
+// CheckKey проверка наличия и корректности ключа шифрования (выполняется при запуске приложения,
+// т.к. без ключа настройки с секретами не сохраняются)
+func CheckKey() error {
+	_, err := encryptionKey()
+	return err
+}
+
+func newGcm() (cipher.AEAD, error) {
+	key, err := encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted признак зашифрованного значения
+func IsEncrypted(val string) bool {
+	return strings.HasPrefix(val, Prefix)
+}
+
+// Encrypt шифрование значения. Пустые и уже зашифрованные значения возвращаются без изменений.
+func Encrypt(val string) (string, error) {
+	if val == "" || IsEncrypted(val) {
+		return val, nil
+	}
+	gcm, err := newGcm()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return Prefix + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(val), nil)), nil
+}
+
+// Decrypt расшифровка значения. Значения без префикса "enc:" (открытый текст) возвращаются без изменений.
+func Decrypt(val string) (string, error) {
+	if !IsEncrypted(val) {
+		return val, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(val, Prefix))
+	if err != nil {
+		return "", fmt.Errorf("Некорректное зашифрованное значение. Ошибка: %v", err)
+	}
+	gcm, err := newGcm()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", ErrWrongKey
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrWrongKey
+	}
+	return string(plain), nil
+}
+
+// EncryptFields шифрование значений по указателям. При ошибке значения не изменяются.
+func EncryptFields(vals ...*string) error {
+	return transformFields(Encrypt, vals)
+}
+
+// DecryptFields расшифровка значений по указателям. При ошибке значения не изменяются.
+func DecryptFields(vals ...*string) error {
+	return transformFields(Decrypt, vals)
+}
+
+func transformFields(transform func(string) (string, error), vals []*string) error {
+	results := make([]string, len(vals))
+	for idx, val := range vals {
+		res, err := transform(*val)
+		if err != nil {
+			return err
+		}
+		results[idx] = res
+	}
+	for idx, val := range vals {
+		*val = results[idx]
+	}
+	return nil
+}
+
+// Redact значение для вывода в журнал и на web страницы (пустое значение остается пустым)
+func Redact(val string) string {
+	if val == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// WriteFile запись файла, содержащего секреты, с правами доступа только для владельца
+// (права ранее созданного файла также ограничиваются)
+func WriteFile(path string, data []byte) error {
+	if err := ioutil.WriteFile(path, data, FilePerm); err != nil {
+		return err
+	}
+	return os.Chmod(path, FilePerm)
+}
@@ -0,0 +1,98 @@
+package secret
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// key source for the test: env value and key file path
+func useKey(t *testing.T, envKey string, keyFile string) {
+	keyMutex.Lock()
+	cachedKey = nil
+	keyMutex.Unlock()
+
+	t.Setenv(KeyEnv, envKey)
+	t.Setenv(KeyFileEnv, keyFile)
+	t.Cleanup(func() {
+		keyMutex.Lock()
+		cachedKey = nil
+		keyMutex.Unlock()
+	})
+}
+
+func TestMissingKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "secret.key")
+	useKey(t, "", keyFile)
+
+	if _, err := Encrypt("password"); err == nil || !strings.Contains(err.Error(), KeyEnv) {
+		t.Fatalf("encrypt without key: got %v, want error naming %s", err, KeyEnv)
+	}
+	if _, err := os.Stat(keyFile); !os.IsNotExist(err) {
+		t.Fatalf("key file must not be generated")
+	}
+
+	// values without secrets need no key
+	if val, err := Encrypt(""); err != nil || val != "" {
+		t.Fatalf("empty value: got %q %v", val, err)
+	}
+	if val, err := Decrypt("plain"); err != nil || val != "plain" {
+		t.Fatalf("plain value: got %q %v", val, err)
+	}
+}
+
+func TestKeyFromFile(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "secret.key")
+	key := base64.StdEncoding.EncodeToString(make([]byte, keySize))
+	if err := ioutil.WriteFile(keyFile, []byte(key+"\n"), FilePerm); err != nil {
+		t.Fatal(err)
+	}
+	useKey(t, "", keyFile)
+
+	enc, err := Encrypt("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(enc) {
+		t.Fatalf("value %q not encrypted", enc)
+	}
+	if plain, err := Decrypt(enc); err != nil || plain != "password" {
+		t.Fatalf("decrypt: got %q %v", plain, err)
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	useKey(t, base64.StdEncoding.EncodeToString(make([]byte, keySize)), "")
+	enc, err := Encrypt("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey := make([]byte, keySize)
+	otherKey[0] = 1
+	useKey(t, base64.StdEncoding.EncodeToString(otherKey), "")
+	if _, err = Decrypt(enc); err != ErrWrongKey {
+		t.Fatalf("decrypt with other key: got %v", err)
+	}
+
+	useKey(t, "short", "")
+	if _, err = Encrypt("password"); err == nil {
+		t.Fatalf("invalid key accepted")
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	// a missing bind mount source leaves a directory in place of the key file
+	useKey(t, "", t.TempDir())
+	if err := CheckKey(); err == nil {
+		t.Fatalf("key file is a directory: no error")
+	}
+
+	useKey(t, base64.StdEncoding.EncodeToString(make([]byte, keySize)), "")
+	if err := CheckKey(); err != nil {
+		t.Fatalf("key from env: %v", err)
+	}
+}